@@ -16,7 +16,7 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-func DoApply(profile, object, context, fileName string) {
+func DoApply(profile, object, context, namespace, fileName string) {
 	if context == constants.ALL_CONTEXTS {
 		logger.Fatalf("", "%s is not allowed for delete actions", constants.ALL_CONTEXTS)
 	}
@@ -26,7 +26,7 @@ func DoApply(profile, object, context, fileName string) {
 	uri := fmt.Sprintf("%s://%s:%s", p.Protocol, p.Host, p.Port)
 
 	logger.Debugf("", "Checking if object is valid")
-	objects := []string{"workflow", "datastore", "state", "task", "file", "user", "input"}
+	objects := []string{"workflow", "datastore", "state", "task", "file", "user", "input", "template", "policy", "namespace"}
 
 	if !utils.Contains(objects, object) {
 		logger.Fatalf("", "Invalid object type passed: '%s'. Valid object types are %v", object, objects)
@@ -36,8 +36,11 @@ func DoApply(profile, object, context, fileName string) {
 	if context == "" {
 		context = p.Workflow
 	}
+	if namespace == "" {
+		namespace = p.Namespace
+	}
 
-	doApply(profile, fileName, context, uri, object)
+	doApply(profile, fileName, context, namespace, uri, object)
 }
 
 func doUpdate(p auth.ProfileObj, uri, object, name string, data map[string]interface{}) {
@@ -48,6 +51,7 @@ func doUpdate(p auth.ProfileObj, uri, object, name string, data map[string]inter
 	requestURL := fmt.Sprintf("%s/api/v1/%s/%s", uri, object, name)
 	req, _ := http.NewRequest("PUT", requestURL, postBodyBuffer)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", p.APIToken))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -58,7 +62,7 @@ func doUpdate(p auth.ProfileObj, uri, object, name string, data map[string]inter
 	}
 }
 
-func doApply(profile, fileName, context, uri, objType string) {
+func doApply(profile, fileName, context, namespace, uri, objType string) {
 	p := auth.ReadProfile(profile)
 
 	var yamlData map[string]interface{}
@@ -75,7 +79,16 @@ func doApply(profile, fileName, context, uri, objType string) {
 
 	name := yamlData["name"].(string)
 
-	if objType != "workflow" && objType != "datastore" && objType != "user" {
+	// Workflows that don't name a namespace go in the one selected
+	if _, ok := yamlData["namespace"]; objType == "workflow" && !ok && namespace != "" && namespace != constants.ALL_CONTEXTS {
+		yamlData["namespace"] = namespace
+	}
+	if ns, ok := yamlData["namespace"].(string); objType == "workflow" && ok {
+		name = utils.QualifyWorkflow(ns, name)
+	}
+
+	if objType != "workflow" && objType != "datastore" && objType != "user" && objType != "template" && objType != "policy" && objType != "namespace" {
+		context = utils.QualifyWorkflow(namespace, context)
 		yamlData["workflow"] = context
 		name = fmt.Sprintf("%s/%s", context, name)
 	}
@@ -19,6 +19,7 @@ type ProfileObj struct {
 	WSPort     string
 	APIToken   string
 	Workflow   string
+	Namespace  string
 	SkipVerify bool
 }
 
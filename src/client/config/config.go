@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"scaffold/client/auth"
+	"scaffold/client/constants"
 	"scaffold/client/logger"
 )
 
@@ -21,7 +22,7 @@ func basicAuth(username, password string) string {
 	return base64.StdEncoding.EncodeToString([]byte(auth))
 }
 
-func DoConfig(host, port, protocol, wsPort, profile, username, password string, skipVerify bool) {
+func DoConfig(host, port, protocol, wsPort, profile, username, password, code string, skipVerify bool) {
 	uri := fmt.Sprintf("%s://%s:%s/auth/token/%s/client", protocol, host, port, username)
 
 	var obj TokenResponse
@@ -29,7 +30,11 @@ func DoConfig(host, port, protocol, wsPort, profile, username, password string,
 	httpClient := &http.Client{}
 	req, _ := http.NewRequest("POST", uri, nil)
 	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", basicAuth(username, password)))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
+	if code != "" {
+		req.Header.Set(constants.TOTP_HEADER, code)
+	}
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		logger.Fatalf("", "Token request failed with error %s", err.Error())
@@ -2,6 +2,11 @@ package constants
 
 const VERSION = "0.4.1"
 
+const USER_AGENT = "scaffold-cli/" + VERSION
+
+// Header carrying a two-factor code alongside a username and password
+const TOTP_HEADER = "X-Scaffold-TOTP"
+
 const COLOR_RED = "\033[0;31m"
 const COLOR_YELLOW = "\033[0;33m"
 const COLOR_GREEN = "\033[0;32m"
@@ -32,3 +37,6 @@ const LOG_FORMAT_JSON = "json"
 const LOG_FORMAT_CONSOLE = "console"
 
 const ALL_CONTEXTS = "all"
+
+const NAMESPACE_DEFAULT = "default"
+const WORKFLOW_NAMESPACE_SEPARATOR = "."
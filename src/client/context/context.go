@@ -2,12 +2,27 @@ package context
 
 import (
 	"scaffold/client/auth"
+	"scaffold/client/constants"
+	"scaffold/client/logger"
 )
 
-func DoContext(profile, context string) {
+// Set the workflow and namespace a profile works in. Passing the all context
+// as the namespace stops limiting requests to one
+func DoContext(profile, context, namespace string) {
+	if context == "" && namespace == "" {
+		logger.Fatalf("", "A workflow context or a namespace is required")
+	}
+
 	p := auth.ReadProfile(profile)
 
-	p.Workflow = context
+	if context != "" {
+		p.Workflow = context
+	}
+	if namespace == constants.ALL_CONTEXTS {
+		p.Namespace = ""
+	} else if namespace != "" {
+		p.Namespace = namespace
+	}
 
 	auth.WriteProfile(profile, p)
 }
@@ -20,7 +20,7 @@ func DoDelete(profile, object, context string) {
 	uri := fmt.Sprintf("%s://%s:%s", p.Protocol, p.Host, p.Port)
 
 	logger.Debugf("", "Checking if object is valid")
-	objects := []string{"workflow", "datastore", "state", "task", "file", "user", "input"}
+	objects := []string{"workflow", "datastore", "state", "task", "file", "user", "input", "template", "policy", "namespace", "queue"}
 
 	parts := strings.Split(object, "/")
 
@@ -32,12 +32,16 @@ func DoDelete(profile, object, context string) {
 		logger.Fatalf("", "Object passed in need to be of format '<object type>/<object name>")
 	}
 
-	if parts[0] != "workflow" && parts[0] != "datastore" && parts[0] != "user" {
+	if parts[0] != "workflow" && parts[0] != "datastore" && parts[0] != "user" && parts[0] != "template" && parts[0] != "policy" && parts[0] != "namespace" && parts[0] != "queue" {
 		if context == "" {
 			context = p.Workflow
 		}
+		context = utils.QualifyWorkflow(p.Namespace, context)
 		object = fmt.Sprintf("%s/%s/%s", parts[0], context, parts[1])
 	}
+	if parts[0] == "workflow" || parts[0] == "datastore" {
+		object = fmt.Sprintf("%s/%s", parts[0], utils.QualifyWorkflow(p.Namespace, parts[1]))
+	}
 
 	err := doDelete(p, uri, object)
 	if err != nil {
@@ -50,6 +54,7 @@ func doDelete(p auth.ProfileObj, uri, object string) error {
 	requestURL := fmt.Sprintf("%s/api/v1/%s", uri, object)
 	req, _ := http.NewRequest("DELETE", requestURL, nil)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", p.APIToken))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -24,7 +24,7 @@ func DoDescribe(profile, object, context, format string) {
 	uri := fmt.Sprintf("%s://%s:%s", p.Protocol, p.Host, p.Port)
 
 	logger.Debugf("", "Checking if object is valid")
-	objects := []string{"workflow", "datastore", "state", "task", "file", "user", "input"}
+	objects := []string{"workflow", "datastore", "state", "task", "file", "user", "input", "template", "policy", "namespace"}
 
 	parts := strings.Split(object, "/")
 
@@ -37,12 +37,16 @@ func DoDescribe(profile, object, context, format string) {
 	}
 
 	logger.Debugf("", "Getting context")
-	if parts[0] != "workflow" && parts[0] != "datastore" && parts[0] != "user" {
+	if parts[0] != "workflow" && parts[0] != "datastore" && parts[0] != "user" && parts[0] != "template" && parts[0] != "policy" && parts[0] != "namespace" {
 		if context == "" {
 			context = p.Workflow
 		}
+		context = utils.QualifyWorkflow(p.Namespace, context)
 		object = fmt.Sprintf("%s/%s/%s", parts[0], context, parts[1])
 	}
+	if parts[0] == "workflow" || parts[0] == "datastore" {
+		object = fmt.Sprintf("%s/%s", parts[0], utils.QualifyWorkflow(p.Namespace, parts[1]))
+	}
 
 	data := getJSON(p, uri, object)
 
@@ -54,6 +58,7 @@ func getJSON(p auth.ProfileObj, uri, object string) []byte {
 	requestURL := fmt.Sprintf("%s/api/v1/%s", uri, object)
 	req, _ := http.NewRequest("GET", requestURL, nil)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", p.APIToken))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
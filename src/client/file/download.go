@@ -6,11 +6,14 @@ import (
 	"net/http"
 	"os"
 	"scaffold/client/auth"
+	"scaffold/client/constants"
 	"scaffold/client/logger"
+	"scaffold/client/utils"
 )
 
-func DoDownload(profile, workflow, name, outPath string) {
+func DoDownload(profile, workflow, name, outPath string, version int) {
 	p := auth.ReadProfile(profile)
+	workflow = utils.QualifyWorkflow(p.Namespace, workflow)
 	uri := fmt.Sprintf("%s://%s:%s", p.Protocol, p.Host, p.Port)
 
 	// Create the file
@@ -23,8 +26,12 @@ func DoDownload(profile, workflow, name, outPath string) {
 	// Get the data
 	httpClient := &http.Client{}
 	requestURL := fmt.Sprintf("%s/api/v1/file/%s/%s/download", uri, workflow, name)
+	if version > 0 {
+		requestURL = fmt.Sprintf("%s/api/v1/file/%s/%s/versions/%d/download", uri, workflow, name, version)
+	}
 	req, _ := http.NewRequest("GET", requestURL, nil)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", p.APIToken))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -9,11 +9,14 @@ import (
 	"os"
 	"path/filepath"
 	"scaffold/client/auth"
+	"scaffold/client/constants"
 	"scaffold/client/logger"
+	"scaffold/client/utils"
 )
 
 func DoUpload(profile, workflow, inPath string) {
 	p := auth.ReadProfile(profile)
+	workflow = utils.QualifyWorkflow(p.Namespace, workflow)
 	uri := fmt.Sprintf("%s://%s:%s", p.Protocol, p.Host, p.Port)
 
 	file, _ := os.Open(inPath)
@@ -29,6 +32,7 @@ func DoUpload(profile, workflow, inPath string) {
 	requestURL := fmt.Sprintf("%s/api/v1/file/%s", uri, workflow)
 	req, _ := http.NewRequest("POST", requestURL, body)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", p.APIToken))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Add("Content-Type", writer.FormDataContentType())
 
 	resp, err := httpClient.Do(req)
@@ -0,0 +1,62 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"scaffold/client/auth"
+	"scaffold/client/constants"
+	"scaffold/client/logger"
+	"scaffold/client/utils"
+	"text/tabwriter"
+)
+
+type fileVersion struct {
+	Version  int    `json:"version"`
+	RunID    string `json:"run_id"`
+	Task     string `json:"task"`
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+	Created  string `json:"created"`
+}
+
+func DoVersions(profile, workflow, name string) {
+	p := auth.ReadProfile(profile)
+	workflow = utils.QualifyWorkflow(p.Namespace, workflow)
+	uri := fmt.Sprintf("%s://%s:%s", p.Protocol, p.Host, p.Port)
+
+	httpClient := &http.Client{}
+	requestURL := fmt.Sprintf("%s/api/v1/file/%s/%s/versions", uri, workflow, name)
+	req, _ := http.NewRequest("GET", requestURL, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", p.APIToken))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		logger.Fatalf("", "Encountered error listing file versions: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		logger.Fatalf("", "Error, got status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Fatalf("", "Error reading body: %s", err.Error())
+	}
+
+	var versions []fileVersion
+	if err := json.Unmarshal(body, &versions); err != nil {
+		logger.Fatalf("", "Unable to marshal file versions JSON: %s", err.Error())
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 8, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "VERSION \tRUN \tTASK \tSIZE \tCHECKSUM \tCREATED \t")
+	for _, v := range versions {
+		fmt.Fprintf(w, "%d \t%s \t%s \t%d \t%s \t%s \n", v.Version, v.RunID, v.Task, v.Size, v.Checksum, v.Created)
+	}
+	w.Flush()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"scaffold/client/auth"
 	"scaffold/client/constants"
@@ -14,13 +15,13 @@ import (
 	"text/tabwriter"
 )
 
-func DoGet(profile, object, context string) {
+func DoGet(profile, object, context, namespace string) {
 	logger.Debugf("", "Getting objects")
 	p := auth.ReadProfile(profile)
 	uri := fmt.Sprintf("%s://%s:%s", p.Protocol, p.Host, p.Port)
 
 	logger.Debugf("", "Checking if object is valid")
-	objects := []string{"workflow", "datastore", "state", "task", "file", "user", "input"}
+	objects := []string{"workflow", "datastore", "state", "task", "file", "user", "input", "template", "policy", "namespace", "queue"}
 
 	parts := strings.Split(object, "/")
 
@@ -32,12 +33,27 @@ func DoGet(profile, object, context string) {
 	if context == "" {
 		context = p.Workflow
 	}
+	if namespace == "" {
+		namespace = p.Namespace
+	}
+	context = utils.QualifyWorkflow(namespace, context)
 	if len(parts) == 2 {
-		if parts[0] != "workflow" && parts[0] != "datastore" && parts[0] != "user" {
+		if parts[0] == "queue" {
+			logger.Fatalf("", "The queue can only be listed, use 'scaffold get queue'")
+		}
+		if parts[0] == "workflow" || parts[0] == "datastore" {
+			object = fmt.Sprintf("%s/%s", parts[0], utils.QualifyWorkflow(namespace, parts[1]))
+		}
+		if parts[0] != "workflow" && parts[0] != "datastore" && parts[0] != "user" && parts[0] != "template" && parts[0] != "policy" && parts[0] != "namespace" {
 			object = fmt.Sprintf("%s/%s/%s", parts[0], context, parts[1])
 		}
 	}
 
+	// Lists are limited to the selected namespace
+	if len(parts) == 1 && parts[0] != "namespace" && namespace != "" && namespace != constants.ALL_CONTEXTS {
+		object = fmt.Sprintf("%s?namespace=%s", object, url.QueryEscape(namespace))
+	}
+
 	data := getJSON(p, uri, object)
 	if len(parts) == 2 {
 		logger.Debugf("", "data is individual objects, editing JSON response")
@@ -60,6 +76,14 @@ func DoGet(profile, object, context string) {
 		listUsers(data)
 	case "input":
 		listInputs(data, context)
+	case "template":
+		listTemplates(data)
+	case "policy":
+		listPolicies(data)
+	case "namespace":
+		listNamespaces(data)
+	case "queue":
+		listQueue(data)
 	}
 }
 
@@ -68,6 +92,7 @@ func getJSON(p auth.ProfileObj, uri, object string) []byte {
 	requestURL := fmt.Sprintf("%s/api/v1/%s", uri, object)
 	req, _ := http.NewRequest("GET", requestURL, nil)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", p.APIToken))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -95,9 +120,13 @@ func listWorkflows(data []byte) {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 8, 1, 1, ' ', 0)
-	fmt.Fprintln(w, "NAME \tVERSION \tGROUPS \tCREATED \tUPDATED \t")
+	fmt.Fprintln(w, "NAME \tNAMESPACE \tVERSION \tGROUPS \tCREATED \tUPDATED \t")
 	for _, c := range workflows {
 		name := c["name"].(string)
+		namespace, _ := c["namespace"].(string)
+		if namespace == "" {
+			namespace = "default"
+		}
 		version := c["version"].(string)
 		groupList := c["groups"].([]interface{})
 		groups := []string{}
@@ -106,7 +135,7 @@ func listWorkflows(data []byte) {
 		}
 		created := c["created"].(string)
 		updated := c["updated"].(string)
-		fmt.Fprintf(w, "%s \t%s \t%s \t%s \t%s \n", name, version, groups, created, updated)
+		fmt.Fprintf(w, "%s \t%s \t%s \t%s \t%s \t%s \n", name, namespace, version, groups, created, updated)
 	}
 	w.Flush()
 }
@@ -253,3 +282,112 @@ func listInputs(data []byte, context string) {
 	}
 	w.Flush()
 }
+
+func listTemplates(data []byte) {
+	var templates []map[string]interface{}
+
+	err := json.Unmarshal(data, &templates)
+	if err != nil {
+		logger.Fatalf("", "Unable to marshal templates JSON: %s", err.Error())
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 8, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "NAME \tPARAMS \tTASKS \tCREATED \tUPDATED \t")
+	for _, t := range templates {
+		name := t["name"].(string)
+		paramList, _ := t["params"].([]interface{})
+		params := []string{}
+		for _, p := range paramList {
+			params = append(params, p.(map[string]interface{})["name"].(string))
+		}
+		taskList, _ := t["tasks"].([]interface{})
+		created := t["created"].(string)
+		updated := t["updated"].(string)
+		fmt.Fprintf(w, "%s \t%s \t%d \t%s \t%s \n", name, params, len(taskList), created, updated)
+	}
+	w.Flush()
+}
+
+func listPolicies(data []byte) {
+	var policies []map[string]interface{}
+
+	err := json.Unmarshal(data, &policies)
+	if err != nil {
+		logger.Fatalf("", "Unable to marshal policies JSON: %s", err.Error())
+	}
+
+	strs := func(v interface{}) []string {
+		list, _ := v.([]interface{})
+		out := []string{}
+		for _, item := range list {
+			out = append(out, item.(string))
+		}
+		return out
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 8, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "NAME \tUSERS \tGROUPS \tWORKFLOWS \tTASKS \tVERBS \tUPDATED \t")
+	for _, p := range policies {
+		name := p["name"].(string)
+		updated := p["updated"].(string)
+		fmt.Fprintf(w, "%s \t%s \t%s \t%s \t%s \t%s \t%s \n", name, strs(p["users"]), strs(p["groups"]), strs(p["workflows"]), strs(p["tasks"]), strs(p["verbs"]), updated)
+	}
+	w.Flush()
+}
+
+func listNamespaces(data []byte) {
+	var namespaces []map[string]interface{}
+
+	err := json.Unmarshal(data, &namespaces)
+	if err != nil {
+		logger.Fatalf("", "Unable to marshal namespaces JSON: %s", err.Error())
+	}
+
+	strs := func(v interface{}) []string {
+		list, _ := v.([]interface{})
+		out := []string{}
+		for _, item := range list {
+			out = append(out, item.(string))
+		}
+		return out
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 8, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "NAME \tGROUPS \tADMINS \tRUNNING \tUPDATED \t")
+	for _, n := range namespaces {
+		name := n["name"].(string)
+		updated, _ := n["updated"].(string)
+		running, _ := n["running"].(float64)
+		limit, _ := n["max_concurrent_runs"].(float64)
+		runs := fmt.Sprintf("%d", int(running))
+		if limit > 0 {
+			runs = fmt.Sprintf("%d/%d", int(running), int(limit))
+		}
+		fmt.Fprintf(w, "%s \t%s \t%s \t%s \t%s \n", name, strs(n["groups"]), strs(n["admins"]), runs, updated)
+	}
+	w.Flush()
+}
+
+func listQueue(data []byte) {
+	var entries []map[string]interface{}
+
+	err := json.Unmarshal(data, &entries)
+	if err != nil {
+		logger.Fatalf("", "Unable to marshal queue JSON: %s", err.Error())
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 8, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "ID \tRUN \tWORKFLOW \tTASK \tSTATUS \tPRIORITY \tCREATED \tREASON \t")
+	for _, e := range entries {
+		id := e["id"].(string)
+		runID, _ := e["run_id"].(string)
+		workflow, _ := e["workflow"].(string)
+		task, _ := e["task"].(string)
+		status, _ := e["status"].(string)
+		priority, _ := e["priority"].(float64)
+		created, _ := e["created"].(string)
+		reason, _ := e["reason"].(string)
+		fmt.Fprintf(w, "%s \t%s \t%s \t%s \t%s \t%d \t%s \t%s \n", id, runID, workflow, task, status, int(priority), created, reason)
+	}
+	w.Flush()
+}
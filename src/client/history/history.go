@@ -0,0 +1,111 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"scaffold/client/auth"
+	"scaffold/client/constants"
+	"scaffold/client/logger"
+	"scaffold/client/utils"
+	"strings"
+	"text/tabwriter"
+)
+
+type revision struct {
+	Version  int    `json:"version"`
+	Author   string `json:"author"`
+	Message  string `json:"message"`
+	Checksum string `json:"checksum"`
+	Created  string `json:"created"`
+}
+
+// Parse a `workflow/<name>` object into the workflow name
+func workflowName(object string) string {
+	parts := strings.Split(object, "/")
+	if len(parts) != 2 || parts[0] != "workflow" || parts[1] == "" {
+		logger.Fatalf("", "Invalid object passed: '%s'. Object must be of format 'workflow/<workflow name>'", object)
+	}
+	return parts[1]
+}
+
+func doRequest(p auth.ProfileObj, method, requestURL string) []byte {
+	httpClient := &http.Client{}
+	req, _ := http.NewRequest(method, requestURL, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", p.APIToken))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		logger.Fatalf("", "Encountered error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Fatalf("", "Error reading body: %s", err.Error())
+	}
+
+	if resp.StatusCode >= 400 {
+		logger.Fatalf("", "Error, got status code %d: %s", resp.StatusCode, string(body))
+	}
+	return body
+}
+
+// List the revisions of a workflow, or print the diff between two of them
+// when either from or to is set
+func DoHistory(profile, object string, from, to int) {
+	p := auth.ReadProfile(profile)
+	uri := fmt.Sprintf("%s://%s:%s", p.Protocol, p.Host, p.Port)
+	name := utils.QualifyWorkflow(p.Namespace, workflowName(object))
+
+	if from > 0 || to > 0 {
+		query := []string{}
+		if from > 0 {
+			query = append(query, fmt.Sprintf("from=%d", from))
+		}
+		if to > 0 {
+			query = append(query, fmt.Sprintf("to=%d", to))
+		}
+		body := doRequest(p, "GET", fmt.Sprintf("%s/api/v1/workflow/%s/diff?%s", uri, name, strings.Join(query, "&")))
+		fmt.Print(string(body))
+		return
+	}
+
+	body := doRequest(p, "GET", fmt.Sprintf("%s/api/v1/workflow/%s/revisions", uri, name))
+
+	var revisions []revision
+	if err := json.Unmarshal(body, &revisions); err != nil {
+		logger.Fatalf("", "Unable to marshal revisions JSON: %s", err.Error())
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 8, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "REVISION \tAUTHOR \tCHECKSUM \tCREATED \tMESSAGE \t")
+	for _, r := range revisions {
+		checksum := r.Checksum
+		if len(checksum) > 12 {
+			checksum = checksum[:12]
+		}
+		fmt.Fprintf(w, "%d \t%s \t%s \t%s \t%s \n", r.Version, r.Author, checksum, r.Created, r.Message)
+	}
+	w.Flush()
+}
+
+func DoRollback(profile, object string, version int) {
+	p := auth.ReadProfile(profile)
+	uri := fmt.Sprintf("%s://%s:%s", p.Protocol, p.Host, p.Port)
+	name := utils.QualifyWorkflow(p.Namespace, workflowName(object))
+
+	body := doRequest(p, "POST", fmt.Sprintf("%s/api/v1/workflow/%s/rollback/%d", uri, name, version))
+
+	var out struct {
+		Revision int `json:"revision"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		logger.Fatalf("", "Unable to marshal rollback JSON: %s", err.Error())
+	}
+
+	logger.Successf("", "Rolled back %s to revision %d as revision %d", name, version, out.Revision)
+}
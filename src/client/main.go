@@ -13,6 +13,7 @@ import (
 	"scaffold/client/describe"
 	"scaffold/client/file"
 	"scaffold/client/get"
+	"scaffold/client/history"
 	"scaffold/client/logger"
 	"scaffold/client/version"
 
@@ -31,26 +32,28 @@ func main() {
 	parser := argparse.NewParser("scaffold", "Scaffold infrastructure management client")
 
 	applyCommand := parser.NewCommand("apply", "Create or update a Scaffold object")
-	applyObject := applyCommand.StringPositional(&argparse.Options{Required: true, Help: "Scaffold object type to create. Valid object types are 'workflow', 'datastore', 'task', 'state', 'file', and 'user"})
+	applyObject := applyCommand.StringPositional(&argparse.Options{Required: true, Help: "Scaffold object type to create. Valid object types are 'workflow', 'datastore', 'task', 'state', 'file', 'user', 'template', 'policy', and 'namespace'"})
 	applyContext := applyCommand.String("c", "context", &argparse.Options{Help: "Workflow context to use. If not set the value in your config file will be pulled", Default: ""})
+	applyNamespace := applyCommand.String("n", "namespace", &argparse.Options{Help: "Namespace to put workflows in when they do not name one. If not set the value in your config file will be pulled", Default: ""})
 	applyProfile := applyCommand.String("p", "profile", &argparse.Options{Help: "Profile to use to connect to Scaffold instance", Default: "default"})
 	applyFile := applyCommand.String("f", "file", &argparse.Options{Required: true, Help: "Scaffold manifest to apply"})
 	applyLogLevel := applyCommand.Selector("l", "log-level", []string{"NONE", "FATAL", "SUCCESS", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}, &argparse.Options{Help: "Log level to use. Valid options are 'NONE', 'FATAL', 'SUCCESS', 'ERROR', 'WARN', 'INFO', 'DEBUG', 'TRACE'. Defaults to 'ERROR'", Default: "ERROR"})
 
 	deleteCommand := parser.NewCommand("delete", "Delete an existing Scaffold object")
-	deleteObject := deleteCommand.StringPositional(&argparse.Options{Required: true, Help: "Scaffold object to get. Can be of format '<object type>', or '<object type>/<object name>'. Valid object types are 'workflow', 'datastore', 'task', 'state', 'file', and 'user"})
+	deleteObject := deleteCommand.StringPositional(&argparse.Options{Required: true, Help: "Scaffold object to get. Can be of format '<object type>', or '<object type>/<object name>'. Valid object types are 'workflow', 'datastore', 'task', 'state', 'file', 'user', 'template', 'policy', 'namespace', and 'queue'"})
 	deleteContext := deleteCommand.String("c", "context", &argparse.Options{Help: "Workflow context to use. If not set the value in your config file will be pulled", Default: ""})
 	deleteProfile := deleteCommand.String("p", "profile", &argparse.Options{Help: "Profile to use to connect to Scaffold instance", Default: "default"})
 	deleteLogLevel := deleteCommand.Selector("l", "log-level", []string{"NONE", "FATAL", "SUCCESS", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}, &argparse.Options{Help: "Log level to use. Valid options are 'NONE', 'FATAL', 'SUCCESS', 'ERROR', 'WARN', 'INFO', 'DEBUG', 'TRACE'. Defaults to 'ERROR'", Default: "ERROR"})
 
 	getCommand := parser.NewCommand("get", "Get Scaffold objects")
-	getObject := getCommand.StringPositional(&argparse.Options{Required: true, Help: "Scaffold object to get. Can be of format '<object type>', or '<object type>/<object name>'. Valid object types are 'workflow', 'datastore', 'task', 'state', 'file', and 'user"})
+	getObject := getCommand.StringPositional(&argparse.Options{Required: true, Help: "Scaffold object to get. Can be of format '<object type>', or '<object type>/<object name>'. Valid object types are 'workflow', 'datastore', 'task', 'state', 'file', 'user', 'template', 'policy', 'namespace', and 'queue'"})
 	getContext := getCommand.String("c", "context", &argparse.Options{Help: "Workflow context to use. If not set the value in your config file will be pulled", Default: ""})
+	getNamespace := getCommand.String("n", "namespace", &argparse.Options{Help: "Namespace to limit lists to, or 'all' for every namespace. If not set the value in your config file will be pulled", Default: ""})
 	getProfile := getCommand.String("p", "profile", &argparse.Options{Help: "Profile to use to connect to Scaffold instance", Default: "default"})
 	getLogLevel := getCommand.Selector("l", "log-level", []string{"NONE", "FATAL", "SUCCESS", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}, &argparse.Options{Help: "Log level to use. Valid options are 'NONE', 'FATAL', 'SUCCESS', 'ERROR', 'WARN', 'INFO', 'DEBUG', 'TRACE'. Defaults to 'ERROR'", Default: "ERROR"})
 
 	describeCommand := parser.NewCommand("describe", "Describe a Scaffold object")
-	describeObject := describeCommand.StringPositional(&argparse.Options{Required: true, Help: "Scaffold object to describe. Must be of format '<object type>/<object name>'. Valid object types are 'workflow', 'datastore', 'task', 'state', 'file', and 'user'"})
+	describeObject := describeCommand.StringPositional(&argparse.Options{Required: true, Help: "Scaffold object to describe. Must be of format '<object type>/<object name>'. Valid object types are 'workflow', 'datastore', 'task', 'state', 'file', 'user', 'template', 'policy', and 'namespace'"})
 	describeProfile := describeCommand.String("p", "profile", &argparse.Options{Help: "Profile to use to connect to Scaffold instance", Default: "default"})
 	describeContext := describeCommand.String("c", "context", &argparse.Options{Help: "Workflow context to use. If not set the value in your config file will be pulled", Default: ""})
 	describeFormat := describeCommand.Selector("o", "output", []string{"yaml", "json"}, &argparse.Options{Help: "Output format to print. Valid options are 'yaml' and 'json'. Defaults to 'yaml'", Default: "yaml"})
@@ -64,11 +67,13 @@ func main() {
 	configProfile := configCommand.String("p", "profile", &argparse.Options{Help: "Name for the profile to configure", Default: "default"})
 	configUsername := configCommand.String("", "username", &argparse.Options{Required: true, Help: "Username to use to connect to Scaffold instance"})
 	configPassword := configCommand.String("", "password", &argparse.Options{Required: true, Help: "Password to use to connect to Scaffold instance"})
+	configCode := configCommand.String("", "code", &argparse.Options{Help: "Two-factor code from your authenticator app, if your account uses two-factor authentication", Default: ""})
 	configLogLevel := configCommand.Selector("l", "log-level", []string{"NONE", "FATAL", "SUCCESS", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}, &argparse.Options{Help: "Log level to use. Valid options are 'NONE', 'FATAL', 'SUCCESS', 'ERROR', 'WARN', 'INFO', 'DEBUG', 'TRACE'. Defaults to 'ERROR'", Default: "ERROR"})
 	configSkipVerify := configCommand.Flag("", "skip-verify", &argparse.Options{Help: "Should SSL certificates not be verified on connection"})
 
 	contextCommand := parser.NewCommand("context", "Configure workflow context for a Scaffold instance")
-	contextContext := contextCommand.StringPositional(&argparse.Options{Required: true, Help: "Scaffold workflow context to use"})
+	contextContext := contextCommand.StringPositional(&argparse.Options{Help: "Scaffold workflow context to use", Default: ""})
+	contextNamespace := contextCommand.String("n", "namespace", &argparse.Options{Help: "Namespace to work in, or 'all' to stop limiting requests to one", Default: ""})
 	contextProfile := contextCommand.String("p", "profile", &argparse.Options{Help: "Name for the profile to configure", Default: "default"})
 	contextLogLevel := contextCommand.Selector("l", "log-level", []string{"NONE", "FATAL", "SUCCESS", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}, &argparse.Options{Help: "Log level to use. Valid options are 'NONE', 'FATAL', 'SUCCESS', 'ERROR', 'WARN', 'INFO', 'DEBUG', 'TRACE'. Defaults to 'ERROR'", Default: "ERROR"})
 
@@ -85,8 +90,28 @@ func main() {
 	downloadFile := downloadCommand.String("f", "file", &argparse.Options{Required: true, Help: "Path to file to download"})
 	downloadWorkflow := downloadCommand.String("w", "workflow", &argparse.Options{Required: true, Help: "Workflow filestore to download file from"})
 	downloadName := downloadCommand.String("n", "name", &argparse.Options{Required: true, Help: "Filename to download from workflow filestore"})
+	downloadVersion := downloadCommand.Int("v", "version", &argparse.Options{Help: "Version of the file to download. Defaults to the latest version", Default: 0})
 	downloadLogLevel := downloadCommand.Selector("l", "log-level", []string{"NONE", "FATAL", "SUCCESS", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}, &argparse.Options{Help: "Log level to use. Valid options are 'NONE', 'FATAL', 'SUCCESS', 'ERROR', 'WARN', 'INFO', 'DEBUG', 'TRACE'. Defaults to 'ERROR'", Default: "ERROR"})
 
+	versionsCommand := fileCommand.NewCommand("versions", "List stored versions of a file")
+	versionsProfile := versionsCommand.String("p", "profile", &argparse.Options{Help: "Profile to use to connect to Scaffold instance", Default: "default"})
+	versionsWorkflow := versionsCommand.String("w", "workflow", &argparse.Options{Required: true, Help: "Workflow filestore the file belongs to"})
+	versionsName := versionsCommand.String("n", "name", &argparse.Options{Required: true, Help: "Filename to list versions of"})
+	versionsLogLevel := versionsCommand.Selector("l", "log-level", []string{"NONE", "FATAL", "SUCCESS", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}, &argparse.Options{Help: "Log level to use. Valid options are 'NONE', 'FATAL', 'SUCCESS', 'ERROR', 'WARN', 'INFO', 'DEBUG', 'TRACE'. Defaults to 'ERROR'", Default: "ERROR"})
+
+	historyCommand := parser.NewCommand("history", "List revisions of a workflow or diff two of them")
+	historyObject := historyCommand.StringPositional(&argparse.Options{Required: true, Help: "Workflow to list revisions of. Must be of format 'workflow/<workflow name>'"})
+	historyProfile := historyCommand.String("p", "profile", &argparse.Options{Help: "Profile to use to connect to Scaffold instance", Default: "default"})
+	historyFrom := historyCommand.Int("", "from", &argparse.Options{Help: "Revision to diff from. Defaults to the revision before --to", Default: 0})
+	historyTo := historyCommand.Int("", "to", &argparse.Options{Help: "Revision to diff to. Defaults to the latest revision", Default: 0})
+	historyLogLevel := historyCommand.Selector("l", "log-level", []string{"NONE", "FATAL", "SUCCESS", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}, &argparse.Options{Help: "Log level to use. Valid options are 'NONE', 'FATAL', 'SUCCESS', 'ERROR', 'WARN', 'INFO', 'DEBUG', 'TRACE'. Defaults to 'ERROR'", Default: "ERROR"})
+
+	rollbackCommand := parser.NewCommand("rollback", "Roll a workflow back to an earlier revision")
+	rollbackObject := rollbackCommand.StringPositional(&argparse.Options{Required: true, Help: "Workflow to roll back. Must be of format 'workflow/<workflow name>'"})
+	rollbackProfile := rollbackCommand.String("p", "profile", &argparse.Options{Help: "Profile to use to connect to Scaffold instance", Default: "default"})
+	rollbackRevision := rollbackCommand.Int("r", "revision", &argparse.Options{Required: true, Help: "Revision to roll back to"})
+	rollbackLogLevel := rollbackCommand.Selector("l", "log-level", []string{"NONE", "FATAL", "SUCCESS", "ERROR", "WARN", "INFO", "DEBUG", "TRACE"}, &argparse.Options{Help: "Log level to use. Valid options are 'NONE', 'FATAL', 'SUCCESS', 'ERROR', 'WARN', 'INFO', 'DEBUG', 'TRACE'. Defaults to 'ERROR'", Default: "ERROR"})
+
 	versionCommand := parser.NewCommand("version", "Get Scaffold versions")
 
 	localCommand := versionCommand.NewCommand("local", "Get local Scaffold CLI version")
@@ -106,7 +131,7 @@ func main() {
 
 	if applyCommand.Happened() {
 		logger.SetLevel(*applyLogLevel)
-		apply.DoApply(*applyProfile, *applyObject, *applyContext, *applyFile)
+		apply.DoApply(*applyProfile, *applyObject, *applyContext, *applyNamespace, *applyFile)
 		os.Exit(0)
 	}
 
@@ -119,19 +144,19 @@ func main() {
 	if configCommand.Happened() {
 		logger.SetLevel(*configLogLevel)
 		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: *configSkipVerify}
-		config.DoConfig(*configHost, *configPort, *configProtocol, *configWSPort, *configProfile, *configUsername, *configPassword, *configSkipVerify)
+		config.DoConfig(*configHost, *configPort, *configProtocol, *configWSPort, *configProfile, *configUsername, *configPassword, *configCode, *configSkipVerify)
 		os.Exit(0)
 	}
 
 	if contextCommand.Happened() {
 		logger.SetLevel(*contextLogLevel)
-		context.DoContext(*contextProfile, *contextContext)
+		context.DoContext(*contextProfile, *contextContext, *contextNamespace)
 		os.Exit(0)
 	}
 
 	if getCommand.Happened() {
 		logger.SetLevel(*getLogLevel)
-		get.DoGet(*getProfile, *getObject, *getContext)
+		get.DoGet(*getProfile, *getObject, *getContext, *getNamespace)
 		os.Exit(0)
 	}
 
@@ -149,7 +174,25 @@ func main() {
 
 	if downloadCommand.Happened() {
 		logger.SetLevel(*downloadLogLevel)
-		file.DoDownload(*downloadProfile, *downloadWorkflow, *downloadName, *downloadFile)
+		file.DoDownload(*downloadProfile, *downloadWorkflow, *downloadName, *downloadFile, *downloadVersion)
+		os.Exit(0)
+	}
+
+	if versionsCommand.Happened() {
+		logger.SetLevel(*versionsLogLevel)
+		file.DoVersions(*versionsProfile, *versionsWorkflow, *versionsName)
+		os.Exit(0)
+	}
+
+	if historyCommand.Happened() {
+		logger.SetLevel(*historyLogLevel)
+		history.DoHistory(*historyProfile, *historyObject, *historyFrom, *historyTo)
+		os.Exit(0)
+	}
+
+	if rollbackCommand.Happened() {
+		logger.SetLevel(*rollbackLogLevel)
+		history.DoRollback(*rollbackProfile, *rollbackObject, *rollbackRevision)
 		os.Exit(0)
 	}
 
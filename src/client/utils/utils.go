@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"scaffold/client/auth"
 	"scaffold/client/config"
+	"scaffold/client/constants"
 	"scaffold/client/logger"
+	"strings"
 )
 
 func SendPost(uri, path string, data map[string]interface{}, p auth.ProfileObj) (map[string]interface{}, error) {
@@ -24,6 +26,7 @@ func SendPost(uri, path string, data map[string]interface{}, p auth.ProfileObj)
 	requestURL := fmt.Sprintf("%s/%s", uri, path)
 	req, _ := http.NewRequest("POST", requestURL, postBodyBuffer)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", config.Token))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -59,6 +62,7 @@ func SendPut(uri, path string, data map[string]interface{}, p auth.ProfileObj) (
 	requestURL := fmt.Sprintf("%s/%s", uri, path)
 	req, _ := http.NewRequest("PUT", requestURL, postBodyBuffer)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", config.Token))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -88,6 +92,7 @@ func SendDelete(uri, path string, p auth.ProfileObj) (map[string]interface{}, er
 	requestURL := fmt.Sprintf("%s/%s", uri, path)
 	req, _ := http.NewRequest("DELETE", requestURL, nil)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", config.Token))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -117,6 +122,7 @@ func SendGet(uri, path string, p auth.ProfileObj) (map[string]interface{}, error
 	requestURL := fmt.Sprintf("%s/%s", uri, path)
 	req, _ := http.NewRequest("GET", requestURL, nil)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", config.Token))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -147,3 +153,16 @@ func Contains(s []string, e string) bool {
 	}
 	return false
 }
+
+// Get the name a workflow in namespace is stored under. Workflows outside the
+// default namespace are stored as `<namespace>.<name>`, names that already
+// carry a namespace are left as they are
+func QualifyWorkflow(namespace, name string) string {
+	if name == "" || namespace == "" || namespace == constants.ALL_CONTEXTS || namespace == constants.NAMESPACE_DEFAULT {
+		return name
+	}
+	if strings.Contains(name, constants.WORKFLOW_NAMESPACE_SEPARATOR) {
+		return name
+	}
+	return namespace + constants.WORKFLOW_NAMESPACE_SEPARATOR + name
+}
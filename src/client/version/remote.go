@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"scaffold/client/auth"
+	"scaffold/client/constants"
 	"scaffold/client/logger"
 )
 
@@ -29,6 +30,7 @@ func getJSON(p auth.ProfileObj, uri string) []byte {
 	requestURL := fmt.Sprintf("%s/health/healthy", uri)
 	req, _ := http.NewRequest("GET", requestURL, nil)
 	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", p.APIToken))
+	req.Header.Set("User-Agent", constants.USER_AGENT)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
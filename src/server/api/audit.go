@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"scaffold/server/audit"
+	"scaffold/server/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@summary					Get audit entries
+//	@description				Get audit log entries matching the given filters, newest first
+//	@tags						manager
+//	@tags						audit
+//	@produce					json
+//	@Param						actor	query		string	false	"Actor"
+//	@Param						source	query		string	false	"Source"
+//	@Param						action	query		string	false	"Action"
+//	@Param						kind	query		string	false	"Kind of object changed"
+//	@Param						target	query		string	false	"Object changed"
+//	@Param						since	query		string	false	"Earliest time"
+//	@Param						until	query		string	false	"Latest time"
+//	@Param						limit	query		int		false	"Maximum number of entries"
+//	@success					200		{array}		audit.Entry
+//	@failure					500		{object}	object
+//	@failure					400		{object}	object
+//	@failure					401		{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/audit [get]
+func GetAuditEntries(ctx *gin.Context) {
+	q, err := audit.ParseQuery(ctx.Request.URL.Query())
+	if err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	entries, err := audit.GetEntries(q)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []*audit.Entry{}
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
+
+//	@summary					Export audit entries
+//	@description				Download audit log entries matching the given filters as JSON lines, newest first
+//	@tags						manager
+//	@tags						audit
+//	@produce					application/x-ndjson
+//	@Param						actor	query		string	false	"Actor"
+//	@Param						source	query		string	false	"Source"
+//	@Param						action	query		string	false	"Action"
+//	@Param						kind	query		string	false	"Kind of object changed"
+//	@Param						target	query		string	false	"Object changed"
+//	@Param						since	query		string	false	"Earliest time"
+//	@Param						until	query		string	false	"Latest time"
+//	@Param						limit	query		int		false	"Maximum number of entries"
+//	@success					200
+//	@failure					500		{object}	object
+//	@failure					400		{object}	object
+//	@failure					401		{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/audit/export [get]
+func ExportAuditEntries(ctx *gin.Context) {
+	q, err := audit.ParseQuery(ctx.Request.URL.Query())
+	if err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	entries, err := audit.GetEntries(q)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("scaffold-audit-%s.jsonl", time.Now().UTC().Format("20060102T150405Z"))
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Status(http.StatusOK)
+	encoder := json.NewEncoder(ctx.Writer)
+	for _, e := range entries {
+		if err := encoder.Encode(e); err != nil {
+			return
+		}
+	}
+}
@@ -1,19 +1,34 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"scaffold/server/auth"
+	"scaffold/server/constants"
 	"scaffold/server/user"
 	"scaffold/server/utils"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Options for a new API token, all of which can be left out
+type APITokenRequest struct {
+	Scope         string   `json:"scope"`
+	Workflows     []string `json:"workflows"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
 //	@summary					Generate API Token
-//	@description				Generate an API token for a user
+//	@description				Generate an API token for a user, optionally limited to a scope and workflows and expiring after a number of days. A token with the same name is replaced
 //	@tags						manager
 //	@tags						user
+//	@accept						json
 //	@produce					json
+//	@Param						options	body		APITokenRequest	false	"Token Options"
 //	@success					200	{array}		object
 //	@failure					500	{object}	object
 //	@failure					401	{object}	object
@@ -26,7 +41,30 @@ func GenerateAPIToken(ctx *gin.Context) {
 	username := ctx.Param("username")
 	name := ctx.Param("name")
 
-	token, err := user.GenerateAPIToken(username, name)
+	var req APITokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+	if req.Scope != "" && req.Scope != constants.API_TOKEN_SCOPE_READ && req.Scope != constants.API_TOKEN_SCOPE_TRIGGER {
+		utils.Error(fmt.Errorf("unknown api token scope %s", req.Scope), ctx, http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		utils.Error(errors.New("expires_in_days cannot be negative"), ctx, http.StatusBadRequest)
+		return
+	}
+
+	t := user.APIToken{
+		Name:      name,
+		Scope:     req.Scope,
+		Workflows: req.Workflows,
+	}
+	if req.ExpiresInDays > 0 {
+		t.Expires = time.Now().UTC().AddDate(0, 0, req.ExpiresInDays).Format("2006-01-02T15:04:05Z")
+	}
+
+	token, err := user.GenerateAPIToken(username, &t)
 	if err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
 		return
@@ -61,6 +99,90 @@ func RevokeAPIToken(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
 }
 
+//	@summary					Get sessions
+//	@description				Get the login sessions of a user
+//	@tags						manager
+//	@tags						user
+//	@produce					json
+//	@success					200	{array}		user.Session
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/auth/session/{username} [get]
+func GetSessions(ctx *gin.Context) {
+	username := ctx.Param("username")
+
+	sessions, err := user.GetSessionsByUsername(username)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if token, err := ctx.Cookie("scaffold_token"); err == nil {
+		if current, err := user.GetSessionByToken(token); err == nil {
+			for _, s := range sessions {
+				s.Current = s.ID == current.ID
+			}
+		}
+	}
+
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+//	@summary					Revoke session
+//	@description				Log a user out of one of their sessions
+//	@tags						manager
+//	@tags						user
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/auth/session/{username}/{id} [delete]
+func RevokeSession(ctx *gin.Context) {
+	username := ctx.Param("username")
+	id := ctx.Param("id")
+
+	err := user.DeleteSessionByID(username, id)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Revoke all sessions
+//	@description				Log a user out of every session
+//	@tags						manager
+//	@tags						user
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/auth/session/{username} [delete]
+func RevokeAllSessions(ctx *gin.Context) {
+	username := ctx.Param("username")
+
+	err := user.DeleteSessionsByUsername(username)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
 //	@summary					Ping manager
 //	@description				Ping manager to reset node age
 //	@tags						manager
@@ -75,9 +197,19 @@ func RevokeAPIToken(ctx *gin.Context) {
 //	@router						/health/ping/{name} [post]
 func Ping(c *gin.Context) {
 	name := c.Param("name")
+
+	// Nodes can only ping for themselves, anything else has to join again
+	parts := strings.Split(c.Request.Header.Get("Authorization"), " ")
+	if len(parts) < 2 || !auth.VerifyNode(name, parts[1]) {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
 	auth.NodeLock.Lock()
 	if n, ok := auth.Nodes[name]; ok {
 		n.Ping = 0
+		// The node signs with its new credential from now on
+		n.PreviousKey = ""
 		auth.Nodes[name] = n
 	}
 	auth.NodeLock.Unlock()
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"scaffold/server/cache"
+	"scaffold/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@summary					Get cache stats
+//	@description				Get task cache hit, miss, and entry counts for a workflow
+//	@tags						manager
+//	@tags						cache
+//	@produce					json
+//	@success					200	{array}		cache.Stats
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/cache/{workflow_name} [get]
+func GetCacheStatsByWorkflow(ctx *gin.Context) {
+	name := ctx.Param("workflow")
+
+	stats, err := cache.GetStatsByWorkflow(name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if stats == nil {
+		stats = make([]*cache.Stats, 0)
+	}
+
+	ctx.JSON(http.StatusOK, stats)
+}
+
+//	@summary					Get cache entries
+//	@description				Get cache entries for a task
+//	@tags						manager
+//	@tags						cache
+//	@produce					json
+//	@success					200	{array}		cache.Entry
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/cache/{workflow_name}/{task_name} [get]
+func GetCacheEntriesByNames(ctx *gin.Context) {
+	name := ctx.Param("workflow")
+	taskName := ctx.Param("task")
+
+	entries, err := cache.GetEntriesByNames(name, taskName)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if entries == nil {
+		entries = make([]*cache.Entry, 0)
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
+
+//	@summary					Invalidate workflow cache
+//	@description				Remove all cache entries and stats for a workflow
+//	@tags						manager
+//	@tags						cache
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/cache/{workflow_name} [delete]
+func DeleteCacheByWorkflow(ctx *gin.Context) {
+	name := ctx.Param("workflow")
+
+	if err := cache.DeleteEntriesByWorkflow(name); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if err := cache.DeleteStatsByWorkflow(name); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Invalidate task cache
+//	@description				Remove all cache entries and stats for a task
+//	@tags						manager
+//	@tags						cache
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/cache/{workflow_name}/{task_name} [delete]
+func DeleteCacheByNames(ctx *gin.Context) {
+	name := ctx.Param("workflow")
+	taskName := ctx.Param("task")
+
+	if err := cache.DeleteEntriesByNames(name, taskName); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if err := cache.DeleteStatsByNames(name, taskName); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
@@ -8,6 +8,7 @@ import (
 	"scaffold/server/constants"
 	"scaffold/server/datastore"
 	"scaffold/server/input"
+	"scaffold/server/policy"
 	"scaffold/server/utils"
 	"scaffold/server/workflow"
 
@@ -37,17 +38,12 @@ func CreateDataStore(ctx *gin.Context) {
 		return
 	}
 
-	c, err := workflow.GetWorkflowByName(d.Name)
-	if err != nil {
-		utils.Error(err, ctx, http.StatusNotFound)
-	}
-	if c.Groups != nil {
-		if !validateUserGroup(ctx, c.Groups) {
-			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
-		}
+	if !validatePermission(ctx, policy.VERB_EDIT, d.Name, "") {
+		utils.Error(errors.New("user is not allowed to edit this workflow"), ctx, http.StatusForbidden)
+		return
 	}
 
-	err = datastore.CreateDataStore(&d)
+	err := datastore.CreateDataStore(&d)
 
 	if err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
@@ -112,17 +108,9 @@ func GetAllDataStores(ctx *gin.Context) {
 	// weirdly (I think at least)
 	datastoresOut := make([]datastore.DataStore, 0)
 	for _, d := range datastores {
-		c, err := workflow.GetWorkflowByName(d.Name)
-		if err != nil {
-			continue
-		}
-		if c.Groups != nil {
-			if validateUserGroup(ctx, c.Groups) {
-				datastoresOut = append(datastoresOut, *d)
-			}
-			continue
+		if inNamespace(ctx, d.Name) && validatePermission(ctx, policy.VERB_VIEW, d.Name, "") {
+			datastoresOut = append(datastoresOut, *d)
 		}
-		datastoresOut = append(datastoresOut, *d)
 	}
 
 	ctx.JSON(http.StatusOK, datastoresOut)
@@ -197,7 +185,7 @@ func UpdateDataStoreByWorkflow(ctx *gin.Context) {
 
 	err := datastore.UpdateDataStoreByWorkflow(name, &d, inputs)
 	if err != nil {
-		utils.Error(err, ctx, http.StatusInternalServerError)
+		utils.Error(err, ctx, inputErrorStatus(err))
 		return
 	}
 
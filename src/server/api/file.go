@@ -5,14 +5,19 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"scaffold/server/artifact"
+	"scaffold/server/constants"
 	"scaffold/server/datastore"
 	"scaffold/server/filestore"
 	"scaffold/server/input"
+	"scaffold/server/manager"
+	"scaffold/server/policy"
 	"scaffold/server/utils"
-	"scaffold/server/workflow"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	logger "github.com/jfcarter2358/go-logger"
 )
 
 //	@summary					Download a file
@@ -33,20 +38,14 @@ func DownloadFile(ctx *gin.Context) {
 	name := ctx.Param("name")
 	fileName := ctx.Param("file")
 
-	c, err := workflow.GetWorkflowByName(name)
-	if err != nil {
-		utils.Error(err, ctx, http.StatusNotFound)
-	}
-	if c.Groups != nil {
-		if !validateUserGroup(ctx, c.Groups) {
-			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
-			return
-		}
+	if !validatePermission(ctx, policy.VERB_VIEW, name, "") {
+		utils.Error(errors.New("user is not allowed to view this workflow"), ctx, http.StatusForbidden)
+		return
 	}
 
 	path := fmt.Sprintf("/tmp/%s", uuid.New().String())
 
-	err = filestore.GetFile(fmt.Sprintf("%s/%s", name, fileName), path)
+	err := filestore.GetFile(fmt.Sprintf("%s/%s", name, fileName), path)
 	if err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
 		return
@@ -86,14 +85,9 @@ func DownloadFile(ctx *gin.Context) {
 func UploadFile(ctx *gin.Context) {
 	name := ctx.Param("name")
 
-	c, err := workflow.GetWorkflowByName(name)
-	if err != nil {
-		utils.Error(err, ctx, http.StatusNotFound)
-	}
-	if c.Groups != nil {
-		if !validateUserGroup(ctx, c.Groups) {
-			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
-		}
+	if !validatePermission(ctx, policy.VERB_EDIT, name, "") {
+		utils.Error(errors.New("user is not allowed to edit this workflow"), ctx, http.StatusForbidden)
+		return
 	}
 
 	file, err := ctx.FormFile("file")
@@ -113,7 +107,8 @@ func UploadFile(ctx *gin.Context) {
 		return
 	}
 
-	if err := filestore.UploadFile(path, fmt.Sprintf("%s/%s", name, fileName)); err != nil {
+	a, err := artifact.Store(path, name, fileName, "", "")
+	if err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
 		return
 	}
@@ -139,6 +134,11 @@ func UploadFile(ctx *gin.Context) {
 		return
 	}
 
+	// The file is stored either way, so a failure to trigger is only logged
+	if err := manager.FileTrigger(name, a.Name, a.Version, "", nil); err != nil {
+		logger.Errorf("", "Cannot fire file triggers for %s/%s: %s", name, a.Name, err.Error())
+	}
+
 	// File saved successfully. Return proper result
 	utils.DynamicAPIResponse(ctx, "/ui/files", http.StatusOK, gin.H{"message": "OK"})
 }
@@ -159,15 +159,9 @@ func UploadFile(ctx *gin.Context) {
 func GetFilesByWorkflow(ctx *gin.Context) {
 	name := ctx.Param("name")
 
-	c, err := workflow.GetWorkflowByName(name)
-	if err != nil {
-		utils.Error(err, ctx, http.StatusNotFound)
-	}
-	if c.Groups != nil {
-		if !validateUserGroup(ctx, c.Groups) {
-			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
-			return
-		}
+	if !validatePermission(ctx, policy.VERB_VIEW, name, "") {
+		utils.Error(errors.New("user is not allowed to view this workflow"), ctx, http.StatusForbidden)
+		return
 	}
 
 	objects, err := filestore.ListObjects()
@@ -204,15 +198,9 @@ func GetFileByNames(ctx *gin.Context) {
 	name := ctx.Param("name")
 	file := ctx.Param("file")
 
-	c, err := workflow.GetWorkflowByName(name)
-	if err != nil {
-		utils.Error(err, ctx, http.StatusNotFound)
-	}
-	if c.Groups != nil {
-		if !validateUserGroup(ctx, c.Groups) {
-			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
-			return
-		}
+	if !validatePermission(ctx, policy.VERB_VIEW, name, "") {
+		utils.Error(errors.New("user is not allowed to view this workflow"), ctx, http.StatusForbidden)
+		return
 	}
 
 	objects, err := filestore.ListObjects()
@@ -258,18 +246,100 @@ func GetAllFiles(ctx *gin.Context) {
 	out := make([]filestore.ObjectMetadata, 0)
 
 	for _, obj := range objects {
-		c, err := workflow.GetWorkflowByName(obj.Workflow)
-		if err != nil {
-			continue
-		}
-		if c.Groups != nil {
-			if validateUserGroup(ctx, c.Groups) {
-				out = append(out, obj)
-			}
-			continue
+		if inNamespace(ctx, obj.Workflow) && validatePermission(ctx, policy.VERB_VIEW, obj.Workflow, "") {
+			out = append(out, obj)
 		}
-		out = append(out, obj)
 	}
 
 	ctx.JSON(http.StatusOK, out)
 }
+
+//	@summary					Get file versions
+//	@description				Get all stored versions of a file, newest first
+//	@tags						manager
+//	@tags						file
+//	@produce					json
+//	@success					200	{array}		artifact.Artifact
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/file/{workflow_name}/{file_name}/versions [get]
+func GetFileVersions(ctx *gin.Context) {
+	name := ctx.Param("name")
+	fileName := ctx.Param("file")
+
+	as, err := artifact.GetArtifactsByNames(name, fileName)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if as == nil {
+		as = make([]*artifact.Artifact, 0)
+	}
+
+	ctx.JSON(http.StatusOK, as)
+}
+
+//	@summary					Download a file version
+//	@description				Download a specific stored version of a file
+//	@tags						manager
+//	@tags						file
+//	@produce					application/text
+//	@success					200
+//	@failure					500
+//	@failure					400
+//	@failure					401
+//	@failure					404
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/file/{workflow_name}/{file_name}/versions/{version}/download [get]
+func DownloadFileVersion(ctx *gin.Context) {
+	name := ctx.Param("name")
+	fileName := ctx.Param("file")
+
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil {
+		utils.Error(fmt.Errorf("invalid version %s", ctx.Param("version")), ctx, http.StatusBadRequest)
+		return
+	}
+
+	a, err := artifact.GetArtifactByVersion(name, fileName, version)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if a == nil {
+		utils.Error(fmt.Errorf("version %d of file %s does not exist in workflow %s", version, fileName, name), ctx, http.StatusNotFound)
+		return
+	}
+
+	path := fmt.Sprintf("/tmp/%s", uuid.New().String())
+
+	if err := filestore.GetFile(a.Path, path); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if a.Kind == constants.ARTIFACT_KIND_DIRECTORY {
+		fileName += ".tar.gz"
+	}
+	ctx.Header("Content-Disposition", "attachment; filename="+fileName)
+	ctx.Header("Content-Type", "application/text/plain")
+	ctx.Header("Accept-Length", fmt.Sprintf("%d", len(data)))
+	ctx.Writer.Write(data)
+	ctx.Status(http.StatusOK)
+}
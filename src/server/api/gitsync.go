@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"scaffold/server/gitsync"
+	"scaffold/server/policy"
+	"scaffold/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@summary					Get git sync status
+//	@description				Get the repository, commit and outcome of the last git sync along with the sync status of each workflow
+//	@tags						manager
+//	@tags						sync
+//	@produce					json
+//	@success					200	{object}	gitsync.Summary
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/sync [get]
+func GetSyncStatus(ctx *gin.Context) {
+	s, err := gitsync.GetSummary()
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	statuses := make([]*gitsync.Status, 0)
+	for _, st := range s.Workflows {
+		if validatePermission(ctx, policy.VERB_VIEW, st.Workflow, "") {
+			statuses = append(statuses, st)
+		}
+	}
+	s.Workflows = statuses
+
+	ctx.JSON(http.StatusOK, s)
+}
+
+//	@summary					Get workflow sync status
+//	@description				Get the file, last commit and sync status of a workflow managed by git sync
+//	@tags						manager
+//	@tags						sync
+//	@produce					json
+//	@success					200	{object}	gitsync.Status
+//	@failure					500	{object}	object
+//	@failure					404	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/sync/{workflow_name} [get]
+func GetSyncStatusByWorkflow(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	s, err := gitsync.GetStatusByWorkflow(name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if s == nil {
+		utils.Error(fmt.Errorf("workflow %s is not managed by git sync", name), ctx, http.StatusNotFound)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, s)
+}
+
+//	@summary					Run git sync
+//	@description				Pull the configured repository and apply its workflows now instead of waiting for the next scheduled sync
+//	@tags						manager
+//	@tags						sync
+//	@produce					json
+//	@success					200	{object}	gitsync.Summary
+//	@failure					500	{object}	object
+//	@failure					400	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/sync [post]
+func TriggerSync(ctx *gin.Context) {
+	if !gitsync.Enabled() {
+		utils.Error(errors.New("no git sync repository is configured"), ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := gitsync.Sync(); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	s, err := gitsync.GetSummary()
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, s)
+}
@@ -2,13 +2,23 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 
-	"scaffold/server/config"
+	"scaffold/server/auth"
+	"scaffold/server/constants"
+	"scaffold/server/input"
+	"scaffold/server/namespace"
+	"scaffold/server/policy"
+	"scaffold/server/task"
+	"scaffold/server/template"
 	"scaffold/server/user"
 	"scaffold/server/utils"
+	"scaffold/server/workflow"
 
 	logger "github.com/jfcarter2358/go-logger"
 )
@@ -43,7 +53,7 @@ func validateUserGroup(ctx *gin.Context, groups []string) bool {
 		token = strings.Split(authString, " ")[1]
 
 		// Is the request coming from a node itself?
-		if token == config.Config.Node.PrimaryKey {
+		if auth.IsNodeKey(token) {
 			logger.Tracef("", "Primary key detected")
 			return true
 		}
@@ -69,3 +79,141 @@ func validateUserGroup(ctx *gin.Context, groups []string) bool {
 
 	return false
 }
+
+// Check whether whoever made a request may perform a verb on a workflow, or
+// on one of its tasks when a task name is given
+func validatePermission(ctx *gin.Context, verb, workflowName, taskName string) bool {
+	usr, t, isNode := auth.RequestUser(ctx)
+	if isNode {
+		return true
+	}
+	return policy.Allowed(usr, t, verb, workflowName, taskName)
+}
+
+// Get the username of whoever made a request. Requests from nodes using the
+// primary key are attributed to Scaffold itself
+func requestUsername(ctx *gin.Context) string {
+	usr, _, isNode := auth.RequestUser(ctx)
+	if isNode {
+		return constants.REVISION_AUTHOR_SCAFFOLD
+	}
+	if usr == nil {
+		return ""
+	}
+	return usr.Username
+}
+
+// Check whether a workflow is in the namespace a list request was limited to
+// with the namespace query parameter, if there is one
+func inNamespace(ctx *gin.Context, workflowName string) bool {
+	name := ctx.Query("namespace")
+	if name == "" {
+		return true
+	}
+	w, err := workflow.GetWorkflowByName(workflowName)
+	if err != nil {
+		logger.Errorf("", "Cannot get workflow %s to check its namespace: %s", workflowName, err.Error())
+		return false
+	}
+	return workflow.NamespaceOf(w) == name
+}
+
+// Check that a workflow can be stored in the namespace it names and that
+// whoever made the request may put workflows there, returning the status to
+// respond with if not
+func validateNamespace(ctx *gin.Context, w *workflow.Workflow) (int, error) {
+	n, err := namespace.CheckWorkflow(w)
+	if err != nil {
+		return inputErrorStatus(err), err
+	}
+	usr, _, isNode := auth.RequestUser(ctx)
+	if isNode || namespace.IsMember(usr, n) {
+		return http.StatusOK, nil
+	}
+	return http.StatusForbidden, fmt.Errorf("user is not a member of namespace %s", workflow.NamespaceOf(w))
+}
+
+// Check the tasks a workflow depends on in other workflows, and the workflows
+// whose files trigger its tasks, returning the status to respond with if it
+// may not refer to them. Their context is copied into the runs they start, so
+// they have to exist, be visible to whoever made the request, and be in a
+// namespace shared with the workflow's
+func validateReferences(ctx *gin.Context, w *workflow.Workflow) (int, error) {
+	if err := workflow.Qualify(w); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := workflow.Expand(w); err != nil {
+		return inputErrorStatus(err), err
+	}
+	for idx := range w.Tasks {
+		for _, dep := range task.Dependencies(&w.Tasks[idx]) {
+			wn, tn := task.SplitDependency(w.Name, dep)
+			if wn == w.Name {
+				continue
+			}
+			if status, err := validateReference(ctx, w, wn, tn); err != nil {
+				return status, fmt.Errorf("task %s cannot depend on %s: %s", w.Tasks[idx].Name, dep, err.Error())
+			}
+		}
+		source := w.Tasks[idx].Trigger.OnFile.Workflow
+		if source == "" {
+			continue
+		}
+		if wn := task.ResolveWorkflow(w.Name, source); wn != w.Name {
+			if status, err := validateReference(ctx, w, wn, ""); err != nil {
+				return status, fmt.Errorf("task %s cannot be triggered by files of %s: %s", w.Tasks[idx].Name, source, err.Error())
+			}
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// Check that workflow w may refer to workflow wn, or to its task tn when set
+func validateReference(ctx *gin.Context, w *workflow.Workflow, wn, tn string) (int, error) {
+	uw, err := workflow.GetWorkflowByName(wn)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if uw == nil {
+		return http.StatusBadRequest, fmt.Errorf("workflow %s does not exist", wn)
+	}
+	if tn != "" {
+		t, err := task.GetTaskByNames(wn, tn)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if t == nil {
+			return http.StatusBadRequest, fmt.Errorf("task %s/%s does not exist", wn, tn)
+		}
+	}
+	if !validatePermission(ctx, policy.VERB_VIEW, wn, tn) {
+		return http.StatusForbidden, fmt.Errorf("user cannot view workflow %s", wn)
+	}
+	if err := namespace.CheckReference(workflow.NamespaceOf(uw), workflow.NamespaceOf(w)); err != nil {
+		return inputErrorStatus(err), err
+	}
+	return http.StatusOK, nil
+}
+
+// Pick the status to respond with for an error from storing an object.
+// Invalid inputs, templates, policies and namespaces are the caller's fault,
+// anything else is a server error
+func inputErrorStatus(err error) int {
+	var ve *input.ValidationError
+	if errors.As(err, &ve) {
+		return http.StatusBadRequest
+	}
+	var te *template.ValidationError
+	if errors.As(err, &te) {
+		return http.StatusBadRequest
+	}
+	var pe *policy.ValidationError
+	if errors.As(err, &pe) {
+		return http.StatusBadRequest
+	}
+	var ne *namespace.ValidationError
+	if errors.As(err, &ne) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
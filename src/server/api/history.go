@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"scaffold/server/history"
 	"scaffold/server/utils"
@@ -28,6 +29,10 @@ func GetHistory(ctx *gin.Context) {
 		utils.Error(err, ctx, http.StatusInternalServerError)
 		return
 	}
+	if h == nil {
+		utils.Error(fmt.Errorf("no run found with ID %s", runID), ctx, http.StatusNotFound)
+		return
+	}
 
 	ctx.JSON(http.StatusOK, &h)
 }
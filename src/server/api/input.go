@@ -5,8 +5,8 @@ import (
 	"net/http"
 	"scaffold/server/input"
 	"scaffold/server/manager"
+	"scaffold/server/policy"
 	"scaffold/server/utils"
-	"scaffold/server/workflow"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -34,20 +34,15 @@ func CreateInput(ctx *gin.Context) {
 		return
 	}
 
-	c, err := workflow.GetWorkflowByName(i.Workflow)
-	if err != nil {
-		utils.Error(err, ctx, http.StatusNotFound)
-	}
-	if c.Groups != nil {
-		if !validateUserGroup(ctx, c.Groups) {
-			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
-		}
+	if !validatePermission(ctx, policy.VERB_EDIT, i.Workflow, "") {
+		utils.Error(errors.New("user is not allowed to edit this workflow"), ctx, http.StatusForbidden)
+		return
 	}
 
-	err = input.CreateInput(&i)
+	err := input.CreateInput(&i)
 
 	if err != nil {
-		utils.Error(err, ctx, http.StatusInternalServerError)
+		utils.Error(err, ctx, inputErrorStatus(err))
 		return
 	}
 
@@ -133,17 +128,9 @@ func GetAllInputs(ctx *gin.Context) {
 
 	inputsOut := make([]input.Input, 0)
 	for _, i := range inputs {
-		c, err := workflow.GetWorkflowByName(i.Workflow)
-		if err == nil {
-			continue
-		}
-		if c.Groups != nil {
-			if validateUserGroup(ctx, c.Groups) {
-				inputsOut = append(inputsOut, *i)
-			}
-			continue
+		if inNamespace(ctx, i.Workflow) && validatePermission(ctx, policy.VERB_VIEW, i.Workflow, "") {
+			inputsOut = append(inputsOut, *i)
 		}
-		inputsOut = append(inputsOut, *i)
 	}
 
 	ctx.JSON(http.StatusOK, inputsOut)
@@ -234,7 +221,7 @@ func UpdateInputByNames(ctx *gin.Context) {
 
 	err := input.UpdateInputByNames(cn, n, &i)
 	if err != nil {
-		utils.Error(err, ctx, http.StatusInternalServerError)
+		utils.Error(err, ctx, inputErrorStatus(err))
 		return
 	}
 
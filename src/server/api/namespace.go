@@ -0,0 +1,201 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"scaffold/server/auth"
+	"scaffold/server/constants"
+	"scaffold/server/namespace"
+	"scaffold/server/queue"
+	"scaffold/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fill in how many runs a namespace has going
+func withRunning(n *namespace.Namespace) (*namespace.Namespace, error) {
+	running, err := queue.CountNamespaceRuns(n.Name)
+	if err != nil {
+		return nil, err
+	}
+	n.Running = running
+	return n, nil
+}
+
+//	@summary					Create a namespace
+//	@description				Create a namespace from a JSON object
+//	@tags						manager
+//	@tags						namespace
+//	@accept						json
+//	@produce					json
+//	@Param						namespace	body		namespace.Namespace	true	"Namespace Data"
+//	@success					201			{object}	object
+//	@failure					500			{object}	object
+//	@failure					400			{object}	object
+//	@failure					401			{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/namespace [post]
+func CreateNamespace(ctx *gin.Context) {
+	var n namespace.Namespace
+	if err := ctx.ShouldBindJSON(&n); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := namespace.CreateNamespace(&n); err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Created"})
+}
+
+//	@summary					Delete a namespace
+//	@description				Delete a namespace by its name. Namespaces that still have workflows cannot be deleted
+//	@tags						manager
+//	@tags						namespace
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					400	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/namespace/{namespace_name} [delete]
+func DeleteNamespaceByName(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	if err := namespace.DeleteNamespaceByName(name); err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Get all namespaces
+//	@description				Get the namespaces the user can put workflows in, along with how many runs each has going
+//	@tags						manager
+//	@tags						namespace
+//	@produce					json
+//	@success					200	{array}		namespace.Namespace
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/namespace [get]
+func GetAllNamespaces(ctx *gin.Context) {
+	namespaces, err := namespace.GetAllNamespaces()
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	// The default namespace exists whether or not it has been configured
+	hasDefault := false
+	for _, n := range namespaces {
+		if n.Name == constants.NAMESPACE_DEFAULT {
+			hasDefault = true
+		}
+	}
+	if !hasDefault {
+		namespaces = append([]*namespace.Namespace{{Name: constants.NAMESPACE_DEFAULT, Groups: []string{}, Admins: []string{}}}, namespaces...)
+	}
+
+	usr, _, isNode := auth.RequestUser(ctx)
+	namespacesOut := make([]*namespace.Namespace, 0)
+	for _, n := range namespaces {
+		if !isNode && !namespace.IsMember(usr, n) {
+			continue
+		}
+		n, err := withRunning(n)
+		if err != nil {
+			utils.Error(err, ctx, http.StatusInternalServerError)
+			return
+		}
+		namespacesOut = append(namespacesOut, n)
+	}
+
+	ctx.JSON(http.StatusOK, namespacesOut)
+}
+
+//	@summary					Get a namespace
+//	@description				Get a namespace by its name, along with how many runs it has going
+//	@tags						manager
+//	@tags						namespace
+//	@produce					json
+//	@success					200	{object}	namespace.Namespace
+//	@failure					500	{object}	object
+//	@failure					404	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/namespace/{namespace_name} [get]
+func GetNamespaceByName(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	n, err := namespace.GetNamespaceByName(name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if n == nil && name == constants.NAMESPACE_DEFAULT {
+		n = &namespace.Namespace{Name: constants.NAMESPACE_DEFAULT, Groups: []string{}, Admins: []string{}}
+	}
+	usr, _, isNode := auth.RequestUser(ctx)
+	if n == nil || (!isNode && !namespace.IsMember(usr, n)) {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("Namespace %s does not exist", name)})
+		return
+	}
+
+	n, err = withRunning(n)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, *n)
+}
+
+//	@summary					Update a namespace
+//	@description				Create or replace a namespace from a JSON object
+//	@tags						manager
+//	@tags						namespace
+//	@accept						json
+//	@produce					json
+//	@Param						namespace	body		namespace.Namespace	true	"Namespace Data"
+//	@success					200			{object}	object
+//	@failure					500			{object}	object
+//	@failure					400			{object}	object
+//	@failure					401			{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/namespace/{namespace_name} [put]
+func UpdateNamespaceByName(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	var n namespace.Namespace
+	if err := ctx.ShouldBindJSON(&n); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := namespace.UpdateNamespaceByName(name, &n); err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
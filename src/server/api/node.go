@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"scaffold/server/auth"
+	"scaffold/server/utils"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@summary					Get all nodes
+//	@description				Get all workers currently joined to the manager
+//	@tags						manager
+//	@tags						node
+//	@produce					json
+//	@success					200	{array}		auth.NodeObject
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/node [get]
+func GetAllNodes(ctx *gin.Context) {
+	auth.NodeLock.RLock()
+	nodes := make([]auth.NodeObject, 0, len(auth.Nodes))
+	for _, n := range auth.Nodes {
+		nodes = append(nodes, n)
+	}
+	auth.NodeLock.RUnlock()
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	ctx.JSON(http.StatusOK, nodes)
+}
+
+//	@summary					Revoke a node
+//	@description				Remove a worker and its credential and stop it from joining again
+//	@tags						manager
+//	@tags						node
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/node/{node_name} [delete]
+func RevokeNode(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	if err := auth.RevokeNode(name, requestUsername(ctx)); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Get all revoked nodes
+//	@description				Get all workers which may not join the manager
+//	@tags						manager
+//	@tags						node
+//	@produce					json
+//	@success					200	{array}		auth.RevokedNode
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/node/revoked [get]
+func GetAllRevokedNodes(ctx *gin.Context) {
+	revoked, err := auth.GetAllRevokedNodes()
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if revoked == nil {
+		revoked = []*auth.RevokedNode{}
+	}
+
+	ctx.JSON(http.StatusOK, revoked)
+}
+
+//	@summary					Allow a revoked node to join
+//	@description				Remove the revocation of a worker so it can join the manager again
+//	@tags						manager
+//	@tags						node
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/node/revoked/{node_name} [delete]
+func DeleteRevokedNode(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	if err := auth.DeleteRevokedNodeByName(name); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"scaffold/server/policy"
+	"scaffold/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@summary					Create a policy
+//	@description				Create a policy granting verbs on workflows and tasks from a JSON object
+//	@tags						manager
+//	@tags						policy
+//	@accept						json
+//	@produce					json
+//	@Param						policy	body		policy.Policy	true	"Policy Data"
+//	@success					201			{object}	object
+//	@failure					500			{object}	object
+//	@failure					400			{object}	object
+//	@failure					401			{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/policy [post]
+func CreatePolicy(ctx *gin.Context) {
+	var p policy.Policy
+	if err := ctx.ShouldBindJSON(&p); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := policy.CreatePolicy(&p); err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Created"})
+}
+
+//	@summary					Delete a policy
+//	@description				Delete a policy by its name
+//	@tags						manager
+//	@tags						policy
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/policy/{policy_name} [delete]
+func DeletePolicyByName(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	if err := policy.DeletePolicyByName(name); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Get all policies
+//	@description				Get all policies
+//	@tags						manager
+//	@tags						policy
+//	@produce					json
+//	@success					200	{array}		policy.Policy
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/policy [get]
+func GetAllPolicies(ctx *gin.Context) {
+	policies, err := policy.GetAllPolicies()
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if policies == nil {
+		policies = make([]*policy.Policy, 0)
+	}
+
+	ctx.JSON(http.StatusOK, policies)
+}
+
+//	@summary					Get a policy
+//	@description				Get a policy by its name
+//	@tags						manager
+//	@tags						policy
+//	@produce					json
+//	@success					200	{object}	policy.Policy
+//	@failure					500	{object}	object
+//	@failure					404	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/policy/{policy_name} [get]
+func GetPolicyByName(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	p, err := policy.GetPolicyByName(name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if p == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("Policy %s does not exist", name)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, *p)
+}
+
+//	@summary					Update a policy
+//	@description				Create or replace a policy from a JSON object
+//	@tags						manager
+//	@tags						policy
+//	@accept						json
+//	@produce					json
+//	@Param						policy	body		policy.Policy	true	"Policy Data"
+//	@success					200			{object}	object
+//	@failure					500			{object}	object
+//	@failure					400			{object}	object
+//	@failure					401			{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/policy/{policy_name} [put]
+func UpdatePolicyByName(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	var p policy.Policy
+	if err := ctx.ShouldBindJSON(&p); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := policy.UpdatePolicyByName(name, &p); err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
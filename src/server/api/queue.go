@@ -0,0 +1,81 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"scaffold/server/policy"
+	"scaffold/server/queue"
+	"scaffold/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@summary					Get the run queue
+//	@description				Get the runs waiting for a concurrency slot and the runs holding one, in the order pending runs will start
+//	@tags						manager
+//	@tags						queue
+//	@produce					json
+//	@success					200	{array}		queue.Entry
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/queue [get]
+func GetQueue(ctx *gin.Context) {
+	entries, err := queue.GetAllEntries()
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	queue.Sort(entries)
+
+	entriesOut := make([]queue.Entry, 0)
+	for _, e := range entries {
+		if inNamespace(ctx, e.Workflow) && validatePermission(ctx, policy.VERB_VIEW, e.Workflow, e.Task) {
+			entriesOut = append(entriesOut, *e)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, entriesOut)
+}
+
+//	@summary					Remove a queued run
+//	@description				Take a run off the queue by its ID. Pending runs are dropped, and running ones give up their concurrency slot without being killed
+//	@tags						manager
+//	@tags						queue
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					404	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/queue/{id} [delete]
+func DeleteQueueEntryByID(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	e, err := queue.GetEntryByID(id)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if e == nil {
+		utils.Error(fmt.Errorf("no queued run found with id %s", id), ctx, http.StatusNotFound)
+		return
+	}
+	if !validatePermission(ctx, policy.VERB_KILL, e.Workflow, e.Task) {
+		utils.Error(fmt.Errorf("user is not allowed to kill runs of %s/%s", e.Workflow, e.Task), ctx, http.StatusForbidden)
+		return
+	}
+
+	if err := queue.Remove(id); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"scaffold/server/revision"
+	"scaffold/server/utils"
+	"scaffold/server/workflow"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@summary					Get workflow revisions
+//	@description				Get every applied revision of a workflow, oldest first
+//	@tags						manager
+//	@tags						workflow
+//	@produce					json
+//	@success					200	{array}		revision.Revision
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/workflow/{workflow_name}/revisions [get]
+func GetWorkflowRevisions(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	revisions, err := revision.GetRevisionsByWorkflow(name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if revisions == nil {
+		revisions = make([]*revision.Revision, 0)
+	}
+
+	ctx.JSON(http.StatusOK, revisions)
+}
+
+//	@summary					Get a workflow revision
+//	@description				Get a single revision of a workflow by its version
+//	@tags						manager
+//	@tags						workflow
+//	@produce					json
+//	@success					200	{object}	revision.Revision
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/workflow/{workflow_name}/revisions/{version} [get]
+func GetWorkflowRevision(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	r, status, err := lookupRevision(name, ctx.Param("version"))
+	if err != nil {
+		utils.Error(err, ctx, status)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, r)
+}
+
+//	@summary					Diff workflow revisions
+//	@description				Get a unified diff between two revisions of a workflow. Defaults to the latest revision and the one before it
+//	@tags						manager
+//	@tags						workflow
+//	@produce					plain
+//	@Param						from	query		int	false	"Revision to diff from"
+//	@Param						to		query		int	false	"Revision to diff to"
+//	@success					200		{string}	string
+//	@failure					500		{object}	object
+//	@failure					401		{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/workflow/{workflow_name}/diff [get]
+func DiffWorkflowRevisions(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	to, status, err := lookupRevision(name, ctx.Query("to"))
+	if err != nil {
+		utils.Error(err, ctx, status)
+		return
+	}
+
+	fromVersion := ctx.Query("from")
+	if fromVersion == "" {
+		fromVersion = strconv.Itoa(to.Version - 1)
+	}
+	from := &revision.Revision{Workflow: name}
+	if fromVersion != "0" {
+		from, status, err = lookupRevision(name, fromVersion)
+		if err != nil {
+			utils.Error(err, ctx, status)
+			return
+		}
+	}
+
+	diff := revision.UnifiedDiff(
+		fmt.Sprintf("%s@%d", name, from.Version),
+		fmt.Sprintf("%s@%d", name, to.Version),
+		from.Definition,
+		to.Definition,
+	)
+
+	ctx.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(diff))
+}
+
+//	@summary					Roll back a workflow
+//	@description				Re-apply an earlier revision of a workflow, recording it as a new revision
+//	@tags						manager
+//	@tags						workflow
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/workflow/{workflow_name}/rollback/{version} [post]
+func RollbackWorkflow(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	target, status, err := lookupRevision(name, ctx.Param("version"))
+	if err != nil {
+		utils.Error(err, ctx, status)
+		return
+	}
+
+	w, err := workflow.FromRevision(target)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	// Revisions from before namespaces existed do not name one, so the
+	// workflow stays where it is
+	if w.Namespace == "" {
+		current, err := workflow.GetWorkflowByName(name)
+		if err != nil {
+			utils.Error(err, ctx, http.StatusInternalServerError)
+			return
+		}
+		w.Namespace = workflow.NamespaceOf(current)
+	}
+	if status, err := validateNamespace(ctx, w); err != nil {
+		utils.Error(err, ctx, status)
+		return
+	}
+	if status, err := validateReferences(ctx, w); err != nil {
+		utils.Error(err, ctx, status)
+		return
+	}
+
+	if err := workflow.UpdateWorkflowByName(name, w); err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	r, err := workflow.RecordRevision(w, requestUsername(ctx), fmt.Sprintf("rollback to revision %d", target.Version))
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "revision": r.Version})
+}
+
+// Get a revision from its version as given in a request. An empty version is
+// the latest revision
+func lookupRevision(name, version string) (*revision.Revision, int, error) {
+	var r *revision.Revision
+	var err error
+	if version == "" {
+		r, err = revision.GetLatestRevision(name)
+	} else {
+		v, convErr := strconv.Atoi(version)
+		if convErr != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid revision %s", version)
+		}
+		r, err = revision.GetRevisionByVersion(name, v)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if r == nil {
+		if version == "" {
+			return nil, http.StatusNotFound, fmt.Errorf("workflow %s has no revisions", name)
+		}
+		return nil, http.StatusNotFound, fmt.Errorf("workflow %s has no revision %s", name, version)
+	}
+	return r, http.StatusOK, nil
+}
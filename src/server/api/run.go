@@ -3,17 +3,20 @@ package api
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"scaffold/server/constants"
 	"scaffold/server/history"
+	"scaffold/server/input"
 	"scaffold/server/manager"
 	"scaffold/server/msg"
-	"scaffold/server/rabbitmq"
+	"scaffold/server/queue"
 	"scaffold/server/run"
 	"scaffold/server/state"
 	"scaffold/server/task"
 	"scaffold/server/utils"
 	"scaffold/server/workflow"
+	"strconv"
 
 	"github.com/google/uuid"
 	logger "github.com/jfcarter2358/go-logger"
@@ -39,6 +42,10 @@ func ManagerKillRun(ctx *gin.Context) {
 	tn := ctx.Param("task")
 
 	logger.Infof("", "Triggering run kill for %s.%s", cn, tn)
+	if err := queue.Cancel(cn, tn); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
 	manager.DoKill(cn, tn)
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
@@ -93,9 +100,12 @@ func KillRun(ctx *gin.Context) {
 }
 
 //	@summary					Create a run
-//	@description				Create a run from a workflow and task
+//	@description				Create a run from a workflow and task. An optional JSON object of input overrides applies to this run only
 //	@tags						manager
 //	@tags						run
+//	@accept						json
+//	@Param						params	body		object	false	"Input overrides"
+//	@Param						priority	query		int		false	"Priority in the pending queue, defaults to the task's"
 //	@success					200	{object}	object
 //	@failure					500	{object}	object
 //	@failure					401	{object}	object
@@ -131,6 +141,25 @@ func CreateRun(ctx *gin.Context) {
 		return
 	}
 
+	var params map[string]string
+	if err := ctx.ShouldBindJSON(&params); err != nil && err != io.EOF {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+	if err := input.ValidateOverrides(c.Inputs, params); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	priority := t.Priority
+	if p, ok := ctx.GetQuery("priority"); ok {
+		priority, err = strconv.Atoi(p)
+		if err != nil {
+			utils.Error(fmt.Errorf("invalid priority %s", p), ctx, http.StatusBadRequest)
+			return
+		}
+	}
+
 	runID := uuid.New().String()
 
 	m := msg.TriggerMsg{
@@ -148,6 +177,10 @@ func CreateRun(ctx *gin.Context) {
 		States:   make([]state.State, 0),
 		Workflow: cn,
 	}
+	if err := history.SetParams(&h, params, c.Inputs); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
 
 	if err := history.CreateHistory(&h); err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
@@ -155,9 +188,13 @@ func CreateRun(ctx *gin.Context) {
 	}
 
 	logger.Infof("", "Creating run with message %v", m)
-	rabbitmq.ManagerPublish(m)
+	e, err := queue.Submit(m, priority)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "run_id": runID, "status": e.Status})
 }
 
 //	@summary					Get run status
@@ -179,14 +216,47 @@ func GetRunStatus(ctx *gin.Context) {
 		utils.Error(err, ctx, http.StatusInternalServerError)
 		return
 	}
+	if h == nil {
+		utils.Error(fmt.Errorf("no run found with ID %s", runID), ctx, http.StatusNotFound)
+		return
+	}
 	running := false
 	errored := false
 	waiting := false
 	killed := false
 	success := false
+	queued := false
+
+	entries, err := queue.GetEntriesByRunID(runID)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	t := ""
+	for _, e := range entries {
+		if e.Status == constants.QUEUE_STATUS_PENDING {
+			queued = true
+			t = e.Task
+		}
+	}
+
+	// A run still waiting for a slot in the pending queue has not reached a
+	// worker, so it has no state of its own to report yet
+	if queued || len(h.States) == 0 {
+		ctx.JSON(http.StatusOK, gin.H{
+			"running": running,
+			"errored": errored,
+			"waiting": true,
+			"killed":  killed,
+			"success": success,
+			"queued":  queued,
+			"task":    t,
+		})
+		return
+	}
 
 	s := h.States[len(h.States)-1]
-	t := s.Task
+	t = s.Task
 
 	ss, err := state.GetStateByNames(h.Workflow, t)
 	if err != nil {
@@ -203,7 +273,7 @@ func GetRunStatus(ctx *gin.Context) {
 		waiting = true
 	case constants.STATE_STATUS_KILLED:
 		killed = true
-	case constants.STATE_STATUS_SUCCESS:
+	case constants.STATE_STATUS_SUCCESS, constants.STATE_STATUS_CACHED:
 		success = true
 	}
 
@@ -213,6 +283,7 @@ func GetRunStatus(ctx *gin.Context) {
 		"waiting": waiting,
 		"killed":  killed,
 		"success": success,
+		"queued":  queued,
 		"task":    t,
 	})
 }
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"scaffold/server/secret"
+	"scaffold/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@summary					Create a secret
+//	@description				Create an encrypted secret for a workflow. The value is never returned again
+//	@tags						manager
+//	@tags						secret
+//	@accept						json
+//	@produce					json
+//	@Param						secret	body		secret.Secret	true	"Secret Data"
+//	@success					201		{object}	object
+//	@failure					500		{object}	object
+//	@failure					401		{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/secret/{workflow_name} [post]
+func CreateSecret(ctx *gin.Context) {
+	var s secret.Secret
+	if err := ctx.ShouldBindJSON(&s); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+	if s.Name == "" {
+		utils.Error(fmt.Errorf("secret name is required"), ctx, http.StatusBadRequest)
+		return
+	}
+	s.Workflow = ctx.Param("workflow")
+
+	if err := secret.CreateSecret(&s); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Created"})
+}
+
+//	@summary					Delete a secret
+//	@description				Delete a secret by its workflow and name
+//	@tags						manager
+//	@tags						secret
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/secret/{workflow_name}/{secret_name} [delete]
+func DeleteSecretByNames(ctx *gin.Context) {
+	workflowName := ctx.Param("workflow")
+	name := ctx.Param("name")
+
+	if err := secret.DeleteSecretByNames(workflowName, name); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Get secrets
+//	@description				Get the names of all secrets for a workflow. Values are not returned
+//	@tags						manager
+//	@tags						secret
+//	@produce					json
+//	@success					200	{array}		secret.Secret
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/secret/{workflow_name} [get]
+func GetSecretsByWorkflow(ctx *gin.Context) {
+	workflowName := ctx.Param("workflow")
+
+	secrets, err := secret.GetSecretsByWorkflow(workflowName)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if secrets == nil {
+		secrets = make([]*secret.Secret, 0)
+	}
+
+	ctx.JSON(http.StatusOK, secrets)
+}
+
+//	@summary					Get a secret
+//	@description				Get a secret's metadata by its workflow and name. The value is not returned
+//	@tags						manager
+//	@tags						secret
+//	@produce					json
+//	@success					200	{object}	secret.Secret
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/secret/{workflow_name}/{secret_name} [get]
+func GetSecretByNames(ctx *gin.Context) {
+	workflowName := ctx.Param("workflow")
+	name := ctx.Param("name")
+
+	s, err := secret.GetSecretByNames(workflowName, name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if s == nil {
+		utils.Error(fmt.Errorf("no secret found with names %s, %s", workflowName, name), ctx, http.StatusNotFound)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, s)
+}
+
+//	@summary					Update a secret
+//	@description				Set the value of a secret, creating it if it does not exist
+//	@tags						manager
+//	@tags						secret
+//	@accept						json
+//	@produce					json
+//	@Param						secret	body		secret.Secret	true	"Secret Data"
+//	@success					200		{object}	object
+//	@failure					500		{object}	object
+//	@failure					401		{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/secret/{workflow_name}/{secret_name} [put]
+func UpdateSecretByNames(ctx *gin.Context) {
+	workflowName := ctx.Param("workflow")
+	name := ctx.Param("name")
+
+	var s secret.Secret
+	if err := ctx.ShouldBindJSON(&s); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := secret.UpdateSecretByNames(workflowName, name, &s); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
@@ -4,9 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"scaffold/server/policy"
 	"scaffold/server/state"
 	"scaffold/server/utils"
-	"scaffold/server/workflow"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -34,17 +34,12 @@ func CreateState(ctx *gin.Context) {
 		return
 	}
 
-	c, err := workflow.GetWorkflowByName(s.Workflow)
-	if err != nil {
-		utils.Error(err, ctx, http.StatusNotFound)
-	}
-	if c.Groups != nil {
-		if !validateUserGroup(ctx, c.Groups) {
-			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
-		}
+	if !validatePermission(ctx, policy.VERB_EDIT, s.Workflow, "") {
+		utils.Error(errors.New("user is not allowed to edit this workflow"), ctx, http.StatusForbidden)
+		return
 	}
 
-	err = state.CreateState(&s)
+	err := state.CreateState(&s)
 
 	if err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
@@ -134,17 +129,9 @@ func GetAllStates(ctx *gin.Context) {
 
 	statesOut := make([]state.State, 0)
 	for _, s := range states {
-		c, err := workflow.GetWorkflowByName(s.Workflow)
-		if err != nil {
-			continue
-		}
-		if c.Groups != nil {
-			if validateUserGroup(ctx, c.Groups) {
-				statesOut = append(statesOut, *s)
-			}
-			continue
+		if inNamespace(ctx, s.Workflow) && validatePermission(ctx, policy.VERB_VIEW, s.Workflow, s.Task) {
+			statesOut = append(statesOut, *s)
 		}
-		statesOut = append(statesOut, *s)
 	}
 
 	ctx.JSON(http.StatusOK, statesOut)
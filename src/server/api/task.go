@@ -4,10 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"scaffold/server/policy"
 	"scaffold/server/state"
 	"scaffold/server/task"
 	"scaffold/server/utils"
-	"scaffold/server/workflow"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -35,17 +35,12 @@ func CreateTask(ctx *gin.Context) {
 		return
 	}
 
-	c, err := workflow.GetWorkflowByName(t.Workflow)
-	if err != nil {
-		utils.Error(err, ctx, http.StatusNotFound)
-	}
-	if c.Groups != nil {
-		if !validateUserGroup(ctx, c.Groups) {
-			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
-		}
+	if !validatePermission(ctx, policy.VERB_EDIT, t.Workflow, "") {
+		utils.Error(errors.New("user is not allowed to edit this workflow"), ctx, http.StatusForbidden)
+		return
 	}
 
-	err = task.CreateTask(&t)
+	err := task.CreateTask(&t)
 
 	if err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
@@ -135,17 +130,9 @@ func GetAllTasks(ctx *gin.Context) {
 
 	tasksOut := make([]task.Task, 0)
 	for _, t := range tasks {
-		c, err := workflow.GetWorkflowByName(t.Workflow)
-		if err != nil {
-			continue
-		}
-		if c.Groups != nil {
-			if validateUserGroup(ctx, c.Groups) {
-				tasksOut = append(tasksOut, *t)
-			}
-			continue
+		if inNamespace(ctx, t.Workflow) && validatePermission(ctx, policy.VERB_VIEW, t.Workflow, t.Name) {
+			tasksOut = append(tasksOut, *t)
 		}
-		tasksOut = append(tasksOut, *t)
 	}
 
 	ctx.JSON(http.StatusOK, tasksOut)
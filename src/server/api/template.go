@@ -0,0 +1,156 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"scaffold/server/template"
+	"scaffold/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+//	@summary					Create a template
+//	@description				Create a template of reusable tasks and inputs from a JSON object
+//	@tags						manager
+//	@tags						template
+//	@accept						json
+//	@produce					json
+//	@Param						template	body		template.Template	true	"Template Data"
+//	@success					201			{object}	object
+//	@failure					500			{object}	object
+//	@failure					400			{object}	object
+//	@failure					401			{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/template [post]
+func CreateTemplate(ctx *gin.Context) {
+	var t template.Template
+	if err := ctx.ShouldBindJSON(&t); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := template.CreateTemplate(&t); err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Created"})
+}
+
+//	@summary					Delete a template
+//	@description				Delete a template by its name. Workflows already expanded from it are not changed
+//	@tags						manager
+//	@tags						template
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/template/{template_name} [delete]
+func DeleteTemplateByName(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	if err := template.DeleteTemplateByName(name); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Get all templates
+//	@description				Get all templates
+//	@tags						manager
+//	@tags						template
+//	@produce					json
+//	@success					200	{array}		template.Template
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/template [get]
+func GetAllTemplates(ctx *gin.Context) {
+	templates, err := template.GetAllTemplates()
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if templates == nil {
+		templates = make([]*template.Template, 0)
+	}
+
+	ctx.JSON(http.StatusOK, templates)
+}
+
+//	@summary					Get a template
+//	@description				Get a template by its name
+//	@tags						manager
+//	@tags						template
+//	@produce					json
+//	@success					200	{object}	template.Template
+//	@failure					500	{object}	object
+//	@failure					404	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/template/{template_name} [get]
+func GetTemplateByName(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	t, err := template.GetTemplateByName(name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if t == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("Template %s does not exist", name)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, *t)
+}
+
+//	@summary					Update a template
+//	@description				Create or replace a template from a JSON object. Workflows pick up the change the next time they are applied
+//	@tags						manager
+//	@tags						template
+//	@accept						json
+//	@produce					json
+//	@Param						template	body		template.Template	true	"Template Data"
+//	@success					200			{object}	object
+//	@failure					500			{object}	object
+//	@failure					400			{object}	object
+//	@failure					401			{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/template/{template_name} [put]
+func UpdateTemplateByName(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	var t template.Template
+	if err := ctx.ShouldBindJSON(&t); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := template.UpdateTemplateByName(name, &t); err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
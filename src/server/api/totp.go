@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"scaffold/server/config"
+	"scaffold/server/user"
+	"scaffold/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A code from an authenticator app, or a recovery code where one is accepted
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+//	@summary					Start two-factor setup
+//	@description				Generate a secret and recovery codes for a user to add to their authenticator app. Two-factor authentication is turned on once a code from it is confirmed
+//	@tags						manager
+//	@tags						user
+//	@produce					json
+//	@success					201	{object}	user.TOTPEnrollment
+//	@failure					500	{object}	object
+//	@failure					400	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/auth/totp/{username} [post]
+func BeginTOTPEnrollment(ctx *gin.Context) {
+	username := ctx.Param("username")
+
+	e, err := user.BeginTOTPEnrollment(username)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, e)
+}
+
+//	@summary					Confirm two-factor setup
+//	@description				Turn on two-factor authentication for a user with a code from the secret they were given
+//	@tags						manager
+//	@tags						user
+//	@accept						json
+//	@produce					json
+//	@Param						code	body		TOTPCodeRequest	true	"Code"
+//	@success					200	{object}	object
+//	@failure					400	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/auth/totp/{username} [put]
+func EnableTOTP(ctx *gin.Context) {
+	username := ctx.Param("username")
+
+	var req TOTPCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := user.EnableTOTP(username, req.Code); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Turn off two-factor authentication
+//	@description				Turn off two-factor authentication for a user with a code from their authenticator app or a recovery code. Not allowed when two-factor authentication is required
+//	@tags						manager
+//	@tags						user
+//	@accept						json
+//	@produce					json
+//	@Param						code	body		TOTPCodeRequest	true	"Code"
+//	@success					200	{object}	object
+//	@failure					400	{object}	object
+//	@failure					403	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/auth/totp/{username}/disable [post]
+func DisableTOTP(ctx *gin.Context) {
+	username := ctx.Param("username")
+
+	if config.Config.TOTP.Required {
+		utils.Error(errors.New("two-factor authentication is required"), ctx, http.StatusForbidden)
+		return
+	}
+
+	var req TOTPCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	u, err := user.GetUserByUsername(username)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if u == nil {
+		utils.Error(fmt.Errorf("no user found with username %s", username), ctx, http.StatusNotFound)
+		return
+	}
+	valid, err := user.VerifyTOTP(u, req.Code)
+	if err != nil || !valid {
+		utils.Error(errors.New("invalid two-factor code"), ctx, http.StatusBadRequest)
+		return
+	}
+
+	if err := user.ResetTOTP(username); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Reset two-factor authentication
+//	@description				Remove a user's second factor, such as when they have lost it. They set up a new one the next time they log in if two-factor authentication is required
+//	@tags						manager
+//	@tags						user
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/auth/totp/{username} [delete]
+func ResetTOTP(ctx *gin.Context) {
+	username := ctx.Param("username")
+
+	if err := user.ResetTOTP(username); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
@@ -167,7 +167,8 @@ func UpdateUserByUsername(ctx *gin.Context) {
 	uu.Groups = u.Groups
 	uu.Roles = u.Roles
 
-	if uu.Password != u.Password {
+	passwordChanged := !uu.ServiceAccount && uu.Password != u.Password
+	if passwordChanged {
 		uu.Password, err = user.HashAndSalt([]byte(u.Password))
 		if err != nil {
 			utils.Error(err, ctx, http.StatusInternalServerError)
@@ -181,5 +182,13 @@ func UpdateUserByUsername(ctx *gin.Context) {
 		return
 	}
 
+	// A new password logs the user out everywhere
+	if passwordChanged {
+		if err := user.DeleteSessionsByUsername(username); err != nil {
+			utils.Error(err, ctx, http.StatusInternalServerError)
+			return
+		}
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
 }
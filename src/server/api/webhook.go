@@ -4,13 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"scaffold/server/config"
 	"scaffold/server/constants"
 	"scaffold/server/history"
+	"scaffold/server/input"
 	"scaffold/server/msg"
-	"scaffold/server/rabbitmq"
+	"scaffold/server/policy"
+	"scaffold/server/queue"
 	"scaffold/server/state"
 	"scaffold/server/task"
 	"scaffold/server/utils"
+	"scaffold/server/webhook"
 	"scaffold/server/workflow"
 
 	"github.com/gin-gonic/gin"
@@ -48,11 +52,22 @@ func TriggerWebhookByID(ctx *gin.Context) {
 		return
 	}
 
-	if w.Groups != nil {
-		if !validateUserGroup(ctx, w.Groups) {
-			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
+	if !validatePermission(ctx, policy.VERB_TRIGGER, wName, tName) {
+		utils.Error(errors.New("user is not allowed to trigger this task"), ctx, http.StatusForbidden)
+		return
+	}
+
+	// Payload values named after an input override it for this run only
+	params := map[string]string{}
+	for _, i := range w.Inputs {
+		if val, ok := data[i.Name]; ok {
+			params[i.Name] = val
 		}
 	}
+	if err := input.ValidateOverrides(w.Inputs, params); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
 
 	t, err := task.GetTaskByNames(wName, tName)
 	if err != nil {
@@ -82,6 +97,10 @@ func TriggerWebhookByID(ctx *gin.Context) {
 		States:   make([]state.State, 0),
 		Workflow: wName,
 	}
+	if err := history.SetParams(&h, params, w.Inputs); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
 
 	if err := history.CreateHistory(&h); err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
@@ -89,7 +108,369 @@ func TriggerWebhookByID(ctx *gin.Context) {
 	}
 
 	logger.Infof("", "Creating run with message %v", m)
-	rabbitmq.ManagerPublish(m)
+	e, err := queue.Submit(m, t.Priority)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "run_id": runID, "status": e.Status})
+}
+
+//	@summary					Create a signed webhook
+//	@description				Create a webhook that triggers a task when called with a valid signature. The response holds the webhook's secret, which is never returned again
+//	@tags						manager
+//	@tags						webhook
+//	@accept						json
+//	@produce					json
+//	@Param						webhook	body		webhook.Webhook	true	"Webhook Data"
+//	@success					201		{object}	object
+//	@failure					500		{object}	object
+//	@failure					400		{object}	object
+//	@failure					401		{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/webhook/{workflow_name} [post]
+func CreateWebhook(ctx *gin.Context) {
+	var h webhook.Webhook
+	if err := ctx.ShouldBindJSON(&h); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+	h.Workflow = ctx.Param("workflow")
+
+	if err := webhook.Validate(&h); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+	if err := webhook.CreateWebhook(&h); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Created", "id": h.ID, "secret": h.Secret, "url": webhookURL(&h)})
+}
+
+func webhookURL(h *webhook.Webhook) string {
+	return fmt.Sprintf("%s/api/v1/hook/%s", config.Config.BaseURL, h.ID)
+}
+
+//	@summary					Delete a signed webhook
+//	@description				Delete a webhook and its delivery log by its workflow and name
+//	@tags						manager
+//	@tags						webhook
+//	@produce					json
+//	@success					200	{object}	object
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/webhook/{workflow_name}/{webhook_name} [delete]
+func DeleteWebhookByNames(ctx *gin.Context) {
+	workflowName := ctx.Param("workflow")
+	name := ctx.Param("name")
+
+	if err := webhook.DeleteWebhookByNames(workflowName, name); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+//	@summary					Get signed webhooks
+//	@description				Get all webhooks of a workflow. Secrets are not returned
+//	@tags						manager
+//	@tags						webhook
+//	@produce					json
+//	@success					200	{array}		webhook.Webhook
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/webhook/{workflow_name} [get]
+func GetWebhooksByWorkflow(ctx *gin.Context) {
+	workflowName := ctx.Param("workflow")
+
+	webhooks, err := webhook.GetWebhooksByWorkflow(workflowName)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if webhooks == nil {
+		webhooks = make([]*webhook.Webhook, 0)
+	}
+
+	ctx.JSON(http.StatusOK, webhooks)
+}
+
+//	@summary					Get a signed webhook
+//	@description				Get a webhook by its workflow and name. The secret is not returned
+//	@tags						manager
+//	@tags						webhook
+//	@produce					json
+//	@success					200	{object}	webhook.Webhook
+//	@failure					500	{object}	object
+//	@failure					404	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/webhook/{workflow_name}/{webhook_name} [get]
+func GetWebhookByNames(ctx *gin.Context) {
+	workflowName := ctx.Param("workflow")
+	name := ctx.Param("name")
+
+	h, err := webhook.GetWebhookByNames(workflowName, name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if h == nil {
+		utils.Error(fmt.Errorf("no webhook found with names %s, %s", workflowName, name), ctx, http.StatusNotFound)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, h)
+}
+
+//	@summary					Update a signed webhook
+//	@description				Replace a webhook's settings, creating it if it does not exist. The secret is only changed when one is given
+//	@tags						manager
+//	@tags						webhook
+//	@accept						json
+//	@produce					json
+//	@Param						webhook	body		webhook.Webhook	true	"Webhook Data"
+//	@success					200		{object}	object
+//	@failure					500		{object}	object
+//	@failure					400		{object}	object
+//	@failure					401		{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/webhook/{workflow_name}/{webhook_name} [put]
+func UpdateWebhookByNames(ctx *gin.Context) {
+	workflowName := ctx.Param("workflow")
+	name := ctx.Param("name")
+
+	var h webhook.Webhook
+	if err := ctx.ShouldBindJSON(&h); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+	h.Workflow = workflowName
+	h.Name = name
+
+	if err := webhook.Validate(&h); err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+	if err := webhook.UpdateWebhookByNames(workflowName, name, &h); err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "id": h.ID, "secret": h.Secret, "url": webhookURL(&h)})
+}
+
+//	@summary					Get webhook deliveries
+//	@description				Get the most recent calls received by a webhook, newest first
+//	@tags						manager
+//	@tags						webhook
+//	@produce					json
+//	@success					200	{array}		webhook.Delivery
+//	@failure					500	{object}	object
+//	@failure					401	{object}	object
+//	@securityDefinitions.apiKey	token
+//	@in							header
+//	@name						Authorization
+//	@security					X-Scaffold-API
+//	@router						/api/v1/webhook/{workflow_name}/{webhook_name}/deliveries [get]
+func GetWebhookDeliveries(ctx *gin.Context) {
+	workflowName := ctx.Param("workflow")
+	name := ctx.Param("name")
+
+	deliveries, err := webhook.GetDeliveriesByNames(workflowName, name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = make([]*webhook.Delivery, 0)
+	}
+
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+//	@summary					Receive a signed webhook call
+//	@description				Trigger a webhook's task from an external service. The request is authenticated by its signature or token instead of a user, filtered, and mapped into the run context. Every call is recorded in the webhook's delivery log
+//	@tags						manager
+//	@tags						webhook
+//	@accept						json
+//	@produce					json
+//	@Param						data	body		object	false	"Payload"
+//	@success					200		{object}	object
+//	@failure					500		{object}	object
+//	@failure					404		{object}	object
+//	@failure					400		{object}	object
+//	@failure					401		{object}	object
+//	@router						/api/v1/hook/{webhook_id} [post]
+func ReceiveWebhook(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	h, err := webhook.GetWebhookByID(id)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if h == nil {
+		utils.Error(fmt.Errorf("no webhook found with id %s", id), ctx, http.StatusNotFound)
+		return
+	}
+
+	body, err := ctx.GetRawData()
+	if err != nil {
+		utils.Error(err, ctx, http.StatusBadRequest)
+		return
+	}
+
+	d := webhook.Delivery{
+		Webhook:  h.Name,
+		Workflow: h.Workflow,
+		Event:    deliveryEvent(ctx.Request.Header),
+		Payload:  string(body),
+	}
+	fail := func(status string, err error, code int) {
+		d.Status = status
+		d.Reason = err.Error()
+		if err := webhook.RecordDelivery(&d); err != nil {
+			logger.Errorf("", "Cannot record delivery of webhook %s/%s: %s", h.Workflow, h.Name, err.Error())
+		}
+		utils.Error(err, ctx, code)
+	}
+
+	if err := webhook.VerifyRequest(h, ctx.Request.Header, body); err != nil {
+		// Unverified payloads are not kept
+		d.Payload = ""
+		fail(constants.WEBHOOK_DELIVERY_REJECTED, err, http.StatusUnauthorized)
+		return
+	}
+
+	payload, err := webhook.Decode(body)
+	if err != nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, err, http.StatusBadRequest)
+		return
+	}
+	failed, err := webhook.Filter(h, payload)
+	if err != nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, err, http.StatusBadRequest)
+		return
+	}
+	if failed != "" {
+		d.Status = constants.WEBHOOK_DELIVERY_FILTERED
+		d.Reason = fmt.Sprintf("filter %s did not match", failed)
+		if err := webhook.RecordDelivery(&d); err != nil {
+			logger.Errorf("", "Cannot record delivery of webhook %s/%s: %s", h.Workflow, h.Name, err.Error())
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "Filtered", "filter": failed})
+		return
+	}
+	data, err := webhook.Map(h, payload)
+	if err != nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, err, http.StatusBadRequest)
+		return
+	}
+
+	w, err := workflow.GetWorkflowByName(h.Workflow)
+	if err != nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, err, http.StatusInternalServerError)
+		return
+	}
+	t, err := task.GetTaskByNames(h.Workflow, h.Task)
+	if err != nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, err, http.StatusInternalServerError)
+		return
+	}
+	if w == nil || t == nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, fmt.Errorf("task %s/%s does not exist", h.Workflow, h.Task), http.StatusNotFound)
+		return
+	}
+	webhook.SetContext(&d, data, w.Inputs)
+	if t.Disabled {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, fmt.Errorf("task %s is disabled", t.Name), http.StatusServiceUnavailable)
+		return
+	}
+
+	// Mapped values named after an input override it for this run only
+	params := map[string]string{}
+	for _, i := range w.Inputs {
+		if val, ok := data[i.Name]; ok {
+			params[i.Name] = val
+		}
+	}
+	if err := input.ValidateOverrides(w.Inputs, params); err != nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, err, http.StatusBadRequest)
+		return
+	}
+
+	runID := uuid.New().String()
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "run_id": runID})
+	m := msg.TriggerMsg{
+		Task:     h.Task,
+		Workflow: h.Workflow,
+		Action:   constants.ACTION_TRIGGER,
+		Groups:   w.Groups,
+		Number:   t.RunNumber + 1,
+		RunID:    runID,
+		Context:  data,
+	}
+
+	hist := history.History{
+		RunID:    runID,
+		States:   make([]state.State, 0),
+		Workflow: h.Workflow,
+	}
+	if err := history.SetParams(&hist, params, w.Inputs); err != nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, err, http.StatusInternalServerError)
+		return
+	}
+	if err := history.CreateHistory(&hist); err != nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, err, http.StatusInternalServerError)
+		return
+	}
+
+	logger.Infof("", "Creating run from webhook %s/%s with message %v", h.Workflow, h.Name, m)
+	e, err := queue.Submit(m, t.Priority)
+	if err != nil {
+		fail(constants.WEBHOOK_DELIVERY_ERROR, err, http.StatusInternalServerError)
+		return
+	}
+
+	d.Status = constants.WEBHOOK_DELIVERY_TRIGGERED
+	d.RunID = runID
+	if err := webhook.RecordDelivery(&d); err != nil {
+		logger.Errorf("", "Cannot record delivery of webhook %s/%s: %s", h.Workflow, h.Name, err.Error())
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "run_id": runID, "status": e.Status})
+}
+
+// Get the event type sent by GitHub, GitLab, or Gitea style services
+func deliveryEvent(headers http.Header) string {
+	for _, name := range []string{"X-GitHub-Event", "X-Gitlab-Event", "X-Gitea-Event"} {
+		if val := headers.Get(name); val != "" {
+			return val
+		}
+	}
+	return ""
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"scaffold/server/policy"
 	"scaffold/server/utils"
 	"scaffold/server/workflow"
 
@@ -36,17 +37,33 @@ func CreateWorkflow(ctx *gin.Context) {
 	if c.Groups != nil {
 		if !validateUserGroup(ctx, c.Groups) {
 			utils.Error(errors.New("user is not part of required groups to access this resources"), ctx, http.StatusForbidden)
+			return
 		}
 	}
 
+	if status, err := validateNamespace(ctx, &c); err != nil {
+		utils.Error(err, ctx, status)
+		return
+	}
+	if status, err := validateReferences(ctx, &c); err != nil {
+		utils.Error(err, ctx, status)
+		return
+	}
+
 	err := workflow.CreateWorkflow(&c)
 
+	if err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	r, err := workflow.RecordRevision(&c, requestUsername(ctx), "")
 	if err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{"message": "Created"})
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Created", "revision": r.Version})
 }
 
 //	@summary					Delete a workflow
@@ -104,13 +121,9 @@ func GetAllWorkflows(ctx *gin.Context) {
 	// weirdly (I think at least)
 	workflowsOut := make([]workflow.Workflow, 0)
 	for _, c := range workflows {
-		if c.Groups != nil {
-			if validateUserGroup(ctx, c.Groups) {
-				workflowsOut = append(workflowsOut, *c)
-			}
-			continue
+		if inNamespace(ctx, c.Name) && validatePermission(ctx, policy.VERB_VIEW, c.Name, "") {
+			workflowsOut = append(workflowsOut, *c)
 		}
-		workflowsOut = append(workflowsOut, *c)
 	}
 
 	ctx.JSON(http.StatusOK, workflowsOut)
@@ -171,11 +184,26 @@ func UpdateWorkflowByName(ctx *gin.Context) {
 		return
 	}
 
+	if status, err := validateNamespace(ctx, &c); err != nil {
+		utils.Error(err, ctx, status)
+		return
+	}
+	if status, err := validateReferences(ctx, &c); err != nil {
+		utils.Error(err, ctx, status)
+		return
+	}
+
 	err := workflow.UpdateWorkflowByName(name, &c)
+	if err != nil {
+		utils.Error(err, ctx, inputErrorStatus(err))
+		return
+	}
+
+	r, err := workflow.RecordRevision(&c, requestUsername(ctx), "")
 	if err != nil {
 		utils.Error(err, ctx, http.StatusInternalServerError)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "revision": r.Version})
 }
@@ -0,0 +1,497 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"scaffold/server/filestore"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	logger "github.com/jfcarter2358/go-logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"scaffold/server/mongodb"
+)
+
+const RUN_REF_PREFIX = "run:"
+const MAPPING_SEPARATOR = "->"
+
+// How many versions a store tries to claim before giving up when other stores
+// of the same file keep taking them first
+const STORE_ATTEMPTS = 5
+
+type Artifact struct {
+	Workflow string `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Name     string `json:"name" bson:"name" yaml:"name"`
+	Version  int    `json:"version" bson:"version" yaml:"version"`
+	RunID    string `json:"run_id" bson:"run_id" yaml:"run_id"`
+	Task     string `json:"task" bson:"task" yaml:"task"`
+	Checksum string `json:"checksum" bson:"checksum" yaml:"checksum"`
+	Size     int64  `json:"size" bson:"size" yaml:"size"`
+	Path     string `json:"path" bson:"path" yaml:"path"`
+	Kind     string `json:"kind" bson:"kind" yaml:"kind"`
+	Created  string `json:"created" bson:"created" yaml:"created"`
+}
+
+// A reference to a stored file as written in a task's `load.file` list. The
+// reference is either a bare file name (latest version), `name@<version>`, or
+// `name@run:<run ID>` (latest version produced by that run)
+type Ref struct {
+	Name    string
+	Version int
+	RunID   string
+}
+
+// Split a `store.file` or `load.file` entry of the form `<source> -> <destination>`
+// into its parts. The destination is empty when no mapping is given
+func SplitMapping(entry string) (string, string) {
+	src, dest, found := strings.Cut(entry, MAPPING_SEPARATOR)
+	src = strings.TrimSpace(src)
+	if !found {
+		return src, ""
+	}
+	return src, strings.TrimSpace(dest)
+}
+
+func IsGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// Clean the name a file is stored under or loaded by. Names are relative to
+// the workflow's files, so absolute names and names that climb out of them
+// with `..` are refused. A trailing slash is dropped so `dist/` names the
+// stored `dist` directory
+func CleanName(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("invalid file name %s, names must be relative to the workflow", name)
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." {
+		return "", fmt.Errorf("invalid file name %s", name)
+	}
+	for _, part := range strings.Split(cleaned, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("invalid file name %s, names cannot contain ..", name)
+		}
+	}
+	return cleaned, nil
+}
+
+func ParseRef(ref string) (Ref, error) {
+	name, pin, found := strings.Cut(ref, "@")
+	r := Ref{Name: name}
+	if name == "" {
+		return r, fmt.Errorf("invalid file reference %s", ref)
+	}
+	cleaned, err := CleanName(name)
+	if err != nil {
+		return r, fmt.Errorf("invalid file reference %s: %s", ref, err.Error())
+	}
+	r.Name = cleaned
+	if !found {
+		return r, nil
+	}
+	if strings.HasPrefix(pin, RUN_REF_PREFIX) {
+		r.RunID = strings.TrimPrefix(pin, RUN_REF_PREFIX)
+		if r.RunID == "" {
+			return r, fmt.Errorf("invalid file reference %s, run ID is empty", ref)
+		}
+		return r, nil
+	}
+	version, err := strconv.Atoi(pin)
+	if err != nil || version < 1 {
+		return r, fmt.Errorf("invalid file reference %s, version must be a positive integer or run:<run ID>", ref)
+	}
+	r.Version = version
+	return r, nil
+}
+
+// Filestore path a specific artifact version is stored at
+func VersionPath(workflow, name, runID string, version int) string {
+	if runID == "" {
+		runID = "upload"
+	}
+	return fmt.Sprintf("%s/%s/%s/%d/%s", constants.FILESTORE_VERSION_PREFIX, workflow, name, version, runID)
+}
+
+func IsVersionPath(path string) bool {
+	return strings.HasPrefix(path, constants.FILESTORE_VERSION_PREFIX+"/")
+}
+
+func Checksum(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// Record a new version of a file, then upload it to the filestore as that
+// immutable version and as the latest copy at `<workflow>/<name>`.
+// Directories are stored as a gzipped tarball of their contents
+func Store(localPath, workflow, name, runID, task string) (*Artifact, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return nil, err
+	}
+	kind := constants.ARTIFACT_KIND_FILE
+	if info.IsDir() {
+		kind = constants.ARTIFACT_KIND_DIRECTORY
+		archive, err := os.CreateTemp("", "scaffold-artifact-*.tar.gz")
+		if err != nil {
+			return nil, err
+		}
+		archive.Close()
+		defer os.Remove(archive.Name())
+		if err := TarDir(localPath, archive.Name()); err != nil {
+			return nil, err
+		}
+		localPath = archive.Name()
+	}
+
+	checksum, size, err := Checksum(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The version is claimed by inserting its metadata before anything is
+	// uploaded. Versions are unique per file, so a store racing another for
+	// the same version gets a duplicate key error and tries the next one
+	var a *Artifact
+	for attempt := 1; ; attempt++ {
+		latest, err := GetLatestArtifact(workflow, name)
+		if err != nil {
+			return nil, err
+		}
+		version := 1
+		if latest != nil {
+			version = latest.Version + 1
+		}
+
+		a = &Artifact{
+			Workflow: workflow,
+			Name:     name,
+			Version:  version,
+			RunID:    runID,
+			Task:     task,
+			Checksum: checksum,
+			Size:     size,
+			Path:     VersionPath(workflow, name, runID, version),
+			Kind:     kind,
+		}
+		err = CreateArtifact(a)
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) || attempt == STORE_ATTEMPTS {
+			return nil, err
+		}
+	}
+
+	if err := filestore.UploadFile(localPath, a.Path); err != nil {
+		if err := DeleteArtifactByVersion(workflow, name, a.Version); err != nil {
+			logger.Errorf("", "Cannot remove artifact %s/%s version %d after failed upload: %s", workflow, name, a.Version, err.Error())
+		}
+		return nil, err
+	}
+
+	// Only the newest version is copied to the latest path, so a slower
+	// upload of an older version cannot replace it
+	newest, err := GetLatestArtifact(workflow, name)
+	if err != nil {
+		return nil, err
+	}
+	if newest == nil || newest.Version == a.Version {
+		if err := filestore.UploadFile(localPath, fmt.Sprintf("%s/%s", workflow, name)); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Resolve a file reference to the artifacts it points to. References whose
+// name is a glob pattern resolve to the latest matching version of every file
+// that matches
+func Resolve(workflow, ref string) ([]*Artifact, error) {
+	r, err := ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsGlob(r.Name) {
+		if r.Version > 0 {
+			return nil, fmt.Errorf("invalid file reference %s, glob patterns cannot be pinned to a version", ref)
+		}
+		as, err := GetArtifactsByWorkflow(workflow)
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		out := []*Artifact{}
+		for _, a := range as {
+			if seen[a.Name] || (r.RunID != "" && a.RunID != r.RunID) {
+				continue
+			}
+			if ok, err := path.Match(r.Name, a.Name); err != nil {
+				return nil, fmt.Errorf("invalid file pattern %s: %s", r.Name, err.Error())
+			} else if ok {
+				seen[a.Name] = true
+				out = append(out, a)
+			}
+		}
+		if len(out) == 0 {
+			return nil, fmt.Errorf("no files match %s", ref)
+		}
+		return out, nil
+	}
+
+	var a *Artifact
+	switch {
+	case r.RunID != "":
+		a, err = GetLatestArtifactByRunID(workflow, r.Name, r.RunID)
+		if err == nil && a == nil {
+			err = fmt.Errorf("no version of %s found for run %s", r.Name, r.RunID)
+		}
+	case r.Version > 0:
+		a, err = GetArtifactByVersion(workflow, r.Name, r.Version)
+		if err == nil && a == nil {
+			err = fmt.Errorf("version %d of %s does not exist", r.Version, r.Name)
+		}
+	default:
+		a, err = GetLatestArtifact(workflow, r.Name)
+		if err == nil && a == nil {
+			// Files stored before versioning only exist as the latest copy
+			a = &Artifact{
+				Workflow: workflow,
+				Name:     r.Name,
+				Path:     fmt.Sprintf("%s/%s", workflow, r.Name),
+				Kind:     constants.ARTIFACT_KIND_FILE,
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []*Artifact{a}, nil
+}
+
+// Download an artifact to dest, extracting it there if it is a directory
+func Fetch(a *Artifact, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if a.Kind != constants.ARTIFACT_KIND_DIRECTORY {
+		return filestore.GetFile(a.Path, dest)
+	}
+
+	archive, err := os.CreateTemp("", "scaffold-artifact-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	archive.Close()
+	defer os.Remove(archive.Name())
+
+	if err := filestore.GetFile(a.Path, archive.Name()); err != nil {
+		return err
+	}
+	return Untar(archive.Name(), dest)
+}
+
+// Remove old artifact versions according to the configured retention policy.
+// The latest version of each file is always kept
+func PruneArtifacts() {
+	artifacts, err := GetAllArtifacts()
+	if err != nil {
+		logger.Errorf("", "Cannot get artifacts: %s", err.Error())
+		return
+	}
+
+	grouped := map[string][]*Artifact{}
+	for _, a := range artifacts {
+		key := fmt.Sprintf("%s/%s", a.Workflow, a.Name)
+		grouped[key] = append(grouped[key], a)
+	}
+
+	now := time.Now().UTC()
+	for _, as := range grouped {
+		sort.Slice(as, func(i, j int) bool {
+			return as[i].Version > as[j].Version
+		})
+		for idx, a := range as {
+			if idx == 0 {
+				continue
+			}
+			expired := config.Config.ArtifactRetentionCount > 0 && idx >= config.Config.ArtifactRetentionCount
+			if !expired && config.Config.ArtifactRetentionHours > 0 {
+				created, err := time.Parse("2006-01-02T15:04:05Z", a.Created)
+				if err != nil {
+					logger.Errorf("", "Cannot parse artifact created timestamp of %s: %s", a.Created, err.Error())
+					continue
+				}
+				expired = now.Sub(created).Hours() > float64(config.Config.ArtifactRetentionHours)
+			}
+			if !expired {
+				continue
+			}
+			if err := filestore.DeleteFile(a.Path); err != nil {
+				logger.Errorf("", "Cannot delete artifact file %s: %s", a.Path, err.Error())
+				continue
+			}
+			if err := DeleteArtifactByVersion(a.Workflow, a.Name, a.Version); err != nil {
+				logger.Errorf("", "Cannot delete artifact %s/%s version %d: %s", a.Workflow, a.Name, a.Version, err.Error())
+			}
+		}
+	}
+}
+
+func CreateArtifact(a *Artifact) error {
+	currentTime := time.Now().UTC()
+	a.Created = currentTime.Format("2006-01-02T15:04:05Z")
+
+	_, err := mongodb.Collections[constants.MONGODB_ARTIFACT_COLLECTION_NAME].InsertOne(mongodb.Ctx, a)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("artifact already exists with names %s, %s and version %d: %w", a.Workflow, a.Name, a.Version, err)
+	}
+	return err
+}
+
+func DeleteArtifactByVersion(workflow, name string, version int) error {
+	filter := bson.M{"workflow": workflow, "name": name, "version": version}
+
+	collection := mongodb.Collections[constants.MONGODB_ARTIFACT_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no artifact found with names %s, %s and version %d", workflow, name, version)
+	}
+
+	return nil
+}
+
+func GetAllArtifacts() ([]*Artifact, error) {
+	filter := bson.D{{}}
+
+	artifacts, err := FilterArtifacts(filter, nil)
+
+	return artifacts, err
+}
+
+func GetArtifactsByWorkflow(workflow string) ([]*Artifact, error) {
+	filter := bson.M{"workflow": workflow}
+
+	return FilterArtifacts(filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "version", Value: -1}}))
+}
+
+func GetArtifactsByNames(workflow, name string) ([]*Artifact, error) {
+	filter := bson.M{"workflow": workflow, "name": name}
+
+	return FilterArtifacts(filter, options.Find().SetSort(bson.D{{Key: "version", Value: -1}}))
+}
+
+func GetArtifactByVersion(workflow, name string, version int) (*Artifact, error) {
+	filter := bson.M{"workflow": workflow, "name": name, "version": version}
+
+	artifacts, err := FilterArtifacts(filter, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(artifacts) == 0 {
+		return nil, nil
+	}
+
+	if len(artifacts) > 1 {
+		return nil, fmt.Errorf("multiple artifacts found with names %s, %s and version %d", workflow, name, version)
+	}
+
+	return artifacts[0], nil
+}
+
+func GetLatestArtifact(workflow, name string) (*Artifact, error) {
+	filter := bson.M{"workflow": workflow, "name": name}
+
+	return getFirstArtifact(filter)
+}
+
+func GetLatestArtifactByRunID(workflow, name, runID string) (*Artifact, error) {
+	filter := bson.M{"workflow": workflow, "name": name, "run_id": runID}
+
+	return getFirstArtifact(filter)
+}
+
+func getFirstArtifact(filter interface{}) (*Artifact, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}}).SetLimit(1)
+
+	artifacts, err := FilterArtifacts(filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(artifacts) == 0 {
+		return nil, nil
+	}
+
+	return artifacts[0], nil
+}
+
+func FilterArtifacts(filter interface{}, opts *options.FindOptions) ([]*Artifact, error) {
+	// A slice of artifacts for storing the decoded documents
+	var artifacts []*Artifact
+
+	collection := mongodb.Collections[constants.MONGODB_ARTIFACT_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	if opts == nil {
+		opts = options.Find()
+	}
+
+	cur, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return artifacts, err
+	}
+
+	for cur.Next(ctx) {
+		var a Artifact
+		err := cur.Decode(&a)
+		if err != nil {
+			return artifacts, err
+		}
+
+		artifacts = append(artifacts, &a)
+	}
+
+	if err := cur.Err(); err != nil {
+		return artifacts, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return artifacts, nil
+}
@@ -0,0 +1,112 @@
+package artifact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	cases := map[string]Ref{
+		"foo.txt":               {Name: "foo.txt"},
+		"foo.txt@3":             {Name: "foo.txt", Version: 3},
+		"foo.txt@run:abc-1":     {Name: "foo.txt", RunID: "abc-1"},
+		"dist/":                 {Name: "dist"},
+		"reports/*.xml@run:abc": {Name: "reports/*.xml", RunID: "abc"},
+	}
+	for ref, expected := range cases {
+		r, err := ParseRef(ref)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", ref, err)
+		}
+		if r != expected {
+			t.Fatalf("got %v for %q, expected %v", r, ref, expected)
+		}
+	}
+
+	for _, ref := range []string{"", "@1", "foo.txt@", "foo.txt@0", "foo.txt@latest", "foo.txt@run:", "../other/secret.txt", "/other/secret.txt", "a/../../b@2"} {
+		if _, err := ParseRef(ref); err == nil {
+			t.Fatalf("expected error for %q", ref)
+		}
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	cases := map[string]string{
+		"dist/":       "dist",
+		"site/./css":  "site/css",
+		"a/b/../c":    "a/c",
+		"reports/*.x": "reports/*.x",
+	}
+	for name, expected := range cases {
+		cleaned, err := CleanName(name)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", name, err)
+		}
+		if cleaned != expected {
+			t.Fatalf("got %q for %q, expected %q", cleaned, name, expected)
+		}
+	}
+
+	for _, name := range []string{"", ".", "/etc/passwd", "../otherwf/secret.txt", "out/../../otherwf/secret.txt", ".."} {
+		if _, err := CleanName(name); err == nil {
+			t.Fatalf("expected error for %q", name)
+		}
+	}
+}
+
+func TestSplitMapping(t *testing.T) {
+	cases := map[string][2]string{
+		"dist/":              {"dist/", ""},
+		"dist/ -> site":      {"dist/", "site"},
+		"*.xml->reports":     {"*.xml", "reports"},
+		"foo@run:abc -> bar": {"foo@run:abc", "bar"},
+	}
+	for entry, expected := range cases {
+		src, dest := SplitMapping(entry)
+		if src != expected[0] || dest != expected[1] {
+			t.Fatalf("got (%q, %q) for %q, expected %v", src, dest, entry, expected)
+		}
+	}
+}
+
+func TestTarDirRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "assets", "css"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "index.html"), []byte("<html/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "assets", "css", "site.css"), []byte("body{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "dist.tar.gz")
+	if err := TarDir(src, archive); err != nil {
+		t.Fatalf("tar: %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "out")
+	if err := Untar(archive, dest); err != nil {
+		t.Fatalf("untar: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "assets", "css", "site.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "body{}" {
+		t.Fatalf("got %q, expected %q", string(data), "body{}")
+	}
+	info, err := os.Stat(filepath.Join(dest, "assets", "css", "site.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("got mode %v, expected %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+	if _, err := os.Stat(filepath.Join(dest, "index.html")); err != nil {
+		t.Fatal(err)
+	}
+}
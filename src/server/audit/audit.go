@@ -0,0 +1,302 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"scaffold/server/constants"
+	"scaffold/server/mongodb"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// Fields whose values are never written to the audit log, matched against the
+// last part of a field's path
+var redactedFields = []string{"password", "token", "login_token", "reset_token", "secret", "value", "ciphertext"}
+
+// A single field that differs between an object before and after a change.
+// Fields are dotted paths into the object's JSON, such as `tasks.0.name`
+type Change struct {
+	Field  string      `json:"field" bson:"field" yaml:"field"`
+	Before interface{} `json:"before" bson:"before" yaml:"before"`
+	After  interface{} `json:"after" bson:"after" yaml:"after"`
+}
+
+// A record of something being changed, who changed it and where from
+type Entry struct {
+	ID      string   `json:"id" bson:"id" yaml:"id"`
+	Time    string   `json:"time" bson:"time" yaml:"time"`
+	Actor   string   `json:"actor" bson:"actor" yaml:"actor"`
+	Source  string   `json:"source" bson:"source" yaml:"source"`
+	Action  string   `json:"action" bson:"action" yaml:"action"`
+	Kind    string   `json:"kind" bson:"kind" yaml:"kind"`
+	Target  string   `json:"target" bson:"target" yaml:"target"`
+	Method  string   `json:"method" bson:"method" yaml:"method"`
+	Path    string   `json:"path" bson:"path" yaml:"path"`
+	Status  int      `json:"status" bson:"status" yaml:"status"`
+	IP      string   `json:"ip" bson:"ip" yaml:"ip"`
+	Changes []Change `json:"changes" bson:"changes" yaml:"changes"`
+}
+
+// Filters for looking up entries. Empty fields match everything, and Since
+// and Until are timestamps in the same format entries are stored with
+type Query struct {
+	Actor  string
+	Source string
+	Action string
+	Kind   string
+	Target string
+	Since  string
+	Until  string
+	Limit  int64
+}
+
+// Read a query from URL parameters. Since and until can also be plain dates,
+// in which case until covers the whole of that day
+func ParseQuery(values url.Values) (Query, error) {
+	q := Query{
+		Actor:  values.Get("actor"),
+		Source: values.Get("source"),
+		Action: values.Get("action"),
+		Kind:   values.Get("kind"),
+		Target: values.Get("target"),
+		Since:  values.Get("since"),
+		Until:  values.Get("until"),
+	}
+	for _, t := range []*string{&q.Since, &q.Until} {
+		if *t == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", *t); err == nil {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02T15:04:05Z", *t); err != nil {
+			return q, fmt.Errorf("invalid time %s, expected YYYY-MM-DD or YYYY-MM-DDTHH:MM:SSZ", *t)
+		}
+	}
+	if len(q.Until) == len("2006-01-02") {
+		q.Until += "T23:59:59Z"
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid limit %s", limit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// Store an entry, filling in its ID and time. Failures are logged rather than
+// returned so that auditing never stops the change being audited
+func Record(e *Entry) {
+	e.ID = uuid.New().String()
+	e.Time = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	if e.Changes == nil {
+		e.Changes = []Change{}
+	}
+
+	if _, err := mongodb.Collections[constants.MONGODB_AUDIT_COLLECTION_NAME].InsertOne(mongodb.Ctx, e); err != nil {
+		logger.Errorf("", "Cannot record audit entry for %s %s: %s", e.Action, e.Target, err.Error())
+	}
+}
+
+// Compare an object before and after a change. Either can be nil for objects
+// that were created or deleted. The defaults of secret inputs and the values of
+// the secret inputs named are redacted along with the fields that always are
+func Diff(before, after interface{}, secretInputs []string) []Change {
+	b := flatten(before)
+	a := flatten(after)
+	secrets := secretFields(b, secretInputs)
+	for field := range secretFields(a, secretInputs) {
+		secrets[field] = true
+	}
+
+	fields := []string{}
+	for field := range b {
+		fields = append(fields, field)
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []Change{}
+	for _, field := range fields {
+		bv, inBefore := b[field]
+		av, inAfter := a[field]
+		if inBefore && inAfter && equal(bv, av) {
+			continue
+		}
+		if redacted(field) || secrets[field] {
+			if inBefore {
+				bv = constants.AUDIT_REDACTED
+			}
+			if inAfter {
+				av = constants.AUDIT_REDACTED
+			}
+		}
+		changes = append(changes, Change{Field: field, Before: bv, After: av})
+	}
+	return changes
+}
+
+func redacted(field string) bool {
+	parts := strings.Split(field, ".")
+	last := parts[len(parts)-1]
+	// Use the name of the list for fields which are list items
+	if _, err := strconv.Atoi(last); err == nil && len(parts) > 1 {
+		last = parts[len(parts)-2]
+	}
+	for _, name := range redactedFields {
+		if last == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the fields of a flattened object holding values of secret inputs.
+// Inputs keep their default next to their type, and data stores keep the value
+// of each input in env under its name
+func secretFields(flat map[string]interface{}, secretInputs []string) map[string]bool {
+	out := map[string]bool{}
+	for field, val := range flat {
+		prefix, last := "", field
+		if idx := strings.LastIndex(field, "."); idx >= 0 {
+			prefix, last = field[:idx+1], field[idx+1:]
+		}
+		if last == "type" && val == constants.INPUT_TYPE_SECRET {
+			out[prefix+"default"] = true
+		}
+	}
+	for _, name := range secretInputs {
+		out["env."+name] = true
+	}
+	return out
+}
+
+func equal(a, b interface{}) bool {
+	aa, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+	return string(aa) == string(bb)
+}
+
+// Turn an object into a map of dotted field paths to values by way of its
+// JSON. Empty maps and lists are kept so adding their first item shows up
+func flatten(obj interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	if obj == nil {
+		return out
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return out
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return out
+	}
+	flattenValue("", v, out)
+	return out
+}
+
+func flattenValue(prefix string, v interface{}, out map[string]interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 && prefix != "" {
+			out[prefix] = val
+		}
+		for key, item := range val {
+			flattenValue(join(key), item, out)
+		}
+	case []interface{}:
+		if len(val) == 0 && prefix != "" {
+			out[prefix] = val
+		}
+		for idx, item := range val {
+			flattenValue(join(strconv.Itoa(idx)), item, out)
+		}
+	case nil:
+		if prefix != "" {
+			out[prefix] = nil
+		}
+	default:
+		out[prefix] = val
+	}
+}
+
+// Get the entries matching a query, newest first
+func GetEntries(q Query) ([]*Entry, error) {
+	filter := bson.M{}
+	for key, val := range map[string]string{"actor": q.Actor, "source": q.Source, "action": q.Action, "kind": q.Kind, "target": q.Target} {
+		if val != "" {
+			filter[key] = val
+		}
+	}
+	timeFilter := bson.M{}
+	if q.Since != "" {
+		timeFilter["$gte"] = q.Since
+	}
+	if q.Until != "" {
+		timeFilter["$lte"] = q.Until
+	}
+	if len(timeFilter) > 0 {
+		filter["time"] = timeFilter
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: -1}})
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+	return FilterEntries(filter, opts)
+}
+
+func FilterEntries(filter interface{}, opts ...*options.FindOptions) ([]*Entry, error) {
+	// A slice of entries for storing the decoded documents
+	var entries []*Entry
+
+	collection := mongodb.Collections[constants.MONGODB_AUDIT_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return entries, err
+	}
+
+	for cur.Next(ctx) {
+		var e Entry
+		err := cur.Decode(&e)
+		if err != nil {
+			return entries, err
+		}
+
+		entries = append(entries, &e)
+	}
+
+	if err := cur.Err(); err != nil {
+		return entries, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return entries, nil
+}
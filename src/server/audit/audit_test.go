@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"net/url"
+	"testing"
+)
+
+type object struct {
+	Name     string            `json:"name"`
+	Password string            `json:"password"`
+	Groups   []string          `json:"groups"`
+	Env      map[string]string `json:"env"`
+}
+
+func TestDiff(t *testing.T) {
+	before := &object{Name: "jane", Password: "old", Groups: []string{"ops"}, Env: map[string]string{}}
+	after := &object{Name: "jane", Password: "new", Groups: []string{"ops", "dev"}, Env: map[string]string{"A": "1"}}
+
+	changes := Diff(before, after, nil)
+	want := []Change{
+		{Field: "env", Before: map[string]interface{}{}, After: nil},
+		{Field: "env.A", Before: nil, After: "1"},
+		{Field: "groups.1", Before: nil, After: "dev"},
+		{Field: "password", Before: "[redacted]", After: "[redacted]"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %+v, want %+v", changes, want)
+	}
+	for idx, c := range changes {
+		if c.Field != want[idx].Field || valueString(c.Before) != valueString(want[idx].Before) || valueString(c.After) != valueString(want[idx].After) {
+			t.Errorf("change %d: got %+v, want %+v", idx, c, want[idx])
+		}
+	}
+
+	var missing *object
+	if changes := Diff(missing, after, nil); len(changes) != 5 {
+		t.Errorf("expected every field of a created object, got %+v", changes)
+	}
+	if changes := Diff(before, before, nil); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+type inputObject struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default"`
+}
+
+type workflowObject struct {
+	Name   string        `json:"name"`
+	Inputs []inputObject `json:"inputs"`
+}
+
+func TestDiffSecretInputs(t *testing.T) {
+	before := &workflowObject{Name: "deploy", Inputs: []inputObject{{Name: "region", Type: "string", Default: "us"}, {Name: "key", Type: "secret", Default: "old"}}}
+	after := &workflowObject{Name: "deploy", Inputs: []inputObject{{Name: "region", Type: "string", Default: "eu"}, {Name: "key", Type: "secret", Default: "new"}}}
+	changes := Diff(before, after, nil)
+	want := []Change{
+		{Field: "inputs.0.default", Before: "us", After: "eu"},
+		{Field: "inputs.1.default", Before: "[redacted]", After: "[redacted]"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %+v, want %+v", changes, want)
+	}
+	for idx, c := range changes {
+		if c != want[idx] {
+			t.Errorf("change %d: got %+v, want %+v", idx, c, want[idx])
+		}
+	}
+
+	// An input made secret has its old default redacted too
+	changed := &inputObject{Name: "region", Type: "secret", Default: "eu"}
+	for _, c := range Diff(&inputObject{Name: "region", Type: "string", Default: "us"}, changed, nil) {
+		if c.Field == "default" && (c.Before != "[redacted]" || c.After != "[redacted]") {
+			t.Errorf("default of secret input was not redacted: %+v", c)
+		}
+	}
+
+	// Data stores keep input values in env by name
+	storeBefore := &object{Name: "deploy", Env: map[string]string{"region": "us", "key": "old"}}
+	storeAfter := &object{Name: "deploy", Env: map[string]string{"region": "eu", "key": "new"}}
+	for _, c := range Diff(storeBefore, storeAfter, []string{"key"}) {
+		switch c.Field {
+		case "env.key":
+			if c.Before != "[redacted]" || c.After != "[redacted]" {
+				t.Errorf("secret input value was not redacted: %+v", c)
+			}
+		case "env.region":
+			if c.Before != "us" || c.After != "eu" {
+				t.Errorf("plain input value was redacted: %+v", c)
+			}
+		}
+	}
+}
+
+func valueString(v interface{}) string {
+	if v == nil {
+		return "<nil>"
+	}
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 0 {
+		return "{}"
+	}
+	return v.(string)
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(url.Values{"actor": {"jane"}, "since": {"2024-01-01"}, "until": {"2024-01-31"}, "limit": {"10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Actor != "jane" || q.Since != "2024-01-01" || q.Until != "2024-01-31T23:59:59Z" || q.Limit != 10 {
+		t.Errorf("unexpected query %+v", q)
+	}
+
+	for _, values := range []url.Values{{"since": {"yesterday"}}, {"limit": {"-1"}}, {"limit": {"ten"}}} {
+		if _, err := ParseQuery(values); err == nil {
+			t.Errorf("invalid query %v was accepted", values)
+		}
+	}
+}
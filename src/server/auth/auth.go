@@ -1,9 +1,11 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"crypto/tls"
 	"net/http"
 	"scaffold/server/config"
+	"scaffold/server/node"
 	"scaffold/server/user"
 	"scaffold/server/utils"
 	"scaffold/server/workflow"
@@ -36,6 +38,12 @@ type NodeJoinObject struct {
 	Version  string `json:"version"`
 }
 
+// Returned to a worker once it has joined, holding the credential it uses for
+// everything it sends the manager
+type NodeJoinResponse struct {
+	Key string `json:"key"`
+}
+
 type NodeObject struct {
 	Name      string `json:"name" bson:"name"`
 	Host      string `json:"host" bson:"host"`
@@ -46,6 +54,11 @@ type NodeObject struct {
 	Available bool   `json:"available" bson:"available"`
 	Version   string `json:"version" bson:"version"`
 	Ping      int    `json:"ping" bson:"ping"`
+	Joined    string `json:"joined" bson:"joined"`
+	Key       string `json:"-" bson:"-"`
+	// The credential the node had before it last joined. Messages it signed
+	// before joining again are still accepted until it pings with the new one
+	PreviousKey string `json:"-" bson:"-"`
 }
 
 var Nodes = make(map[string]NodeObject)
@@ -72,42 +85,36 @@ func PerformLogin(c *gin.Context) {
 			username = authData[0]
 			password = authData[1]
 
-			valid, _ := user.VerifyUser(username, password)
+			// There is no second step for basic auth so any two-factor code
+			// comes with the password
+			valid, _ := VerifyBasicAuth(c, username, password)
 			if valid {
-				// There's definitely better ways of doing this but it's fine for now
-				token := utils.GenerateToken(32)
-				c.SetCookie("scaffold_token", token, 3600, "", "", false, false)
-				u, _ := user.GetUserByUsername(username)
-				hashedToken, err := HashAndSalt([]byte(token))
-				if err != nil {
+				if err := StartSession(c, username, false); err != nil {
 					c.HTML(http.StatusBadRequest, "login.html", gin.H{
 						"ErrorTitle":   "Login Failed",
 						"ErrorMessage": err.Error()})
 				}
-				u.LoginToken = hashedToken
-				user.UpdateUserByUsername(username, u)
 				return
 			}
 		}
 	} else {
 		valid, err := user.VerifyUser(username, password)
 		if valid {
-			token := utils.GenerateToken(32)
-			if rememberMe == "on" {
-				c.SetCookie("scaffold_token", token, 604800, "", "", false, false)
-			} else {
-				c.SetCookie("scaffold_token", token, 3600, "", "", false, false)
-			}
-
 			u, _ := user.GetUserByUsername(username)
-			hashedToken, err := HashAndSalt([]byte(token))
-			if err != nil {
+			if u != nil && (u.HasTOTP() || u.NeedsTOTP()) {
+				if err := startTOTPLogin(c, u, rememberMe == "on"); err != nil {
+					c.HTML(http.StatusBadRequest, "login.html", gin.H{
+						"ErrorTitle":   "Login Failed",
+						"ErrorMessage": err.Error()})
+				}
+				return
+			}
+			if err := StartSession(c, username, rememberMe == "on"); err != nil {
 				c.HTML(http.StatusBadRequest, "login.html", gin.H{
 					"ErrorTitle":   "Login Failed",
 					"ErrorMessage": err.Error()})
+				return
 			}
-			u.LoginToken = hashedToken
-			user.UpdateUserByUsername(username, u)
 
 			c.Redirect(302, "/")
 			return
@@ -120,15 +127,29 @@ func PerformLogin(c *gin.Context) {
 	c.AbortWithStatus(http.StatusUnauthorized)
 }
 
-// Clear the cookie on logout and redirect to login page
+// Start a session for a user who has just logged in and hand its token to the
+// browser. Remembered sessions keep their cookie until the session's absolute
+// expiry, others only until the browser is closed
+func StartSession(c *gin.Context, username string, remember bool) error {
+	token, err := user.CreateSession(username, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return err
+	}
+	maxAge := 0
+	if remember {
+		maxAge = config.Config.SessionAbsoluteTimeout
+	}
+	c.SetCookie("scaffold_token", token, maxAge, "", "", false, false)
+	return nil
+}
+
+// End the session, clear the cookie on logout and redirect to login page
 func PerformLogout(c *gin.Context) {
 	token, err := c.Cookie("scaffold_token")
 
-	if err != nil {
-		u, err := user.GetUserByLoginToken(token)
-		if err != nil {
-			u.LoginToken = ""
-			user.UpdateUserByUsername(u.Username, u)
+	if err == nil && token != "" {
+		if err := user.DeleteSessionByToken(token); err != nil {
+			logger.Debugf("", "Cannot end session on logout: %s", err.Error())
 		}
 	}
 	c.SetCookie("scaffold_token", "", -1, "", "", false, true)
@@ -210,6 +231,9 @@ func DoPasswordReset(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 	}
 	user.UpdateUserByUsername(u.Username, u)
+	if err := user.DeleteSessionsByUsername(u.Username); err != nil {
+		logger.Errorf("", "Cannot log out user %s after password reset: %s", u.Username, err.Error())
+	}
 	c.JSON(http.StatusOK, gin.H{})
 }
 
@@ -230,33 +254,49 @@ func JoinNode(ctx *gin.Context) {
 		return
 	}
 
-	if n.JoinKey == config.Config.Node.JoinKey {
-		ipAddr := ctx.ClientIP()
-		logger.Debugf("", "Joining node %s, %d, %d", ipAddr, n.Port, n.WSPort)
-		if nd, ok := Nodes[n.Name]; ok {
-			nd.Ping = 0
-			Nodes[n.Name] = nd
-			ctx.Status(http.StatusOK)
-			return
-		}
+	if subtle.ConstantTimeCompare([]byte(n.JoinKey), []byte(config.Config.Node.JoinKey)) != 1 {
+		ctx.Status(http.StatusUnauthorized)
+		return
+	}
 
-		NodeLock.Lock()
-		Nodes[n.Name] = NodeObject{
-			Name:     n.Name,
-			Host:     ipAddr,
-			Port:     n.Port,
-			WSPort:   n.WSPort,
-			Healthy:  true,
-			Version:  n.Version,
-			Protocol: n.Protocol,
-			Ping:     0,
-		}
-		NodeLock.Unlock()
-		ctx.Status(http.StatusOK)
+	r, err := GetRevokedNodeByName(n.Name)
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+	if r != nil {
+		logger.Errorf("", "Refusing to join revoked node %s", n.Name)
+		ctx.Status(http.StatusForbidden)
 		return
 	}
 
-	ctx.Status(http.StatusUnauthorized)
+	// Every join issues a new credential, so a worker that lost its own
+	// replaces the one the manager had
+	key, err := node.GenerateKey()
+	if err != nil {
+		utils.Error(err, ctx, http.StatusInternalServerError)
+		return
+	}
+
+	ipAddr := ctx.ClientIP()
+	logger.Debugf("", "Joining node %s, %d, %d", ipAddr, n.Port, n.WSPort)
+	NodeLock.Lock()
+	previous := Nodes[n.Name].Key
+	Nodes[n.Name] = NodeObject{
+		Name:        n.Name,
+		Host:        ipAddr,
+		Port:        n.Port,
+		WSPort:      n.WSPort,
+		Healthy:     true,
+		Version:     n.Version,
+		Protocol:    n.Protocol,
+		Ping:        0,
+		Joined:      time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Key:         key,
+		PreviousKey: previous,
+	}
+	NodeLock.Unlock()
+	ctx.JSON(http.StatusOK, NodeJoinResponse{Key: key})
 }
 
 // Get all the currently used groups
@@ -295,3 +335,41 @@ func GetAllGroups() ([]string, error) {
 func GetAllRoles() []string {
 	return []string{"read", "write", "admin"}
 }
+
+// Find the user a request was made by, and the API token used if there was
+// one. Requests from nodes using the primary key have no user and are
+// reported separately
+func RequestUser(c *gin.Context) (*user.User, *user.APIToken, bool) {
+	baUsername, baPassword, hasAuth := c.Request.BasicAuth()
+	if hasAuth {
+		verified, err := VerifyBasicAuth(c, baUsername, baPassword)
+		if err != nil || !verified {
+			return nil, nil, false
+		}
+		usr, _ := user.GetUserByUsername(baUsername)
+		return usr, nil, false
+	}
+
+	var token string
+	authString := c.Request.Header.Get("Authorization")
+	if authString == "" {
+		token, _ = c.Cookie("scaffold_token")
+	} else if parts := strings.Split(authString, " "); len(parts) > 1 {
+		token = parts[1]
+	}
+	if token == "" {
+		return nil, nil, false
+	}
+	if IsNodeKey(token) {
+		return nil, nil, true
+	}
+
+	if authString != "" {
+		usr, t, _ := user.GetAPIToken(token)
+		if usr != nil {
+			return usr, t, false
+		}
+	}
+	usr, _ := user.GetUserByLoginToken(token)
+	return usr, nil, false
+}
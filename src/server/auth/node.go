@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"scaffold/server/mongodb"
+	"scaffold/server/node"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// A node which may not join the manager again until its revocation is removed
+type RevokedNode struct {
+	Name      string `json:"name" bson:"name" yaml:"name"`
+	Host      string `json:"host" bson:"host" yaml:"host"`
+	RevokedBy string `json:"revoked_by" bson:"revoked_by" yaml:"revoked_by"`
+	Revoked   string `json:"revoked" bson:"revoked" yaml:"revoked"`
+}
+
+// Check whether a token is a node credential this process accepts. Workers
+// only accept their own credential, which the manager uses to call them, and
+// the manager accepts its primary key and the credential of any joined worker
+func IsNodeKey(token string) bool {
+	if config.Config.Node.Type == constants.NODE_TYPE_WORKER {
+		return node.KeysEqual(token, node.WorkerKey)
+	}
+	if node.KeysEqual(token, config.Config.Node.PrimaryKey) {
+		return true
+	}
+	NodeLock.RLock()
+	defer NodeLock.RUnlock()
+	for _, n := range Nodes {
+		if node.KeysEqual(token, n.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check that a key is the credential issued to the named node
+func VerifyNode(name, key string) bool {
+	NodeLock.RLock()
+	defer NodeLock.RUnlock()
+	n, ok := Nodes[name]
+	return ok && node.KeysEqual(key, n.Key)
+}
+
+// Get the credential of a joined node
+func GetNodeKey(name string) (string, bool) {
+	NodeLock.RLock()
+	defer NodeLock.RUnlock()
+	n, ok := Nodes[name]
+	return n.Key, ok
+}
+
+// Check the signature of a message sent by the named node. Messages signed
+// with the credential the node had before it last joined are accepted until it
+// pings with the new one, as they may have been queued before it joined again
+func VerifyMessage(name string, data []byte, signature string) bool {
+	NodeLock.RLock()
+	n, ok := Nodes[name]
+	NodeLock.RUnlock()
+	if !ok {
+		return false
+	}
+	for _, key := range []string{n.Key, n.PreviousKey} {
+		if key != "" && hmac.Equal([]byte(node.Sign(key, data)), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove a node along with its credential and stop it from joining again
+func RevokeNode(name, revokedBy string) error {
+	r, err := GetRevokedNodeByName(name)
+	if err != nil {
+		return err
+	}
+
+	NodeLock.Lock()
+	n, ok := Nodes[name]
+	delete(Nodes, name)
+	NodeLock.Unlock()
+
+	if r != nil {
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("no node found with name %s", name)
+	}
+
+	r = &RevokedNode{
+		Name:      name,
+		Host:      n.Host,
+		RevokedBy: revokedBy,
+		Revoked:   time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	_, err = mongodb.Collections[constants.MONGODB_REVOKED_NODE_COLLECTION_NAME].InsertOne(mongodb.Ctx, r)
+	return err
+}
+
+func DeleteRevokedNodeByName(name string) error {
+	filter := bson.M{"name": name}
+
+	collection := mongodb.Collections[constants.MONGODB_REVOKED_NODE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no revoked node found with name %s", name)
+	}
+
+	return nil
+}
+
+func GetAllRevokedNodes() ([]*RevokedNode, error) {
+	filter := bson.D{{}}
+
+	revoked, err := FilterRevokedNodes(filter)
+
+	return revoked, err
+}
+
+func GetRevokedNodeByName(name string) (*RevokedNode, error) {
+	filter := bson.M{"name": name}
+
+	revoked, err := FilterRevokedNodes(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revoked) == 0 {
+		return nil, nil
+	}
+
+	return revoked[0], nil
+}
+
+func FilterRevokedNodes(filter interface{}) ([]*RevokedNode, error) {
+	// A slice of revoked nodes for storing the decoded documents
+	var revoked []*RevokedNode
+
+	collection := mongodb.Collections[constants.MONGODB_REVOKED_NODE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return revoked, err
+	}
+
+	for cur.Next(ctx) {
+		var r RevokedNode
+		err := cur.Decode(&r)
+		if err != nil {
+			return revoked, err
+		}
+
+		revoked = append(revoked, &r)
+	}
+
+	if err := cur.Err(); err != nil {
+		return revoked, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return revoked, nil
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"scaffold/server/node"
+	"testing"
+)
+
+func TestVerifyMessagePreviousKey(t *testing.T) {
+	Nodes = map[string]NodeObject{"worker-1": {Name: "worker-1", Key: "new-key", PreviousKey: "old-key"}}
+	defer func() { Nodes = make(map[string]NodeObject) }()
+
+	data := []byte(`{"task":"build"}`)
+	for _, tc := range []struct {
+		key  string
+		want bool
+	}{
+		{"new-key", true},
+		{"old-key", true},
+		{"other-key", false},
+	} {
+		if got := VerifyMessage("worker-1", data, node.Sign(tc.key, data)); got != tc.want {
+			t.Errorf("VerifyMessage signed with %s = %v, want %v", tc.key, got, tc.want)
+		}
+	}
+
+	Nodes["worker-1"] = NodeObject{Name: "worker-1", Key: "new-key"}
+	if VerifyMessage("worker-1", data, node.Sign("old-key", data)) {
+		t.Errorf("previous key was accepted after it was cleared")
+	}
+	if VerifyMessage("worker-2", data, node.Sign("new-key", data)) {
+		t.Errorf("message from an unknown worker was accepted")
+	}
+}
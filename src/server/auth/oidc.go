@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"scaffold/server/oidc"
+	"scaffold/server/user"
+	"scaffold/server/utils"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+var oidcProvider *oidc.Provider
+var oidcLogins = make(map[string]*oidc.Login)
+var oidcLock = &sync.Mutex{}
+
+func getOIDCProvider() *oidc.Provider {
+	oidcLock.Lock()
+	defer oidcLock.Unlock()
+	if oidcProvider == nil {
+		oidcProvider = oidc.NewProvider(config.Config.OIDC)
+	}
+	return oidcProvider
+}
+
+func oidcError(c *gin.Context, err error) {
+	logger.Errorf("", "Single sign-on failed: %s", err.Error())
+	c.Redirect(http.StatusFound, "/ui/login?error="+url.QueryEscape("Single sign-on failed: "+err.Error()))
+}
+
+// Send the user to the OpenID Connect issuer to log in
+func OIDCLogin(c *gin.Context) {
+	if !oidc.Enabled() {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	l, err := oidc.NewLogin()
+	if err != nil {
+		oidcError(c, err)
+		return
+	}
+	authURL, err := getOIDCProvider().AuthURL(l)
+	if err != nil {
+		oidcError(c, err)
+		return
+	}
+
+	oidcLock.Lock()
+	for state, pending := range oidcLogins {
+		if time.Now().After(pending.Expires) {
+			delete(oidcLogins, state)
+		}
+	}
+	oidcLogins[l.State] = l
+	oidcLock.Unlock()
+
+	// Tie the login to this browser so a callback cannot be replayed in another
+	c.SetCookie("scaffold_oidc_state", l.State, int(oidc.LOGIN_TIMEOUT.Seconds()), "/auth/oidc", "", false, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Finish a login when the issuer redirects back, provisioning the user on their
+// first login
+func OIDCCallback(c *gin.Context) {
+	if !oidc.Enabled() {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	if e := c.Query("error"); e != "" {
+		oidcError(c, fmt.Errorf("%s %s", e, c.Query("error_description")))
+		return
+	}
+
+	state := c.Query("state")
+	cookie, _ := c.Cookie("scaffold_oidc_state")
+	c.SetCookie("scaffold_oidc_state", "", -1, "/auth/oidc", "", false, true)
+
+	oidcLock.Lock()
+	l, ok := oidcLogins[state]
+	delete(oidcLogins, state)
+	oidcLock.Unlock()
+
+	if !ok || state == "" || cookie != state || time.Now().After(l.Expires) {
+		oidcError(c, fmt.Errorf("login expired or was started in another browser"))
+		return
+	}
+
+	p := getOIDCProvider()
+	claims, err := p.Exchange(c.Query("code"), l)
+	if err != nil {
+		oidcError(c, err)
+		return
+	}
+	id, err := p.Identity(claims)
+	if err != nil {
+		oidcError(c, err)
+		return
+	}
+	u, err := provisionOIDCUser(id)
+	if err != nil {
+		oidcError(c, err)
+		return
+	}
+
+	if err := user.UpdateUserByUsername(u.Username, u); err != nil {
+		oidcError(c, err)
+		return
+	}
+	if err := StartSession(c, u.Username, false); err != nil {
+		oidcError(c, err)
+		return
+	}
+	c.Set(constants.AUDIT_ACTOR_KEY, u.Username)
+
+	c.Redirect(http.StatusFound, "/")
+}
+
+// Create or update the user for an identity. The groups and roles come from the
+// issuer on every login so changes there apply the next time the user logs in
+func provisionOIDCUser(id *oidc.Identity) (*user.User, error) {
+	roles := []string{}
+	for _, r := range id.Roles {
+		if utils.Contains(GetAllRoles(), r) {
+			roles = append(roles, r)
+		} else {
+			logger.Warnf("", "Ignoring unknown role %s for user %s", r, id.Username)
+		}
+	}
+
+	u, err := user.GetUserByUsername(id.Username)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		logger.Infof("", "Provisioning single sign-on user %s", id.Username)
+		u = &user.User{
+			Username:   id.Username,
+			Password:   utils.GenerateToken(32),
+			GivenName:  id.GivenName,
+			FamilyName: id.FamilyName,
+			Email:      id.Email,
+			APITokens:  []user.APIToken{},
+			Groups:     id.Groups,
+			Roles:      roles,
+			Provider:   constants.USER_PROVIDER_OIDC,
+		}
+		if err := user.CreateUser(u); err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+	if u.Provider != constants.USER_PROVIDER_OIDC {
+		return nil, fmt.Errorf("a local user named %s already exists", id.Username)
+	}
+	if u.Disabled {
+		return nil, fmt.Errorf("user %s is disabled", id.Username)
+	}
+
+	u.GivenName = id.GivenName
+	u.FamilyName = id.FamilyName
+	u.Email = id.Email
+	u.Groups = id.Groups
+	u.Roles = roles
+	return u, nil
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"scaffold/server/constants"
+	"scaffold/server/user"
+	"scaffold/server/utils"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// How long a user has to give their second factor after their password
+const TOTP_LOGIN_TIMEOUT = 5 * time.Minute
+
+// How many wrong codes can be given before the login has to start again
+const TOTP_LOGIN_ATTEMPTS = 5
+
+// A login waiting for a second factor. Users who have to set one up before
+// they can log in do so here, with the enrollment kept until they give a
+// valid code
+type TOTPLogin struct {
+	Username       string
+	Remember       bool
+	Enrollment     *user.TOTPEnrollment
+	RecoveryHashes []string
+	Attempts       int
+	Expires        time.Time
+}
+
+// Context key holding whether the basic auth credentials of a request are valid
+const BASIC_AUTH_KEY = "basic_auth_verified"
+
+var totpLogins = make(map[string]*TOTPLogin)
+var totpLock = &sync.Mutex{}
+
+// Check the basic auth credentials of a request, including the two-factor code
+// of users who have one. Codes only work once, so the result is kept on the
+// request for every check after the first
+func VerifyBasicAuth(c *gin.Context, username, password string) (bool, error) {
+	if verified, ok := c.Get(BASIC_AUTH_KEY); ok {
+		return verified.(bool), nil
+	}
+	verified, err := user.VerifyBasicAuth(username, password, c.GetHeader(constants.TOTP_HEADER))
+	c.Set(BASIC_AUTH_KEY, err == nil && verified)
+	return verified, err
+}
+
+func totpError(c *gin.Context, path, message string) {
+	c.Redirect(http.StatusFound, path+"?error="+url.QueryEscape(message))
+}
+
+// Hold a login whose password was right until the second factor is given
+func startTOTPLogin(c *gin.Context, u *user.User, remember bool) error {
+	l := &TOTPLogin{
+		Username: u.Username,
+		Remember: remember,
+		Expires:  time.Now().Add(TOTP_LOGIN_TIMEOUT),
+	}
+	if u.NeedsTOTP() {
+		e, hashes, err := user.NewTOTPEnrollment(u.Username)
+		if err != nil {
+			return err
+		}
+		l.Enrollment = e
+		l.RecoveryHashes = hashes
+	}
+
+	state := utils.GenerateToken(32)
+	totpLock.Lock()
+	for s, pending := range totpLogins {
+		if time.Now().After(pending.Expires) {
+			delete(totpLogins, s)
+		}
+	}
+	totpLogins[state] = l
+	totpLock.Unlock()
+
+	c.SetCookie("scaffold_totp_state", state, int(TOTP_LOGIN_TIMEOUT.Seconds()), "/", "", false, true)
+	c.Redirect(http.StatusFound, "/ui/login/totp")
+	return nil
+}
+
+// Get the login waiting for a second factor in this browser, if any
+func GetTOTPLogin(c *gin.Context) *TOTPLogin {
+	state, err := c.Cookie("scaffold_totp_state")
+	if err != nil || state == "" {
+		return nil
+	}
+	totpLock.Lock()
+	defer totpLock.Unlock()
+	l, ok := totpLogins[state]
+	if !ok || time.Now().After(l.Expires) {
+		return nil
+	}
+	return l
+}
+
+func endTOTPLogin(c *gin.Context) {
+	if state, err := c.Cookie("scaffold_totp_state"); err == nil {
+		totpLock.Lock()
+		delete(totpLogins, state)
+		totpLock.Unlock()
+	}
+	c.SetCookie("scaffold_totp_state", "", -1, "/", "", false, true)
+}
+
+// Finish a login with a code from the user's authenticator app or one of their
+// recovery codes. Users setting up a second factor give a code from the one
+// they were shown, which turns it on
+// This takes the following in a posted form:
+//   - code string
+func PerformTOTPLogin(c *gin.Context) {
+	l := GetTOTPLogin(c)
+	if l == nil {
+		endTOTPLogin(c)
+		totpError(c, "/ui/login", "Login expired, please log in again")
+		return
+	}
+	c.Set(constants.AUDIT_ACTOR_KEY, l.Username)
+	code := c.PostForm("code")
+
+	var valid bool
+	var err error
+	if l.Enrollment != nil {
+		err = user.CompleteTOTPEnrollment(l.Username, l.Enrollment.Secret, l.RecoveryHashes, code)
+		valid = err == nil
+	} else {
+		var u *user.User
+		u, err = user.GetUserByUsername(l.Username)
+		if err == nil && u != nil {
+			valid, err = user.VerifyTOTP(u, code)
+		}
+	}
+	if err != nil {
+		logger.Debugf("", "Two-factor login of %s failed: %s", l.Username, err.Error())
+	}
+
+	if !valid {
+		totpLock.Lock()
+		l.Attempts++
+		attempts := l.Attempts
+		totpLock.Unlock()
+		if attempts >= TOTP_LOGIN_ATTEMPTS {
+			endTOTPLogin(c)
+			totpError(c, "/ui/login", "Too many invalid codes, please log in again")
+			return
+		}
+		totpError(c, "/ui/login/totp", "Invalid code")
+		return
+	}
+
+	endTOTPLogin(c)
+	if err := StartSession(c, l.Username, l.Remember); err != nil {
+		totpError(c, "/ui/login", "Login failed: "+err.Error())
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/")
+}
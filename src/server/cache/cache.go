@@ -0,0 +1,305 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"scaffold/server/constants"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"scaffold/server/mongodb"
+)
+
+type CacheFile struct {
+	Name    string `json:"name" bson:"name" yaml:"name"`
+	Version int    `json:"version" bson:"version" yaml:"version"`
+}
+
+type Entry struct {
+	Key      string            `json:"key" bson:"key" yaml:"key"`
+	Workflow string            `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Task     string            `json:"task" bson:"task" yaml:"task"`
+	RunID    string            `json:"run_id" bson:"run_id" yaml:"run_id"`
+	Env      map[string]string `json:"env" bson:"env" yaml:"env"`
+	Files    []CacheFile       `json:"files" bson:"files" yaml:"files"`
+	Hits     int               `json:"hits" bson:"hits" yaml:"hits"`
+	Created  string            `json:"created" bson:"created" yaml:"created"`
+	LastHit  string            `json:"last_hit" bson:"last_hit" yaml:"last_hit"`
+}
+
+type Stats struct {
+	Workflow string `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Task     string `json:"task" bson:"task" yaml:"task"`
+	Hits     int    `json:"hits" bson:"hits" yaml:"hits"`
+	Misses   int    `json:"misses" bson:"misses" yaml:"misses"`
+	Entries  int    `json:"entries" bson:"-" yaml:"entries"`
+}
+
+// Everything that determines the outcome of a deterministic task run
+type KeyInput struct {
+	Kind    string
+	Image   string
+	Digest  string
+	Script  string
+	Env     map[string]string
+	Secrets map[string]string
+	Files   map[string]string
+}
+
+// Hash a run's inputs into a cache key. Maps are hashed in sorted key order so
+// the same inputs always produce the same key
+func ComputeKey(in KeyInput) string {
+	h := sha256.New()
+	writeField := func(name, value string) {
+		fmt.Fprintf(h, "%s:%d:%s\n", name, len(value), value)
+	}
+	writeMap := func(name string, m map[string]string) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeField(name, fmt.Sprintf("%d", len(keys)))
+		for _, k := range keys {
+			writeField(name+".key", k)
+			writeField(name+".value", m[k])
+		}
+	}
+
+	writeField("kind", in.Kind)
+	writeField("image", in.Image)
+	writeField("digest", in.Digest)
+	writeField("script", in.Script)
+	writeMap("env", in.Env)
+	writeMap("secrets", in.Secrets)
+	writeMap("files", in.Files)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Check whether an entry is older than the given TTL in hours. A TTL of 0
+// never expires
+func IsExpired(e *Entry, ttl int) bool {
+	if ttl <= 0 {
+		return false
+	}
+	created, err := time.Parse("2006-01-02T15:04:05Z", e.Created)
+	if err != nil {
+		return true
+	}
+	return time.Now().UTC().Sub(created).Hours() > float64(ttl)
+}
+
+func CreateEntry(e *Entry) error {
+	currentTime := time.Now().UTC()
+	e.Created = currentTime.Format("2006-01-02T15:04:05Z")
+
+	ee, err := GetEntryByKey(e.Workflow, e.Task, e.Key)
+	if err != nil {
+		return fmt.Errorf("error getting cache entries: %s", err.Error())
+	}
+	if ee != nil {
+		return fmt.Errorf("cache entry already exists for %s, %s with key %s", e.Workflow, e.Task, e.Key)
+	}
+
+	_, err = mongodb.Collections[constants.MONGODB_CACHE_COLLECTION_NAME].InsertOne(mongodb.Ctx, e)
+	return err
+}
+
+func DeleteEntryByKey(workflow, task, key string) error {
+	filter := bson.M{"workflow": workflow, "task": task, "key": key}
+
+	collection := mongodb.Collections[constants.MONGODB_CACHE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no cache entry found for %s, %s with key %s", workflow, task, key)
+	}
+
+	return nil
+}
+
+func DeleteEntriesByWorkflow(workflow string) error {
+	filter := bson.M{"workflow": workflow}
+
+	collection := mongodb.Collections[constants.MONGODB_CACHE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	_, err := collection.DeleteMany(ctx, filter)
+
+	return err
+}
+
+func DeleteEntriesByNames(workflow, task string) error {
+	filter := bson.M{"workflow": workflow, "task": task}
+
+	collection := mongodb.Collections[constants.MONGODB_CACHE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	_, err := collection.DeleteMany(ctx, filter)
+
+	return err
+}
+
+func GetEntriesByWorkflow(workflow string) ([]*Entry, error) {
+	filter := bson.M{"workflow": workflow}
+
+	return FilterEntries(filter)
+}
+
+func GetEntriesByNames(workflow, task string) ([]*Entry, error) {
+	filter := bson.M{"workflow": workflow, "task": task}
+
+	return FilterEntries(filter)
+}
+
+func GetEntryByKey(workflow, task, key string) (*Entry, error) {
+	filter := bson.M{"workflow": workflow, "task": task, "key": key}
+
+	entries, err := FilterEntries(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	if len(entries) > 1 {
+		return nil, fmt.Errorf("multiple cache entries found for %s, %s with key %s", workflow, task, key)
+	}
+
+	return entries[0], nil
+}
+
+func FilterEntries(filter interface{}) ([]*Entry, error) {
+	// A slice of entries for storing the decoded documents
+	var entries []*Entry
+
+	collection := mongodb.Collections[constants.MONGODB_CACHE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return entries, err
+	}
+
+	for cur.Next(ctx) {
+		var e Entry
+		err := cur.Decode(&e)
+		if err != nil {
+			return entries, err
+		}
+
+		entries = append(entries, &e)
+	}
+
+	if err := cur.Err(); err != nil {
+		return entries, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return entries, nil
+}
+
+func RecordHit(e *Entry) error {
+	currentTime := time.Now().UTC()
+	e.LastHit = currentTime.Format("2006-01-02T15:04:05Z")
+	e.Hits += 1
+
+	filter := bson.M{"workflow": e.Workflow, "task": e.Task, "key": e.Key}
+	update := bson.M{"$inc": bson.M{"hits": 1}, "$set": bson.M{"last_hit": e.LastHit}}
+	if _, err := mongodb.Collections[constants.MONGODB_CACHE_COLLECTION_NAME].UpdateOne(mongodb.Ctx, filter, update); err != nil {
+		return err
+	}
+
+	return incrementStats(e.Workflow, e.Task, "hits")
+}
+
+func RecordMiss(workflow, task string) error {
+	return incrementStats(workflow, task, "misses")
+}
+
+func incrementStats(workflow, task, field string) error {
+	filter := bson.M{"workflow": workflow, "task": task}
+	update := bson.M{"$inc": bson.M{field: 1}}
+	opts := options.Update().SetUpsert(true)
+
+	_, err := mongodb.Collections[constants.MONGODB_CACHE_STATS_COLLECTION_NAME].UpdateOne(mongodb.Ctx, filter, update, opts)
+	return err
+}
+
+func DeleteStatsByWorkflow(workflow string) error {
+	filter := bson.M{"workflow": workflow}
+
+	_, err := mongodb.Collections[constants.MONGODB_CACHE_STATS_COLLECTION_NAME].DeleteMany(mongodb.Ctx, filter)
+
+	return err
+}
+
+func DeleteStatsByNames(workflow, task string) error {
+	filter := bson.M{"workflow": workflow, "task": task}
+
+	_, err := mongodb.Collections[constants.MONGODB_CACHE_STATS_COLLECTION_NAME].DeleteMany(mongodb.Ctx, filter)
+
+	return err
+}
+
+// Get hit/miss counters for each cached task in a workflow along with the
+// number of entries currently held for it
+func GetStatsByWorkflow(workflow string) ([]*Stats, error) {
+	filter := bson.M{"workflow": workflow}
+
+	collection := mongodb.Collections[constants.MONGODB_CACHE_STATS_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	var stats []*Stats
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return stats, err
+	}
+
+	for cur.Next(ctx) {
+		var s Stats
+		err := cur.Decode(&s)
+		if err != nil {
+			return stats, err
+		}
+
+		stats = append(stats, &s)
+	}
+
+	if err := cur.Err(); err != nil {
+		return stats, err
+	}
+
+	cur.Close(ctx)
+
+	entries, err := GetEntriesByWorkflow(workflow)
+	if err != nil {
+		return stats, err
+	}
+	for _, s := range stats {
+		for _, e := range entries {
+			if e.Task == s.Task {
+				s.Entries += 1
+			}
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,37 @@
+package cache
+
+import "testing"
+
+func TestComputeKey(t *testing.T) {
+	base := KeyInput{
+		Kind:   "container",
+		Image:  "alpine:latest",
+		Digest: "sha256:abc",
+		Script: "echo hello",
+		Env:    map[string]string{"A": "1", "B": "2"},
+		Files:  map[string]string{"in.txt": "deadbeef"},
+	}
+	key := ComputeKey(base)
+
+	same := base
+	same.Env = map[string]string{"B": "2", "A": "1"}
+	if ComputeKey(same) != key {
+		t.Fatalf("expected key to be independent of map order")
+	}
+
+	changes := []func(in *KeyInput){
+		func(in *KeyInput) { in.Digest = "sha256:def" },
+		func(in *KeyInput) { in.Script = "echo world" },
+		func(in *KeyInput) { in.Env = map[string]string{"A": "1", "B": "3"} },
+		func(in *KeyInput) { in.Files = map[string]string{"in.txt": "cafef00d"} },
+		// values must not be able to bleed into neighbouring fields
+		func(in *KeyInput) { in.Env = map[string]string{"A": "1B", "": "2"} },
+	}
+	for idx, change := range changes {
+		in := base
+		change(&in)
+		if ComputeKey(in) == key {
+			t.Fatalf("change %d did not alter the cache key", idx)
+		}
+	}
+}
@@ -8,6 +8,7 @@ const STATE_STATUS_RUNNING = "running"
 const STATE_STATUS_WAITING = "waiting"
 const STATE_STATUS_NOT_STARTED = "not_started"
 const STATE_STATUS_KILLED = "killed"
+const STATE_STATUS_CACHED = "cached"
 
 const MONGODB_WORKFLOW_COLLECTION_NAME = "workflow"
 const MONGODB_DATASTORE_COLLECTION_NAME = "datastore"
@@ -17,6 +18,20 @@ const MONGODB_TASK_COLLECTION_NAME = "task"
 const MONGODB_INPUT_COLLECTION_NAME = "input"
 const MONGODB_WEBHOOK_COLLECTION_NAME = "webhook"
 const MONGODB_HISTORY_COLLECTION_NAME = "history"
+const MONGODB_ARTIFACT_COLLECTION_NAME = "artifact"
+const MONGODB_CACHE_COLLECTION_NAME = "cache"
+const MONGODB_CACHE_STATS_COLLECTION_NAME = "cache_stats"
+const MONGODB_SECRET_COLLECTION_NAME = "secret"
+const MONGODB_REVISION_COLLECTION_NAME = "revision"
+const MONGODB_GITSYNC_COLLECTION_NAME = "gitsync"
+const MONGODB_TEMPLATE_COLLECTION_NAME = "template"
+const MONGODB_WEBHOOK_DELIVERY_COLLECTION_NAME = "webhook_delivery"
+const MONGODB_POLICY_COLLECTION_NAME = "policy"
+const MONGODB_REVOKED_NODE_COLLECTION_NAME = "revoked_node"
+const MONGODB_AUDIT_COLLECTION_NAME = "audit"
+const MONGODB_SESSION_COLLECTION_NAME = "session"
+const MONGODB_NAMESPACE_COLLECTION_NAME = "namespace"
+const MONGODB_RUN_QUEUE_COLLECTION_NAME = "run_queue"
 
 const NODE_TYPE_WORKER = "worker"
 const NODE_TYPE_MANAGER = "manager"
@@ -39,11 +54,98 @@ const STATUS_TRIGGER_ALWAYS = "always"
 const STATUS_TRIGGER_SUCCESS = "success"
 const STATUS_TRIGGER_ERROR = "error"
 
+const CONTEXT_TRIGGER_FILE_WORKFLOW = "SCAFFOLD_TRIGGER_FILE_WORKFLOW"
+const CONTEXT_TRIGGER_FILE_NAME = "SCAFFOLD_TRIGGER_FILE_NAME"
+const CONTEXT_TRIGGER_FILE_VERSION = "SCAFFOLD_TRIGGER_FILE_VERSION"
+
+// Tasks that stored the files leading up to a file triggered run, and the run
+// they were recorded for
+const CONTEXT_TRIGGER_CHAIN = "SCAFFOLD_TRIGGER_CHAIN"
+const CONTEXT_TRIGGER_CHAIN_RUN_ID = "SCAFFOLD_TRIGGER_CHAIN_RUN_ID"
+
+const CONTEXT_UPSTREAM_WORKFLOW = "SCAFFOLD_UPSTREAM_WORKFLOW"
+const CONTEXT_UPSTREAM_TASK = "SCAFFOLD_UPSTREAM_TASK"
+const CONTEXT_UPSTREAM_RUN_ID = "SCAFFOLD_UPSTREAM_RUN_ID"
+
+const NOTIFY_CHANNEL_WEBHOOK = "webhook"
+const NOTIFY_CHANNEL_SLACK = "slack"
+const NOTIFY_CHANNEL_TEAMS = "teams"
+const NOTIFY_CHANNEL_EMAIL = "email"
+
+const NOTIFY_EVENT_TASK_SUCCEEDED = "task_succeeded"
+const NOTIFY_EVENT_TASK_FAILED = "task_failed"
+const NOTIFY_EVENT_RUN_SUCCEEDED = "run_succeeded"
+const NOTIFY_EVENT_RUN_FAILED = "run_failed"
+const NOTIFY_EVENT_WORKER_LOST = "worker_lost"
+const NOTIFY_EVENT_APPROVAL_REQUESTED = "approval_requested"
+
+const WEBHOOK_VERIFY_HMAC_SHA256 = "hmac-sha256"
+const WEBHOOK_VERIFY_TOKEN = "token"
+
+const WEBHOOK_DELIVERY_TRIGGERED = "triggered"
+const WEBHOOK_DELIVERY_FILTERED = "filtered"
+const WEBHOOK_DELIVERY_REJECTED = "rejected"
+const WEBHOOK_DELIVERY_ERROR = "error"
+
+const USER_PROVIDER_OIDC = "oidc"
+const USER_PROVIDER_LDAP = "ldap"
+
+const API_TOKEN_PREFIX = "scaffold_"
+const API_TOKEN_SCOPE_READ = "read"
+const API_TOKEN_SCOPE_TRIGGER = "trigger"
+
+const AUDIT_SOURCE_UI = "ui"
+const AUDIT_SOURCE_API = "api"
+const AUDIT_SOURCE_CLI = "cli"
+const AUDIT_SOURCE_WEBHOOK = "webhook"
+const AUDIT_SOURCE_CRON = "cron"
+const AUDIT_SOURCE_NODE = "node"
+const AUDIT_REDACTED = "[redacted]"
+const AUDIT_ACTOR_KEY = "audit_actor"
+
+const CLI_USER_AGENT_PREFIX = "scaffold-cli/"
+
+// Header carrying a two-factor code when logging in with basic auth
+const TOTP_HEADER = "X-Scaffold-TOTP"
+
 const ACTION_TRIGGER = "trigger"
 const ACTION_KILL = "kill"
 
+const QUEUE_STATUS_PENDING = "pending"
+const QUEUE_STATUS_RUNNING = "running"
+
 const FILESTORE_TYPE_S3 = "s3"
 const FILESTORE_TYPE_ARTIFACTORY = "artifactory"
+const FILESTORE_TYPE_LOCAL = "local"
+
+const FILESTORE_VERSION_PREFIX = "_versions"
+
+const ARTIFACT_KIND_FILE = "file"
+const ARTIFACT_KIND_DIRECTORY = "directory"
+
+const INPUT_TYPE_STRING = "string"
+const INPUT_TYPE_PLAINTEXT = "plaintext"
+const INPUT_TYPE_INT = "int"
+const INPUT_TYPE_BOOL = "bool"
+const INPUT_TYPE_ENUM = "enum"
+const INPUT_TYPE_REGEX = "regex"
+const INPUT_TYPE_JSON = "json"
+const INPUT_TYPE_SECRET = "secret"
+
+const GITSYNC_STATUS_SYNCED = "synced"
+const GITSYNC_STATUS_ERROR = "error"
+const GITSYNC_STATUS_ORPHANED = "orphaned"
+
+// Namespace workflows are put in when they do not name one
+const NAMESPACE_DEFAULT = "default"
+
+// Separates the namespace from the name of workflows outside the default
+// namespace
+const WORKFLOW_NAMESPACE_SEPARATOR = "."
+
+// Authors of workflow revisions not applied by a user
+const REVISION_AUTHOR_SCAFFOLD = "scaffold"
+const REVISION_AUTHOR_GITSYNC = "gitsync"
 
 const TASK_KIND_LOCAL = "local"
 const TASK_KIND_CONTAINER = "container"
@@ -3,13 +3,18 @@ package scron
 import (
 	// "scaffold/server/bulwark"
 
+	"scaffold/server/artifact"
+	"scaffold/server/audit"
 	"scaffold/server/config"
 	"scaffold/server/constants"
+	"scaffold/server/gitsync"
 	"scaffold/server/history"
+	"scaffold/server/ldap"
 	"scaffold/server/msg"
-	"scaffold/server/rabbitmq"
+	"scaffold/server/queue"
 	"scaffold/server/state"
 	"scaffold/server/task"
+	"scaffold/server/user"
 	"scaffold/server/utils"
 	"scaffold/server/workflow"
 	"strconv"
@@ -27,6 +32,14 @@ func Start() {
 	c := cron.New()
 	c.AddFunc("* * * * * *", checkTaskCrons)
 	c.AddFunc(config.Config.RunPruneCron, history.PruneHistories)
+	c.AddFunc(config.Config.ArtifactPruneCron, artifact.PruneArtifacts)
+	c.AddFunc(config.Config.SessionPruneCron, user.PruneSessions)
+	if gitsync.Enabled() {
+		c.AddFunc(config.Config.GitSync.Cron, gitsync.Run)
+	}
+	if ldap.Enabled() {
+		c.AddFunc(config.Config.LDAP.SyncCron, user.RunLDAPSync)
+	}
 	go c.Start()
 }
 
@@ -86,34 +99,46 @@ func checkCron(currentTime time.Time, crontab, name string, runNumber int, c *wo
 		}
 
 		for _, tt := range t.DependsOn.Success {
-			s, err := state.GetStateByNames(c.Name, tt)
+			s, err := state.GetStateByNames(task.SplitDependency(c.Name, tt))
 			if err != nil {
 				logger.Errorf("", "Error getting cron run state: %s", err.Error())
 				return
 			}
-			if s.Status != constants.STATE_STATUS_SUCCESS {
+			if s == nil {
+				logger.Tracef("", "Cron dependency %s has no state", tt)
+				return
+			}
+			if !state.Succeeded(s.Status) {
 				logger.Tracef("", "Cron status of %s does not match %s", s.Status, constants.STATE_STATUS_SUCCESS)
 				return
 			}
 		}
 		for _, tt := range t.DependsOn.Error {
-			s, err := state.GetStateByNames(c.Name, tt)
+			s, err := state.GetStateByNames(task.SplitDependency(c.Name, tt))
 			if err != nil {
 				logger.Errorf("", "Error getting cron run state: %s", err.Error())
 				return
 			}
+			if s == nil {
+				logger.Tracef("", "Cron dependency %s has no state", tt)
+				return
+			}
 			if s.Status != constants.STATE_STATUS_ERROR {
 				logger.Tracef("", "Cron status of %s does not match %s", s.Status, constants.STATE_STATUS_ERROR)
 				return
 			}
 		}
 		for _, tt := range t.DependsOn.Always {
-			s, err := state.GetStateByNames(c.Name, tt)
+			s, err := state.GetStateByNames(task.SplitDependency(c.Name, tt))
 			if err != nil {
 				logger.Errorf("", "Error getting cron run state: %s", err.Error())
 				return
 			}
-			if s.Status != constants.STATE_STATUS_SUCCESS && s.Status != constants.STATE_STATUS_ERROR {
+			if s == nil {
+				logger.Tracef("", "Cron dependency %s has no state", tt)
+				return
+			}
+			if !state.Succeeded(s.Status) && s.Status != constants.STATE_STATUS_ERROR {
 				logger.Tracef("", "Cron status of %s does not match %s or %s", s.Status, constants.STATE_STATUS_SUCCESS, constants.STATE_STATUS_ERROR)
 				return
 			}
@@ -133,6 +158,7 @@ func checkCron(currentTime time.Time, crontab, name string, runNumber int, c *wo
 			Action:   constants.ACTION_TRIGGER,
 			Groups:   c.Groups,
 			Number:   runNumber + 1,
+			RunID:    runID,
 			Context:  s.Context,
 		}
 		h := history.History{
@@ -147,9 +173,17 @@ func checkCron(currentTime time.Time, crontab, name string, runNumber int, c *wo
 		}
 
 		logger.Infof("", "Triggering run with message %v", m)
-		if err := rabbitmq.ManagerPublish(m); err != nil {
+		if _, err := queue.Submit(m, t.Priority); err != nil {
 			logger.Errorf("", "Error triggering cron run: %s", err.Error())
+			return
 		}
+		audit.Record(&audit.Entry{
+			Actor:  "scaffold",
+			Source: constants.AUDIT_SOURCE_CRON,
+			Action: "trigger",
+			Kind:   "run",
+			Target: c.Name + "/" + name,
+		})
 	}
 }
 
@@ -14,6 +14,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"scaffold/server/mongodb"
+	"scaffold/server/node"
 
 	logger "github.com/jfcarter2358/go-logger"
 )
@@ -97,6 +98,10 @@ func GetDataStoreByWorkflow(name string) (*DataStore, error) {
 
 // Update a datastore for a particular workflow
 func UpdateDataStoreByWorkflow(name string, d *DataStore, is []input.Input) error {
+	if err := input.ValidateValues(is, d.Env, false); err != nil {
+		return err
+	}
+
 	filter := bson.M{"name": name}
 
 	currentTime := time.Now().UTC()
@@ -120,7 +125,7 @@ func UpdateDataStoreByWorkflow(name string, d *DataStore, is []input.Input) erro
 	httpClient := http.Client{}
 	requestURL := fmt.Sprintf("%s://%s:%d/api/v1/input/%s/update", config.Config.Node.ManagerProtocol, config.Config.Node.ManagerHost, config.Config.Node.ManagerPort, d.Name)
 	req, _ := http.NewRequest("POST", requestURL, postBodyBuffer)
-	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", config.Config.Node.PrimaryKey))
+	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", node.Key()))
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
@@ -88,6 +88,11 @@ func InitBucket() {
 			}
 		}
 	}
+	if config.Config.FileStore.Type == constants.FILESTORE_TYPE_LOCAL {
+		if err := os.MkdirAll(config.Config.FileStore.Path, 0755); err != nil {
+			panic(err)
+		}
+	}
 }
 
 func GetFile(inputPath, outputPath string) error {
@@ -96,6 +101,8 @@ func GetFile(inputPath, outputPath string) error {
 		return doS3Download(inputPath, outputPath)
 	case constants.FILESTORE_TYPE_ARTIFACTORY:
 		return doArtifactoryDownload(inputPath, outputPath)
+	case constants.FILESTORE_TYPE_LOCAL:
+		return doLocalDownload(inputPath, outputPath)
 	}
 	return fmt.Errorf("invalid filestore type: %s", config.Config.FileStore.Type)
 }
@@ -106,18 +113,45 @@ func UploadFile(inputPath, outputPath string) error {
 		return doS3Upload(inputPath, outputPath)
 	case constants.FILESTORE_TYPE_ARTIFACTORY:
 		return doArtifactoryUpload(inputPath, outputPath)
+	case constants.FILESTORE_TYPE_LOCAL:
+		return doLocalUpload(inputPath, outputPath)
+	}
+	return fmt.Errorf("invalid filestore type: %s", config.Config.FileStore.Type)
+}
+
+func DeleteFile(path string) error {
+	switch config.Config.FileStore.Type {
+	case constants.FILESTORE_TYPE_S3:
+		return doS3Delete(path)
+	case constants.FILESTORE_TYPE_ARTIFACTORY:
+		return doArtifactoryDelete(path)
+	case constants.FILESTORE_TYPE_LOCAL:
+		return doLocalDelete(path)
 	}
 	return fmt.Errorf("invalid filestore type: %s", config.Config.FileStore.Type)
 }
 
 func ListObjects() (map[string]ObjectMetadata, error) {
+	var output map[string]ObjectMetadata
+	var err error
 	switch config.Config.FileStore.Type {
 	case constants.FILESTORE_TYPE_S3:
-		return doS3List()
+		output, err = doS3List()
 	case constants.FILESTORE_TYPE_ARTIFACTORY:
-		return doArtifactoryList()
+		output, err = doArtifactoryList()
+	case constants.FILESTORE_TYPE_LOCAL:
+		output, err = doLocalList()
+	default:
+		return map[string]ObjectMetadata{}, fmt.Errorf("invalid filestore type: %s", config.Config.FileStore.Type)
 	}
-	return map[string]ObjectMetadata{}, fmt.Errorf("invalid filestore type: %s", config.Config.FileStore.Type)
+	// Historical file versions are tracked by the artifact package, only the
+	// latest copy of each file is listed here
+	for key, obj := range output {
+		if obj.Workflow == constants.FILESTORE_VERSION_PREFIX {
+			delete(output, key)
+		}
+	}
+	return output, err
 }
 
 func doArtifactoryDownload(inputPath, outputPath string) error {
@@ -270,6 +304,26 @@ func doArtifactoryUpload(inputPath, outputPath string) error {
 	return nil
 }
 
+func doArtifactoryDelete(path string) error {
+	uri := fmt.Sprintf("%s://%s:%d/artifactory/%s", config.Config.FileStore.Protocol, config.Config.FileStore.Host, config.Config.FileStore.Port, config.Config.FileStore.Bucket)
+
+	httpClient := &http.Client{}
+	requestURL := fmt.Sprintf("%s/%s", uri, path)
+	req, _ := http.NewRequest("DELETE", requestURL, nil)
+	req.SetBasicAuth(config.Config.FileStore.AccessKey, config.Config.FileStore.SecretKey)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("got status code %d on file delete", resp.StatusCode)
+	}
+
+	return nil
+}
+
 func doS3Download(inputPath, outputPath string) error {
 	session, err := session.NewSession(S3Config)
 	if err != nil {
@@ -319,6 +373,21 @@ func doS3List() (map[string]ObjectMetadata, error) {
 	return output, nil
 }
 
+func doS3Delete(path string) error {
+	session, err := session.NewSession(S3Config)
+	if err != nil {
+		panic(err)
+	}
+	svc := s3.New(session)
+
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(config.Config.FileStore.Bucket),
+		Key:    aws.String(path),
+	})
+
+	return err
+}
+
 func doS3Upload(inputPath, outputPath string) error {
 	session, err := session.NewSession(S3Config)
 	if err != nil {
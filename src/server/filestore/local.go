@@ -0,0 +1,167 @@
+package filestore
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"scaffold/server/config"
+	"strings"
+)
+
+const localTempPrefix = ".scaffold-tmp-"
+
+// Resolve an object key to a path under the configured filestore directory,
+// refusing any key that would escape it
+func localPath(key string) (string, error) {
+	root, err := filepath.Abs(config.Config.FileStore.Path)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(key, "\x00") {
+		return "", fmt.Errorf("invalid filestore path %s", key)
+	}
+	cleaned := filepath.Clean("/" + filepath.ToSlash(key))
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid filestore path %s", key)
+	}
+	path := filepath.Join(root, cleaned)
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("filestore path %s is outside of %s", key, root)
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, localTempPrefix) {
+			return "", fmt.Errorf("invalid filestore path %s", key)
+		}
+	}
+	return path, nil
+}
+
+// Copy a file to its destination by writing a temporary file next to it and
+// renaming it into place so readers never see a partially written file
+func writeFileAtomic(src io.Reader, dest string) error {
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, localTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, dest); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+func doLocalDownload(inputPath, outputPath string) error {
+	path, err := localPath(inputPath)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func doLocalUpload(inputPath, outputPath string) error {
+	path, err := localPath(outputPath)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFileAtomic(in, path)
+}
+
+func doLocalList() (map[string]ObjectMetadata, error) {
+	output := make(map[string]ObjectMetadata)
+
+	root, err := filepath.Abs(config.Config.FileStore.Path)
+	if err != nil {
+		return output, err
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), localTempPrefix) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		output[key] = ObjectMetadata{
+			Name:     key,
+			Modified: info.ModTime().UTC().Format("2006-01-02T15:04:05Z"),
+			Workflow: strings.Split(key, "/")[0],
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return output, nil
+	}
+
+	return output, err
+}
+
+func doLocalDelete(path string) error {
+	p, err := localPath(path)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(p)
+}
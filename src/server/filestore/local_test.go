@@ -0,0 +1,96 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"testing"
+)
+
+func setupLocal(t *testing.T) string {
+	root := t.TempDir()
+	config.Config.FileStore.Type = constants.FILESTORE_TYPE_LOCAL
+	config.Config.FileStore.Path = root
+	return root
+}
+
+func TestLocalUploadDownloadList(t *testing.T) {
+	setupLocal(t)
+
+	src := filepath.Join(t.TempDir(), "in.txt")
+	if err := os.WriteFile(src, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := UploadFile(src, "foo/bar.txt"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "out.txt")
+	if err := GetFile("foo/bar.txt", dest); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("got %q, expected %q", string(data), "hello")
+	}
+
+	objects, err := ListObjects()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	obj, ok := objects["foo/bar.txt"]
+	if !ok {
+		t.Fatalf("object foo/bar.txt missing from %v", objects)
+	}
+	if obj.Workflow != "foo" || obj.Name != "foo/bar.txt" || obj.Modified == "" {
+		t.Fatalf("unexpected metadata %v", obj)
+	}
+}
+
+func TestLocalIgnoresTempFiles(t *testing.T) {
+	root := setupLocal(t)
+
+	if err := os.MkdirAll(filepath.Join(root, "foo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "foo", localTempPrefix+"123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := ListObjects()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(objects) != 0 {
+		t.Fatalf("expected no objects, got %v", objects)
+	}
+}
+
+func TestLocalPathTraversal(t *testing.T) {
+	root := setupLocal(t)
+
+	for _, key := range []string{"", "/", "..", "../escape", "foo/../../escape"} {
+		path, err := localPath(key)
+		if key == "../escape" || key == "foo/../../escape" {
+			// cleaned keys are rooted, so they must resolve inside of the filestore
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", key, err)
+			}
+			if filepath.Dir(path) != root {
+				t.Fatalf("key %q resolved outside of root: %s", key, path)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("expected error for key %q, got path %s", key, path)
+		}
+	}
+
+	if _, err := localPath("foo/" + localTempPrefix + "abc"); err == nil {
+		t.Fatalf("expected error for temp file key")
+	}
+}
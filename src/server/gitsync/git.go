@@ -0,0 +1,117 @@
+package gitsync
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"scaffold/server/workflow"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A workflow definition found in the repository along with the file it was
+// read from, relative to the repository root
+type definition struct {
+	File     string
+	Workflow workflow.Workflow
+}
+
+func git(dir string, args ...string) (string, error) {
+	command := args[0]
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s", command, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Bring the working copy in dir up to date with the branch of the repository,
+// cloning it first if needed, and return the commit it is now at. A working
+// copy of a different repository is thrown away and cloned again
+func checkout(repository, branch, dir string) (string, error) {
+	origin := ""
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		origin, _ = git(dir, "remote", "get-url", "origin")
+	}
+	if origin != repository {
+		if err := os.RemoveAll(dir); err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return "", err
+		}
+		if _, err := git("", "clone", "--quiet", "--single-branch", "--branch", branch, repository, dir); err != nil {
+			return "", err
+		}
+	} else {
+		if _, err := git(dir, "fetch", "--quiet", "origin", branch); err != nil {
+			return "", err
+		}
+		if _, err := git(dir, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	}
+	return git(dir, "rev-parse", "HEAD")
+}
+
+// Get the last commit that touched a file in the working copy
+func lastCommit(dir, file string) (string, error) {
+	return git(dir, "log", "-1", "--format=%H", "--", file)
+}
+
+// Read every workflow defined in a YAML file under path in the working copy.
+// Files without a workflow name are skipped, a name defined twice is an error
+func readDefinitions(dir, path string) ([]definition, error) {
+	root := filepath.Join(dir, path)
+	if root != dir && !strings.HasPrefix(root, dir+string(filepath.Separator)) {
+		return nil, fmt.Errorf("sync path %s is outside of the repository", path)
+	}
+
+	defs := []definition{}
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(p)
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var w workflow.Workflow
+		if err := yaml.Unmarshal(data, &w); err != nil {
+			return fmt.Errorf("cannot parse %s: %s", rel, err.Error())
+		}
+		if w.Name == "" {
+			return nil
+		}
+		if other, ok := files[w.Name]; ok {
+			return fmt.Errorf("workflow %s is defined in both %s and %s", w.Name, other, rel)
+		}
+		files[w.Name] = rel
+		defs = append(defs, definition{File: rel, Workflow: w})
+		return nil
+	})
+	return defs, err
+}
@@ -0,0 +1,115 @@
+package gitsync
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %s", args, out)
+	}
+	return string(out)
+}
+
+func commitFile(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, dir, "add", "-A")
+	run(t, dir, "commit", "-q", "-m", "update "+name)
+	run(t, dir, "push", "-q", "origin", "HEAD:main")
+}
+
+func TestCheckoutAndRead(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmp := t.TempDir()
+	bare := filepath.Join(tmp, "remote.git")
+	work := filepath.Join(tmp, "work")
+	dir := filepath.Join(tmp, "sync")
+	repository := "file://" + bare
+
+	run(t, tmp, "init", "-q", "--bare", "-b", "main", bare)
+	run(t, tmp, "clone", "-q", repository, work)
+	run(t, work, "checkout", "-q", "-b", "main")
+
+	commitFile(t, work, "workflows/build.yaml", "version: v1\nname: build\ntasks:\n  - name: compile\n    run: make\n")
+	commitFile(t, work, "workflows/deploy.yml", "version: v1\nname: deploy\n")
+	commitFile(t, work, "README.md", "not a workflow\n")
+	commitFile(t, work, "workflows/values.yaml", "replicas: 3\n")
+
+	head, err := checkout(repository, "main", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := run(t, work, "rev-parse", "HEAD"); got[:40] != head {
+		t.Errorf("checkout at %s, want %s", head, got[:40])
+	}
+
+	defs, err := readDefinitions(dir, "workflows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 2 || defs[0].Workflow.Name != "build" || defs[1].Workflow.Name != "deploy" {
+		t.Fatalf("unexpected definitions: %+v", defs)
+	}
+	if defs[0].File != "workflows/build.yaml" || len(defs[0].Workflow.Tasks) != 1 {
+		t.Errorf("unexpected build definition: %+v", defs[0])
+	}
+
+	buildCommit, err := lastCommit(dir, defs[0].File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buildCommit == head {
+		t.Errorf("build.yaml was not changed by the latest commit")
+	}
+
+	// A second sync fast-forwards the existing working copy
+	commitFile(t, work, "workflows/deploy.yml", "version: v2\nname: deploy\n")
+	next, err := checkout(repository, "main", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == head {
+		t.Errorf("checkout did not pick up the new commit")
+	}
+	if c, _ := lastCommit(dir, "workflows/deploy.yml"); c != next {
+		t.Errorf("deploy.yml last commit is %s, want %s", c, next)
+	}
+	defs, err = readDefinitions(dir, "workflows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defs[1].Workflow.Version != "v2" {
+		t.Errorf("deploy version is %s, want v2", defs[1].Workflow.Version)
+	}
+
+	commitFile(t, work, "workflows/copy.yaml", "version: v1\nname: build\n")
+	if _, err := checkout(repository, "main", dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readDefinitions(dir, "workflows"); err == nil {
+		t.Errorf("expected an error for a workflow defined twice")
+	}
+	if _, err := readDefinitions(dir, "../.."); err == nil {
+		t.Errorf("expected an error for a path outside of the repository")
+	}
+}
@@ -0,0 +1,291 @@
+package gitsync
+
+import (
+	"fmt"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"scaffold/server/namespace"
+	"scaffold/server/workflow"
+	"sync"
+	"time"
+
+	logger "github.com/jfcarter2358/go-logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"scaffold/server/mongodb"
+)
+
+const AUTHOR = constants.REVISION_AUTHOR_GITSYNC
+
+// The sync state of a single workflow managed from the repository
+type Status struct {
+	Workflow string `json:"workflow" bson:"workflow" yaml:"workflow"`
+	File     string `json:"file" bson:"file" yaml:"file"`
+	Commit   string `json:"commit" bson:"commit" yaml:"commit"`
+	Status   string `json:"status" bson:"status" yaml:"status"`
+	Error    string `json:"error" bson:"error" yaml:"error"`
+	Synced   string `json:"synced" bson:"synced" yaml:"synced"`
+}
+
+// The outcome of the last sync of the whole repository
+type Summary struct {
+	Repository string    `json:"repository" yaml:"repository"`
+	Branch     string    `json:"branch" yaml:"branch"`
+	Path       string    `json:"path" yaml:"path"`
+	Commit     string    `json:"commit" yaml:"commit"`
+	Error      string    `json:"error" yaml:"error"`
+	Synced     string    `json:"synced" yaml:"synced"`
+	Workflows  []*Status `json:"workflows" yaml:"workflows"`
+}
+
+var last Summary
+var lock sync.Mutex
+
+func Enabled() bool {
+	return config.Config.GitSync.Repository != ""
+}
+
+// Sync on a schedule, logging instead of returning errors
+func Run() {
+	if err := Sync(); err != nil {
+		logger.Errorf("", "Git sync of %s failed: %s", config.Config.GitSync.Repository, err.Error())
+	}
+}
+
+// Pull the configured repository and apply every workflow defined in it that
+// differs from what is currently applied. Workflows synced before but no
+// longer in the repository are deleted when pruning is enabled, otherwise they
+// are marked as orphaned
+func Sync() error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	cfg := config.Config.GitSync
+	if cfg.Repository == "" {
+		return fmt.Errorf("no git sync repository is configured")
+	}
+
+	currentTime := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	last = Summary{
+		Repository: cfg.Repository,
+		Branch:     cfg.Branch,
+		Path:       cfg.Path,
+		Commit:     last.Commit,
+		Synced:     currentTime,
+	}
+
+	err := syncRepository(cfg, currentTime)
+	if err != nil {
+		last.Error = err.Error()
+	}
+	return err
+}
+
+func syncRepository(cfg config.GitSyncObject, currentTime string) error {
+	commit, err := checkout(cfg.Repository, cfg.Branch, cfg.Directory)
+	if err != nil {
+		return err
+	}
+	last.Commit = commit
+
+	// A definition that cannot be read aborts the whole sync so a broken
+	// file is never mistaken for a removed workflow
+	defs, err := readDefinitions(cfg.Directory, cfg.Path)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for _, d := range defs {
+		// Statuses are kept under the name the workflow is stored as, which
+		// includes its namespace
+		w := d.Workflow
+		qerr := workflow.Qualify(&w)
+		names[w.Name] = true
+
+		s := &Status{
+			Workflow: w.Name,
+			File:     d.File,
+			Status:   constants.GITSYNC_STATUS_SYNCED,
+			Synced:   currentTime,
+		}
+		if s.Commit, err = lastCommit(cfg.Directory, d.File); err != nil {
+			return err
+		}
+		if err = qerr; err == nil {
+			err = apply(&w, s.Commit)
+		}
+		if err != nil {
+			logger.Errorf("", "Cannot sync workflow %s from %s: %s", s.Workflow, s.File, err.Error())
+			s.Status = constants.GITSYNC_STATUS_ERROR
+			s.Error = err.Error()
+		}
+		if err := saveStatus(s); err != nil {
+			return err
+		}
+	}
+
+	statuses, err := GetAllStatuses()
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if names[s.Workflow] {
+			continue
+		}
+		if !cfg.Prune {
+			s.Status = constants.GITSYNC_STATUS_ORPHANED
+			s.Error = ""
+			s.Synced = currentTime
+			if err := saveStatus(s); err != nil {
+				return err
+			}
+			continue
+		}
+		logger.Infof("", "Pruning workflow %s removed from %s", s.Workflow, cfg.Repository)
+		if err := workflow.DeleteWorkflowByName(s.Workflow); err != nil {
+			logger.Warnf("", "Cannot prune workflow %s: %s", s.Workflow, err.Error())
+		}
+		if err := DeleteStatusByWorkflow(s.Workflow); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Create or update a workflow unless its definition matches what is applied
+func apply(w *workflow.Workflow, commit string) error {
+	// Compare the expanded definition as templates are expanded when applied
+	if err := workflow.Expand(w); err != nil {
+		return err
+	}
+	def, err := workflow.Definition(w)
+	if err != nil {
+		return err
+	}
+
+	if _, err := namespace.CheckWorkflow(w); err != nil {
+		return err
+	}
+
+	existing, err := workflow.GetWorkflowByName(w.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		current, err := workflow.Definition(existing)
+		if err != nil {
+			return err
+		}
+		if current == def {
+			return nil
+		}
+		logger.Infof("", "Updating workflow %s from commit %s", w.Name, commit)
+		err = workflow.UpdateWorkflowByName(w.Name, w)
+		if err != nil {
+			return err
+		}
+	} else {
+		logger.Infof("", "Creating workflow %s from commit %s", w.Name, commit)
+		if err := workflow.CreateWorkflow(w); err != nil {
+			return err
+		}
+	}
+
+	_, err = workflow.RecordRevision(w, AUTHOR, fmt.Sprintf("Synced from commit %s", commit))
+	return err
+}
+
+// Get the outcome of the last sync along with the status of every workflow
+func GetSummary() (*Summary, error) {
+	lock.Lock()
+	s := last
+	lock.Unlock()
+
+	if s.Repository == "" {
+		s.Repository = config.Config.GitSync.Repository
+		s.Branch = config.Config.GitSync.Branch
+		s.Path = config.Config.GitSync.Path
+	}
+
+	var err error
+	s.Workflows, err = GetAllStatuses()
+	return &s, err
+}
+
+func saveStatus(s *Status) error {
+	filter := bson.M{"workflow": s.Workflow}
+	opts := options.Replace().SetUpsert(true)
+
+	_, err := mongodb.Collections[constants.MONGODB_GITSYNC_COLLECTION_NAME].ReplaceOne(mongodb.Ctx, filter, s, opts)
+	return err
+}
+
+func DeleteStatusByWorkflow(workflow string) error {
+	filter := bson.M{"workflow": workflow}
+
+	_, err := mongodb.Collections[constants.MONGODB_GITSYNC_COLLECTION_NAME].DeleteOne(mongodb.Ctx, filter)
+
+	return err
+}
+
+func GetAllStatuses() ([]*Status, error) {
+	filter := bson.D{{}}
+
+	return FilterStatuses(filter)
+}
+
+func GetStatusByWorkflow(workflow string) (*Status, error) {
+	filter := bson.M{"workflow": workflow}
+
+	statuses, err := FilterStatuses(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+
+	if len(statuses) > 1 {
+		return nil, fmt.Errorf("multiple sync statuses found for workflow %s", workflow)
+	}
+
+	return statuses[0], nil
+}
+
+func FilterStatuses(filter interface{}) ([]*Status, error) {
+	// A slice of statuses for storing the decoded documents
+	var statuses []*Status
+
+	collection := mongodb.Collections[constants.MONGODB_GITSYNC_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	opts := options.Find().SetSort(bson.M{"workflow": 1})
+	cur, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return statuses, err
+	}
+
+	for cur.Next(ctx) {
+		var s Status
+		err := cur.Decode(&s)
+		if err != nil {
+			return statuses, err
+		}
+
+		statuses = append(statuses, &s)
+	}
+
+	if err := cur.Err(); err != nil {
+		return statuses, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return statuses, nil
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"scaffold/server/config"
 	"scaffold/server/constants"
+	"scaffold/server/input"
+	"scaffold/server/revision"
+	"scaffold/server/secret"
 	"scaffold/server/state"
 	"time"
 
@@ -16,11 +19,75 @@ import (
 )
 
 type History struct {
-	RunID    string        `json:"run_id" bson:"run_id" yaml:"run_id"`
-	States   []state.State `json:"states" bson:"states" yaml:"states"`
-	Workflow string        `json:"workflow" bson:"workflow" yaml:"workflow"`
-	Created  string        `json:"created" bson:"created" yaml:"created"`
-	Updated  string        `json:"updated" bson:"updated" yaml:"updated"`
+	RunID    string            `json:"run_id" bson:"run_id" yaml:"run_id"`
+	States   []state.State     `json:"states" bson:"states" yaml:"states"`
+	Workflow string            `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Params   map[string]string `json:"params" bson:"params" yaml:"params"`
+	// Revision of the workflow definition the run executed
+	Revision int `json:"revision" bson:"revision" yaml:"revision"`
+	// Encrypted values of overridden secret inputs, shown masked in Params
+	SecretParams map[string]string `json:"-" bson:"secret_params" yaml:"-"`
+	// Task in another workflow whose run started this one
+	Upstream *Upstream `json:"upstream,omitempty" bson:"upstream,omitempty" yaml:"upstream,omitempty"`
+	Created  string    `json:"created" bson:"created" yaml:"created"`
+	Updated  string    `json:"updated" bson:"updated" yaml:"updated"`
+}
+
+// The run of a task in another workflow that a run was started by
+type Upstream struct {
+	Workflow string `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Task     string `json:"task" bson:"task" yaml:"task"`
+	RunID    string `json:"run_id" bson:"run_id" yaml:"run_id"`
+}
+
+// Record the input overrides a run was triggered with. Overrides of secret
+// inputs are stored encrypted and only appear masked in the history
+func SetParams(h *History, params map[string]string, is []input.Input) error {
+	h.Params = map[string]string{}
+	h.SecretParams = map[string]string{}
+	for key, val := range params {
+		isSecret := false
+		for _, i := range is {
+			if i.Name == key && i.Type == constants.INPUT_TYPE_SECRET {
+				isSecret = true
+				break
+			}
+		}
+		if !isSecret {
+			h.Params[key] = val
+			continue
+		}
+		ciphertext, err := secret.Encrypt(val)
+		if err != nil {
+			return err
+		}
+		h.Params[key] = secret.MASK
+		h.SecretParams[key] = ciphertext
+	}
+	return nil
+}
+
+// Get the plain-text input overrides of a run
+func GetParams(runID string) (map[string]string, error) {
+	params := map[string]string{}
+	if runID == "" {
+		return params, nil
+	}
+	h, err := GetHistoryByRunID(runID)
+	if err != nil || h == nil {
+		return params, err
+	}
+	for key, val := range h.Params {
+		params[key] = val
+	}
+	for key, val := range h.SecretParams {
+		plaintext, err := secret.Decrypt(val)
+		if err != nil {
+			return params, err
+		}
+		params[key] = plaintext
+	}
+	return params, nil
 }
 
 func PruneHistories() {
@@ -77,6 +144,16 @@ func CreateHistory(h *History) error {
 
 	logger.Errorf("", "Creating history for %s", h.RunID)
 
+	if h.Revision == 0 {
+		r, err := revision.GetLatestRevision(h.Workflow)
+		if err != nil {
+			return err
+		}
+		if r != nil {
+			h.Revision = r.Version
+		}
+	}
+
 	hh, err := GetHistoryByRunID(h.RunID)
 	if err != nil {
 		return fmt.Errorf("error getting histories: %s", err.Error())
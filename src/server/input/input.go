@@ -11,14 +11,21 @@ import (
 )
 
 type Input struct {
-	Name        string `json:"name" bson:"name" yaml:"name"`
-	Workflow    string `json:"workflow" bson:"workflow" yaml:"workflow"`
-	Description string `json:"description" bson:"description" yaml:"description"`
-	Default     string `json:"default" bson:"default" yaml:"default"`
-	Type        string `json:"type" bson:"type" yaml:"type"`
+	Name        string   `json:"name" bson:"name" yaml:"name"`
+	Workflow    string   `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Description string   `json:"description" bson:"description" yaml:"description"`
+	Default     string   `json:"default" bson:"default" yaml:"default"`
+	Type        string   `json:"type" bson:"type" yaml:"type"`
+	Required    bool     `json:"required" bson:"required" yaml:"required"`
+	Options     []string `json:"options" bson:"options" yaml:"options"`
+	Pattern     string   `json:"pattern" bson:"pattern" yaml:"pattern"`
 }
 
 func CreateInput(i *Input) error {
+	if err := ValidateDefinition(i); err != nil {
+		return err
+	}
+
 	ii, err := GetInputByNames(i.Workflow, i.Name)
 	if err != nil {
 		return fmt.Errorf("error getting inputs: %s", err.Error())
@@ -112,6 +119,10 @@ func GetInputsByWorkflow(workflow string) ([]*Input, error) {
 }
 
 func UpdateInputByNames(workflow, name string, i *Input) error {
+	if err := ValidateDefinition(i); err != nil {
+		return err
+	}
+
 	filter := bson.M{"workflow": workflow, "name": name}
 
 	collection := mongodb.Collections[constants.MONGODB_INPUT_COLLECTION_NAME]
@@ -0,0 +1,158 @@
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"scaffold/server/constants"
+	"strconv"
+	"strings"
+)
+
+// Returned when an input definition or value is invalid, so callers can report
+// it as a bad request rather than a server error
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, "; ")
+}
+
+var types = []string{
+	constants.INPUT_TYPE_STRING,
+	constants.INPUT_TYPE_PLAINTEXT,
+	constants.INPUT_TYPE_INT,
+	constants.INPUT_TYPE_BOOL,
+	constants.INPUT_TYPE_ENUM,
+	constants.INPUT_TYPE_REGEX,
+	constants.INPUT_TYPE_JSON,
+	constants.INPUT_TYPE_SECRET,
+}
+
+// Check that an input is well formed and that its default satisfies its type
+func ValidateDefinition(i *Input) error {
+	errs := []string{}
+
+	if i.Name == "" {
+		errs = append(errs, "input name is required")
+	}
+
+	known := i.Type == ""
+	for _, t := range types {
+		if i.Type == t {
+			known = true
+			break
+		}
+	}
+	if !known {
+		errs = append(errs, fmt.Sprintf("input %s has unknown type %s", i.Name, i.Type))
+	}
+
+	switch i.Type {
+	case constants.INPUT_TYPE_ENUM:
+		if len(i.Options) == 0 {
+			errs = append(errs, fmt.Sprintf("enum input %s must list its options", i.Name))
+		}
+	case constants.INPUT_TYPE_REGEX:
+		if i.Pattern == "" {
+			errs = append(errs, fmt.Sprintf("regex input %s must have a pattern", i.Name))
+		} else if _, err := regexp.Compile(i.Pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("regex input %s has an invalid pattern: %s", i.Name, err.Error()))
+		}
+	}
+
+	if len(errs) == 0 && i.Default != "" {
+		if err := ValidateValue(i, i.Default); err != nil {
+			errs = append(errs, fmt.Sprintf("default of %s", err.Error()))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// Check a single value against an input's type. An empty value is only
+// rejected for required inputs
+func ValidateValue(i *Input, value string) error {
+	if value == "" {
+		if i.Required {
+			return fmt.Errorf("input %s is required", i.Name)
+		}
+		return nil
+	}
+
+	switch i.Type {
+	case constants.INPUT_TYPE_INT:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("input %s must be an integer", i.Name)
+		}
+	case constants.INPUT_TYPE_BOOL:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("input %s must be true or false", i.Name)
+		}
+	case constants.INPUT_TYPE_ENUM:
+		for _, o := range i.Options {
+			if value == o {
+				return nil
+			}
+		}
+		return fmt.Errorf("input %s must be one of %s", i.Name, strings.Join(i.Options, ", "))
+	case constants.INPUT_TYPE_REGEX:
+		re, err := regexp.Compile(i.Pattern)
+		if err != nil {
+			return fmt.Errorf("input %s has an invalid pattern: %s", i.Name, err.Error())
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("input %s must match %s", i.Name, i.Pattern)
+		}
+	case constants.INPUT_TYPE_JSON:
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("input %s must be valid JSON", i.Name)
+		}
+	}
+	return nil
+}
+
+// Check per-run overrides, which may only set inputs the workflow defines
+func ValidateOverrides(is []Input, values map[string]string) error {
+	errs := []string{}
+	for key := range values {
+		found := false
+		for _, i := range is {
+			if i.Name == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s is not an input of this workflow", key))
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return ValidateValues(is, values, true)
+}
+
+// Check a set of values against a workflow's inputs. With partial set only the
+// values that are present are checked, as for trigger payloads that override
+// some inputs. Values that do not belong to an input are ignored
+func ValidateValues(is []Input, values map[string]string, partial bool) error {
+	errs := []string{}
+	for idx := range is {
+		val, ok := values[is[idx].Name]
+		if !ok && partial {
+			continue
+		}
+		if err := ValidateValue(&is[idx], val); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package input
+
+import (
+	"scaffold/server/constants"
+	"testing"
+)
+
+func TestValidateDefinition(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Input
+		ok    bool
+	}{
+		{"untyped", Input{Name: "a"}, true},
+		{"legacy plaintext", Input{Name: "a", Type: constants.INPUT_TYPE_PLAINTEXT}, true},
+		{"unknown type", Input{Name: "a", Type: "float"}, false},
+		{"missing name", Input{Type: constants.INPUT_TYPE_STRING}, false},
+		{"enum without options", Input{Name: "a", Type: constants.INPUT_TYPE_ENUM}, false},
+		{"enum", Input{Name: "a", Type: constants.INPUT_TYPE_ENUM, Options: []string{"dev", "prod"}, Default: "dev"}, true},
+		{"enum bad default", Input{Name: "a", Type: constants.INPUT_TYPE_ENUM, Options: []string{"dev", "prod"}, Default: "qa"}, false},
+		{"regex without pattern", Input{Name: "a", Type: constants.INPUT_TYPE_REGEX}, false},
+		{"regex bad pattern", Input{Name: "a", Type: constants.INPUT_TYPE_REGEX, Pattern: "("}, false},
+		{"int bad default", Input{Name: "a", Type: constants.INPUT_TYPE_INT, Default: "ten"}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateDefinition(&tt.input)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: ValidateDefinition error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		input Input
+		value string
+		ok    bool
+	}{
+		{Input{Name: "a"}, "", true},
+		{Input{Name: "a", Required: true}, "", false},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_INT}, "42", true},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_INT}, "4.2", false},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_BOOL}, "true", true},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_BOOL}, "yes", false},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_ENUM, Options: []string{"dev", "prod"}}, "prod", true},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_ENUM, Options: []string{"dev", "prod"}}, "qa", false},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_REGEX, Pattern: `^v\d+$`}, "v12", true},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_REGEX, Pattern: `^v\d+$`}, "12", false},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_JSON}, `{"a": [1, 2]}`, true},
+		{Input{Name: "a", Type: constants.INPUT_TYPE_JSON}, `{"a": `, false},
+	}
+	for _, tt := range tests {
+		err := ValidateValue(&tt.input, tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateValue(%s %q) error = %v, want ok %v", tt.input.Type, tt.value, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateValues(t *testing.T) {
+	is := []Input{
+		{Name: "count", Type: constants.INPUT_TYPE_INT, Required: true},
+		{Name: "env", Type: constants.INPUT_TYPE_ENUM, Options: []string{"dev", "prod"}},
+	}
+
+	if err := ValidateValues(is, map[string]string{"env": "dev"}, false); err == nil {
+		t.Errorf("missing required input was accepted")
+	}
+	if err := ValidateValues(is, map[string]string{"env": "dev"}, true); err != nil {
+		t.Errorf("partial values were rejected: %v", err)
+	}
+	if err := ValidateValues(is, map[string]string{"count": "3", "other": "x"}, false); err != nil {
+		t.Errorf("valid values were rejected: %v", err)
+	}
+	if err := ValidateValues(is, map[string]string{"count": "three", "env": "qa"}, false); err == nil {
+		t.Errorf("invalid values were accepted")
+	} else if len(err.(*ValidationError).Errors) != 2 {
+		t.Errorf("got %d errors, want 2", len(err.(*ValidationError).Errors))
+	}
+}
+
+func TestValidateOverrides(t *testing.T) {
+	is := []Input{
+		{Name: "count", Type: constants.INPUT_TYPE_INT, Required: true},
+	}
+
+	if err := ValidateOverrides(is, nil); err != nil {
+		t.Errorf("no overrides were rejected: %v", err)
+	}
+	if err := ValidateOverrides(is, map[string]string{"count": "3"}); err != nil {
+		t.Errorf("valid override was rejected: %v", err)
+	}
+	if err := ValidateOverrides(is, map[string]string{"count": "x"}); err == nil {
+		t.Errorf("invalid override was accepted")
+	}
+	if err := ValidateOverrides(is, map[string]string{"other": "x"}); err == nil {
+		t.Errorf("override of unknown input was accepted")
+	}
+}
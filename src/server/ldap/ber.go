@@ -0,0 +1,166 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The subset of BER that LDAP messages need
+
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+	constructed      = 0x20
+)
+
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10 | constructed
+	tagSet         = 0x11 | constructed
+)
+
+// The largest message Scaffold will read from a directory
+const maxPacketSize = 16 * 1024 * 1024
+
+type packet struct {
+	tag      byte
+	value    []byte
+	children []*packet
+}
+
+func (p *packet) constructed() bool {
+	return p.tag&constructed != 0
+}
+
+func newSequence(tag byte, children ...*packet) *packet {
+	return &packet{tag: tag, children: children}
+}
+
+func newString(tag byte, s string) *packet {
+	return &packet{tag: tag, value: []byte(s)}
+}
+
+// Encode a non-negative integer
+func newInteger(tag byte, i int) *packet {
+	value := []byte{}
+	for {
+		value = append([]byte{byte(i)}, value...)
+		i >>= 8
+		if i == 0 && value[0]&0x80 == 0 {
+			break
+		}
+	}
+	return &packet{tag: tag, value: value}
+}
+
+func newBoolean(b bool) *packet {
+	if b {
+		return &packet{tag: tagBoolean, value: []byte{0xff}}
+	}
+	return &packet{tag: tagBoolean, value: []byte{0x00}}
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	out := []byte{}
+	for ; n > 0; n >>= 8 {
+		out = append([]byte{byte(n)}, out...)
+	}
+	return append([]byte{0x80 | byte(len(out))}, out...)
+}
+
+func (p *packet) bytes() []byte {
+	content := p.value
+	if p.constructed() {
+		content = []byte{}
+		for _, child := range p.children {
+			content = append(content, child.bytes()...)
+		}
+	}
+	out := append([]byte{p.tag}, encodeLength(len(content))...)
+	return append(out, content...)
+}
+
+func (p *packet) integer() int {
+	i := 0
+	for idx, b := range p.value {
+		if idx == 0 && b&0x80 != 0 {
+			i = -1
+		}
+		i = i<<8 | int(b)
+	}
+	return i
+}
+
+func (p *packet) child(idx int) (*packet, error) {
+	if idx >= len(p.children) {
+		return nil, fmt.Errorf("packet with tag %#x has no element %d", p.tag, idx)
+	}
+	return p.children[idx], nil
+}
+
+// Read one element and everything inside it
+func readPacket(r *bufio.Reader) (*packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&0x1f == 0x1f {
+		return nil, errors.New("multi-byte tags are not supported")
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, errors.New("unsupported length encoding")
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length < 0 || length > maxPacketSize {
+		return nil, fmt.Errorf("packet of %d bytes is too large", length)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parsePacket(tag, content)
+}
+
+func parsePacket(tag byte, content []byte) (*packet, error) {
+	p := &packet{tag: tag}
+	if !p.constructed() {
+		p.value = content
+		return p, nil
+	}
+	r := bufio.NewReader(bytes.NewReader(content))
+	for {
+		child, err := readPacket(r)
+		if err == io.EOF {
+			return p, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+	}
+}
@@ -0,0 +1,182 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"scaffold/server/config"
+	"strings"
+)
+
+// A directory user and the names of the groups they are a member of
+type Account struct {
+	DN         string
+	Username   string
+	Email      string
+	GivenName  string
+	FamilyName string
+	Groups     []string
+}
+
+// Check whether an LDAP directory is configured
+func Enabled() bool {
+	return config.Config.LDAP.URL != ""
+}
+
+// The LDAP configuration with defaults filled in for anything left out
+func settings() config.LDAPObject {
+	c := config.Config.LDAP
+	if c.UserFilter == "" {
+		c.UserFilter = "(uid={username})"
+	}
+	if c.EmailAttribute == "" {
+		c.EmailAttribute = "mail"
+	}
+	if c.GivenNameAttribute == "" {
+		c.GivenNameAttribute = "givenName"
+	}
+	if c.FamilyNameAttribute == "" {
+		c.FamilyNameAttribute = "sn"
+	}
+	if c.GroupAttribute == "" {
+		c.GroupAttribute = "memberOf"
+	}
+	if c.GroupBaseDN == "" {
+		c.GroupBaseDN = c.BaseDN
+	}
+	return c
+}
+
+// Connect to the configured directory, binding as the service account when
+// one is set
+func Connect() (*Conn, error) {
+	c := settings()
+	conn, err := Dial(c.URL, c.StartTLS)
+	if err != nil {
+		return nil, err
+	}
+	if c.BindDN != "" {
+		if err := conn.Bind(c.BindDN, c.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("service account bind failed: %s", err.Error())
+		}
+	}
+	return conn, nil
+}
+
+// Look up a user and their groups, returning nil when the directory has no
+// such user
+func (conn *Conn) FindUser(username string) (*Account, error) {
+	c := settings()
+	filter := strings.ReplaceAll(c.UserFilter, "{username}", EscapeFilter(username))
+	entries, err := conn.Search(c.BaseDN, filter, []string{c.EmailAttribute, c.GivenNameAttribute, c.FamilyNameAttribute, c.GroupAttribute})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if len(entries) > 1 {
+		return nil, fmt.Errorf("multiple directory entries found for user %s", username)
+	}
+
+	e := entries[0]
+	a := &Account{
+		DN:         e.DN,
+		Username:   username,
+		Email:      e.Value(c.EmailAttribute),
+		GivenName:  e.Value(c.GivenNameAttribute),
+		FamilyName: e.Value(c.FamilyNameAttribute),
+		Groups:     []string{},
+	}
+
+	// Directories without a memberOf attribute are searched for groups that
+	// list the user as a member instead
+	if c.GroupFilter == "" {
+		a.Groups = append(a.Groups, e.Values(c.GroupAttribute)...)
+		return a, nil
+	}
+	filter = strings.ReplaceAll(c.GroupFilter, "{dn}", EscapeFilter(e.DN))
+	filter = strings.ReplaceAll(filter, "{username}", EscapeFilter(username))
+	groups, err := conn.Search(c.GroupBaseDN, filter, []string{"cn"})
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		a.Groups = append(a.Groups, g.DN)
+	}
+	return a, nil
+}
+
+// Check a username and password against the directory by binding as the user
+func Authenticate(username, password string) (*Account, error) {
+	if password == "" {
+		return nil, errors.New("password is required")
+	}
+	conn, err := Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	a, err := conn.FindUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, fmt.Errorf("no directory user found with username %s", username)
+	}
+	if err := conn.Bind(a.DN, password); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Get the common name of a group from its DN
+func groupName(dn string) string {
+	first := strings.SplitN(dn, ",", 2)[0]
+	if key, value, found := strings.Cut(first, "="); found && strings.EqualFold(strings.TrimSpace(key), "cn") {
+		return strings.TrimSpace(value)
+	}
+	return dn
+}
+
+func lookupMapping(mapping map[string]string, dn string) (string, bool) {
+	for key, value := range mapping {
+		if strings.EqualFold(key, dn) || strings.EqualFold(key, groupName(dn)) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Map directory groups to Scaffold groups and roles. Mapping keys can be either
+// the DN or the common name of a group. Without a group mapping every group is
+// used by its common name, users with no mapped role get the default roles
+func MapGroups(dns []string) ([]string, []string) {
+	c := config.Config.LDAP
+	groups := []string{}
+	roles := []string{}
+	for _, dn := range dns {
+		if len(c.GroupMapping) == 0 {
+			groups = appendUnique(groups, groupName(dn))
+		} else if mapped, ok := lookupMapping(c.GroupMapping, dn); ok {
+			groups = appendUnique(groups, mapped)
+		}
+		if mapped, ok := lookupMapping(c.RoleMapping, dn); ok {
+			roles = appendUnique(roles, mapped)
+		}
+	}
+	if len(roles) == 0 {
+		roles = append(roles, c.DefaultRoles...)
+	}
+	return groups, roles
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
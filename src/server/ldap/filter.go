@@ -0,0 +1,170 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	filterAnd            = classContext | constructed | 0
+	filterOr             = classContext | constructed | 1
+	filterNot            = classContext | constructed | 2
+	filterEqualityMatch  = classContext | constructed | 3
+	filterSubstrings     = classContext | constructed | 4
+	filterGreaterOrEqual = classContext | constructed | 5
+	filterLessOrEqual    = classContext | constructed | 6
+	filterPresent        = classContext | 7
+	filterApproxMatch    = classContext | constructed | 8
+)
+
+// Escape a value so it can be put into a search filter as is
+func EscapeFilter(s string) string {
+	var out strings.Builder
+	for _, b := range []byte(s) {
+		switch b {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&out, "\\%02x", b)
+		default:
+			out.WriteByte(b)
+		}
+	}
+	return out.String()
+}
+
+func unescapeFilter(s string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", fmt.Errorf("filter value %s has an incomplete escape", s)
+		}
+		b, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("filter value %s has an invalid escape", s)
+		}
+		out.Write(b)
+		i += 2
+	}
+	return out.String(), nil
+}
+
+// Encode a search filter such as `(&(objectClass=person)(uid=jdoe))`
+func parseFilter(s string) (*packet, error) {
+	p, rest, err := parseFilterAt(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("filter %s has trailing text %s", s, rest)
+	}
+	return p, nil
+}
+
+func parseFilterAt(s string) (*packet, string, error) {
+	if !strings.HasPrefix(s, "(") || len(s) < 2 {
+		return nil, "", fmt.Errorf("filter %s does not start with (", s)
+	}
+	s = s[1:]
+
+	switch s[0] {
+	case '&', '|', '!':
+		op := s[0]
+		tag := byte(filterAnd)
+		if op == '|' {
+			tag = filterOr
+		} else if op == '!' {
+			tag = filterNot
+		}
+		p := newSequence(tag)
+		s = s[1:]
+		for strings.HasPrefix(s, "(") {
+			child, rest, err := parseFilterAt(s)
+			if err != nil {
+				return nil, "", err
+			}
+			p.children = append(p.children, child)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", fmt.Errorf("filter is missing a )")
+		}
+		if tag == filterNot && len(p.children) != 1 {
+			return nil, "", fmt.Errorf("! filter must have exactly one filter")
+		}
+		if len(p.children) == 0 {
+			return nil, "", fmt.Errorf("%c filter has no filters", op)
+		}
+		return p, s[1:], nil
+	}
+
+	end := strings.Index(s, ")")
+	if end == -1 {
+		return nil, "", fmt.Errorf("filter is missing a )")
+	}
+	p, err := parseItem(s[:end])
+	if err != nil {
+		return nil, "", err
+	}
+	return p, s[end+1:], nil
+}
+
+func parseItem(item string) (*packet, error) {
+	idx := strings.Index(item, "=")
+	if idx < 1 {
+		return nil, fmt.Errorf("filter item %s has no attribute", item)
+	}
+	attr := item[:idx]
+	raw := item[idx+1:]
+
+	tag := byte(filterEqualityMatch)
+	switch attr[len(attr)-1] {
+	case '~':
+		tag = filterApproxMatch
+	case '>':
+		tag = filterGreaterOrEqual
+	case '<':
+		tag = filterLessOrEqual
+	}
+	if tag != filterEqualityMatch {
+		attr = attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, fmt.Errorf("filter item %s has no attribute", item)
+	}
+
+	if tag == filterEqualityMatch && raw == "*" {
+		return newString(filterPresent, attr), nil
+	}
+	if tag == filterEqualityMatch && strings.Contains(raw, "*") {
+		parts := strings.Split(raw, "*")
+		subs := newSequence(tagSequence)
+		for idx, part := range parts {
+			if part == "" {
+				continue
+			}
+			value, err := unescapeFilter(part)
+			if err != nil {
+				return nil, err
+			}
+			switch idx {
+			case 0:
+				subs.children = append(subs.children, newString(classContext|0, value))
+			case len(parts) - 1:
+				subs.children = append(subs.children, newString(classContext|2, value))
+			default:
+				subs.children = append(subs.children, newString(classContext|1, value))
+			}
+		}
+		return newSequence(filterSubstrings, newString(tagOctetString, attr), subs), nil
+	}
+
+	value, err := unescapeFilter(raw)
+	if err != nil {
+		return nil, err
+	}
+	return newSequence(tag, newString(tagOctetString, attr), newString(tagOctetString, value)), nil
+}
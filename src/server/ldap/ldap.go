@@ -0,0 +1,284 @@
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"scaffold/server/config"
+	"strings"
+	"time"
+)
+
+const (
+	opBindRequest           = classApplication | constructed | 0
+	opBindResponse          = classApplication | constructed | 1
+	opUnbindRequest         = classApplication | 2
+	opSearchRequest         = classApplication | constructed | 3
+	opSearchResultEntry     = classApplication | constructed | 4
+	opSearchResultDone      = classApplication | constructed | 5
+	opSearchResultReference = classApplication | constructed | 19
+	opExtendedRequest       = classApplication | constructed | 23
+	opExtendedResponse      = classApplication | constructed | 24
+)
+
+const RESULT_SUCCESS = 0
+const RESULT_INVALID_CREDENTIALS = 49
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// How long a single directory operation may take
+const TIMEOUT = 30 * time.Second
+
+// An LDAP operation that did not succeed
+type ResultError struct {
+	Code    int
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap result code %d", e.Code)
+	}
+	return fmt.Sprintf("ldap result code %d: %s", e.Code, e.Message)
+}
+
+// An object found by a search. Attribute names are kept lower case as the
+// directory treats them without regard to case
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+func (e *Entry) Values(name string) []string {
+	return e.Attributes[strings.ToLower(name)]
+}
+
+func (e *Entry) Value(name string) string {
+	values := e.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// A connection to a directory server speaking LDAPv3
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	msgID  int
+}
+
+// Connect to an `ldap://` or `ldaps://` URL, upgrading plain connections with
+// StartTLS when asked to
+func Dial(rawURL string, startTLS bool) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Hostname()
+	port := u.Port()
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: config.Config.TLSSkipVerify}
+	dialer := &net.Dialer{Timeout: TIMEOUT}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+		conn, err = dialer.Dial("tcp", net.JoinHostPort(host, port))
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), tlsConfig)
+	default:
+		return nil, fmt.Errorf("unsupported ldap url scheme %s", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{conn: conn, reader: bufio.NewReader(conn)}
+	if startTLS && u.Scheme == "ldap" {
+		if err := c.startTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starttls failed: %s", err.Error())
+		}
+	}
+	return c, nil
+}
+
+func (c *Conn) startTLS(tlsConfig *tls.Config) error {
+	id, err := c.send(newSequence(opExtendedRequest, newString(classContext|0, startTLSOID)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != opExtendedResponse {
+		return fmt.Errorf("unexpected response with tag %#x", op.tag)
+	}
+	if err := result(op); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, tlsConfig)
+	tlsConn.SetDeadline(time.Now().Add(TIMEOUT))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Unbind and close the connection
+func (c *Conn) Close() error {
+	c.send(&packet{tag: opUnbindRequest})
+	return c.conn.Close()
+}
+
+// Authenticate the connection with a simple bind. An empty password is refused
+// as directories treat it as an anonymous bind that always succeeds
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" {
+		return errors.New("password is required")
+	}
+	id, err := c.send(newSequence(opBindRequest,
+		newInteger(tagInteger, 3),
+		newString(tagOctetString, dn),
+		newString(classContext|0, password),
+	))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != opBindResponse {
+		return fmt.Errorf("unexpected response with tag %#x", op.tag)
+	}
+	return result(op)
+}
+
+// Search the subtree under a base DN, returning the requested attributes of
+// each entry found
+func (c *Conn) Search(base, filter string, attributes []string) ([]*Entry, error) {
+	f, err := parseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := newSequence(tagSequence)
+	for _, a := range attributes {
+		attrs.children = append(attrs.children, newString(tagOctetString, a))
+	}
+	id, err := c.send(newSequence(opSearchRequest,
+		newString(tagOctetString, base),
+		newInteger(tagEnumerated, 2), // whole subtree
+		newInteger(tagEnumerated, 0), // never dereference aliases
+		newInteger(tagInteger, 0),    // no size limit
+		newInteger(tagInteger, int(TIMEOUT.Seconds())),
+		newBoolean(false),
+		f,
+		attrs,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*Entry{}
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case opSearchResultEntry:
+			e, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		case opSearchResultReference:
+			// Referrals to other servers are not followed
+		case opSearchResultDone:
+			return entries, result(op)
+		default:
+			return nil, fmt.Errorf("unexpected response with tag %#x", op.tag)
+		}
+	}
+}
+
+func (c *Conn) send(op *packet) (int, error) {
+	c.msgID++
+	msg := newSequence(tagSequence, newInteger(tagInteger, c.msgID), op)
+	c.conn.SetDeadline(time.Now().Add(TIMEOUT))
+	_, err := c.conn.Write(msg.bytes())
+	return c.msgID, err
+}
+
+// Read the next message for a request and return its protocol operation
+func (c *Conn) receive(id int) (*packet, error) {
+	c.conn.SetDeadline(time.Now().Add(TIMEOUT))
+	msg, err := readPacket(c.reader)
+	if err != nil {
+		return nil, err
+	}
+	if msg.tag != tagSequence || len(msg.children) < 2 {
+		return nil, errors.New("malformed ldap message")
+	}
+	if got := msg.children[0].integer(); got != id {
+		return nil, fmt.Errorf("got response to message %d, want %d", got, id)
+	}
+	return msg.children[1], nil
+}
+
+// Check the LDAPResult at the start of a response
+func result(op *packet) error {
+	code, err := op.child(0)
+	if err != nil {
+		return err
+	}
+	if code.integer() == RESULT_SUCCESS {
+		return nil
+	}
+	e := &ResultError{Code: code.integer()}
+	if message, err := op.child(2); err == nil {
+		e.Message = string(message.value)
+	}
+	return e
+}
+
+func parseEntry(op *packet) (*Entry, error) {
+	dn, err := op.child(0)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := op.child(1)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{DN: string(dn.value), Attributes: map[string][]string{}}
+	for _, attr := range attrs.children {
+		name, err := attr.child(0)
+		if err != nil {
+			return nil, err
+		}
+		vals, err := attr.child(1)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(string(name.value))
+		for _, v := range vals.children {
+			e.Attributes[key] = append(e.Attributes[key], string(v.value))
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,159 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"scaffold/server/config"
+	"strings"
+	"testing"
+)
+
+// A directory with a service account and one user, answering binds and
+// searches for uid equality filters
+func serveDirectory(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	passwords := map[string]string{
+		"cn=scaffold,dc=example,dc=com":        "svc",
+		"uid=jdoe,ou=people,dc=example,dc=com": "secret",
+	}
+	entry := newSequence(opSearchResultEntry,
+		newString(tagOctetString, "uid=jdoe,ou=people,dc=example,dc=com"),
+		newSequence(tagSequence,
+			newSequence(tagSequence, newString(tagOctetString, "mail"), newSequence(tagSet, newString(tagOctetString, "jdoe@example.com"))),
+			newSequence(tagSequence, newString(tagOctetString, "memberOf"), newSequence(tagSet,
+				newString(tagOctetString, "cn=Platform,ou=groups,dc=example,dc=com"),
+				newString(tagOctetString, "cn=Scaffold Admins,ou=groups,dc=example,dc=com"),
+			)),
+		),
+	)
+	done := func(tag byte, code int) *packet {
+		return newSequence(tag, newInteger(tagEnumerated, code), newString(tagOctetString, ""), newString(tagOctetString, ""))
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					msg, err := readPacket(r)
+					if err != nil {
+						return
+					}
+					id := msg.children[0].integer()
+					op := msg.children[1]
+					replies := []*packet{}
+					switch op.tag {
+					case opUnbindRequest:
+						return
+					case opBindRequest:
+						code := RESULT_INVALID_CREDENTIALS
+						if pw, ok := passwords[string(op.children[1].value)]; ok && pw == string(op.children[2].value) {
+							code = RESULT_SUCCESS
+						}
+						replies = append(replies, done(opBindResponse, code))
+					case opSearchRequest:
+						f := op.children[6]
+						if f.tag == filterEqualityMatch && string(f.children[0].value) == "uid" && string(f.children[1].value) == "jdoe" {
+							replies = append(replies, entry)
+						}
+						replies = append(replies, done(opSearchResultDone, RESULT_SUCCESS))
+					}
+					for _, reply := range replies {
+						conn.Write(newSequence(tagSequence, newInteger(tagInteger, id), reply).bytes())
+					}
+				}
+			}()
+		}
+	}()
+	return "ldap://" + listener.Addr().String()
+}
+
+func TestAuthenticate(t *testing.T) {
+	config.Config.LDAP = config.LDAPObject{
+		URL:          serveDirectory(t),
+		BindDN:       "cn=scaffold,dc=example,dc=com",
+		BindPassword: "svc",
+		BaseDN:       "ou=people,dc=example,dc=com",
+	}
+
+	a, err := Authenticate("jdoe", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.DN != "uid=jdoe,ou=people,dc=example,dc=com" || a.Email != "jdoe@example.com" || len(a.Groups) != 2 {
+		t.Errorf("unexpected account %+v", a)
+	}
+
+	if _, err := Authenticate("jdoe", "wrong"); err == nil {
+		t.Errorf("wrong password was accepted")
+	}
+	if _, err := Authenticate("jdoe", ""); err == nil {
+		t.Errorf("empty password was accepted")
+	}
+	if _, err := Authenticate("nobody", "secret"); err == nil {
+		t.Errorf("unknown user was accepted")
+	}
+
+	config.Config.LDAP.BindPassword = "wrong"
+	if _, err := Connect(); err == nil {
+		t.Errorf("service account with the wrong password was accepted")
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	p, err := parseFilter("(uid=jdoe)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0xa3, 0x0b, 0x04, 0x03, 'u', 'i', 'd', 0x04, 0x04, 'j', 'd', 'o', 'e'}
+	if !bytes.Equal(p.bytes(), want) {
+		t.Errorf("unexpected encoding % x", p.bytes())
+	}
+
+	if p, err = parseFilter("(&(objectClass=person)(|(cn=J*n*e)(mail=*))(!(uid=" + EscapeFilter("a*(b)") + ")))"); err != nil {
+		t.Fatal(err)
+	}
+	if p.tag != filterAnd || len(p.children) != 3 || p.children[1].children[0].tag != filterSubstrings || p.children[1].children[1].tag != filterPresent {
+		t.Errorf("unexpected filter structure")
+	}
+	if value := string(p.children[2].children[0].children[1].value); value != "a*(b)" {
+		t.Errorf("escaped value decoded to %q", value)
+	}
+
+	for _, f := range []string{"uid=jdoe", "(uid=jdoe", "(&)", "(!(a=b)(c=d))", "(=jdoe)", `(uid=\zz)`, "(uid=jdoe))"} {
+		if _, err := parseFilter(f); err == nil {
+			t.Errorf("invalid filter %s was accepted", f)
+		}
+	}
+}
+
+func TestMapGroups(t *testing.T) {
+	dns := []string{"cn=Platform,ou=groups,dc=example,dc=com", "CN=Scaffold Admins,OU=Groups,DC=example,DC=com"}
+
+	config.Config.LDAP = config.LDAPObject{DefaultRoles: []string{"read"}}
+	groups, roles := MapGroups(dns)
+	if strings.Join(groups, ",") != "Platform,Scaffold Admins" || strings.Join(roles, ",") != "read" {
+		t.Errorf("unexpected groups %v and roles %v", groups, roles)
+	}
+
+	config.Config.LDAP = config.LDAPObject{
+		GroupMapping: map[string]string{"platform": "ops"},
+		RoleMapping:  map[string]string{"cn=scaffold admins,ou=groups,dc=example,dc=com": "admin"},
+		DefaultRoles: []string{"read"},
+	}
+	groups, roles = MapGroups(dns)
+	if strings.Join(groups, ",") != "ops" || strings.Join(roles, ",") != "admin" {
+		t.Errorf("unexpected mapped groups %v and roles %v", groups, roles)
+	}
+}
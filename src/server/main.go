@@ -14,6 +14,7 @@ import (
 	"scaffold/server/manager"
 	"scaffold/server/mongodb"
 	"scaffold/server/rabbitmq"
+	"scaffold/server/secret"
 	"scaffold/server/worker"
 	"time"
 
@@ -53,6 +54,7 @@ func run(ctx context.Context, channel chan struct{}) {
 		go rabbitmq.RunConsumer(manager.QueueDataReceive, config.Config.ManagerQueueName)
 	} else {
 		rabbitmq.RunWorkerProducer()
+		secret.InitProviders()
 		go worker.Run()
 		go rabbitmq.RunConsumer(worker.QueueDataReceive, config.Config.WorkerQueueName)
 		// go rabbitmq.RunConsumer(worker.)
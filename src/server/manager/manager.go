@@ -13,13 +13,19 @@ import (
 	"scaffold/server/health"
 	"scaffold/server/history"
 	"scaffold/server/msg"
+	"scaffold/server/namespace"
+	"scaffold/server/notify"
+	"scaffold/server/policy"
 	"scaffold/server/proxy"
+	"scaffold/server/queue"
 	"scaffold/server/rabbitmq"
+	"scaffold/server/revision"
 	"scaffold/server/state"
 	"scaffold/server/task"
 	"scaffold/server/user"
 	"scaffold/server/utils"
 	"scaffold/server/workflow"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -77,6 +83,9 @@ func Run() {
 		logger.Fatalf("", "Unable to create admin user: %s", err.Error())
 	}
 	auth.Nodes = make(map[string]auth.NodeObject)
+	if err := workflow.CheckNames(); err != nil {
+		logger.Errorf("", "Unable to check workflow names: %s", err.Error())
+	}
 
 	health.IsReady = true
 
@@ -88,6 +97,11 @@ func Run() {
 	}
 	workflow.SetCache(ws)
 
+	// Start any runs left pending when the manager last stopped
+	if _, err := queue.Dispatch(); err != nil {
+		logger.Errorf("", "Error dispatching queued runs: %s", err.Error())
+	}
+
 	scron.Start()
 }
 
@@ -95,14 +109,27 @@ func QueueDataReceive(data []byte) error {
 	if len(data) == 0 {
 		return nil
 	}
+	var sm msg.SignedMsg
+	if err := json.Unmarshal([]byte(data), &sm); err != nil {
+		logger.Errorf("", "Error processing queue message: %s", err.Error())
+		return err
+	}
+	// Messages that are not from a joined worker are dropped rather than
+	// requeued, as they will never verify. A worker that joined again while
+	// its messages were queued still has them accepted under its previous
+	// credential until it pings with the new one
+	if !auth.VerifyMessage(sm.Worker, sm.Data, sm.Signature) {
+		logger.Errorf("", "Dropping queue message with invalid signature from worker %s", sm.Worker)
+		return nil
+	}
 	var m msg.RunMsg
-	if err := json.Unmarshal([]byte(data), &m); err != nil {
+	if err := json.Unmarshal(sm.Data, &m); err != nil {
 		logger.Errorf("", "Error processing queue message: %s", err.Error())
 		return err
 	}
 	switch m.Status {
-	case constants.STATE_STATUS_SUCCESS:
-		logger.Debugf("", "Task %s has completed with status success", m.Task)
+	case constants.STATE_STATUS_SUCCESS, constants.STATE_STATUS_CACHED:
+		logger.Debugf("", "Task %s has completed with status %s", m.Task, m.Status)
 		if err := history.AddStateToHistory(m.RunID, m.State); err != nil {
 			logger.Errorf("", "Error updating history: %s", err.Error())
 			return err
@@ -110,6 +137,10 @@ func QueueDataReceive(data []byte) error {
 		stateChange(m.Workflow, m.Task, constants.STATE_STATUS_SUCCESS, m.Context, m.RunID)
 		autoTrigger(m.Workflow, m.Task, constants.STATUS_TRIGGER_SUCCESS, m.Context, m.RunID)
 		autoTrigger(m.Workflow, m.Task, constants.STATUS_TRIGGER_ALWAYS, m.Context, m.RunID)
+		fileTriggers(m)
+		notifyEvent(notify.Event{Event: constants.NOTIFY_EVENT_TASK_SUCCEEDED, Workflow: m.Workflow, Task: m.Task, RunID: m.RunID, Status: m.Status, Worker: m.State.Worker})
+		notifyRunFinished(m.Workflow, m.RunID)
+		finishRun(m)
 	case constants.STATE_STATUS_ERROR:
 		logger.Debugf("", "Task %s has completed with status error", m.Task)
 		if err := history.AddStateToHistory(m.RunID, m.State); err != nil {
@@ -119,6 +150,10 @@ func QueueDataReceive(data []byte) error {
 		stateChange(m.Workflow, m.Task, constants.STATE_STATUS_ERROR, m.Context, m.RunID)
 		autoTrigger(m.Workflow, m.Task, constants.STATUS_TRIGGER_ERROR, m.Context, m.RunID)
 		autoTrigger(m.Workflow, m.Task, constants.STATUS_TRIGGER_ALWAYS, m.Context, m.RunID)
+		fileTriggers(m)
+		notifyEvent(notify.Event{Event: constants.NOTIFY_EVENT_TASK_FAILED, Workflow: m.Workflow, Task: m.Task, RunID: m.RunID, Status: m.Status, Worker: m.State.Worker})
+		notifyRunFinished(m.Workflow, m.RunID)
+		finishRun(m)
 	case constants.STATE_STATUS_KILLED:
 		logger.Debugf("", "Task %s has completed with status killed", m.Task)
 		if err := history.AddStateToHistory(m.RunID, m.State); err != nil {
@@ -131,10 +166,19 @@ func QueueDataReceive(data []byte) error {
 			logger.Errorf("", "Error publishing kill id: %s", err.Error())
 			return err
 		}
+		finishRun(m)
 	}
 	return nil
 }
 
+// Give up the concurrency slot held by a finished task. This happens after
+// the run's next tasks are triggered so they go ahead of other pending runs
+func finishRun(m msg.RunMsg) {
+	if err := queue.Finish(m.Workflow, m.Task, m.RunID); err != nil {
+		logger.Errorf("", "Error releasing queued run of %s/%s: %s", m.Workflow, m.Task, err.Error())
+	}
+}
+
 func BufferDataReceive(endpoint, data string) error {
 	// if len(data) == 0 {
 	// 	return nil
@@ -171,7 +215,14 @@ func healthCheck() {
 						DoKill(s.Workflow, s.Task)
 					case constants.STATE_STATUS_WAITING:
 						DoKill(s.Workflow, s.Task)
+					default:
+						continue
+					}
+					// Only notify the first time the worker misses its heartbeat
+					if n.Ping == config.Config.HeartbeatBackoff+1 {
+						notifyEvent(notify.Event{Event: constants.NOTIFY_EVENT_WORKER_LOST, Workflow: s.Workflow, Task: s.Task, Status: s.Status, Worker: n.Name})
 					}
+					releaseLostState(s)
 				}
 			}
 			n.Ping += 1
@@ -183,6 +234,21 @@ func healthCheck() {
 	}
 }
 
+// Mark a task that was going on a lost worker as killed and give up its slot
+// in the run queue, as the worker will never report back on it
+func releaseLostState(s *state.State) {
+	s.Status = constants.STATE_STATUS_KILLED
+	s.Killed = true
+	s.Finished = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	if err := state.UpdateStateByNames(s.Workflow, s.Task, s); err != nil {
+		logger.Errorf("", "Cannot mark task %s/%s on a lost worker killed: %s", s.Workflow, s.Task, err.Error())
+		return
+	}
+	if err := queue.Finish(s.Workflow, s.Task, ""); err != nil {
+		logger.Errorf("", "Error releasing queued run of %s/%s: %s", s.Workflow, s.Task, err.Error())
+	}
+}
+
 func stateChange(cn, tn, status string, context map[string]string, runID string) error {
 	ss, err := state.GetStateByNames(cn, tn)
 	if err != nil {
@@ -218,11 +284,14 @@ func stateChange(cn, tn, status string, context map[string]string, runID string)
 						continue
 					}
 				}
-				s, err := state.GetStateByNames(cn, n)
+				s, err := state.GetStateByNames(task.SplitDependency(cn, n))
 				if err != nil {
 					return err
 				}
-				if s.Status != constants.STATE_STATUS_ERROR && s.Status != constants.STATE_STATUS_SUCCESS {
+				if s == nil {
+					continue
+				}
+				if s.Status != constants.STATE_STATUS_ERROR && !state.Succeeded(s.Status) {
 					continue
 				}
 			}
@@ -237,14 +306,14 @@ func stateChange(cn, tn, status string, context map[string]string, runID string)
 						continue
 					}
 				}
-				s, err := state.GetStateByNames(cn, n)
+				s, err := state.GetStateByNames(task.SplitDependency(cn, n))
 				if err != nil {
 					return err
 				}
 				if s == nil {
 					continue
 				}
-				if s.Status != constants.STATE_STATUS_SUCCESS {
+				if !state.Succeeded(s.Status) {
 					continue
 				}
 			}
@@ -273,11 +342,14 @@ func stateChange(cn, tn, status string, context map[string]string, runID string)
 						continue
 					}
 				}
-				s, err := state.GetStateByNames(cn, n)
+				s, err := state.GetStateByNames(task.SplitDependency(cn, n))
 				if err != nil {
 					return err
 				}
-				if s.Status != constants.STATE_STATUS_ERROR && s.Status != constants.STATE_STATUS_SUCCESS {
+				if s == nil {
+					continue
+				}
+				if s.Status != constants.STATE_STATUS_ERROR && !state.Succeeded(s.Status) {
 					continue
 				}
 			}
@@ -292,7 +364,7 @@ func stateChange(cn, tn, status string, context map[string]string, runID string)
 						continue
 					}
 				}
-				s, err := state.GetStateByNames(cn, n)
+				s, err := state.GetStateByNames(task.SplitDependency(cn, n))
 				if err != nil {
 					return err
 				}
@@ -363,29 +435,29 @@ func stateChange(cn, tn, status string, context map[string]string, runID string)
 
 func checkDeps(cn string, t *task.Task) (bool, error) {
 	for _, n := range t.DependsOn.Success {
-		s, err := state.GetStateByNames(cn, n)
+		s, err := state.GetStateByNames(task.SplitDependency(cn, n))
 		if err != nil {
 			return false, err
 		}
-		if s.Status != constants.STATE_STATUS_SUCCESS {
+		if s == nil || !state.Succeeded(s.Status) {
 			return false, nil
 		}
 	}
 	for _, n := range t.DependsOn.Error {
-		s, err := state.GetStateByNames(cn, n)
+		s, err := state.GetStateByNames(task.SplitDependency(cn, n))
 		if err != nil {
 			return false, err
 		}
-		if s.Status != constants.STATE_STATUS_ERROR {
+		if s == nil || s.Status != constants.STATE_STATUS_ERROR {
 			return false, nil
 		}
 	}
 	for _, n := range t.DependsOn.Always {
-		s, err := state.GetStateByNames(cn, n)
+		s, err := state.GetStateByNames(task.SplitDependency(cn, n))
 		if err != nil {
 			return false, err
 		}
-		if s.Status != constants.STATE_STATUS_SUCCESS && s.Status != constants.STATE_STATUS_ERROR {
+		if s == nil || !state.Succeeded(s.Status) && s.Status != constants.STATE_STATUS_ERROR {
 			return false, nil
 		}
 	}
@@ -394,72 +466,279 @@ func checkDeps(cn string, t *task.Task) (bool, error) {
 
 func autoTrigger(cn, tn, status string, context map[string]string, runID string) error {
 	logger.Debugf("", "Doing auto trigger for %s %s with status %s", cn, tn, status)
-	ts, err := task.GetTasksByWorkflow(cn)
+	// Tasks in other workflows can depend on this one as `<workflow>/<task>`
+	ts, err := task.GetAllTasks()
 	if err != nil {
 		logger.Errorf("", "Cannot perform auto trigger for %s", cn)
 		return err
 	}
-	toTrigger := []string{}
+	toTrigger := []*task.Task{}
 
-	switch status {
-	case constants.STATUS_TRIGGER_SUCCESS:
-		for _, t := range ts {
-			if utils.Contains(t.DependsOn.Success, tn) && t.AutoExecute {
-				trigger, err := checkDeps(cn, t)
-				if err != nil {
-					logger.Errorf("", "Error checking dependency states: %s", err.Error())
-					return err
-				}
-				if trigger {
-					toTrigger = append(toTrigger, t.Name)
-				}
-			}
+	for _, t := range ts {
+		if !t.AutoExecute {
+			continue
 		}
-	case constants.STATUS_TRIGGER_ERROR:
-		for _, t := range ts {
-			if utils.Contains(t.DependsOn.Error, tn) && t.AutoExecute {
-				trigger, err := checkDeps(cn, t)
-				if err != nil {
-					logger.Errorf("", "Error checking dependency states: %s", err.Error())
-					return err
-				}
-				if trigger {
-					toTrigger = append(toTrigger, t.Name)
-				}
+		var deps []string
+		switch status {
+		case constants.STATUS_TRIGGER_SUCCESS:
+			deps = t.DependsOn.Success
+		case constants.STATUS_TRIGGER_ERROR:
+			deps = t.DependsOn.Error
+		case constants.STATUS_TRIGGER_ALWAYS:
+			deps = t.DependsOn.Always
+		}
+		if !task.DependsOnTask(deps, t.Workflow, cn, tn) {
+			continue
+		}
+		trigger, err := checkDeps(t.Workflow, t)
+		if err != nil {
+			logger.Errorf("", "Error checking dependency states: %s", err.Error())
+			return err
+		}
+		if trigger {
+			toTrigger = append(toTrigger, t)
+		}
+	}
+
+	// Every downstream workflow gets a single new run for all of its tasks
+	// triggered by this one
+	downstream := map[string]string{}
+	for _, t := range toTrigger {
+		if t.Workflow == cn {
+			if err := DoTrigger(cn, t.Name, context, runID); err != nil {
+				return err
 			}
+			continue
 		}
-	case constants.STATUS_TRIGGER_ALWAYS:
-		for _, t := range ts {
-			if utils.Contains(t.DependsOn.Always, tn) && t.AutoExecute {
-				trigger, err := checkDeps(cn, t)
-				if err != nil {
-					logger.Errorf("", "Error checking dependency states: %s", err.Error())
-					return err
-				}
-				if trigger {
-					toTrigger = append(toTrigger, t.Name)
-				}
+		if err := checkReference(t.Workflow, cn, tn); err != nil {
+			logger.Warnf("", "Not triggering task %s/%s after %s/%s: %s", t.Workflow, t.Name, cn, tn, err.Error())
+			continue
+		}
+		id, ok := downstream[t.Workflow]
+		if !ok {
+			id, err = startDownstreamRun(t.Workflow, cn, tn, runID)
+			if err != nil {
+				logger.Errorf("", "Cannot start run of %s after %s/%s: %s", t.Workflow, cn, tn, err.Error())
+				continue
 			}
+			downstream[t.Workflow] = id
+		}
+		upstreamContext := map[string]string{}
+		for key, val := range context {
+			upstreamContext[key] = val
+		}
+		upstreamContext[constants.CONTEXT_UPSTREAM_WORKFLOW] = cn
+		upstreamContext[constants.CONTEXT_UPSTREAM_TASK] = tn
+		upstreamContext[constants.CONTEXT_UPSTREAM_RUN_ID] = runID
+		// The downstream run carries on the chain of file triggers the upstream
+		// run is part of
+		if len(triggerChain(context, runID)) > 0 {
+			upstreamContext[constants.CONTEXT_TRIGGER_CHAIN_RUN_ID] = id
+		}
+
+		logger.Infof("", "Task %s/%s triggers task %s/%s", cn, tn, t.Workflow, t.Name)
+		if err := DoTrigger(t.Workflow, t.Name, upstreamContext, id); err != nil {
+			logger.Errorf("", "Cannot trigger task %s/%s: %s", t.Workflow, t.Name, err.Error())
 		}
 	}
-	for _, t := range toTrigger {
-		if err := DoTrigger(cn, t, context, runID); err != nil {
+	return nil
+}
+
+// Check that workflow wn may still be started by task tn of workflow cn, as
+// the upstream run's context is copied into its run. The namespace of cn has
+// to be shared with that of wn, and whoever last applied wn has to be able to
+// view the task
+func checkReference(wn, cn, tn string) error {
+	// Workflows kept from before namespaces may have a . in their name, so the
+	// namespace is taken from the stored workflow rather than the name
+	upstream, err := workflow.GetWorkflowByName(cn)
+	if err != nil {
+		return err
+	}
+	downstream, err := workflow.GetWorkflowByName(wn)
+	if err != nil {
+		return err
+	}
+	if err := namespace.CheckReference(workflow.NamespaceOf(upstream), workflow.NamespaceOf(downstream)); err != nil {
+		return err
+	}
+	r, err := revision.GetLatestRevision(wn)
+	if err != nil {
+		return err
+	}
+	if r == nil || r.Author == constants.REVISION_AUTHOR_SCAFFOLD || r.Author == constants.REVISION_AUTHOR_GITSYNC {
+		return nil
+	}
+	if r.Author == "" {
+		logger.Errorf("", "Revision %d of %s has no author to check access to %s/%s with", r.Version, wn, cn, tn)
+		return fmt.Errorf("revision %d of %s has no author", r.Version, wn)
+	}
+	u, err := user.GetUserByUsername(r.Author)
+	if err != nil {
+		return err
+	}
+	if !policy.Allowed(u, nil, policy.VERB_VIEW, cn, tn) {
+		return fmt.Errorf("%s, who last applied %s, cannot view %s/%s", r.Author, wn, cn, tn)
+	}
+	return nil
+}
+
+// Create the history of a run of workflow wn started by a task in another
+// workflow, linking it to the upstream run
+func startDownstreamRun(wn, cn, tn, runID string) (string, error) {
+	h := history.History{
+		RunID:    uuid.New().String(),
+		States:   make([]state.State, 0),
+		Workflow: wn,
+		Upstream: &history.Upstream{
+			Workflow: cn,
+			Task:     tn,
+			RunID:    runID,
+		},
+	}
+	if err := history.CreateHistory(&h); err != nil {
+		return "", err
+	}
+	return h.RunID, nil
+}
+
+// Send an event to the notification rules of its workflow
+func notifyEvent(e notify.Event) {
+	w := workflow.GetCacheSingle(e.Workflow)
+	if len(w.Notifications) == 0 {
+		return
+	}
+	notify.Notify(w.Notifications, e)
+}
+
+// Send a run succeeded or failed event once none of the workflow's tasks are
+// left waiting or running. The run failed if the last state of any of its
+// tasks is an error
+func notifyRunFinished(wn, runID string) {
+	if runID == "" || len(workflow.GetCacheSingle(wn).Notifications) == 0 {
+		return
+	}
+	ss, err := state.GetStatesByWorkflow(wn)
+	if err != nil {
+		logger.Errorf("", "Cannot get states for %s: %s", wn, err.Error())
+		return
+	}
+	for _, s := range ss {
+		if s.Status == constants.STATE_STATUS_WAITING || s.Status == constants.STATE_STATUS_RUNNING {
+			return
+		}
+	}
+	h, err := history.GetHistoryByRunID(runID)
+	if err != nil || h == nil {
+		return
+	}
+	last := map[string]string{}
+	for _, s := range h.States {
+		last[s.Task] = s.Status
+	}
+	event := constants.NOTIFY_EVENT_RUN_SUCCEEDED
+	for _, status := range last {
+		if status == constants.STATE_STATUS_ERROR {
+			event = constants.NOTIFY_EVENT_RUN_FAILED
+		}
+	}
+	notifyEvent(notify.Event{Event: event, Workflow: wn, RunID: runID})
+}
+
+// Fire file triggers for every file a finished run stored
+func fileTriggers(m msg.RunMsg) {
+	chain := triggerChain(m.Context, m.RunID)
+	for _, f := range m.Files {
+		if err := FileTrigger(m.Workflow, f.Name, f.Version, m.Task, chain); err != nil {
+			logger.Errorf("", "Cannot fire file triggers for %s/%s: %s", m.Workflow, f.Name, err.Error())
+		}
+	}
+}
+
+// Get the tasks that stored the files leading up to a run. Contexts are kept
+// between runs, so the chain only counts for the run it was recorded for
+func triggerChain(context map[string]string, runID string) []string {
+	if runID == "" || context[constants.CONTEXT_TRIGGER_CHAIN_RUN_ID] != runID || context[constants.CONTEXT_TRIGGER_CHAIN] == "" {
+		return nil
+	}
+	return strings.Split(context[constants.CONTEXT_TRIGGER_CHAIN], ",")
+}
+
+// Start every task whose `trigger.on_file` matches a newly stored file, passing
+// the file's workflow, name, and version in the run context. The file was
+// stored by task source after the tasks in chain stored theirs, and a task is
+// never triggered by a file it or a task before it in the chain stored, so
+// tasks that store files the other watches cannot trigger each other forever
+func FileTrigger(wn, name string, version int, source string, chain []string) error {
+	ts, err := task.GetAllTasks()
+	if err != nil {
+		return err
+	}
+	chain = append([]string{}, chain...)
+	if source != "" {
+		chain = append(chain, fmt.Sprintf("%s/%s", wn, source))
+	}
+	for _, t := range ts {
+		if !task.MatchesFile(t, wn, name) {
+			continue
+		}
+		if utils.Contains(chain, fmt.Sprintf("%s/%s", t.Workflow, t.Name)) {
+			logger.Warnf("", "Not triggering task %s/%s on file %s/%s as it stored a file leading up to it", t.Workflow, t.Name, wn, name)
+			continue
+		}
+		if t.Workflow != wn {
+			if err := checkReference(t.Workflow, wn, ""); err != nil {
+				logger.Warnf("", "Not triggering task %s/%s on file %s/%s: %s", t.Workflow, t.Name, wn, name, err.Error())
+				continue
+			}
+		}
+		s, err := state.GetStateByNames(t.Workflow, t.Name)
+		if err != nil {
 			return err
 		}
+		context := map[string]string{}
+		if s != nil {
+			for key, val := range s.Context {
+				context[key] = val
+			}
+		}
+		context[constants.CONTEXT_TRIGGER_FILE_WORKFLOW] = wn
+		context[constants.CONTEXT_TRIGGER_FILE_NAME] = name
+		context[constants.CONTEXT_TRIGGER_FILE_VERSION] = fmt.Sprintf("%d", version)
+
+		runID, err := startRun(t.Workflow)
+		if err != nil {
+			logger.Errorf("", "Cannot start run of %s: %s", t.Workflow, err.Error())
+			continue
+		}
+		context[constants.CONTEXT_TRIGGER_CHAIN] = strings.Join(chain, ",")
+		context[constants.CONTEXT_TRIGGER_CHAIN_RUN_ID] = runID
+
+		logger.Infof("", "Version %d of file %s/%s triggers task %s/%s", version, wn, name, t.Workflow, t.Name)
+		if err := DoTrigger(t.Workflow, t.Name, context, runID); err != nil {
+			logger.Errorf("", "Cannot trigger task %s/%s: %s", t.Workflow, t.Name, err.Error())
+		}
 	}
 	return nil
 }
 
+// Create the history of a new run of workflow wn
+func startRun(wn string) (string, error) {
+	h := history.History{
+		RunID:    uuid.New().String(),
+		States:   make([]state.State, 0),
+		Workflow: wn,
+	}
+	if err := history.CreateHistory(&h); err != nil {
+		return "", err
+	}
+	return h.RunID, nil
+}
+
 func DoTrigger(wn, tn string, context map[string]string, runID string) error {
 	if runID == "" {
-		runID = uuid.New().String()
-		h := history.History{
-			RunID:    runID,
-			States:   make([]state.State, 0),
-			Workflow: wn,
-		}
-
-		if err := history.CreateHistory(&h); err != nil {
+		var err error
+		if runID, err = startRun(wn); err != nil {
 			return err
 		}
 	}
@@ -478,20 +757,20 @@ func DoTrigger(wn, tn string, context map[string]string, runID string) error {
 	}
 
 	for _, s := range t.DependsOn.Success {
-		ss, err := state.GetStateByNames(wn, s)
+		ss, err := state.GetStateByNames(task.SplitDependency(wn, s))
 		if err != nil {
 			return err
 		}
-		if ss.Status != constants.STATE_STATUS_SUCCESS {
+		if ss == nil || !state.Succeeded(ss.Status) {
 			return nil
 		}
 	}
 	for _, s := range t.DependsOn.Error {
-		ss, err := state.GetStateByNames(wn, s)
+		ss, err := state.GetStateByNames(task.SplitDependency(wn, s))
 		if err != nil {
 			return err
 		}
-		if ss.Status != constants.STATE_STATUS_SUCCESS {
+		if ss == nil || ss.Status != constants.STATE_STATUS_SUCCESS {
 			return nil
 		}
 	}
@@ -533,7 +812,8 @@ func DoTrigger(wn, tn string, context map[string]string, runID string) error {
 	}
 
 	logger.Infof("", "Triggering run with message %v", m)
-	return rabbitmq.ManagerPublish(m)
+	_, err = queue.Submit(m, t.Priority)
+	return err
 	// return bulwark.QueuePush(bulwark.WorkerClient, m)
 }
 
@@ -551,7 +831,7 @@ func DoKill(cn, tn string) error {
 		httpClient := &http.Client{}
 		requestURL := fmt.Sprintf("%s/api/v1/run/%s/%s", uri, cn, tn)
 		req, _ := http.NewRequest("DELETE", requestURL, nil)
-		req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", config.Config.Node.PrimaryKey))
+		req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", node.Key))
 		req.Header.Set("Content-Type", "application/json")
 		resp, err := httpClient.Do(req)
 		if err != nil {
@@ -0,0 +1,23 @@
+package manager
+
+import (
+	"scaffold/server/constants"
+	"testing"
+)
+
+func TestTriggerChain(t *testing.T) {
+	context := map[string]string{
+		constants.CONTEXT_TRIGGER_CHAIN:        "app/build,ops.security/scan",
+		constants.CONTEXT_TRIGGER_CHAIN_RUN_ID: "run-1",
+	}
+	chain := triggerChain(context, "run-1")
+	if len(chain) != 2 || chain[0] != "app/build" || chain[1] != "ops.security/scan" {
+		t.Errorf("triggerChain = %v", chain)
+	}
+	if chain := triggerChain(context, "run-2"); chain != nil {
+		t.Errorf("chain of another run was used: %v", chain)
+	}
+	if chain := triggerChain(map[string]string{}, "run-1"); chain != nil {
+		t.Errorf("empty context gave a chain: %v", chain)
+	}
+}
@@ -0,0 +1,316 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"scaffold/server/audit"
+	"scaffold/server/auth"
+	"scaffold/server/constants"
+	"scaffold/server/datastore"
+	"scaffold/server/input"
+	"scaffold/server/namespace"
+	"scaffold/server/policy"
+	"scaffold/server/secret"
+	"scaffold/server/task"
+	"scaffold/server/template"
+	"scaffold/server/user"
+	"scaffold/server/webhook"
+	"scaffold/server/workflow"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// The names identifying the object a request changes, taken from the route
+// parameters or, for requests creating something, from the request body
+type auditKey struct {
+	Workflow string `json:"workflow"`
+	Name     string `json:"name"`
+	Task     string `json:"task"`
+	Username string `json:"username"`
+}
+
+type auditRoute struct {
+	kind   string
+	action string
+}
+
+// Routes whose kind or action can't be worked out from their path and method.
+// GET routes are only audited when they are listed here
+var auditRoutes = map[string]auditRoute{
+	"GET /auth/logout":                              {"user", "logout"},
+	"GET /auth/oidc/callback":                       {"user", "login"},
+	"POST /auth/login":                              {"user", "login"},
+	"POST /auth/login/totp":                         {"user", "login"},
+	"POST /auth/reset/request":                      {"user", "request-password-reset"},
+	"POST /auth/reset/do":                           {"user", "reset-password"},
+	"POST /auth/join":                               {"node", "join"},
+	"POST /auth/token/:username/:name":              {"token", "create"},
+	"DELETE /auth/token/:username/:name":            {"token", "revoke"},
+	"DELETE /auth/session/:username":                {"session", "revoke-all"},
+	"DELETE /auth/session/:username/:id":            {"session", "revoke"},
+	"POST /auth/totp/:username":                     {"totp", "enroll"},
+	"PUT /auth/totp/:username":                      {"totp", "enable"},
+	"POST /auth/totp/:username/disable":             {"totp", "disable"},
+	"DELETE /auth/totp/:username":                   {"totp", "reset"},
+	"POST /api/v1/workflow/:name/rollback/:version": {"workflow", "rollback"},
+	"POST /api/v1/file/:name":                       {"file", "upload"},
+	"POST /api/v1/input/:workflow/update":           {"input", "update"},
+	"PUT /api/v1/task/:workflow/:task/enabled":      {"task", "toggle"},
+	"POST /api/v1/run/:workflow/:task":              {"run", "trigger"},
+	"DELETE /api/v1/run/:workflow/:task":            {"run", "kill"},
+	"POST /api/v1/webhook/:workflow/:task":          {"webhook", "trigger"},
+	"POST /api/v1/hook/:id":                         {"hook", "trigger"},
+	"DELETE /api/v1/node/:name":                     {"node", "revoke"},
+	"DELETE /api/v1/node/revoked/:name":             {"node", "unrevoke"},
+	"POST /api/v1/sync":                             {"sync", "trigger"},
+}
+
+var auditActions = map[string]string{
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// Look up the current state of the object a request changes, by kind
+var auditLoaders = map[string]func(k auditKey) (interface{}, error){
+	"workflow": func(k auditKey) (interface{}, error) {
+		return workflow.GetWorkflowByName(k.Name)
+	},
+	"datastore": func(k auditKey) (interface{}, error) {
+		return datastore.GetDataStoreByWorkflow(k.Name)
+	},
+	"input": func(k auditKey) (interface{}, error) {
+		if k.Name == "" {
+			return input.GetInputsByWorkflow(k.Workflow)
+		}
+		return input.GetInputByNames(k.Workflow, k.Name)
+	},
+	"task": func(k auditKey) (interface{}, error) {
+		name := k.Task
+		if name == "" {
+			name = k.Name
+		}
+		if name == "" {
+			return task.GetTasksByWorkflow(k.Workflow)
+		}
+		return task.GetTaskByNames(k.Workflow, name)
+	},
+	"user": func(k auditKey) (interface{}, error) {
+		return user.GetUserByUsername(k.Username)
+	},
+	"totp": func(k auditKey) (interface{}, error) {
+		return user.GetUserByUsername(k.Username)
+	},
+	"token": func(k auditKey) (interface{}, error) {
+		u, err := user.GetUserByUsername(k.Username)
+		if err != nil || u == nil {
+			return nil, err
+		}
+		for _, t := range u.APITokens {
+			if t.Name == k.Name {
+				return t, nil
+			}
+		}
+		return nil, nil
+	},
+	"secret": func(k auditKey) (interface{}, error) {
+		return secret.GetSecretByNames(k.Workflow, k.Name)
+	},
+	"webhook": func(k auditKey) (interface{}, error) {
+		if k.Name == "" {
+			return nil, nil
+		}
+		return webhook.GetWebhookByNames(k.Workflow, k.Name)
+	},
+	"template": func(k auditKey) (interface{}, error) {
+		return template.GetTemplateByName(k.Name)
+	},
+	"policy": func(k auditKey) (interface{}, error) {
+		return policy.GetPolicyByName(k.Name)
+	},
+	"namespace": func(k auditKey) (interface{}, error) {
+		return namespace.GetNamespaceByName(k.Name)
+	},
+}
+
+// Get the names of a workflow's secret inputs when the object a request changes
+// keeps input values, so they can be redacted from its changes
+func auditSecretInputs(r auditRoute, k auditKey) []string {
+	workflowName := k.Workflow
+	if r.kind == "datastore" {
+		workflowName = k.Name
+	}
+	if workflowName == "" {
+		return nil
+	}
+	is, err := input.GetInputsByWorkflow(workflowName)
+	if err != nil {
+		logger.Errorf("", "Cannot get inputs of %s for audit: %s", workflowName, err.Error())
+		return nil
+	}
+	names := []string{}
+	for _, i := range is {
+		if i.Type == constants.INPUT_TYPE_SECRET {
+			names = append(names, i.Name)
+		}
+	}
+	return names
+}
+
+// Work out the kind of object a route changes and what it does to it
+func auditRouteFor(method, path string) auditRoute {
+	if r, ok := auditRoutes[method+" "+path]; ok {
+		return r
+	}
+	kind := strings.TrimPrefix(strings.TrimPrefix(path, "/api/v1/"), "/auth/")
+	kind, _, _ = strings.Cut(kind, "/")
+	return auditRoute{kind: kind, action: auditActions[method]}
+}
+
+// Read the names of the object a request changes. Request bodies are put back
+// once read so the handler can still bind them
+func auditKeyFor(c *gin.Context) auditKey {
+	k := auditKey{
+		Workflow: c.Param("workflow"),
+		Name:     c.Param("name"),
+		Task:     c.Param("task"),
+		Username: c.Param("username"),
+	}
+	if c.Request.Method != http.MethodPost || c.Request.Body == nil || !strings.HasPrefix(c.ContentType(), "application/json") {
+		return k
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return k
+	}
+	var body auditKey
+	if err := json.Unmarshal(data, &body); err != nil {
+		return k
+	}
+	if k.Workflow == "" {
+		k.Workflow = body.Workflow
+	}
+	if k.Name == "" {
+		k.Name = body.Name
+	}
+	if k.Username == "" {
+		k.Username = body.Username
+	}
+	return k
+}
+
+func auditTarget(c *gin.Context, k auditKey) string {
+	parts := []string{}
+	if len(c.Params) > 0 {
+		for _, p := range c.Params {
+			parts = append(parts, p.Value)
+		}
+		return strings.Join(parts, "/")
+	}
+	for _, part := range []string{k.Workflow, k.Task, k.Name, k.Username} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Work out where a request came from. Browsers authenticate with the login
+// cookie, the CLI identifies itself by its user agent, and anything else with
+// an Authorization header is an API call
+func auditSource(c *gin.Context, r auditRoute, isNode bool) string {
+	switch {
+	case r.kind == "hook" || (r.kind == "webhook" && r.action == "trigger"):
+		return constants.AUDIT_SOURCE_WEBHOOK
+	case isNode:
+		return constants.AUDIT_SOURCE_NODE
+	case strings.HasPrefix(c.Request.UserAgent(), constants.CLI_USER_AGENT_PREFIX):
+		return constants.AUDIT_SOURCE_CLI
+	case c.Request.Header.Get("Authorization") == "":
+		return constants.AUDIT_SOURCE_UI
+	}
+	return constants.AUDIT_SOURCE_API
+}
+
+func auditActor(c *gin.Context, r auditRoute) (string, bool) {
+	usr, _, isNode := auth.RequestUser(c)
+	if isNode {
+		return "scaffold", true
+	}
+	if usr != nil {
+		return usr.Username, false
+	}
+	if r.action == "login" {
+		if username, _, ok := c.Request.BasicAuth(); ok {
+			return username, false
+		}
+		return c.PostForm("username"), false
+	}
+	return "", false
+}
+
+// This middleware records every request that changes something in the audit
+// log, along with how the object it changed differs before and after. Failed
+// and refused requests are recorded too, without the difference
+func Audit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodHead, http.MethodOptions:
+			return
+		case http.MethodGet:
+			if _, ok := auditRoutes[c.Request.Method+" "+c.FullPath()]; !ok {
+				return
+			}
+		}
+
+		r := auditRouteFor(c.Request.Method, c.FullPath())
+		k := auditKeyFor(c)
+		actor, isNode := auditActor(c, r)
+		if r.action == "login" && k.Username == "" {
+			k.Username = actor
+		}
+
+		load := auditLoaders[r.kind]
+		var before interface{}
+		if load != nil {
+			var err error
+			if before, err = load(k); err != nil {
+				logger.Errorf("", "Cannot load %s %v for audit: %s", r.kind, k, err.Error())
+			}
+		}
+
+		c.Next()
+
+		// Handlers that log someone in say who once they know
+		if actor == "" {
+			actor = c.GetString(constants.AUDIT_ACTOR_KEY)
+		}
+
+		e := &audit.Entry{
+			Actor:  actor,
+			Source: auditSource(c, r, isNode),
+			Action: r.action,
+			Kind:   r.kind,
+			Target: auditTarget(c, k),
+			Method: c.Request.Method,
+			Path:   c.Request.URL.Path,
+			Status: c.Writer.Status(),
+			IP:     c.ClientIP(),
+		}
+		if load != nil && e.Status < http.StatusBadRequest {
+			after, err := load(k)
+			if err != nil {
+				logger.Errorf("", "Cannot load %s %v for audit: %s", r.kind, k, err.Error())
+			}
+			e.Changes = audit.Diff(before, after, auditSecretInputs(r, k))
+		}
+		audit.Record(e)
+	}
+}
@@ -2,10 +2,10 @@ package middleware
 
 import (
 	"net/http"
-	"scaffold/server/config"
+	"scaffold/server/auth"
+	"scaffold/server/history"
+	"scaffold/server/policy"
 	"scaffold/server/user"
-	"scaffold/server/utils"
-	"scaffold/server/workflow"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -25,7 +25,7 @@ func EnsureLoggedIn() gin.HandlerFunc {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
 			}
-			verified, err := user.VerifyUser(baUsername, baPassword)
+			verified, err := auth.VerifyBasicAuth(c, baUsername, baPassword)
 			if err != nil || !verified {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
@@ -43,7 +43,7 @@ func EnsureLoggedIn() gin.HandlerFunc {
 		} else {
 			token = strings.Split(authString, " ")[1]
 		}
-		if token == config.Config.Node.PrimaryKey {
+		if auth.IsNodeKey(token) {
 			return
 		}
 
@@ -75,7 +75,7 @@ func EnsureLoggedInAPI() gin.HandlerFunc {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
 			}
-			verified, err := user.VerifyUser(baUsername, baPassword)
+			verified, err := auth.VerifyBasicAuth(c, baUsername, baPassword)
 			if err != nil || !verified {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
@@ -93,7 +93,7 @@ func EnsureLoggedInAPI() gin.HandlerFunc {
 		} else {
 			token = strings.Split(authString, " ")[1]
 		}
-		if token == config.Config.Node.PrimaryKey {
+		if auth.IsNodeKey(token) {
 			return
 		}
 
@@ -128,7 +128,7 @@ func EnsureNotLoggedIn() gin.HandlerFunc {
 			token = strings.Split(authString, " ")[1]
 		}
 
-		if token == config.Config.Node.PrimaryKey {
+		if auth.IsNodeKey(token) {
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
@@ -144,78 +144,60 @@ func EnsureNotLoggedIn() gin.HandlerFunc {
 	}
 }
 
-// This middleware ensures that a request will be aborted with an error
-// if the user is not logged in
-func EnsureWorkflowGroup(paramName string) gin.HandlerFunc {
+// This middleware ensures that a request will be aborted with an error if
+// the user may not perform a verb on the workflow, or the task when a task
+// parameter is given
+func EnsureAllowed(verb, workflowParam, taskParam string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var token string
-		var err error
-		isUI := false
-		workflowName := c.Param(paramName)
-		cs, _ := workflow.GetWorkflowByName(workflowName)
-		if err != nil {
-			c.AbortWithStatus(http.StatusUnauthorized)
-		}
-		if cs == nil {
+		usr, t, isNode := auth.RequestUser(c)
+		if isNode {
 			return
 		}
 
-		authString := c.Request.Header.Get("Authorization")
-		if authString == "" {
-			token, err = c.Cookie("scaffold_token")
-			if err != nil {
-				c.Redirect(http.StatusUnauthorized, "/ui/401")
-				return
-			}
-			isUI = true
-		} else {
-			token = strings.Split(authString, " ")[1]
+		taskName := ""
+		if taskParam != "" {
+			taskName = c.Param(taskParam)
 		}
-		if token == config.Config.Node.PrimaryKey {
+		if policy.Allowed(usr, t, verb, c.Param(workflowParam), taskName) {
 			return
 		}
 
-		usr, _ := user.GetUserByAPIToken(token)
-		if usr != nil {
-			if utils.Contains(usr.Groups, "admin") {
-				return
-			}
-			if cs.Groups == nil {
-				return
-			}
-			for _, group := range cs.Groups {
-				if utils.Contains(usr.Groups, group) {
-					return
-				}
-			}
-			if isUI {
-				c.Redirect(http.StatusUnauthorized, "/ui/401")
-				return
-			}
-			c.AbortWithStatus(http.StatusUnauthorized)
+		if strings.HasPrefix(c.Request.URL.Path, "/ui/") {
+			c.Redirect(http.StatusTemporaryRedirect, "/ui/403")
+			c.Abort()
+			return
+		}
+		c.AbortWithStatus(http.StatusForbidden)
+	}
+}
+
+// This middleware ensures that a request will be aborted with an error if
+// the user may not perform a verb on the workflow a run belongs to
+func EnsureRunAllowed(verb, runParam string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		usr, t, isNode := auth.RequestUser(c)
+		if isNode {
+			return
 		}
 
-		usr, _ = user.GetUserByLoginToken(token)
-		if usr != nil {
-			if utils.Contains(usr.Groups, "admin") {
-				return
-			}
-			for _, group := range cs.Groups {
-				if utils.Contains(usr.Groups, group) {
-					return
-				}
-			}
-			if isUI {
-				c.Redirect(http.StatusUnauthorized, "/ui/401")
-				return
-			}
-			c.AbortWithStatus(http.StatusUnauthorized)
+		h, err := history.GetHistoryByRunID(c.Param(runParam))
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
 		}
-		if isUI {
-			c.Redirect(http.StatusUnauthorized, "/ui/401")
+		if h == nil {
 			return
 		}
-		c.AbortWithStatus(http.StatusUnauthorized)
+		if policy.Allowed(usr, t, verb, h.Workflow, "") {
+			return
+		}
+
+		if strings.HasPrefix(c.Request.URL.Path, "/ui/") {
+			c.Redirect(http.StatusTemporaryRedirect, "/ui/403")
+			c.Abort()
+			return
+		}
+		c.AbortWithStatus(http.StatusForbidden)
 	}
 }
 
@@ -230,13 +212,14 @@ func EnsureSelf() gin.HandlerFunc {
 		if hasAuth {
 			if baUsername != username {
 				c.AbortWithStatus(http.StatusUnauthorized)
+				return
 			}
 			_, err := user.GetUserByUsername(baUsername)
 			if err != nil {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
 			}
-			verified, err := user.VerifyUser(baUsername, baPassword)
+			verified, err := auth.VerifyBasicAuth(c, baUsername, baPassword)
 			if err != nil || !verified {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
@@ -254,11 +237,16 @@ func EnsureSelf() gin.HandlerFunc {
 		} else {
 			token = strings.Split(authString, " ")[1]
 		}
-		if token == config.Config.Node.PrimaryKey {
+		if auth.IsNodeKey(token) {
 			return
 		}
 
-		usr, _ := user.GetUserByAPIToken(token)
+		// Tokens limited to a scope or workflows cannot manage tokens
+		usr, t, _ := user.GetAPIToken(token)
+		if t != nil && t.Restricted() {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
 		if usr != nil {
 			if usr.Username == username || StringSliceContains(usr.Groups, "admin") || StringSliceContains(usr.Roles, "admin") {
 				return
@@ -272,6 +260,7 @@ func EnsureSelf() gin.HandlerFunc {
 				return
 			}
 			c.AbortWithStatus(http.StatusUnauthorized)
+			return
 		}
 		if usr.Username == username || StringSliceContains(usr.Groups, "admin") || StringSliceContains(usr.Roles, "admin") {
 			return
@@ -300,7 +289,7 @@ func EnsureGroupsAllowed(groups []string) gin.HandlerFunc {
 		} else {
 			if !found {
 				token := strings.Split(authString, " ")[1]
-				if token == config.Config.Node.PrimaryKey {
+				if auth.IsNodeKey(token) {
 					return
 				}
 				var err error
@@ -340,14 +329,21 @@ func EnsureRolesAllowed(roles []string) gin.HandlerFunc {
 			}
 		} else {
 			token := strings.Split(authString, " ")[1]
-			if token == config.Config.Node.PrimaryKey {
+			if auth.IsNodeKey(token) {
 				return
 			}
-			usr, err = user.GetUserByAPIToken(token)
+			var t *user.APIToken
+			usr, t, err = user.GetAPIToken(token)
 			if err != nil {
 				c.AbortWithStatus(http.StatusUnauthorized)
 				return
 			}
+			// Outside of workflows, tokens limited to a scope or workflows
+			// can only read
+			if t.Restricted() && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
 		}
 		if usr != nil {
 			for _, role := range usr.Roles {
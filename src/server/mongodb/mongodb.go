@@ -6,6 +6,7 @@ import (
 	"scaffold/server/config"
 	"scaffold/server/constants"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -19,7 +20,28 @@ var collectionNames = []string{
 	constants.MONGODB_INPUT_COLLECTION_NAME,
 	constants.MONGODB_WEBHOOK_COLLECTION_NAME,
 	constants.MONGODB_HISTORY_COLLECTION_NAME,
+	constants.MONGODB_ARTIFACT_COLLECTION_NAME,
+	constants.MONGODB_CACHE_COLLECTION_NAME,
+	constants.MONGODB_CACHE_STATS_COLLECTION_NAME,
+	constants.MONGODB_SECRET_COLLECTION_NAME,
+	constants.MONGODB_REVISION_COLLECTION_NAME,
+	constants.MONGODB_GITSYNC_COLLECTION_NAME,
+	constants.MONGODB_TEMPLATE_COLLECTION_NAME,
+	constants.MONGODB_WEBHOOK_DELIVERY_COLLECTION_NAME,
+	constants.MONGODB_POLICY_COLLECTION_NAME,
+	constants.MONGODB_REVOKED_NODE_COLLECTION_NAME,
+	constants.MONGODB_AUDIT_COLLECTION_NAME,
+	constants.MONGODB_SESSION_COLLECTION_NAME,
+	constants.MONGODB_NAMESPACE_COLLECTION_NAME,
+	constants.MONGODB_RUN_QUEUE_COLLECTION_NAME,
 }
+
+// Fields that must be unique together in a collection, so that concurrent
+// writers racing for the same key get a duplicate key error
+var uniqueIndexes = map[string][]string{
+	constants.MONGODB_ARTIFACT_COLLECTION_NAME: {"workflow", "name", "version"},
+}
+
 var Collections map[string]*mongo.Collection
 var Ctx = context.TODO()
 
@@ -40,4 +62,15 @@ func InitCollections() {
 	for _, collection := range collectionNames {
 		Collections[collection] = client.Database(config.Config.DB.Name).Collection(collection)
 	}
+
+	for collection, fields := range uniqueIndexes {
+		keys := bson.D{}
+		for _, field := range fields {
+			keys = append(keys, bson.E{Key: field, Value: 1})
+		}
+		index := mongo.IndexModel{Keys: keys, Options: options.Index().SetUnique(true)}
+		if _, err := Collections[collection].Indexes().CreateOne(Ctx, index); err != nil {
+			log.Printf("Unable to create unique index on %s: %s", collection, err.Error())
+		}
+	}
 }
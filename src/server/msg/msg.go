@@ -1,6 +1,9 @@
 package msg
 
-import "scaffold/server/state"
+import (
+	"encoding/json"
+	"scaffold/server/state"
+)
 
 type RunMsg struct {
 	Task     string            `json:"task"`
@@ -9,6 +12,21 @@ type RunMsg struct {
 	RunID    string            `json:"run_id"`
 	Context  map[string]string `json:"context"`
 	State    state.State       `json:"state"`
+	Files    []StoredFile      `json:"files"`
+}
+
+// A run message from a worker, signed with the credential the worker was
+// issued when it joined so the manager can tell who sent it
+type SignedMsg struct {
+	Worker    string          `json:"worker"`
+	Signature string          `json:"signature"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// A file version stored by a run
+type StoredFile struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
 }
 
 type TriggerMsg struct {
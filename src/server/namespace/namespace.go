@@ -0,0 +1,314 @@
+package namespace
+
+import (
+	"fmt"
+	"regexp"
+	"scaffold/server/constants"
+	"scaffold/server/mongodb"
+	"scaffold/server/user"
+	"scaffold/server/utils"
+	"scaffold/server/workflow"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Scopes workflows, along with their inputs, datastores, files and secrets,
+// to a set of groups. Admins of a namespace can do anything with its
+// workflows, and runs of its workflows are limited to MaxConcurrentRuns at a
+// time when it is set
+type Namespace struct {
+	Name              string   `json:"name" bson:"name" yaml:"name"`
+	Description       string   `json:"description" bson:"description" yaml:"description"`
+	Groups            []string `json:"groups" bson:"groups" yaml:"groups"`
+	Admins            []string `json:"admins" bson:"admins" yaml:"admins"`
+	MaxConcurrentRuns int      `json:"max_concurrent_runs" bson:"max_concurrent_runs" yaml:"max_concurrent_runs"`
+	Created           string   `json:"created" bson:"created" yaml:"created"`
+	Updated           string   `json:"updated" bson:"updated" yaml:"updated"`
+	// How many runs of the namespace's workflows are going, filled in when it
+	// is returned from the API
+	Running int `json:"running" bson:"-" yaml:"-"`
+	// Namespaces whose workflows can refer to this one's, such as to depend on
+	// their tasks
+	SharedWith []string `json:"shared_with,omitempty" bson:"shared_with,omitempty" yaml:"shared_with,omitempty"`
+}
+
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, "; ")
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// Check a namespace before it is stored. Each group can only belong to one
+// namespace, so the other stored namespaces are passed in
+func Validate(n *Namespace, others []*Namespace) error {
+	errs := []string{}
+	if !namePattern.MatchString(n.Name) {
+		errs = append(errs, fmt.Sprintf("namespace name %s must be lowercase letters, numbers and dashes", n.Name))
+	}
+	if n.MaxConcurrentRuns < 0 {
+		errs = append(errs, fmt.Sprintf("namespace %s cannot have a negative max_concurrent_runs", n.Name))
+	}
+	for _, name := range n.SharedWith {
+		if !namePattern.MatchString(name) {
+			errs = append(errs, fmt.Sprintf("namespace %s is shared with an invalid namespace name %s", n.Name, name))
+		}
+	}
+	for _, group := range n.Groups {
+		if group == "admin" {
+			errs = append(errs, fmt.Sprintf("namespace %s cannot own the admin group", n.Name))
+			continue
+		}
+		for _, o := range others {
+			if o.Name != n.Name && utils.Contains(o.Groups, group) {
+				errs = append(errs, fmt.Sprintf("group %s already belongs to namespace %s", group, o.Name))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// Check whether a user is an admin of a namespace
+func IsAdmin(u *user.User, n *Namespace) bool {
+	return u != nil && n != nil && utils.Contains(n.Admins, u.Username)
+}
+
+// Check whether a user may put workflows in a namespace. Namespaces without
+// groups are open to everyone
+func IsMember(u *user.User, n *Namespace) bool {
+	if u == nil {
+		return false
+	}
+	if n == nil || len(n.Groups) == 0 || utils.Contains(u.Groups, "admin") || IsAdmin(u, n) {
+		return true
+	}
+	for _, group := range u.Groups {
+		if utils.Contains(n.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether workflows in namespace to may refer to workflows in namespace
+// from, such as to depend on their tasks. Workflows in the same namespace can
+// always refer to each other, otherwise from has to be shared with to
+func CheckReference(from, to string) error {
+	if from == to {
+		return nil
+	}
+	n, err := GetNamespaceByName(from)
+	if err != nil {
+		return err
+	}
+	if n == nil || !utils.Contains(n.SharedWith, to) {
+		return &ValidationError{Errors: []string{fmt.Sprintf("namespace %s is not shared with namespace %s", from, to)}}
+	}
+	return nil
+}
+
+// Check that a workflow can be stored in the namespace it names. The
+// namespace has to exist, and a workflow in a namespace with groups can only
+// be shared with those groups
+func CheckWorkflow(w *workflow.Workflow) (*Namespace, error) {
+	name := workflow.NamespaceOf(w)
+	n, err := GetNamespaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		if name != constants.NAMESPACE_DEFAULT {
+			return nil, &ValidationError{Errors: []string{fmt.Sprintf("namespace %s does not exist", name)}}
+		}
+		return nil, nil
+	}
+
+	errs := []string{}
+	if len(n.Groups) > 0 {
+		for _, group := range w.Groups {
+			if !utils.Contains(n.Groups, group) {
+				errs = append(errs, fmt.Sprintf("group %s does not belong to namespace %s", group, name))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	return n, nil
+}
+
+// Get the namespace a workflow belongs to. This is nil for workflows in the
+// default namespace when it has not been configured
+func GetNamespaceByWorkflow(workflowName string) (*Namespace, error) {
+	w, err := workflow.GetWorkflowByName(workflowName)
+	if err != nil {
+		return nil, err
+	}
+	return GetNamespaceByName(workflow.NamespaceOf(w))
+}
+
+func CreateNamespace(n *Namespace) error {
+	others, err := GetAllNamespaces()
+	if err != nil {
+		return err
+	}
+	if err := Validate(n, others); err != nil {
+		return err
+	}
+
+	nn, err := GetNamespaceByName(n.Name)
+	if err != nil {
+		return fmt.Errorf("error getting namespaces: %s", err.Error())
+	}
+	if nn != nil {
+		return fmt.Errorf("namespace already exists with name %s", n.Name)
+	}
+
+	currentTime := time.Now().UTC()
+	n.Created = currentTime.Format("2006-01-02T15:04:05Z")
+	n.Updated = currentTime.Format("2006-01-02T15:04:05Z")
+
+	_, err = mongodb.Collections[constants.MONGODB_NAMESPACE_COLLECTION_NAME].InsertOne(mongodb.Ctx, n)
+	return err
+}
+
+// Delete a namespace. Namespaces still holding workflows cannot be deleted
+func DeleteNamespaceByName(name string) error {
+	ws, err := workflow.GetWorkflowsByNamespace(name)
+	if err != nil {
+		return err
+	}
+	if len(ws) > 0 {
+		return &ValidationError{Errors: []string{fmt.Sprintf("namespace %s still has %d workflows", name, len(ws))}}
+	}
+
+	filter := bson.M{"name": name}
+
+	collection := mongodb.Collections[constants.MONGODB_NAMESPACE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no namespace found with name %s", name)
+	}
+
+	return nil
+}
+
+func GetAllNamespaces() ([]*Namespace, error) {
+	filter := bson.D{{}}
+
+	namespaces, err := FilterNamespaces(filter)
+
+	return namespaces, err
+}
+
+// Get every stored namespace keyed by name, for looking up the namespaces of
+// many workflows at once
+func GetNamespaceMap() (map[string]*Namespace, error) {
+	namespaces, err := GetAllNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*Namespace)
+	for _, n := range namespaces {
+		out[n.Name] = n
+	}
+	return out, nil
+}
+
+func GetNamespaceByName(name string) (*Namespace, error) {
+	filter := bson.M{"name": name}
+
+	namespaces, err := FilterNamespaces(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+
+	if len(namespaces) > 1 {
+		return nil, fmt.Errorf("multiple namespaces found with name %s", name)
+	}
+
+	return namespaces[0], nil
+}
+
+func UpdateNamespaceByName(name string, n *Namespace) error {
+	n.Name = name
+
+	existing, err := GetNamespaceByName(name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return CreateNamespace(n)
+	}
+
+	others, err := GetAllNamespaces()
+	if err != nil {
+		return err
+	}
+	if err := Validate(n, others); err != nil {
+		return err
+	}
+
+	n.Created = existing.Created
+	n.Updated = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	filter := bson.M{"name": name}
+	opts := options.Replace().SetUpsert(true)
+
+	_, err = mongodb.Collections[constants.MONGODB_NAMESPACE_COLLECTION_NAME].ReplaceOne(mongodb.Ctx, filter, n, opts)
+	return err
+}
+
+func FilterNamespaces(filter interface{}) ([]*Namespace, error) {
+	// A slice of namespaces for storing the decoded documents
+	var namespaces []*Namespace
+
+	collection := mongodb.Collections[constants.MONGODB_NAMESPACE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return namespaces, err
+	}
+
+	for cur.Next(ctx) {
+		var n Namespace
+		err := cur.Decode(&n)
+		if err != nil {
+			return namespaces, err
+		}
+
+		namespaces = append(namespaces, &n)
+	}
+
+	if err := cur.Err(); err != nil {
+		return namespaces, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return namespaces, nil
+}
@@ -0,0 +1,27 @@
+package namespace
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	others := []*Namespace{{Name: "payments", Groups: []string{"payments"}}}
+
+	n := &Namespace{Name: "Team_A", Groups: []string{"admin", "payments"}, MaxConcurrentRuns: -1}
+	err := Validate(n, others)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := "namespace name Team_A must be lowercase letters, numbers and dashes; namespace Team_A cannot have a negative max_concurrent_runs; namespace Team_A cannot own the admin group; group payments already belongs to namespace payments"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+
+	n = &Namespace{Name: "payments", Groups: []string{"payments", "billing"}, MaxConcurrentRuns: 2, SharedWith: []string{"reporting"}}
+	if err := Validate(n, others); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+
+	n = &Namespace{Name: "payments", SharedWith: []string{"Reporting"}}
+	if err := Validate(n, others); err == nil {
+		t.Errorf("invalid shared_with namespace was accepted")
+	}
+}
@@ -0,0 +1,49 @@
+// Node holds the credential a node authenticates to other nodes with
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+)
+
+// The credential this worker was issued by the manager when it joined
+var WorkerKey = ""
+
+// Create a new credential for a joining worker
+func GenerateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Compare two credentials in constant time. Empty credentials never match
+func KeysEqual(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// Get the key this process authenticates to other nodes with. Workers use the
+// credential they were issued and the manager uses the primary key, which it
+// only ever sends to itself
+func Key() string {
+	if config.Config.Node.Type == constants.NODE_TYPE_WORKER {
+		return WorkerKey
+	}
+	return config.Config.Node.PrimaryKey
+}
+
+// Sign a message sent between nodes with a node credential
+func Sign(key string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
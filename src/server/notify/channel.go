@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Send a rendered notification to a channel once
+func send(ch config.NotifyChannelObject, subject, message string, e *Event) error {
+	switch ch.Type {
+	case constants.NOTIFY_CHANNEL_WEBHOOK:
+		return post(ch, struct {
+			*Event
+			Subject string `json:"subject"`
+			Message string `json:"message"`
+		}{e, subject, message})
+	case constants.NOTIFY_CHANNEL_SLACK:
+		return post(ch, map[string]string{"text": fmt.Sprintf("*%s*\n%s", subject, message)})
+	case constants.NOTIFY_CHANNEL_TEAMS:
+		return post(ch, map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  subject,
+			"title":    subject,
+			"text":     message,
+		})
+	case constants.NOTIFY_CHANNEL_EMAIL:
+		return sendEmail(ch, subject, message)
+	}
+	return fmt.Errorf("unknown notification channel type %s", ch.Type)
+}
+
+func post(ch config.NotifyChannelObject, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, ch.URL, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range ch.Headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("got status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Send an email through the SMTP server configured for password resets
+func sendEmail(ch config.NotifyChannelObject, subject, message string) error {
+	if len(ch.To) == 0 {
+		return fmt.Errorf("email channel %s has no recipients", ch.Name)
+	}
+	reset := config.Config.Reset
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", reset.Email)
+	m.SetHeader("To", ch.To...)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/plain", message)
+
+	d := gomail.NewDialer(reset.Host, reset.Port, reset.Email, reset.Password)
+	d.TLSConfig = &tls.Config{ServerName: reset.Host, InsecureSkipVerify: config.Config.TLSSkipVerify}
+	return d.DialAndSend(m)
+}
@@ -0,0 +1,206 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"text/template"
+	"time"
+
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// A workflow's rule for which events to send to a channel. Subject and message
+// are Go templates rendered with the event
+type Rule struct {
+	Channel string   `json:"channel" bson:"channel" yaml:"channel"`
+	Events  []string `json:"events" bson:"events" yaml:"events"`
+	Tasks   []string `json:"tasks,omitempty" bson:"tasks,omitempty" yaml:"tasks,omitempty"`
+	Subject string   `json:"subject,omitempty" bson:"subject,omitempty" yaml:"subject,omitempty"`
+	Message string   `json:"message,omitempty" bson:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// Something that happened in a workflow which rules can notify about
+type Event struct {
+	Event    string `json:"event"`
+	Workflow string `json:"workflow"`
+	Task     string `json:"task,omitempty"`
+	RunID    string `json:"run_id,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Worker   string `json:"worker,omitempty"`
+	URL      string `json:"url"`
+	Time     string `json:"time"`
+	// Rendered subject, only set while rendering the message
+	Subject string `json:"-"`
+}
+
+var events = map[string]bool{
+	constants.NOTIFY_EVENT_TASK_SUCCEEDED:     true,
+	constants.NOTIFY_EVENT_TASK_FAILED:        true,
+	constants.NOTIFY_EVENT_RUN_SUCCEEDED:      true,
+	constants.NOTIFY_EVENT_RUN_FAILED:         true,
+	constants.NOTIFY_EVENT_WORKER_LOST:        true,
+	constants.NOTIFY_EVENT_APPROVAL_REQUESTED: true,
+}
+
+var channelTypes = map[string]bool{
+	constants.NOTIFY_CHANNEL_WEBHOOK: true,
+	constants.NOTIFY_CHANNEL_SLACK:   true,
+	constants.NOTIFY_CHANNEL_TEAMS:   true,
+	constants.NOTIFY_CHANNEL_EMAIL:   true,
+}
+
+var defaultSubjects = map[string]string{
+	constants.NOTIFY_EVENT_TASK_SUCCEEDED:     "Task {{ .Workflow }}/{{ .Task }} succeeded",
+	constants.NOTIFY_EVENT_TASK_FAILED:        "Task {{ .Workflow }}/{{ .Task }} failed",
+	constants.NOTIFY_EVENT_RUN_SUCCEEDED:      "Run of {{ .Workflow }} succeeded",
+	constants.NOTIFY_EVENT_RUN_FAILED:         "Run of {{ .Workflow }} failed",
+	constants.NOTIFY_EVENT_WORKER_LOST:        "Worker {{ .Worker }} lost while running {{ .Workflow }}/{{ .Task }}",
+	constants.NOTIFY_EVENT_APPROVAL_REQUESTED: "Task {{ .Workflow }}/{{ .Task }} is waiting for approval",
+}
+
+const defaultMessage = "{{ .Subject }}\n\nRun: {{ .RunID }}\n{{ .URL }}"
+
+// Check a rule when the workflow it belongs to is applied
+func Validate(r *Rule) error {
+	ch, ok := GetChannel(r.Channel)
+	if !ok {
+		return fmt.Errorf("notification channel %s is not configured", r.Channel)
+	}
+	if !channelTypes[ch.Type] {
+		return fmt.Errorf("notification channel %s has unknown type %s", ch.Name, ch.Type)
+	}
+	if len(r.Events) == 0 {
+		return fmt.Errorf("notification rule for channel %s has no events", r.Channel)
+	}
+	for _, e := range r.Events {
+		if !events[e] {
+			return fmt.Errorf("notification rule for channel %s has unknown event %s", r.Channel, e)
+		}
+	}
+	if _, err := template.New("subject").Parse(r.Subject); err != nil {
+		return fmt.Errorf("notification rule for channel %s has an invalid subject: %s", r.Channel, err.Error())
+	}
+	if _, err := template.New("message").Parse(r.Message); err != nil {
+		return fmt.Errorf("notification rule for channel %s has an invalid message: %s", r.Channel, err.Error())
+	}
+	return nil
+}
+
+// Get a channel from the configuration by its name
+func GetChannel(name string) (config.NotifyChannelObject, bool) {
+	for _, ch := range config.Config.Notify.Channels {
+		if ch.Name == name {
+			return ch, true
+		}
+	}
+	return config.NotifyChannelObject{}, false
+}
+
+// Check whether a rule applies to an event. Rules without tasks apply to every
+// task in the workflow
+func Matches(r *Rule, e *Event) bool {
+	matched := false
+	for _, name := range r.Events {
+		if name == e.Event {
+			matched = true
+		}
+	}
+	if !matched || len(r.Tasks) == 0 || e.Task == "" {
+		return matched
+	}
+	for _, name := range r.Tasks {
+		if name == e.Task {
+			return true
+		}
+	}
+	return false
+}
+
+// Render the subject and message of a rule for an event. The message can refer
+// to the rendered subject as `{{ .Subject }}`
+func Render(r *Rule, e *Event) (string, string, error) {
+	subject := r.Subject
+	if subject == "" {
+		subject = defaultSubjects[e.Event]
+	}
+	message := r.Message
+	if message == "" {
+		message = defaultMessage
+	}
+
+	renderedSubject, err := execute(subject, e)
+	if err != nil {
+		return "", "", err
+	}
+	data := *e
+	data.Subject = renderedSubject
+	renderedMessage, err := execute(message, &data)
+	if err != nil {
+		return "", "", err
+	}
+	return renderedSubject, renderedMessage, nil
+}
+
+func execute(text string, data interface{}) (string, error) {
+	t, err := template.New("notification").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Send an event to the channel of every rule that matches it. Delivery happens
+// in the background and is retried with backoff
+func Notify(rules []Rule, e Event) {
+	if e.Time == "" {
+		e.Time = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	}
+	if e.URL == "" {
+		e.URL = fmt.Sprintf("%s/ui/workflows/%s", config.Config.BaseURL, e.Workflow)
+		if e.RunID != "" {
+			e.URL = fmt.Sprintf("%s/ui/runs/%s", config.Config.BaseURL, e.RunID)
+		}
+	}
+
+	for idx := range rules {
+		r := rules[idx]
+		if !Matches(&r, &e) {
+			continue
+		}
+		ch, ok := GetChannel(r.Channel)
+		if !ok {
+			logger.Errorf("", "Notification channel %s for workflow %s is not configured", r.Channel, e.Workflow)
+			continue
+		}
+		subject, message, err := Render(&r, &e)
+		if err != nil {
+			logger.Errorf("", "Cannot render %s notification for workflow %s: %s", e.Event, e.Workflow, err.Error())
+			continue
+		}
+		go deliver(ch, subject, message, e)
+	}
+}
+
+func deliver(ch config.NotifyChannelObject, subject, message string, e Event) {
+	interval := time.Duration(config.Config.Notify.RetryInterval) * time.Second
+	for attempt := 0; ; attempt++ {
+		err := send(ch, subject, message, &e)
+		if err == nil {
+			logger.Debugf("", "Sent %s notification for workflow %s to %s", e.Event, e.Workflow, ch.Name)
+			return
+		}
+		if attempt >= config.Config.Notify.Retries {
+			logger.Errorf("", "Giving up on %s notification for workflow %s to %s: %s", e.Event, e.Workflow, ch.Name, err.Error())
+			return
+		}
+		logger.Warnf("", "Cannot send %s notification for workflow %s to %s, retrying in %s: %s", e.Event, e.Workflow, ch.Name, interval, err.Error())
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	e := &Event{Event: constants.NOTIFY_EVENT_TASK_FAILED, Workflow: "nightly", Task: "build", RunID: "1234", URL: "http://scaffold/ui/runs/1234"}
+
+	subject, message, err := Render(&Rule{}, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Task nightly/build failed" {
+		t.Errorf("unexpected default subject %q", subject)
+	}
+	if message != "Task nightly/build failed\n\nRun: 1234\nhttp://scaffold/ui/runs/1234" {
+		t.Errorf("unexpected default message %q", message)
+	}
+
+	r := &Rule{Subject: "{{ .Event }} in {{ .Workflow }}", Message: "{{ .Subject }}: {{ .Task }}"}
+	if subject, message, err = Render(r, e); err != nil {
+		t.Fatal(err)
+	}
+	if subject != "task_failed in nightly" || message != "task_failed in nightly: build" {
+		t.Errorf("unexpected rendered notification %q %q", subject, message)
+	}
+}
+
+func TestDefaultSubjects(t *testing.T) {
+	for event := range events {
+		if defaultSubjects[event] == "" {
+			t.Errorf("event %s has no default subject", event)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	r := &Rule{Events: []string{constants.NOTIFY_EVENT_TASK_FAILED, constants.NOTIFY_EVENT_RUN_FAILED}, Tasks: []string{"deploy"}}
+	for _, tc := range []struct {
+		event Event
+		want  bool
+	}{
+		{Event{Event: constants.NOTIFY_EVENT_TASK_FAILED, Task: "deploy"}, true},
+		{Event{Event: constants.NOTIFY_EVENT_TASK_FAILED, Task: "build"}, false},
+		{Event{Event: constants.NOTIFY_EVENT_TASK_SUCCEEDED, Task: "deploy"}, false},
+		{Event{Event: constants.NOTIFY_EVENT_RUN_FAILED}, true},
+	} {
+		if got := Matches(r, &tc.event); got != tc.want {
+			t.Errorf("Matches(%s, %s) = %v, want %v", tc.event.Event, tc.event.Task, got, tc.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	var got map[string]interface{}
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Token")
+		got = map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	e := &Event{Event: constants.NOTIFY_EVENT_RUN_SUCCEEDED, Workflow: "nightly", RunID: "1234"}
+
+	ch := config.NotifyChannelObject{Name: "hook", Type: constants.NOTIFY_CHANNEL_WEBHOOK, URL: server.URL, Headers: map[string]string{"X-Token": "abc"}}
+	if err := send(ch, "subject", "message", e); err != nil {
+		t.Fatal(err)
+	}
+	if header != "abc" || got["event"] != "run_succeeded" || got["run_id"] != "1234" || got["subject"] != "subject" || got["message"] != "message" {
+		t.Errorf("unexpected webhook payload %v with header %q", got, header)
+	}
+
+	ch = config.NotifyChannelObject{Name: "slack", Type: constants.NOTIFY_CHANNEL_SLACK, URL: server.URL}
+	if err := send(ch, "subject", "message", e); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"] != "*subject*\nmessage" {
+		t.Errorf("unexpected slack payload %v", got)
+	}
+
+	ch = config.NotifyChannelObject{Name: "teams", Type: constants.NOTIFY_CHANNEL_TEAMS, URL: server.URL}
+	if err := send(ch, "subject", "message", e); err != nil {
+		t.Fatal(err)
+	}
+	if got["@type"] != "MessageCard" || got["title"] != "subject" || got["text"] != "message" {
+		t.Errorf("unexpected teams payload %v", got)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	config.Config.Notify = config.NotifyObject{Retries: 2, RetryInterval: 0}
+	ch := config.NotifyChannelObject{Name: "hook", Type: constants.NOTIFY_CHANNEL_WEBHOOK, URL: server.URL}
+	deliver(ch, "subject", "message", Event{Event: constants.NOTIFY_EVENT_RUN_FAILED, Workflow: "nightly"})
+	if attempts != 3 {
+		t.Errorf("delivered after %d attempts, want 3", attempts)
+	}
+
+	attempts = -10
+	deliver(ch, "subject", "message", Event{Event: constants.NOTIFY_EVENT_RUN_FAILED, Workflow: "nightly"})
+	if attempts != -7 {
+		t.Errorf("gave up after %d attempts, want 3", attempts+10)
+	}
+}
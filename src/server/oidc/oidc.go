@@ -0,0 +1,319 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"scaffold/server/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a login can take between the redirect to the issuer and the
+// callback
+const LOGIN_TIMEOUT = 10 * time.Minute
+
+// The parts of an issuer's discovery document Scaffold uses
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Logs users in against an OpenID Connect issuer with the authorization code
+// flow and PKCE. The discovery document and signing keys are fetched on first
+// use, keys are fetched again when a token is signed with an unknown one
+type Provider struct {
+	Config config.OIDCObject
+	Client *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]crypto.PublicKey
+}
+
+// A login in progress, kept by the manager until the issuer redirects back
+type Login struct {
+	State    string
+	Nonce    string
+	Verifier string
+	Expires  time.Time
+}
+
+// The Scaffold account details taken from the claims of an ID token
+type Identity struct {
+	Username   string
+	Email      string
+	GivenName  string
+	FamilyName string
+	Groups     []string
+	Roles      []string
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func NewProvider(c config.OIDCObject) *Provider {
+	if c.RedirectURL == "" {
+		c.RedirectURL = strings.TrimSuffix(config.Config.BaseURL, "/") + "/auth/oidc/callback"
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "profile", "email"}
+	}
+	if c.UsernameClaim == "" {
+		c.UsernameClaim = "preferred_username"
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+	if c.RolesClaim == "" {
+		c.RolesClaim = "roles"
+	}
+	return &Provider{
+		Config: c,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Check whether single sign-on is configured
+func Enabled() bool {
+	return config.Config.OIDC.Issuer != ""
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Start a login with a new state, nonce, and PKCE code verifier
+func NewLogin() (*Login, error) {
+	l := &Login{Expires: time.Now().Add(LOGIN_TIMEOUT)}
+	var err error
+	if l.State, err = randomString(); err != nil {
+		return nil, err
+	}
+	if l.Nonce, err = randomString(); err != nil {
+		return nil, err
+	}
+	if l.Verifier, err = randomString(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// The S256 PKCE challenge of a code verifier
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) getJSON(u string, v interface{}) error {
+	resp, err := p.Client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *Provider) discover() (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	d := &Discovery{}
+	issuer := strings.TrimSuffix(p.Config.Issuer, "/")
+	if err := p.getJSON(issuer+"/.well-known/openid-configuration", d); err != nil {
+		return nil, fmt.Errorf("discovery failed: %s", err.Error())
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %s, not %s", d.Issuer, p.Config.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing an endpoint")
+	}
+	p.discovery = d
+	return d, nil
+}
+
+// Build the URL of the issuer's authorization endpoint to send the user to
+func (p *Provider) AuthURL(l *Login) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.Config.ClientID)
+	q.Set("redirect_uri", p.Config.RedirectURL)
+	q.Set("scope", strings.Join(p.Config.Scopes, " "))
+	q.Set("state", l.State)
+	q.Set("nonce", l.Nonce)
+	q.Set("code_challenge", challenge(l.Verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Redeem an authorization code at the token endpoint and return the verified
+// claims of the ID token
+func (p *Provider) Exchange(code string, l *Login) (map[string]interface{}, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	form.Set("client_id", p.Config.ClientID)
+	form.Set("code_verifier", l.Verifier)
+
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.Config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var t tokenResponse
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if t.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned %s: %s", t.Error, t.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || t.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint returned status %d without an ID token", resp.StatusCode)
+	}
+
+	return p.verify(t.IDToken, l.Nonce)
+}
+
+// Map the claims of an ID token to a Scaffold account. Group and role claim
+// values are translated with the configured mappings, or used as they are when
+// no mapping is set. Values from either claim can be mapped to a role
+func (p *Provider) Identity(claims map[string]interface{}) (*Identity, error) {
+	id := &Identity{
+		Email:      claimString(claims, "email"),
+		GivenName:  claimString(claims, "given_name"),
+		FamilyName: claimString(claims, "family_name"),
+		Groups:     []string{},
+		Roles:      []string{},
+	}
+	if id.Username = claimString(claims, p.Config.UsernameClaim); id.Username == "" {
+		return nil, fmt.Errorf("ID token has no %s claim", p.Config.UsernameClaim)
+	}
+
+	groups := claimStrings(claims, p.Config.GroupsClaim)
+	roles := claimStrings(claims, p.Config.RolesClaim)
+
+	for _, g := range groups {
+		if len(p.Config.GroupMapping) == 0 {
+			id.Groups = appendUnique(id.Groups, g)
+		} else if mapped, ok := p.Config.GroupMapping[g]; ok {
+			id.Groups = appendUnique(id.Groups, mapped)
+		}
+	}
+	for _, r := range append(roles, groups...) {
+		if mapped, ok := p.Config.RoleMapping[r]; ok {
+			id.Roles = appendUnique(id.Roles, mapped)
+		}
+	}
+	if len(p.Config.RoleMapping) == 0 {
+		for _, r := range roles {
+			id.Roles = appendUnique(id.Roles, r)
+		}
+	}
+	if len(id.Roles) == 0 {
+		id.Roles = append(id.Roles, p.Config.DefaultRoles...)
+	}
+	return id, nil
+}
+
+// Look up a claim by name. Dots reach into nested objects, so Keycloak's realm
+// roles can be read with `realm_access.roles`
+func claim(claims map[string]interface{}, name string) interface{} {
+	if v, ok := claims[name]; ok {
+		return v
+	}
+	var v interface{} = claims
+	for _, key := range strings.Split(name, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	s, _ := claim(claims, name).(string)
+	return s
+}
+
+// Get a claim that holds a list of strings. A single string is treated as a
+// list of one
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch v := claim(claims, name).(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return []string{}
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,213 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"scaffold/server/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A local issuer that hands out an ID token for a single authorization code
+type mockIssuer struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	claims    map[string]interface{}
+	challenge string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks{Keys: []jwk{{
+			Kty: "RSA",
+			Kid: "test",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.PostFormValue("code") != "good-code" || id != "scaffold" || secret != "shh" || challenge(r.PostFormValue("code_verifier")) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, "RS256", "test", m.claims)})
+	})
+	m.server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockIssuer) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(jwtHeader{Alg: alg, Kid: kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestLogin(t *testing.T) {
+	m := newMockIssuer(t)
+	defer m.server.Close()
+
+	p := NewProvider(config.OIDCObject{Issuer: m.server.URL, ClientID: "scaffold", ClientSecret: "shh", RedirectURL: "http://scaffold/auth/oidc/callback"})
+	l, err := NewLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthURL(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") || q.Get("state") != l.State || q.Get("nonce") != l.Nonce || q.Get("code_challenge_method") != "S256" || q.Get("scope") != "openid profile email" {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+	m.challenge = q.Get("code_challenge")
+
+	claims := map[string]interface{}{
+		"iss":                m.server.URL,
+		"aud":                "scaffold",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"nonce":              l.Nonce,
+		"preferred_username": "jdoe",
+		"email":              "jdoe@example.com",
+	}
+	m.claims = claims
+	got, err := p.Exchange("good-code", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["preferred_username"] != "jdoe" {
+		t.Errorf("unexpected claims %v", got)
+	}
+
+	if _, err := p.Exchange("bad-code", l); err == nil {
+		t.Errorf("invalid code was accepted")
+	}
+	if _, err := p.Exchange("good-code", &Login{Nonce: l.Nonce, Verifier: "other"}); err == nil {
+		t.Errorf("wrong code verifier was accepted")
+	}
+
+	for name, change := range map[string]func(map[string]interface{}){
+		"issuer":   func(c map[string]interface{}) { c["iss"] = "http://evil" },
+		"audience": func(c map[string]interface{}) { c["aud"] = []string{"other"} },
+		"expiry":   func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"nonce":    func(c map[string]interface{}) { c["nonce"] = "replayed" },
+	} {
+		bad := map[string]interface{}{}
+		for k, v := range claims {
+			bad[k] = v
+		}
+		change(bad)
+		m.claims = bad
+		if _, err := p.Exchange("good-code", l); err == nil {
+			t.Errorf("ID token with a bad %s was accepted", name)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	m := newMockIssuer(t)
+	defer m.server.Close()
+	p := NewProvider(config.OIDCObject{Issuer: m.server.URL, ClientID: "scaffold"})
+	claims := map[string]interface{}{"iss": m.server.URL, "aud": "scaffold", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "n"}
+
+	token := m.sign(t, "RS256", "test", claims)
+	if _, err := p.verify(token, "n"); err != nil {
+		t.Fatalf("valid token was rejected: %s", err.Error())
+	}
+	parts := strings.Split(token, ".")
+	tampered, _ := json.Marshal(map[string]interface{}{"iss": m.server.URL, "aud": "scaffold", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "n", "admin": true})
+	if _, err := p.verify(parts[0]+"."+base64.RawURLEncoding.EncodeToString(tampered)+"."+parts[2], "n"); err == nil {
+		t.Errorf("tampered token was accepted")
+	}
+	if _, err := p.verify(m.sign(t, "RS256", "unknown", claims), "n"); err == nil {
+		t.Errorf("token signed with an unknown key was accepted")
+	}
+	none, _ := json.Marshal(jwtHeader{Alg: "none"})
+	if _, err := p.verify(base64.RawURLEncoding.EncodeToString(none)+"."+parts[1]+".", "n"); err == nil {
+		t.Errorf("unsigned token was accepted")
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	digest := sha256.Sum256([]byte("signed"))
+	r, s, _ := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	if err := verifySignature("ES256", &ecKey.PublicKey, []byte("signed"), sig); err != nil {
+		t.Errorf("valid ES256 signature was rejected: %s", err.Error())
+	}
+	if err := verifySignature("RS256", &ecKey.PublicKey, []byte("signed"), sig); err == nil {
+		t.Errorf("RS256 was accepted for an EC key")
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	claims := map[string]interface{}{
+		"preferred_username": "jdoe",
+		"email":              "jdoe@example.com",
+		"given_name":         "Jane",
+		"groups":             []interface{}{"platform", "scaffold-admins", "finance"},
+		"realm_access":       map[string]interface{}{"roles": []interface{}{"write"}},
+	}
+
+	p := NewProvider(config.OIDCObject{DefaultRoles: []string{"read"}})
+	id, err := p.Identity(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Username != "jdoe" || id.Email != "jdoe@example.com" || id.GivenName != "Jane" || len(id.Groups) != 3 || len(id.Roles) != 1 || id.Roles[0] != "read" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+
+	p = NewProvider(config.OIDCObject{
+		RolesClaim:   "realm_access.roles",
+		GroupMapping: map[string]string{"platform": "ops", "scaffold-admins": "admin"},
+		RoleMapping:  map[string]string{"scaffold-admins": "admin", "write": "write"},
+		DefaultRoles: []string{"read"},
+	})
+	if id, err = p.Identity(claims); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(id.Groups, ",") != "ops,admin" || strings.Join(id.Roles, ",") != "write,admin" {
+		t.Errorf("unexpected mapped groups %v and roles %v", id.Groups, id.Roles)
+	}
+
+	p = NewProvider(config.OIDCObject{UsernameClaim: "sub"})
+	if _, err := p.Identity(claims); err == nil {
+		t.Errorf("identity without a username was accepted")
+	}
+}
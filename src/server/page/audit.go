@@ -0,0 +1,299 @@
+package page
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"scaffold/server/audit"
+	"scaffold/server/constants"
+	"strings"
+
+	"github.com/jfcarter2358/ui"
+	"github.com/jfcarter2358/ui/breadcrumb"
+	"github.com/jfcarter2358/ui/button"
+	"github.com/jfcarter2358/ui/elements/br"
+	"github.com/jfcarter2358/ui/elements/div"
+	"github.com/jfcarter2358/ui/elements/link"
+	"github.com/jfcarter2358/ui/page"
+	"github.com/jfcarter2358/ui/sidebar"
+	"github.com/jfcarter2358/ui/table"
+	"github.com/jfcarter2358/ui/table/cell"
+	"github.com/jfcarter2358/ui/table/header"
+	"github.com/jfcarter2358/ui/topbar"
+
+	_ "embed"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// How many entries the audit page shows when no limit is given
+const AUDIT_PAGE_LIMIT = 200
+
+func AuditTableEndpoint(ctx *gin.Context) {
+	q, err := audit.ParseQuery(ctx.Request.URL.Query())
+	if err != nil {
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(`<p style="margin:16px;">`+html.EscapeString(err.Error())+`</p>`))
+		return
+	}
+	if q.Limit == 0 {
+		q.Limit = AUDIT_PAGE_LIMIT
+	}
+
+	entries, err := audit.GetEntries(q)
+	if err != nil {
+		logger.Errorf("", "Cannot render audit page: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	markdown := auditBuildTable(entries, ctx)
+
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
+}
+
+func AuditPageEndpoint(ctx *gin.Context) {
+	markdown := auditBuildPage(ctx)
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
+}
+
+func auditFilterInput(name, placeholder, inputType string) string {
+	return fmt.Sprintf(`<input class="w3-input w3-round theme-light" type="%s" name="%s" placeholder="%s"
+                    style="display:inline-block;width:12%%;margin-right:4px;" />`, inputType, name, placeholder)
+}
+
+func auditBuildPage(ctx *gin.Context) []byte {
+	sources := `<option value="">Any Source</option>`
+	for _, s := range []string{constants.AUDIT_SOURCE_UI, constants.AUDIT_SOURCE_API, constants.AUDIT_SOURCE_CLI, constants.AUDIT_SOURCE_WEBHOOK, constants.AUDIT_SOURCE_CRON, constants.AUDIT_SOURCE_NODE} {
+		sources += fmt.Sprintf(`<option value="%s">%s</option>`, s, s)
+	}
+
+	p := page.Page{
+		ID:             "page",
+		SidebarEnabled: true,
+		Sidebar: sidebar.Sidebar{
+			ID:      "sidebar",
+			Classes: "theme-light",
+			Components: []ui.Component{
+				link.Link{
+					Title: "Audit",
+					HRef:  "/ui/audit",
+				},
+				link.Link{
+					Title: "Dashboard",
+					HRef:  "/ui/dashboard",
+				},
+				link.Link{
+					Title: "Files",
+					HRef:  "/ui/files",
+				},
+				link.Link{
+					Title: "Runs",
+					HRef:  "/ui/runs",
+				},
+				link.Link{
+					Title: "Users",
+					HRef:  "/ui/users",
+				},
+				link.Link{
+					Title: "Workflows",
+					HRef:  "/ui/workflows",
+				},
+			},
+		},
+		Components: []ui.Component{
+			topbar.Topbar{
+				Title:   "Scaffold",
+				Classes: "ui-green",
+				Buttons: []ui.Component{
+					link.Link{
+						Title:   "Logout",
+						HRef:    "/auth/logout",
+						Style:   "passing:12px;",
+						Classes: "theme-dark rounded-md",
+					},
+				},
+				MenuClasses: "theme-light",
+			},
+			div.Div{
+				Classes: "theme-light rounded-md",
+				Components: []ui.Component{
+					div.Div{
+						Classes: "ui-green rounded-md",
+						Style:   "height:64px;",
+						Components: []ui.Component{
+							breadcrumb.Breadcrumb{
+								Components: []ui.Component{
+									link.Link{
+										Title: "Audit",
+										HRef:  "/ui/audit",
+									},
+								},
+								Style: "margin-left:16px;",
+							},
+							button.Button{
+								ID:      "export_button",
+								OnClick: "exportAudit()",
+								Title:   `Export&nbsp;<i class="fa-solid fa-file-export"></i>`,
+								Style:   "float:right;display:inline-block;margin-right:8px;margin-top:-32px;margin-bottom:8px;",
+								Classes: "theme-base",
+							},
+						},
+					},
+					ui.Raw{
+						HTMLString: `<form id="audit-filters" hx-get="/htmx/audit/table" hx-trigger="change, keyup changed delay:250ms"
+                            hx-target="#audit-table-div" style="margin-top:8px;margin-bottom:8px;margin-left:1%;width:98%">` +
+							auditFilterInput("actor", "Actor", "text") +
+							`<select class="w3-select w3-round theme-light" name="source" style="display:inline-block;width:12%;margin-right:4px;">` + sources + `</select>` +
+							auditFilterInput("action", "Action", "text") +
+							auditFilterInput("kind", "Kind", "text") +
+							auditFilterInput("target", "Target", "text") +
+							auditFilterInput("since", "Since", "date") +
+							auditFilterInput("until", "Until", "date") +
+							`</form>`,
+					},
+					div.Div{
+						ID:        "audit-table-div",
+						HXTrigger: "load",
+						HXGet:     "/htmx/audit/table",
+					},
+				},
+				Style: "margin:64px;",
+			},
+			br.BR{},
+			ui.Raw{
+				HTMLString: `
+					<script>
+						function exportAudit() {
+							const params = new URLSearchParams(new FormData(document.getElementById("audit-filters")))
+							window.location.href = "/api/v1/audit/export?" + params.toString()
+						}
+					</script>
+					`,
+			},
+		},
+	}
+	html, err := p.Render()
+	if err != nil {
+		logger.Errorf("", "Cannot render audit page: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	return []byte(html)
+}
+
+func auditValue(v interface{}) string {
+	if v == nil {
+		return "-"
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+func auditChanges(changes []audit.Change) string {
+	lines := []string{}
+	for _, c := range changes {
+		lines = append(lines, fmt.Sprintf("<b>%s</b>: %s &rarr; %s", html.EscapeString(c.Field), html.EscapeString(auditValue(c.Before)), html.EscapeString(auditValue(c.After))))
+	}
+	return strings.Join(lines, "<br>")
+}
+
+func auditBuildTable(entries []*audit.Entry, ctx *gin.Context) []byte {
+	t := table.Table{
+		ID: "audit_table",
+		Headers: []header.Header{
+			{
+				Contents: "Time",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Actor",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Source",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Action",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Kind",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Target",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Status",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "IP",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Changes",
+				Classes:  "text-lg",
+			},
+		},
+		Rows:          make([][]cell.Cell, 0),
+		Classes:       "theme-light",
+		Style:         "width:100%;",
+		HeaderClasses: "rounded-md ui-green",
+	}
+
+	for _, e := range entries {
+		status := ""
+		if e.Status != 0 {
+			status = fmt.Sprintf("%d", e.Status)
+		}
+		r := []cell.Cell{
+			{
+				Contents: e.Time,
+			},
+			{
+				Contents: html.EscapeString(e.Actor),
+			},
+			{
+				Contents: e.Source,
+			},
+			{
+				Contents: html.EscapeString(e.Action),
+			},
+			{
+				Contents: html.EscapeString(e.Kind),
+			},
+			{
+				Contents: html.EscapeString(e.Target),
+			},
+			{
+				Contents: status,
+			},
+			{
+				Contents: html.EscapeString(e.IP),
+			},
+			{
+				Contents: auditChanges(e.Changes),
+			},
+		}
+		t.Rows = append(t.Rows, r)
+	}
+
+	html, err := t.Render()
+	if err != nil {
+		logger.Errorf("", "Cannot render audit table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	return []byte(html)
+}
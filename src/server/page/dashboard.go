@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"scaffold/server/constants"
+	"scaffold/server/namespace"
+	"scaffold/server/policy"
 	"scaffold/server/state"
 	"scaffold/server/user"
 	"scaffold/server/workflow"
@@ -77,10 +79,18 @@ func dashboardBuildPage(ctx *gin.Context) []byte {
 			ID:      "sidebar",
 			Classes: "theme-light",
 			Components: []ui.Component{
+				link.Link{
+					Title: "Audit",
+					HRef:  "/ui/audit",
+				},
 				link.Link{
 					Title: "Dashboard",
 					HRef:  "/ui/dashboard",
 				},
+				link.Link{
+					Title: "Files",
+					HRef:  "/ui/files",
+				},
 				link.Link{
 					Title: "Runs",
 					HRef:  "/ui/runs",
@@ -181,23 +191,22 @@ func dashboardBuildTable(ws []workflow.Workflow, ctx *gin.Context) []byte {
 
 	token, _ := ctx.Cookie("scaffold_token")
 	u, _ := user.GetUserByLoginToken(token)
+	policies, err := policy.GetAllPolicies()
+	if err != nil {
+		logger.Errorf("", "Cannot render dashboard table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	namespaces, err := namespace.GetNamespaceMap()
+	if err != nil {
+		logger.Errorf("", "Cannot render dashboard table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
 
 	for _, w := range ws {
-		isInGroup := false
-		for _, ug := range u.Groups {
-			if ug == "admin" {
-				isInGroup = true
-				break
-			}
-			for _, wg := range w.Groups {
-				if ug == wg {
-					isInGroup = true
-					break
-				}
-			}
-			if isInGroup {
-				break
-			}
+		if !policy.GrantsInNamespace(u, namespaces[workflow.NamespaceOf(&w)], w.Groups, policies, policy.VERB_VIEW, w.Name, "") {
+			continue
 		}
 		ss, err := state.GetAllStates()
 		if err != nil {
@@ -223,7 +232,7 @@ func dashboardBuildTable(ws []workflow.Workflow, ctx *gin.Context) []byte {
 					notStartedCount += 1
 				case constants.STATE_STATUS_RUNNING:
 					runningCount += 1
-				case constants.STATE_STATUS_SUCCESS:
+				case constants.STATE_STATUS_SUCCESS, constants.STATE_STATUS_CACHED:
 					successCount += 1
 				case constants.STATE_STATUS_WAITING:
 					waitingCount += 1
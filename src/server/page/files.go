@@ -0,0 +1,303 @@
+package page
+
+import (
+	"fmt"
+	"net/http"
+	"scaffold/server/artifact"
+	"scaffold/server/namespace"
+	"scaffold/server/policy"
+	"scaffold/server/user"
+	"scaffold/server/workflow"
+	"sort"
+	"strings"
+
+	"github.com/jfcarter2358/ui"
+	"github.com/jfcarter2358/ui/breadcrumb"
+	"github.com/jfcarter2358/ui/elements/br"
+	"github.com/jfcarter2358/ui/elements/div"
+	"github.com/jfcarter2358/ui/elements/link"
+	"github.com/jfcarter2358/ui/page"
+	"github.com/jfcarter2358/ui/sidebar"
+	"github.com/jfcarter2358/ui/table"
+	"github.com/jfcarter2358/ui/table/cell"
+	"github.com/jfcarter2358/ui/table/header"
+	"github.com/jfcarter2358/ui/topbar"
+
+	_ "embed"
+
+	"github.com/gin-gonic/gin"
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+func FilesSearchEndpoint(ctx *gin.Context) {
+	searchTerm, ok := ctx.GetQuery("search")
+	if !ok {
+		ctx.Status(http.StatusBadRequest)
+		return
+	}
+	query := strings.ToLower(strings.TrimSpace(searchTerm))
+
+	artifacts, err := artifact.GetAllArtifacts()
+	if err != nil {
+		logger.Errorf("", "Cannot render files page: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	filtered := []artifact.Artifact{}
+
+	for _, a := range artifacts {
+		if strings.Contains(strings.ToLower(a.Name), query) || strings.Contains(strings.ToLower(a.Workflow), query) || strings.Contains(strings.ToLower(a.RunID), query) {
+			filtered = append(filtered, *a)
+		}
+	}
+
+	markdown := filesBuildTable(filtered, ctx)
+
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
+}
+
+func FilesTableEndpoint(ctx *gin.Context) {
+	artifacts, err := artifact.GetAllArtifacts()
+	if err != nil {
+		logger.Errorf("", "Cannot render files page: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	filtered := []artifact.Artifact{}
+
+	for _, a := range artifacts {
+		filtered = append(filtered, *a)
+	}
+
+	markdown := filesBuildTable(filtered, ctx)
+
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
+}
+
+func FilesPageEndpoint(ctx *gin.Context) {
+	markdown := filesBuildPage(ctx)
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
+}
+
+func filesBuildPage(ctx *gin.Context) []byte {
+	p := page.Page{
+		ID:             "page",
+		SidebarEnabled: true,
+		Sidebar: sidebar.Sidebar{
+			ID:      "sidebar",
+			Classes: "theme-light",
+			Components: []ui.Component{
+				link.Link{
+					Title: "Audit",
+					HRef:  "/ui/audit",
+				},
+				link.Link{
+					Title: "Dashboard",
+					HRef:  "/ui/dashboard",
+				},
+				link.Link{
+					Title: "Files",
+					HRef:  "/ui/files",
+				},
+				link.Link{
+					Title: "Runs",
+					HRef:  "/ui/runs",
+				},
+				link.Link{
+					Title: "Users",
+					HRef:  "/ui/users",
+				},
+				link.Link{
+					Title: "Workflows",
+					HRef:  "/ui/workflows",
+				},
+			},
+		},
+		Components: []ui.Component{
+			topbar.Topbar{
+				Title:   "Scaffold",
+				Classes: "ui-green",
+				Buttons: []ui.Component{
+					link.Link{
+						Title:   "Logout",
+						HRef:    "/auth/logout",
+						Style:   "passing:12px;",
+						Classes: "theme-dark rounded-md",
+					},
+				},
+				MenuClasses: "theme-light",
+			},
+			div.Div{
+				Classes: "theme-light rounded-md",
+				Components: []ui.Component{
+					div.Div{
+						Classes: "ui-green rounded-md",
+						Components: []ui.Component{
+							breadcrumb.Breadcrumb{
+								Components: []ui.Component{
+									link.Link{
+										Title: "Files",
+										HRef:  "/ui/files",
+									},
+								},
+								Style: "margin-left:16px;",
+							},
+						},
+					},
+					ui.Raw{
+						HTMLString: `<input id="search" class="w3-input w3-round search-bar theme-light" type="text"
+                            name="search" placeholder="Search Files"
+                            style="margin-top:8px;margin-bottom:8px;margin-left:1%;width:98%" hx-get="/htmx/files/search"
+                            hx-trigger="keyup changed delay:250ms" hx-target="#files-table-div" />`,
+					},
+					div.Div{
+						ID:        "files-table-div",
+						HXTrigger: "load",
+						HXGet:     "/htmx/files/table",
+					},
+				},
+				Style: "margin:64px;",
+			},
+			br.BR{},
+		},
+	}
+	html, err := p.Render()
+	if err != nil {
+		logger.Errorf("", "Cannot render files page: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	return []byte(html)
+}
+
+func filesBuildTable(as []artifact.Artifact, ctx *gin.Context) []byte {
+	sort.Slice(as, func(i, j int) bool {
+		if as[i].Workflow != as[j].Workflow {
+			return as[i].Workflow < as[j].Workflow
+		}
+		if as[i].Name != as[j].Name {
+			return as[i].Name < as[j].Name
+		}
+		return as[i].Version > as[j].Version
+	})
+
+	t := table.Table{
+		ID: "files_table",
+		Headers: []header.Header{
+			{
+				Contents: "Workflow",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Name",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Version",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Run",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Task",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Size",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Checksum",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Created",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "",
+				Classes:  "text-lg",
+			},
+		},
+		Rows:          make([][]cell.Cell, 0),
+		Classes:       "theme-light",
+		Style:         "width:100%;",
+		HeaderClasses: "rounded-md ui-green",
+	}
+
+	token, _ := ctx.Cookie("scaffold_token")
+	u, _ := user.GetUserByLoginToken(token)
+	if u == nil {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return []byte{}
+	}
+	ws := workflow.GetCacheAll()
+	policies, err := policy.GetAllPolicies()
+	if err != nil {
+		logger.Errorf("", "Cannot render files table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	namespaces, err := namespace.GetNamespaceMap()
+	if err != nil {
+		logger.Errorf("", "Cannot render files table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+
+	for _, a := range as {
+		w := ws[a.Workflow]
+		if !policy.GrantsInNamespace(u, namespaces[workflow.NamespaceOf(&w)], w.Groups, policies, policy.VERB_VIEW, a.Workflow, "") {
+			continue
+		}
+
+		checksum := a.Checksum
+		if len(checksum) > 12 {
+			checksum = checksum[:12]
+		}
+		r := []cell.Cell{
+			{
+				Contents: a.Workflow,
+			},
+			{
+				Contents: a.Name,
+			},
+			{
+				Contents: fmt.Sprintf("%d", a.Version),
+			},
+			{
+				Contents: a.RunID,
+			},
+			{
+				Contents: a.Task,
+			},
+			{
+				Contents: fmt.Sprintf("%d", a.Size),
+			},
+			{
+				Contents: checksum,
+			},
+			{
+				Contents: a.Created,
+			},
+			{
+				Contents: fmt.Sprintf(`<a href="/api/v1/file/%s/%s/versions/%d/download" class="table-link-link w3-right-align dark theme-text"
+                    style="float:right;margin-right:16px;">
+                    <i class="fa-solid fa-download"></i>
+                </a>`, a.Workflow, a.Name, a.Version),
+			},
+		}
+		t.Rows = append(t.Rows, r)
+	}
+
+	html, err := t.Render()
+	if err != nil {
+		logger.Errorf("", "Cannot render files table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	return []byte(html)
+}
@@ -1,17 +1,23 @@
 package page
 
 import (
+	"html"
 	"net/http"
 	"scaffold/server/history"
+	"scaffold/server/namespace"
+	"scaffold/server/policy"
+	"scaffold/server/queue"
 	"scaffold/server/user"
 	"scaffold/server/workflow"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/jfcarter2358/ui"
 	"github.com/jfcarter2358/ui/breadcrumb"
 	"github.com/jfcarter2358/ui/elements/br"
 	"github.com/jfcarter2358/ui/elements/div"
+	"github.com/jfcarter2358/ui/elements/h1"
 	"github.com/jfcarter2358/ui/elements/link"
 	"github.com/jfcarter2358/ui/page"
 	"github.com/jfcarter2358/ui/sidebar"
@@ -72,6 +78,11 @@ func HistoriesTableEndpoint(ctx *gin.Context) {
 	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
 }
 
+func HistoriesQueueEndpoint(ctx *gin.Context) {
+	markdown := historiesBuildQueueTable(ctx)
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
+}
+
 func HistoriesPageEndpoint(ctx *gin.Context) {
 	markdown := historiesBuildPage(ctx)
 	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
@@ -85,10 +96,18 @@ func historiesBuildPage(ctx *gin.Context) []byte {
 			ID:      "sidebar",
 			Classes: "theme-light",
 			Components: []ui.Component{
+				link.Link{
+					Title: "Audit",
+					HRef:  "/ui/audit",
+				},
 				link.Link{
 					Title: "Dashboard",
 					HRef:  "/ui/dashboard",
 				},
+				link.Link{
+					Title: "Files",
+					HRef:  "/ui/files",
+				},
 				link.Link{
 					Title: "Runs",
 					HRef:  "/ui/runs",
@@ -145,6 +164,21 @@ func historiesBuildPage(ctx *gin.Context) []byte {
 						HXTrigger: "load",
 						HXGet:     "/htmx/runs/table",
 					},
+					br.BR{},
+					h1.H1{
+						Contents: `
+						<h1 id="queue-header" class="text-xl" style="float:left;padding-top:8px;padding-left:32px;">Run Queue</h1>
+						`,
+						Classes: "ui-green rounded-md",
+						Style:   "width:100%;",
+					},
+					br.BR{},
+					br.BR{},
+					div.Div{
+						ID:        "queue-table-div",
+						HXTrigger: "load, every 5s",
+						HXGet:     "/htmx/runs/queue",
+					},
 				},
 				Style: "margin:64px;",
 			},
@@ -206,37 +240,23 @@ func historiesBuildTable(hs []history.History, ctx *gin.Context) []byte {
 	token, _ := ctx.Cookie("scaffold_token")
 	u, _ := user.GetUserByLoginToken(token)
 	ws := workflow.GetCacheAll()
-	groups := []string{}
-	for _, w := range ws {
-		if w.Name == hs[0].Workflow {
-			groups = w.Groups
-		}
+	policies, err := policy.GetAllPolicies()
+	if err != nil {
+		logger.Errorf("", "Cannot render runs table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	namespaces, err := namespace.GetNamespaceMap()
+	if err != nil {
+		logger.Errorf("", "Cannot render runs table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
 	}
 
 	for _, h := range hs {
-		isInGroup := false
-		for _, ug := range u.Groups {
-			if ug == "admin" {
-				isInGroup = true
-				break
-			}
-			for _, wg := range groups {
-				if ug == wg {
-					isInGroup = true
-					break
-				}
-			}
-			if isInGroup {
-				break
-			}
-		}
-		for _, ur := range u.Roles {
-			if ur == "admin" {
-				break
-			}
-			if ur == "write" {
-				break
-			}
+		w := ws[h.Workflow]
+		if !policy.GrantsInNamespace(u, namespaces[workflow.NamespaceOf(&w)], w.Groups, policies, policy.VERB_VIEW, h.Workflow, "") {
+			continue
 		}
 		logger.Errorf("", "Current history check: %s", h.RunID)
 		logger.Errorf("", "Current history states: %v", h.States)
@@ -281,3 +301,108 @@ func historiesBuildTable(hs []history.History, ctx *gin.Context) []byte {
 	}
 	return []byte(html)
 }
+
+// Build the table of runs waiting for a concurrency slot and runs holding one,
+// in the order pending runs will start
+func historiesBuildQueueTable(ctx *gin.Context) []byte {
+	entries, err := queue.GetAllEntries()
+	if err != nil {
+		logger.Errorf("", "Cannot render run queue table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	queue.Sort(entries)
+
+	t := table.Table{
+		ID: "queue_table",
+		Headers: []header.Header{
+			{
+				Contents: "Run",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Workflow",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Task",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Status",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Priority",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Waiting On",
+				Classes:  "text-lg",
+			},
+			{
+				Contents: "Queued",
+				Classes:  "text-lg",
+			},
+		},
+		Rows:          make([][]cell.Cell, 0),
+		Classes:       "theme-light",
+		Style:         "width:100%;",
+		HeaderClasses: "rounded-md ui-green",
+	}
+
+	token, _ := ctx.Cookie("scaffold_token")
+	u, _ := user.GetUserByLoginToken(token)
+	ws := workflow.GetCacheAll()
+	policies, err := policy.GetAllPolicies()
+	if err != nil {
+		logger.Errorf("", "Cannot render run queue table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	namespaces, err := namespace.GetNamespaceMap()
+	if err != nil {
+		logger.Errorf("", "Cannot render run queue table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+
+	for _, e := range entries {
+		w := ws[e.Workflow]
+		if !policy.GrantsInNamespace(u, namespaces[workflow.NamespaceOf(&w)], w.Groups, policies, policy.VERB_VIEW, e.Workflow, e.Task) {
+			continue
+		}
+		r := []cell.Cell{
+			{
+				Contents: `<a href="/ui/runs/` + e.RunID + `">` + e.RunID + `</a>`,
+			},
+			{
+				Contents: e.Workflow,
+			},
+			{
+				Contents: e.Task,
+			},
+			{
+				Contents: e.Status,
+			},
+			{
+				Contents: strconv.Itoa(e.Priority),
+			},
+			{
+				Contents: html.EscapeString(e.Reason),
+			},
+			{
+				Contents: e.Created,
+			},
+		}
+		t.Rows = append(t.Rows, r)
+	}
+
+	out, err := t.Render()
+	if err != nil {
+		logger.Errorf("", "Cannot render run queue table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	return []byte(out)
+}
@@ -2,9 +2,11 @@ package page
 
 import (
 	"fmt"
+	"html"
 	"net/http"
 	"scaffold/server/constants"
 	"scaffold/server/history"
+	"sort"
 
 	"github.com/jfcarter2358/ui"
 	"github.com/jfcarter2358/ui/breadcrumb"
@@ -88,10 +90,18 @@ func historyBuildPage(ctx *gin.Context) []byte {
 			ID:      "sidebar",
 			Classes: "theme-light",
 			Components: []ui.Component{
+				link.Link{
+					Title: "Audit",
+					HRef:  "/ui/audit",
+				},
 				link.Link{
 					Title: "Dashboard",
 					HRef:  "/ui/dashboard",
 				},
+				link.Link{
+					Title: "Files",
+					HRef:  "/ui/files",
+				},
 				link.Link{
 					Title: "Runs",
 					HRef:  "/ui/runs",
@@ -194,7 +204,7 @@ func historyBuildTimeline(h history.History, runID string, ctx *gin.Context) []b
 					return "fa-regular fa-circle ui-text-charcoal"
 				case constants.STATE_STATUS_WAITING:
 					return "fa-solid fa-clock ui-text-yellow"
-				case constants.STATE_STATUS_SUCCESS:
+				case constants.STATE_STATUS_SUCCESS, constants.STATE_STATUS_CACHED:
 					return "fa-solid fa-circle-check ui-text-green"
 				}
 				return "fa-solid fa-circle-question ui-text-charcoal"
@@ -211,7 +221,7 @@ func historyBuildTimeline(h history.History, runID string, ctx *gin.Context) []b
 					return "ui-charcoal"
 				case constants.STATE_STATUS_WAITING:
 					return "ui-yellow"
-				case constants.STATE_STATUS_SUCCESS:
+				case constants.STATE_STATUS_SUCCESS, constants.STATE_STATUS_CACHED:
 					return "ui-green"
 				}
 				return "ui-charcoal"
@@ -228,5 +238,28 @@ func historyBuildTimeline(h history.History, runID string, ctx *gin.Context) []b
 		ctx.AbortWithStatus(http.StatusInternalServerError)
 		return []byte{}
 	}
-	return []byte(html)
+	return []byte(historyBuildSummary(h) + html)
+}
+
+// Show the workflow revision the run executed and the input overrides it was
+// triggered with
+func historyBuildSummary(h history.History) string {
+	out := `<div style="margin-bottom:16px;">`
+	if h.Revision > 0 {
+		out += fmt.Sprintf("<b>Revision</b> %d<br>", h.Revision)
+	}
+	if len(h.Params) > 0 {
+		keys := make([]string, 0, len(h.Params))
+		for key := range h.Params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		out += "<b>Parameters</b><ul>"
+		for _, key := range keys {
+			out += fmt.Sprintf("<li><code>%s</code>: <code>%s</code></li>", html.EscapeString(key), html.EscapeString(h.Params[key]))
+		}
+		out += "</ul>"
+	}
+	return out + "</div>"
 }
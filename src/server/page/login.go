@@ -1,8 +1,13 @@
 package page
 
 import (
+	"encoding/json"
+	"html"
 	"net/http"
+	"scaffold/server/auth"
 	"scaffold/server/constants"
+	"scaffold/server/oidc"
+	"strings"
 
 	"github.com/jfcarter2358/ui"
 	"github.com/jfcarter2358/ui/elements/br"
@@ -13,11 +18,19 @@ import (
 )
 
 func LoginPageEndpoint(ctx *gin.Context) {
-	markdown := loginBuildPage("", ctx)
+	// Single sign-on failures are sent back here with the reason
+	markdown := loginBuildPage(html.EscapeString(ctx.Query("error")), ctx)
 	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
 }
 
 func loginBuildPage(errorMessage string, ctx *gin.Context) []byte {
+	sso := ""
+	if oidc.Enabled() {
+		sso = `
+		<a href="/auth/oidc/login" style="padding-left:8px;">
+			<div class="w3-button dark theme-light ui-text-green w3-round ui-border-grey w3-border"><b>Log In With SSO</b></div>
+		</a>`
+	}
 	p := page.Page{
 		ID: "page",
 		Components: []ui.Component{
@@ -58,7 +71,7 @@ func loginBuildPage(errorMessage string, ctx *gin.Context) []byte {
 		<button type="submit" class="w3-button ui-green w3-round diagonal-shadow-grey"><b>Login</b></button>
 		<a href="/ui/forgot_password" style="padding-left:8px;">
 			<div class="w3-button dark theme-light ui-text-green w3-round ui-border-grey w3-border"><b>Forgot Password</b></div>
-		</a>
+		</a>` + sso + `
 	</div>
 </form>
 <br>
@@ -77,3 +90,82 @@ func loginBuildPage(errorMessage string, ctx *gin.Context) []byte {
 	}
 	return []byte(html)
 }
+
+func LoginTOTPPageEndpoint(ctx *gin.Context) {
+	l := auth.GetTOTPLogin(ctx)
+	if l == nil {
+		ctx.Redirect(http.StatusFound, "/ui/login")
+		return
+	}
+	markdown := loginBuildTOTPPage(l, html.EscapeString(ctx.Query("error")), ctx)
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", markdown)
+}
+
+// Build the second step of logging in, where users give a code from their
+// authenticator app. Users who have to set one up first are shown the QR code
+// and their recovery codes here too
+func loginBuildTOTPPage(l *auth.TOTPLogin, errorMessage string, ctx *gin.Context) []byte {
+	prompt := "Enter the code from your authenticator app, or one of your recovery codes"
+	enroll := ""
+	if l.Enrollment != nil {
+		prompt = "Enter the code your authenticator app shows to finish setting it up"
+		uri, _ := json.Marshal(l.Enrollment.URI)
+		enroll = `
+	<p class="ui-text-green">Two-factor authentication is required. Scan this QR code with your authenticator app, or enter the key <b>` + html.EscapeString(l.Enrollment.Secret) + `</b></p>
+	<div id="totp-qr" style="margin-bottom:16px;"></div>
+	<p class="ui-text-green">Keep these recovery codes somewhere safe. Each can be used once in place of a code if you lose your authenticator app</p>
+	<pre>` + html.EscapeString(strings.Join(l.Enrollment.RecoveryCodes, "\n")) + `</pre>
+	<script src="https://cdn.jsdelivr.net/npm/qrcodejs@1.0.0/qrcode.min.js"></script>
+	<script>
+		new QRCode(document.getElementById("totp-qr"), {text: ` + string(uri) + `, width: 192, height: 192})
+	</script>`
+	}
+	p := page.Page{
+		ID: "page",
+		Components: []ui.Component{
+			br.BR{},
+			br.BR{},
+			br.BR{},
+			br.BR{},
+			ui.Raw{
+				HTMLString: `
+<div class="modal-content dark theme-light animate w3-border w3-border-black w3-card w3-round" style="width:40%;margin-left:30%;margin-right:30%;">
+<div class="w3-container ui-green w3-round">
+	<div class="w3-center">
+		<h1 class="header-text"><b>Scaffold</b></h1>
+	</div>
+</div>
+<br>
+<form class="w3-container" action="/auth/login/totp" id="totp_form" method="POST">` + enroll + `
+	<div class="form-group">
+		<label for="code" class="label-text ui-text-green">` + prompt + `</label>
+		<input type="text" class="form-control w3-round w3-input dark theme-light" id="code" name="code" placeholder="Code" autocomplete="one-time-code" autofocus>
+	</div>
+	<br>
+	<p class="ui-text-red">` +
+					errorMessage +
+					`</p>
+	<br>
+	<div>
+		<button type="submit" class="w3-button ui-green w3-round diagonal-shadow-grey"><b>Verify</b></button>
+		<a href="/ui/login" style="padding-left:8px;">
+			<div class="w3-button dark theme-light ui-text-green w3-round ui-border-grey w3-border"><b>Cancel</b></div>
+		</a>
+	</div>
+</form>
+<br>
+<div class="w3-container ui-green w3-round">
+	<p style="float: right;" class="footer-text w3-text-white"><b>v` + constants.VERSION + `</b></p>
+</div>
+</div>`,
+			},
+		},
+	}
+	html, err := p.Render()
+	if err != nil {
+		logger.Errorf("", "Cannot render two-factor login page : %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	return []byte(html)
+}
@@ -91,11 +91,17 @@ function generateAPIToken() {
     username = parts[parts.length - 1]
 
     tokenName = $("#user-generate-api-token-name").val()
+    options = {
+        scope: $("#user-generate-api-token-scope").val(),
+        workflows: $("#user-generate-api-token-workflows").val().split(',').map(w => w.trim()).filter(w => w != ''),
+        expires_in_days: parseInt($("#user-generate-api-token-expires").val()) || 0,
+    }
 
     $.ajax({
         url: `/auth/token/${username}/${tokenName}`,
         type: "POST",
         contentType: 'application/json',
+        data: JSON.stringify(options),
         success: function(response) {
             $("#spinner").css("display", "none")
             $("#page-darken").css("opacity", "0")
@@ -141,3 +147,130 @@ function revokeAPIToken(name) {
         }
     });
 }
+
+function revokeSession(id) {
+    parts = window.location.href.split('/')
+    username = parts[parts.length - 1]
+
+    $.ajax({
+        url: `/auth/session/${username}/${id}`,
+        type: "DELETE",
+        contentType: 'application/json',
+        success: function(response) {
+            $("#spinner").css("display", "none")
+            $("#page-darken").css("opacity", "0")
+            window.location.reload();
+        },
+        error: function(response) {
+            console.log(response)
+            if (response.status == 401) {
+                window.location.assign("/ui/login");
+            }
+            $("#error-container").text(response.responseJSON['error'])
+            openModal('error-modal')
+        }
+    });
+}
+
+function beginTOTP() {
+    parts = window.location.href.split('/')
+    username = parts[parts.length - 1]
+
+    $.ajax({
+        url: `/auth/totp/${username}`,
+        type: "POST",
+        contentType: 'application/json',
+        success: function(response) {
+            $("#totp-secret").text(response.secret)
+            $("#totp-recovery-codes").text(response.recovery_codes.join("\n"))
+            $("#totp-qr").empty()
+            new QRCode(document.getElementById("totp-qr"), {text: response.uri, width: 192, height: 192})
+            totp_modal.showModal()
+        },
+        error: function(response) {
+            console.log(response)
+            if (response.status == 401) {
+                window.location.assign("/ui/login");
+            }
+            $("#error-container").text(response.responseJSON['error'])
+            openModal('error-modal')
+        }
+    });
+}
+
+function enableTOTP() {
+    parts = window.location.href.split('/')
+    username = parts[parts.length - 1]
+
+    $.ajax({
+        url: `/auth/totp/${username}`,
+        type: "PUT",
+        contentType: 'application/json',
+        data: JSON.stringify({code: $("#totp-code").val()}),
+        success: function(response) {
+            window.location.reload();
+        },
+        error: function(response) {
+            console.log(response)
+            if (response.status == 401) {
+                window.location.assign("/ui/login");
+            }
+            $("#error-container").text(response.responseJSON['error'])
+            openModal('error-modal')
+        }
+    });
+}
+
+function disableTOTP() {
+    parts = window.location.href.split('/')
+    username = parts[parts.length - 1]
+
+    code = prompt("Enter a code from your authenticator app or a recovery code")
+    if (code == null) {
+        return
+    }
+
+    $.ajax({
+        url: `/auth/totp/${username}/disable`,
+        type: "POST",
+        contentType: 'application/json',
+        data: JSON.stringify({code: code}),
+        success: function(response) {
+            window.location.reload();
+        },
+        error: function(response) {
+            console.log(response)
+            if (response.status == 401) {
+                window.location.assign("/ui/login");
+            }
+            $("#error-container").text(response.responseJSON['error'])
+            openModal('error-modal')
+        }
+    });
+}
+
+function resetTOTP() {
+    parts = window.location.href.split('/')
+    username = parts[parts.length - 1]
+
+    if (!confirm(`Remove the second factor of ${username}?`)) {
+        return
+    }
+
+    $.ajax({
+        url: `/auth/totp/${username}`,
+        type: "DELETE",
+        contentType: 'application/json',
+        success: function(response) {
+            window.location.reload();
+        },
+        error: function(response) {
+            console.log(response)
+            if (response.status == 401) {
+                window.location.assign("/ui/login");
+            }
+            $("#error-container").text(response.responseJSON['error'])
+            openModal('error-modal')
+        }
+    });
+}
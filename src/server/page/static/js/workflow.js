@@ -654,6 +654,31 @@ function getInputs(trigger, datastore) {
     });
 }
 
+function inputControl(i) {
+    let required = i.required ? "required" : ""
+    let cls = "w3-input theme-light"
+    switch (i.type) {
+        case "int":
+            return `<input class="${cls}" type="number" step="1" id="${i.name}" ${required}>`
+        case "bool":
+            return `<select class="${cls}" id="${i.name}" ${required}>
+                <option value="true">true</option>
+                <option value="false">false</option>
+            </select>`
+        case "enum":
+            let options = (i.options || []).map(o => `<option value="${o}">${o}</option>`).join("")
+            return `<select class="${cls}" id="${i.name}" ${required}>${required ? "" : '<option value=""></option>'}${options}</select>`
+        case "regex":
+            return `<input class="${cls}" type="text" pattern="${i.pattern}" title="Must match ${i.pattern}" id="${i.name}" ${required}>`
+        case "json":
+            return `<textarea class="${cls}" rows="4" style="font-family:monospace;" id="${i.name}" ${required}></textarea>`
+        case "secret":
+            return `<input class="${cls}" type="password" id="${i.name}" ${required}>`
+        default:
+            return `<input class="${cls}" type="text" id="${i.name}" ${required}>`
+    }
+}
+
 function loadInputData(inputs) {
     console.log("Loading input data!")
     $("#current-input-div").empty()
@@ -663,14 +688,10 @@ function loadInputData(inputs) {
         console.log(`Got input with name ${i.name}`)
         let value = datastore.env[i.name]
         let html = `<div class="w3-bar-item theme-base w3-border-bottom theme-border-light">
-            <b>${i.description}</b>
+            <b>${i.description}</b>${i.required ? " *" : ""}
         </div>
         <div class="w3-bar-item theme-light w3-border-bottom theme-border-light">
-            <input
-                class="w3-input theme-light"
-                type="${i.type}"
-                id="${i.name}"
-            >
+            ${inputControl(i)}
         </div>`
         $("#current-input-div").append(html)
         $(`#${i.name}`).val(value)
@@ -691,6 +712,14 @@ function saveInputs() {
     let parts = window.location.href.split('/')
     let workflowName = parts[parts.length - 1]
 
+    for (let i = 0; i < inputs.length; i++) {
+        let el = document.getElementById(inputs[i].name)
+        if (!el.checkValidity()) {
+            el.reportValidity()
+            return
+        }
+    }
+
     $("#spinner").css("display", "block")
     $("#page-darken").css("opacity", "1")
     
@@ -767,7 +796,8 @@ var state_colors = {
     "error": "scaffold-red",
     "running": "scaffold-blue",
     "waiting": "scaffold-yellow",
-    "killed": "scaffold-orange"
+    "killed": "scaffold-orange",
+    "cached": "scaffold-green"
 }
 
 var state_icons = {
@@ -776,7 +806,8 @@ var state_icons = {
     "error": '<i class="w3-medium fa-solid fa-circle-exclamation"></i>',
     "running": '<i class="w3-medium fa-sharp fa-solid fa-spinner fa-spin"></i>',
     "waiting": '<i class="w3-medium fa-solid fa-clock"></i>',
-    "killed": '<i class="w3-medium fa-solid fa-skull"></i>'
+    "killed": '<i class="w3-medium fa-solid fa-skull"></i>',
+    "cached": '<i class="w3-medium fa-solid fa-box-archive"></i>'
 }
 
 var state_colors_hex = {
@@ -785,7 +816,8 @@ var state_colors_hex = {
     "error": "#BF616A",
     "running": "#5E81AC",
     "waiting": "#EBCB8B",
-    "killed": "#D08770"
+    "killed": "#D08770",
+    "cached": "#A3BE8C"
 }
 
 var state_text_colors = {
@@ -794,10 +826,11 @@ var state_text_colors = {
     "error": "scaffold-text-red",
     "running": "scaffold-text-blue",
     "waiting": "scaffold-text-yellow",
-    "killed": "scaffold-text-orange"
+    "killed": "scaffold-text-orange",
+    "cached": "scaffold-text-green"
 }
 
-color_keys = ["not_started", "success", "error", "running", "waiting", "killed"]
+color_keys = ["not_started", "success", "error", "running", "waiting", "killed", "cached"]
 
 var hidden = []
 var disabled = []
@@ -996,6 +1029,10 @@ function getTasks() {
             for (let task of result) {
                 if (task.depends_on.success != null && task.depends_on.success != undefined && task.depends_on.success.length > 0) {
                     for (let name of task.depends_on.success) {
+                        // Dependencies on other workflows are not part of this graph
+                        if (tasks[name] === undefined) {
+                            continue
+                        }
                         console.log(name)
                         tasks[task.name].parents.push(name)
                         if (tasks[name].out['Success'] !== undefined) {
@@ -1007,6 +1044,10 @@ function getTasks() {
                 }
                 if (task.depends_on.error != null && task.depends_on.error != undefined && task.depends_on.error.length > 0) {
                     for (let name of task.depends_on.error) {
+                        // Dependencies on other workflows are not part of this graph
+                        if (tasks[name] === undefined) {
+                            continue
+                        }
                         tasks[task.name].parents.push(name)
                         if (tasks[name].out['Error'] !== undefined) {
                             tasks[name].out['Error'].push(task.name)
@@ -1017,6 +1058,10 @@ function getTasks() {
                 }
                 if (task.depends_on.always != null && task.depends_on.always != undefined && task.depends_on.always.length > 0) {
                     for (let name of task.depends_on.always) {
+                        // Dependencies on other workflows are not part of this graph
+                        if (tasks[name] === undefined) {
+                            continue
+                        }
                         tasks[task.name].parents.push(name)
                         if (tasks[name].out['Always'] !== undefined) {
                             tasks[name].out['Always'].push(task.name)
@@ -2,8 +2,11 @@ package page
 
 import (
 	"fmt"
+	"html"
 	"net/http"
+	"scaffold/server/config"
 	"scaffold/server/user"
+	"scaffold/server/utils"
 	"strings"
 
 	"github.com/jfcarter2358/ui"
@@ -49,10 +52,18 @@ func userBuildPage(ctx *gin.Context) []byte {
 			ID:      "sidebar",
 			Classes: "theme-light",
 			Components: []ui.Component{
+				link.Link{
+					Title: "Audit",
+					HRef:  "/ui/audit",
+				},
 				link.Link{
 					Title: "Dashboard",
 					HRef:  "/ui/dashboard",
 				},
+				link.Link{
+					Title: "Files",
+					HRef:  "/ui/files",
+				},
 				link.Link{
 					Title: "Runs",
 					HRef:  "/ui/runs",
@@ -179,10 +190,22 @@ func userBuildPage(ctx *gin.Context) []byte {
 								Classes:  "text-lg",
 								Contents: "Name",
 							},
+							{
+								Classes:  "text-lg",
+								Contents: "Scope",
+							},
 							{
 								Classes:  "text-lg",
 								Contents: "Created",
 							},
+							{
+								Classes:  "text-lg",
+								Contents: "Expires",
+							},
+							{
+								Classes:  "text-lg",
+								Contents: "Last Used",
+							},
 							{
 								Contents: "",
 								Classes:  "text-lg",
@@ -195,9 +218,18 @@ func userBuildPage(ctx *gin.Context) []byte {
 									{
 										Contents: token.Name,
 									},
+									{
+										Contents: apiTokenScope(token),
+									},
 									{
 										Contents: token.Created,
 									},
+									{
+										Contents: token.Expires,
+									},
+									{
+										Contents: token.LastUsed,
+									},
 									{
 										Contents: fmt.Sprintf(`<div class="icon"><i class="fa-solid fa-trash-can w3-large pointer-cursor" onclick="revokeAPIToken('%s')"></i></div>`, token.Name),
 									},
@@ -208,6 +240,49 @@ func userBuildPage(ctx *gin.Context) []byte {
 						}(*u),
 					},
 					br.BR{},
+					h1.H1{
+						Contents: `
+						<h1 id="session-header" class="text-xl" style="float:left;padding-top:8px;padding-left:32px;">Sessions</h1>
+						`,
+						Classes: "ui-green rounded-md",
+						Style:   "width:100%;",
+					},
+					br.BR{},
+					br.BR{},
+					table.Table{
+						ID: "session-table",
+						Headers: []header.Header{
+							{
+								Classes:  "text-lg",
+								Contents: "Created",
+							},
+							{
+								Classes:  "text-lg",
+								Contents: "Last Seen",
+							},
+							{
+								Classes:  "text-lg",
+								Contents: "Expires",
+							},
+							{
+								Classes:  "text-lg",
+								Contents: "IP",
+							},
+							{
+								Classes:  "text-lg",
+								Contents: "User Agent",
+							},
+							{
+								Contents: "",
+								Classes:  "text-lg",
+							},
+						},
+						Rows: userSessionRows(ctx, u.Username),
+					},
+					br.BR{},
+					div.Div{
+						Components: userTOTPSection(ctx, u),
+					},
 				},
 				Style: "margin:64px;",
 			},
@@ -216,9 +291,44 @@ func userBuildPage(ctx *gin.Context) []byte {
 				HTMLString: `
 				<script src="https://ajax.googleapis.com/ajax/libs/jquery/3.5.1/jquery.min.js"></script>
 				<script src="/static/js/user.js"></script>
+				<script src="https://cdn.jsdelivr.net/npm/qrcodejs@1.0.0/qrcode.min.js"></script>
 				<script src="https://malsup.github.io/jquery.form.js"></script> 
 				`,
 			},
+			modal.Modal{
+				ID: "totp_modal",
+				Components: []ui.Component{
+					h1.H1{
+						Contents: `
+						Set Up Two-Factor Authentication
+						`,
+						Classes: "ui-green rounded-md text-3xl",
+						Style:   "width:100%;",
+					},
+					br.BR{},
+					ui.Raw{
+						HTMLString: `<p>Scan this QR code with your authenticator app, or enter the key <b id="totp-secret"></b></p>
+						<div id="totp-qr" style="margin-top:8px;margin-bottom:8px;"></div>
+						<p>Keep these recovery codes somewhere safe. Each can be used once in place of a code if you lose your authenticator app</p>
+						<pre id="totp-recovery-codes"></pre>`,
+					},
+					ui.Raw{
+						HTMLString: `<label>Code</label>`,
+					},
+					ui.Raw{
+						HTMLString: `<input class="w3-input w3-round theme-light" type="text" autocomplete="one-time-code" id="totp-code">`,
+					},
+					br.BR{},
+					button.Button{
+						ID:      "do_enable_totp_button",
+						OnClick: "enableTOTP()",
+						Title:   `Turn On`,
+						Style:   "",
+						Classes: "theme-base",
+					},
+				},
+				Classes: "",
+			},
 			modal.Modal{
 				ID: "api_token_modal",
 				Components: []ui.Component{
@@ -239,6 +349,31 @@ func userBuildPage(ctx *gin.Context) []byte {
 						HTMLString: `<input class="w3-input w3-round theme-light" type="text" id="user-generate-api-token-name">`,
 					},
 					br.BR{},
+					ui.Raw{
+						HTMLString: `<label>Scope</label>`,
+					},
+					ui.Raw{
+						HTMLString: `<select class="w3-select w3-round theme-light" id="user-generate-api-token-scope">
+							<option value="" selected>Everything the user can do</option>
+							<option value="read">Read only</option>
+							<option value="trigger">Trigger and kill runs</option>
+						</select>`,
+					},
+					br.BR{},
+					ui.Raw{
+						HTMLString: `<label>Workflows (comma separated, leave empty for all)</label>`,
+					},
+					ui.Raw{
+						HTMLString: `<input class="w3-input w3-round theme-light" type="text" id="user-generate-api-token-workflows">`,
+					},
+					br.BR{},
+					ui.Raw{
+						HTMLString: `<label>Expires In Days (leave empty to never expire)</label>`,
+					},
+					ui.Raw{
+						HTMLString: `<input class="w3-input w3-round theme-light" type="number" min="1" id="user-generate-api-token-expires">`,
+					},
+					br.BR{},
 					card.Card{
 						Classes: "ui-green",
 						Components: []ui.Component{
@@ -269,3 +404,118 @@ func userBuildPage(ctx *gin.Context) []byte {
 	}
 	return []byte(html)
 }
+
+// Describe what an API token is limited to
+func apiTokenScope(t user.APIToken) string {
+	scope := t.Scope
+	if scope == "" {
+		scope = "all"
+	}
+	if len(t.Workflows) > 0 {
+		scope += " on " + html.EscapeString(strings.Join(t.Workflows, ", "))
+	}
+	return scope
+}
+
+// Build the rows of the sessions table, marking the session the page is being
+// viewed with
+func userSessionRows(ctx *gin.Context, username string) [][]cell.Cell {
+	output := make([][]cell.Cell, 0)
+	sessions, err := user.GetSessionsByUsername(username)
+	if err != nil {
+		logger.Errorf("", "Cannot get sessions of user %s: %s", username, err.Error())
+		return output
+	}
+
+	currentID := ""
+	if token, err := ctx.Cookie("scaffold_token"); err == nil {
+		if current, err := user.GetSessionByToken(token); err == nil {
+			currentID = current.ID
+		}
+	}
+
+	for _, s := range sessions {
+		lastSeen := s.LastSeen
+		if s.ID == currentID {
+			lastSeen += " (this session)"
+		}
+		r := []cell.Cell{
+			{
+				Contents: s.Created,
+			},
+			{
+				Contents: lastSeen,
+			},
+			{
+				Contents: s.Expires,
+			},
+			{
+				Contents: html.EscapeString(s.IP),
+			},
+			{
+				Contents: html.EscapeString(s.UserAgent),
+			},
+			{
+				Contents: fmt.Sprintf(`<div class="icon"><i class="fa-solid fa-trash-can w3-large pointer-cursor" onclick="revokeSession('%s')"></i></div>`, s.ID),
+			},
+		}
+		output = append(output, r)
+	}
+	return output
+}
+
+// Build the two-factor authentication section of a user's page. Users set up
+// and turn off their own second factor, and admins can reset anyone's
+func userTOTPSection(ctx *gin.Context, u *user.User) []ui.Component {
+	if !u.TOTPAllowed() {
+		return []ui.Component{}
+	}
+
+	token, _ := ctx.Cookie("scaffold_token")
+	viewer, _ := user.GetUserByLoginToken(token)
+	if viewer == nil {
+		return []ui.Component{}
+	}
+	isSelf := viewer.Username == u.Username
+	isAdmin := utils.Contains(viewer.Groups, "admin") || utils.Contains(viewer.Roles, "admin")
+	if !isSelf && !isAdmin {
+		return []ui.Component{}
+	}
+
+	status := "Two-factor authentication is off"
+	if u.HasTOTP() {
+		status = fmt.Sprintf("Two-factor authentication is on, with %d recovery codes left", len(u.RecoveryCodes))
+	} else if config.Config.TOTP.Required {
+		status = "Two-factor authentication is required and will be set up at the next login"
+	}
+
+	buttons := ""
+	totpButton := func(onClick, title string) string {
+		return fmt.Sprintf(`<button class="w3-button theme-base w3-round" style="margin-left:32px;" onclick="%s">%s</button>`, onClick, title)
+	}
+	if isSelf && !u.HasTOTP() {
+		buttons += totpButton("beginTOTP()", "Set Up")
+	}
+	if isSelf && u.HasTOTP() && !config.Config.TOTP.Required {
+		buttons += totpButton("disableTOTP()", "Turn Off")
+	}
+	if isAdmin && u.HasTOTP() {
+		buttons += totpButton("resetTOTP()", "Reset")
+	}
+
+	return []ui.Component{
+		h1.H1{
+			Contents: `
+			<h1 id="totp-header" class="text-xl" style="float:left;padding-top:8px;padding-left:32px;">Two-Factor Authentication</h1>
+			`,
+			Classes: "ui-green rounded-md",
+			Style:   "width:100%;",
+		},
+		br.BR{},
+		br.BR{},
+		ui.Raw{
+			HTMLString: `<p style="padding-left:32px;">` + status + `</p>` + buttons,
+		},
+		br.BR{},
+	}
+}
@@ -89,10 +89,18 @@ func usersBuildPage(ctx *gin.Context) []byte {
 			ID:      "sidebar",
 			Classes: "theme-light",
 			Components: []ui.Component{
+				link.Link{
+					Title: "Audit",
+					HRef:  "/ui/audit",
+				},
 				link.Link{
 					Title: "Dashboard",
 					HRef:  "/ui/dashboard",
 				},
+				link.Link{
+					Title: "Files",
+					HRef:  "/ui/files",
+				},
 				link.Link{
 					Title: "Runs",
 					HRef:  "/ui/runs",
@@ -54,10 +54,18 @@ func workflowBuildPage(workflowName string, ctx *gin.Context) []byte {
 					Contents: "Scaffold",
 					Classes:  "ui-green",
 				},
+				link.Link{
+					Title: "Audit",
+					HRef:  "/ui/audit",
+				},
 				link.Link{
 					Title: "Dashboard",
 					HRef:  "/ui/dashboard",
 				},
+				link.Link{
+					Title: "Files",
+					HRef:  "/ui/files",
+				},
 				link.Link{
 					Title: "Runs",
 					HRef:  "/ui/runs",
@@ -574,7 +582,7 @@ func getStateColor(s state.State) string {
 		return fmt.Sprintf("ui-%s", constants.UI_COLORS[constants.NODE_NOT_DEPLOYED])
 	case constants.STATE_STATUS_RUNNING:
 		return fmt.Sprintf("ui-%s", constants.UI_COLORS[constants.NODE_RUNNING])
-	case constants.STATE_STATUS_SUCCESS:
+	case constants.STATE_STATUS_SUCCESS, constants.STATE_STATUS_CACHED:
 		return fmt.Sprintf("ui-%s", constants.UI_COLORS[constants.NODE_SUCCESS])
 	case constants.STATE_STATUS_WAITING:
 		return fmt.Sprintf("ui-%s", constants.UI_COLORS[constants.NODE_WAITING])
@@ -592,7 +600,7 @@ func getStateTextColor(s state.State) string {
 		return fmt.Sprintf("ui-text-%s", constants.UI_COLORS[constants.NODE_NOT_DEPLOYED])
 	case constants.STATE_STATUS_RUNNING:
 		return fmt.Sprintf("ui-text-%s", constants.UI_COLORS[constants.NODE_RUNNING])
-	case constants.STATE_STATUS_SUCCESS:
+	case constants.STATE_STATUS_SUCCESS, constants.STATE_STATUS_CACHED:
 		return fmt.Sprintf("ui-text-%s", constants.UI_COLORS[constants.NODE_SUCCESS])
 	case constants.STATE_STATUS_WAITING:
 		return fmt.Sprintf("ui-text-%s", constants.UI_COLORS[constants.NODE_WAITING])
@@ -1,7 +1,12 @@
 package page
 
 import (
+	"fmt"
+	"html"
 	"net/http"
+	"scaffold/server/gitsync"
+	"scaffold/server/namespace"
+	"scaffold/server/policy"
 	"scaffold/server/user"
 	"scaffold/server/workflow"
 	"sort"
@@ -38,7 +43,7 @@ func WorkflowsSearchEndpoint(ctx *gin.Context) {
 	filtered := []workflow.Workflow{}
 
 	for name, w := range workflows {
-		if strings.Contains(strings.ToLower(name), strings.ToLower(query)) {
+		if strings.Contains(strings.ToLower(name), strings.ToLower(query)) || strings.Contains(workflow.NamespaceOf(&w), strings.ToLower(query)) {
 			filtered = append(filtered, w)
 		}
 	}
@@ -74,10 +79,18 @@ func workflowsBuildPage(ctx *gin.Context) []byte {
 			ID:      "sidebar",
 			Classes: "theme-light",
 			Components: []ui.Component{
+				link.Link{
+					Title: "Audit",
+					HRef:  "/ui/audit",
+				},
 				link.Link{
 					Title: "Dashboard",
 					HRef:  "/ui/dashboard",
 				},
+				link.Link{
+					Title: "Files",
+					HRef:  "/ui/files",
+				},
 				link.Link{
 					Title: "Runs",
 					HRef:  "/ui/runs",
@@ -161,6 +174,10 @@ func workflowsBuildTable(ws []workflow.Workflow, ctx *gin.Context) []byte {
 				Contents: "Name",
 				Classes:  "text-lg",
 			},
+			{
+				Contents: "Namespace",
+				Classes:  "text-lg",
+			},
 			{
 				Contents: "Created",
 				Classes:  "text-lg",
@@ -173,6 +190,10 @@ func workflowsBuildTable(ws []workflow.Workflow, ctx *gin.Context) []byte {
 				Contents: "Version",
 				Classes:  "text-lg",
 			},
+			{
+				Contents: "Sync",
+				Classes:  "text-lg",
+			},
 			{
 				Contents: "",
 				Classes:  "text-lg",
@@ -191,38 +212,40 @@ func workflowsBuildTable(ws []workflow.Workflow, ctx *gin.Context) []byte {
 	token, _ := ctx.Cookie("scaffold_token")
 	u, _ := user.GetUserByLoginToken(token)
 
+	statuses, err := gitsync.GetAllStatuses()
+	if err != nil {
+		logger.Errorf("", "Cannot get git sync statuses: %s", err.Error())
+	}
+	synced := map[string]*gitsync.Status{}
+	for _, s := range statuses {
+		synced[s.Workflow] = s
+	}
+
+	policies, err := policy.GetAllPolicies()
+	if err != nil {
+		logger.Errorf("", "Cannot render workflows table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+	namespaces, err := namespace.GetNamespaceMap()
+	if err != nil {
+		logger.Errorf("", "Cannot render workflows table: %s", err.Error())
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return []byte{}
+	}
+
 	for _, w := range ws {
-		isInGroup := false
-		isAdmin := false
-		for _, ug := range u.Groups {
-			if ug == "admin" {
-				isInGroup = true
-				isAdmin = true
-				break
-			}
-			for _, wg := range w.Groups {
-				if ug == wg {
-					isInGroup = true
-					break
-				}
-			}
-			if isInGroup {
-				break
-			}
-		}
-		for _, ur := range u.Roles {
-			if ur == "admin" {
-				isAdmin = true
-				break
-			}
-			if ur == "write" {
-				break
-			}
+		if !policy.GrantsInNamespace(u, namespaces[workflow.NamespaceOf(&w)], w.Groups, policies, policy.VERB_VIEW, w.Name, "") {
+			continue
 		}
+		canEdit := policy.GrantsInNamespace(u, namespaces[workflow.NamespaceOf(&w)], w.Groups, policies, policy.VERB_EDIT, w.Name, "")
 		r := []cell.Cell{
 			{
 				Contents: w.Name,
 			},
+			{
+				Contents: html.EscapeString(workflow.NamespaceOf(&w)),
+			},
 			{
 				Contents: w.Created,
 			},
@@ -232,6 +255,9 @@ func workflowsBuildTable(ws []workflow.Workflow, ctx *gin.Context) []byte {
 			{
 				Contents: w.Version,
 			},
+			{
+				Contents: workflowsSyncCell(synced[w.Name]),
+			},
 			{
 				Contents: `<a href="/ui/workflows/` + w.Name + `" class="table-link-link w3-right-align dark theme-text"
                     style="float:right;margin-right:16px;">
@@ -242,7 +268,7 @@ func workflowsBuildTable(ws []workflow.Workflow, ctx *gin.Context) []byte {
 				Contents: "",
 			},
 		}
-		if isAdmin {
+		if canEdit {
 			r[len(r)-1] = cell.Cell{
 				Contents: `<div class="table-link-link w3-right-align dark theme-text" style="float:right;margin-right:16px;">
                     <i class="fa-solid fa-trash" style="cursor:pointer;" onclick="deleteWorkflow('` + w.Name + `')"></i>
@@ -260,3 +286,20 @@ func workflowsBuildTable(ws []workflow.Workflow, ctx *gin.Context) []byte {
 	}
 	return []byte(html)
 }
+
+// Show the sync status and last commit of a workflow managed by git sync. The
+// file and any error are shown on hover
+func workflowsSyncCell(s *gitsync.Status) string {
+	if s == nil {
+		return ""
+	}
+	commit := s.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	title := s.File
+	if s.Error != "" {
+		title += ": " + s.Error
+	}
+	return fmt.Sprintf(`<span title="%s">%s <code>%s</code></span>`, html.EscapeString(title), html.EscapeString(s.Status), commit)
+}
@@ -0,0 +1,351 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"scaffold/server/constants"
+	"scaffold/server/mongodb"
+	"scaffold/server/namespace"
+	"scaffold/server/user"
+	"scaffold/server/utils"
+	"scaffold/server/workflow"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+const VERB_VIEW = "view"
+const VERB_TRIGGER = "trigger"
+const VERB_KILL = "kill"
+const VERB_EDIT = "edit"
+const VERB_VIEW_SECRETS = "view-secrets"
+const VERB_APPROVE = "approve"
+
+// Verbs granted to everyone in a workflow's groups by their role, before any
+// policies are looked at
+var roleVerbs = map[string][]string{
+	"read":  {VERB_VIEW, VERB_VIEW_SECRETS},
+	"write": {VERB_VIEW, VERB_VIEW_SECRETS, VERB_TRIGGER, VERB_KILL, VERB_EDIT},
+	"admin": Verbs(),
+}
+
+// Verbs an API token is limited to by its scope
+var scopeVerbs = map[string][]string{
+	constants.API_TOKEN_SCOPE_READ:    {VERB_VIEW, VERB_VIEW_SECRETS},
+	constants.API_TOKEN_SCOPE_TRIGGER: {VERB_VIEW, VERB_TRIGGER, VERB_KILL},
+}
+
+// Grants verbs on the workflows and tasks matching its patterns to users and
+// members of groups. Patterns use shell globs such as `deploy-*`, no tasks
+// means every task of the matched workflows
+type Policy struct {
+	Name        string   `json:"name" bson:"name" yaml:"name"`
+	Description string   `json:"description" bson:"description" yaml:"description"`
+	Users       []string `json:"users" bson:"users" yaml:"users"`
+	Groups      []string `json:"groups" bson:"groups" yaml:"groups"`
+	Workflows   []string `json:"workflows" bson:"workflows" yaml:"workflows"`
+	Tasks       []string `json:"tasks" bson:"tasks" yaml:"tasks"`
+	Verbs       []string `json:"verbs" bson:"verbs" yaml:"verbs"`
+	Created     string   `json:"created" bson:"created" yaml:"created"`
+	Updated     string   `json:"updated" bson:"updated" yaml:"updated"`
+}
+
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, "; ")
+}
+
+// Get every verb a policy can grant
+func Verbs() []string {
+	return []string{VERB_VIEW, VERB_TRIGGER, VERB_KILL, VERB_EDIT, VERB_VIEW_SECRETS, VERB_APPROVE}
+}
+
+// Check a policy before it is stored
+func Validate(p *Policy) error {
+	errs := []string{}
+	if p.Name == "" {
+		errs = append(errs, "policy name is required")
+	}
+	if len(p.Users) == 0 && len(p.Groups) == 0 {
+		errs = append(errs, fmt.Sprintf("policy %s does not apply to any users or groups", p.Name))
+	}
+	if len(p.Workflows) == 0 {
+		errs = append(errs, fmt.Sprintf("policy %s does not match any workflows", p.Name))
+	}
+	if len(p.Verbs) == 0 {
+		errs = append(errs, fmt.Sprintf("policy %s does not grant any verbs", p.Name))
+	}
+	for _, v := range p.Verbs {
+		if !utils.Contains(Verbs(), v) {
+			errs = append(errs, fmt.Sprintf("policy %s has unknown verb %s", p.Name, v))
+		}
+	}
+	for _, pattern := range append(append([]string{}, p.Workflows...), p.Tasks...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("policy %s has invalid pattern %s", p.Name, pattern))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func appliesTo(p *Policy, u *user.User) bool {
+	if utils.Contains(p.Users, u.Username) {
+		return true
+	}
+	for _, group := range u.Groups {
+		if utils.Contains(p.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Work out whether a user may perform a verb on a workflow, or on one of its
+// tasks when a task name is given. Members of the admin group can do
+// anything, members of the workflow's groups get the verbs of their roles,
+// and policies grant verbs on top of that. Any policy matching a workflow
+// also lets its users view it, so they can find what they were granted
+func Grants(u *user.User, groups []string, policies []*Policy, verb, workflowName, taskName string) bool {
+	if u == nil {
+		return false
+	}
+	if utils.Contains(u.Groups, "admin") {
+		return true
+	}
+
+	isMember := len(groups) == 0
+	for _, group := range groups {
+		if utils.Contains(u.Groups, group) {
+			isMember = true
+			break
+		}
+	}
+	if isMember {
+		for _, role := range u.Roles {
+			if utils.Contains(roleVerbs[role], verb) {
+				return true
+			}
+		}
+	}
+
+	for _, p := range policies {
+		if !appliesTo(p, u) || !matchAny(p.Workflows, workflowName) {
+			continue
+		}
+		if verb == VERB_VIEW {
+			return true
+		}
+		if utils.Contains(p.Verbs, verb) && (len(p.Tasks) == 0 || matchAny(p.Tasks, taskName)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether an API token's scope and workflows let it be used for a verb
+// on a workflow. Requests made without a token are not limited
+func TokenGrants(t *user.APIToken, verb, workflowName string) bool {
+	if t == nil {
+		return true
+	}
+	if len(t.Workflows) > 0 && !matchAny(t.Workflows, workflowName) {
+		return false
+	}
+	if t.Scope == "" {
+		return true
+	}
+	return utils.Contains(scopeVerbs[t.Scope], verb)
+}
+
+// Look up a workflow's groups and the stored policies and check whether a user
+// may perform a verb on it, limited by the API token the request was made
+// with if there is one
+func Allowed(u *user.User, t *user.APIToken, verb, workflowName, taskName string) bool {
+	if u == nil || !TokenGrants(t, verb, workflowName) {
+		return false
+	}
+	if utils.Contains(u.Groups, "admin") {
+		return true
+	}
+
+	groups := []string{}
+	w, err := workflow.GetWorkflowByName(workflowName)
+	if err != nil {
+		logger.Errorf("", "Cannot get workflow %s to check permissions: %s", workflowName, err.Error())
+		return false
+	}
+	if w != nil {
+		groups = w.Groups
+	}
+
+	n, err := namespace.GetNamespaceByName(workflow.NamespaceOf(w))
+	if err != nil {
+		logger.Errorf("", "Cannot get namespace of workflow %s to check permissions: %s", workflowName, err.Error())
+		return false
+	}
+
+	policies, err := GetAllPolicies()
+	if err != nil {
+		logger.Errorf("", "Cannot get policies: %s", err.Error())
+		return false
+	}
+	return GrantsInNamespace(u, n, groups, policies, verb, workflowName, taskName)
+}
+
+// Work out whether a user may perform a verb on a workflow in a namespace,
+// which is nil for the default namespace when it has not been configured.
+// Admins of the namespace can do anything, and workflows without groups of
+// their own take their namespace's
+func GrantsInNamespace(u *user.User, n *namespace.Namespace, groups []string, policies []*Policy, verb, workflowName, taskName string) bool {
+	if namespace.IsAdmin(u, n) {
+		return true
+	}
+	if n != nil && len(groups) == 0 {
+		groups = n.Groups
+	}
+	return Grants(u, groups, policies, verb, workflowName, taskName)
+}
+
+func CreatePolicy(p *Policy) error {
+	if err := Validate(p); err != nil {
+		return err
+	}
+
+	pp, err := GetPolicyByName(p.Name)
+	if err != nil {
+		return fmt.Errorf("error getting policies: %s", err.Error())
+	}
+	if pp != nil {
+		return fmt.Errorf("policy already exists with name %s", p.Name)
+	}
+
+	currentTime := time.Now().UTC()
+	p.Created = currentTime.Format("2006-01-02T15:04:05Z")
+	p.Updated = currentTime.Format("2006-01-02T15:04:05Z")
+
+	_, err = mongodb.Collections[constants.MONGODB_POLICY_COLLECTION_NAME].InsertOne(mongodb.Ctx, p)
+	return err
+}
+
+func DeletePolicyByName(name string) error {
+	filter := bson.M{"name": name}
+
+	collection := mongodb.Collections[constants.MONGODB_POLICY_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no policy found with name %s", name)
+	}
+
+	return nil
+}
+
+func GetAllPolicies() ([]*Policy, error) {
+	filter := bson.D{{}}
+
+	policies, err := FilterPolicies(filter)
+
+	return policies, err
+}
+
+func GetPolicyByName(name string) (*Policy, error) {
+	filter := bson.M{"name": name}
+
+	policies, err := FilterPolicies(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	if len(policies) > 1 {
+		return nil, fmt.Errorf("multiple policies found with name %s", name)
+	}
+
+	return policies[0], nil
+}
+
+func UpdatePolicyByName(name string, p *Policy) error {
+	p.Name = name
+	if err := Validate(p); err != nil {
+		return err
+	}
+
+	existing, err := GetPolicyByName(name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return CreatePolicy(p)
+	}
+
+	p.Created = existing.Created
+	p.Updated = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	filter := bson.M{"name": name}
+	opts := options.Replace().SetUpsert(true)
+
+	_, err = mongodb.Collections[constants.MONGODB_POLICY_COLLECTION_NAME].ReplaceOne(mongodb.Ctx, filter, p, opts)
+	return err
+}
+
+func FilterPolicies(filter interface{}) ([]*Policy, error) {
+	// A slice of policies for storing the decoded documents
+	var policies []*Policy
+
+	collection := mongodb.Collections[constants.MONGODB_POLICY_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return policies, err
+	}
+
+	for cur.Next(ctx) {
+		var p Policy
+		err := cur.Decode(&p)
+		if err != nil {
+			return policies, err
+		}
+
+		policies = append(policies, &p)
+	}
+
+	if err := cur.Err(); err != nil {
+		return policies, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return policies, nil
+}
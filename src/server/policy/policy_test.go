@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"scaffold/server/namespace"
+	"scaffold/server/user"
+	"testing"
+)
+
+func TestGrants(t *testing.T) {
+	policies := []*Policy{
+		{Name: "deployers", Groups: []string{"release"}, Workflows: []string{"deploy-*"}, Tasks: []string{"prod-*"}, Verbs: []string{VERB_TRIGGER, VERB_APPROVE}},
+		{Name: "auditor", Users: []string{"jane"}, Workflows: []string{"*"}, Verbs: []string{VERB_VIEW}},
+	}
+	reader := &user.User{Username: "bob", Groups: []string{"ops"}, Roles: []string{"read"}}
+	writer := &user.User{Username: "sue", Groups: []string{"ops"}, Roles: []string{"write"}}
+	releaser := &user.User{Username: "tom", Groups: []string{"release"}}
+	auditor := &user.User{Username: "jane"}
+	admin := &user.User{Username: "admin", Groups: []string{"admin"}}
+
+	cases := []struct {
+		u        *user.User
+		groups   []string
+		verb     string
+		workflow string
+		task     string
+		want     bool
+	}{
+		{reader, []string{"ops"}, VERB_VIEW, "build", "", true},
+		{reader, []string{"ops"}, VERB_TRIGGER, "build", "compile", false},
+		{reader, []string{"dev"}, VERB_VIEW, "build", "", false},
+		{writer, []string{"ops"}, VERB_TRIGGER, "build", "compile", true},
+		{writer, []string{"ops"}, VERB_APPROVE, "build", "compile", false},
+		{writer, nil, VERB_EDIT, "build", "", true},
+		{releaser, []string{"ops"}, VERB_TRIGGER, "deploy-api", "prod-eu", true},
+		{releaser, []string{"ops"}, VERB_TRIGGER, "deploy-api", "staging", false},
+		{releaser, []string{"ops"}, VERB_TRIGGER, "build", "prod-eu", false},
+		{releaser, []string{"ops"}, VERB_VIEW, "deploy-api", "", true},
+		{releaser, []string{"ops"}, VERB_KILL, "deploy-api", "prod-eu", false},
+		{auditor, []string{"ops"}, VERB_VIEW, "build", "compile", true},
+		{auditor, []string{"ops"}, VERB_VIEW_SECRETS, "build", "", false},
+		{admin, []string{"ops"}, VERB_EDIT, "build", "", true},
+		{nil, nil, VERB_VIEW, "build", "", false},
+	}
+	for _, c := range cases {
+		username := "<nil>"
+		if c.u != nil {
+			username = c.u.Username
+		}
+		if got := Grants(c.u, c.groups, policies, c.verb, c.workflow, c.task); got != c.want {
+			t.Errorf("%s %s on %s/%s: got %v, want %v", username, c.verb, c.workflow, c.task, got, c.want)
+		}
+	}
+}
+
+func TestGrantsInNamespace(t *testing.T) {
+	ns := &namespace.Namespace{Name: "payments", Groups: []string{"payments"}, Admins: []string{"ann"}}
+	owner := &user.User{Username: "ann"}
+	member := &user.User{Username: "bob", Groups: []string{"payments"}, Roles: []string{"read"}}
+	outsider := &user.User{Username: "sue", Groups: []string{"ops"}, Roles: []string{"write"}}
+
+	cases := []struct {
+		u      *user.User
+		n      *namespace.Namespace
+		groups []string
+		verb   string
+		want   bool
+	}{
+		{owner, ns, []string{"payments"}, VERB_APPROVE, true},
+		{owner, nil, []string{"payments"}, VERB_VIEW, false},
+		{member, ns, nil, VERB_VIEW, true},
+		{member, ns, nil, VERB_EDIT, false},
+		{outsider, ns, nil, VERB_VIEW, false},
+		{outsider, nil, nil, VERB_VIEW, true},
+	}
+	for _, c := range cases {
+		if got := GrantsInNamespace(c.u, c.n, c.groups, nil, c.verb, "ledger", ""); got != c.want {
+			t.Errorf("%s %s with namespace %v: got %v, want %v", c.u.Username, c.verb, c.n != nil, got, c.want)
+		}
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	p := &Policy{Name: "bad", Workflows: []string{"["}, Verbs: []string{"delete"}}
+	err := Validate(p)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := "policy bad does not apply to any users or groups; policy bad has unknown verb delete; policy bad has invalid pattern ["
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+
+	p = &Policy{Name: "ok", Groups: []string{"ops"}, Workflows: []string{"*"}, Verbs: []string{VERB_VIEW}}
+	if err := Validate(p); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
+
+func TestTokenGrants(t *testing.T) {
+	cases := []struct {
+		token    *user.APIToken
+		verb     string
+		workflow string
+		want     bool
+	}{
+		{nil, VERB_EDIT, "build", true},
+		{&user.APIToken{}, VERB_EDIT, "build", true},
+		{&user.APIToken{Scope: "read"}, VERB_VIEW, "build", true},
+		{&user.APIToken{Scope: "read"}, VERB_TRIGGER, "build", false},
+		{&user.APIToken{Scope: "trigger"}, VERB_KILL, "build", true},
+		{&user.APIToken{Scope: "trigger"}, VERB_EDIT, "build", false},
+		{&user.APIToken{Workflows: []string{"deploy-*"}}, VERB_EDIT, "deploy-api", true},
+		{&user.APIToken{Workflows: []string{"deploy-*"}}, VERB_VIEW, "build", false},
+	}
+	for _, c := range cases {
+		if got := TokenGrants(c.token, c.verb, c.workflow); got != c.want {
+			t.Errorf("%+v %s on %s: got %v, want %v", c.token, c.verb, c.workflow, got, c.want)
+		}
+	}
+}
@@ -1,15 +1,15 @@
 package proxy
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
+	"scaffold/server/policy"
 	"scaffold/server/user"
-	"scaffold/server/utils"
-	"scaffold/server/workflow"
 	"strings"
 
 	logger "github.com/jfcarter2358/go-logger"
@@ -43,6 +43,10 @@ type WebsocketProxy struct {
 	// unmodified request.
 	Backend func(*http.Request) *url.URL
 
+	// Authorize, if non-nil, is called before anything else and the request
+	// is refused when it returns an error
+	Authorize func(*http.Request) error
+
 	// Upgrader specifies the parameters for upgrading a incoming HTTP
 	// connection to a WebSocket connection. If nil, DefaultUpgrader is used.
 	Upgrader *websocket.Upgrader
@@ -67,38 +71,12 @@ func NewProxy() *WebsocketProxy {
 		run := vars["run"]
 		version := vars["version"]
 
-		c, err := workflow.GetWorkflowByName(workflowName)
-		if err != nil {
-			log.Fatalln(err)
-		}
-
-		authString := r.Header.Get("Authorization")
-		if authString == "" {
-			log.Fatalln("No auth header present")
-		}
-		token := strings.Split(authString, " ")[1]
-
-		usr, _ := user.GetUserByAPIToken(token)
-
-		if usr == nil {
-			log.Fatalln("No user present that matches auth information")
-		}
-		isValid := false
-		for _, group := range c.Groups {
-			if utils.Contains(usr.Groups, group) {
-				isValid = true
-				break
-			}
-		}
-		if !isValid {
-			log.Fatalln("User is not permitted to access this container")
-		}
-
 		logger.Tracef("", "Trying to exec with information %s, %s, %s, %s, %s", host, port, workflowName, run, version)
 
 		url, err := url.Parse(fmt.Sprintf("ws://%s:%s/ws/%s/%s/%s", host, port, workflowName, run, version))
 		if err != nil {
-			log.Fatalln(err)
+			logger.Errorf("", "Cannot parse backend url: %s", err.Error())
+			return nil
 		}
 
 		// Shallow copy
@@ -108,11 +86,38 @@ func NewProxy() *WebsocketProxy {
 		// u.RawQuery = r.URL.RawQuery
 		return &u
 	}
-	return &WebsocketProxy{Backend: backend}
+	return &WebsocketProxy{Backend: backend, Authorize: authorize}
+}
+
+// Only users allowed to edit a workflow can open a shell in its runs
+func authorize(r *http.Request) error {
+	workflowName := mux.Vars(r)["workflow"]
+
+	authString := r.Header.Get("Authorization")
+	parts := strings.Split(authString, " ")
+	if len(parts) < 2 {
+		return errors.New("no auth header present")
+	}
+	usr, t, _ := user.GetAPIToken(parts[1])
+	if usr == nil {
+		return errors.New("no user present that matches auth information")
+	}
+	if !policy.Allowed(usr, t, policy.VERB_EDIT, workflowName, "") {
+		return fmt.Errorf("user %s is not permitted to access workflow %s", usr.Username, workflowName)
+	}
+	return nil
 }
 
 // ServeHTTP implements the http.Handler that proxies WebSocket connections.
 func (w *WebsocketProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if w.Authorize != nil {
+		if err := w.Authorize(req); err != nil {
+			log.Printf("websocketproxy: %s", err.Error())
+			http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+	}
+
 	if w.Backend == nil {
 		log.Println("websocketproxy: backend function is not defined")
 		http.Error(rw, "internal server error (code: 1)", http.StatusInternalServerError)
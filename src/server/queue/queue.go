@@ -0,0 +1,454 @@
+// Package queue holds triggered runs until the concurrency limits of their
+// workflow, task, namespace, and pools allow them to start
+package queue
+
+import (
+	"fmt"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"scaffold/server/mongodb"
+	"scaffold/server/msg"
+	"scaffold/server/namespace"
+	"scaffold/server/rabbitmq"
+	"scaffold/server/task"
+	"scaffold/server/workflow"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	logger "github.com/jfcarter2358/go-logger"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// A triggered run of a task, either waiting for a slot or holding one until
+// the task finishes
+type Entry struct {
+	ID       string            `json:"id" bson:"id" yaml:"id"`
+	Workflow string            `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Task     string            `json:"task" bson:"task" yaml:"task"`
+	RunID    string            `json:"run_id" bson:"run_id" yaml:"run_id"`
+	Number   int               `json:"number" bson:"number" yaml:"number"`
+	Groups   []string          `json:"groups" bson:"groups" yaml:"groups"`
+	Context  map[string]string `json:"-" bson:"context" yaml:"-"`
+	Priority int               `json:"priority" bson:"priority" yaml:"priority"`
+	Status   string            `json:"status" bson:"status" yaml:"status"`
+	// Why a pending run has not started yet
+	Reason string `json:"reason" bson:"reason" yaml:"reason"`
+	// Pools the run took a slot in when it started
+	WorkflowPool string `json:"workflow_pool,omitempty" bson:"workflow_pool,omitempty" yaml:"workflow_pool,omitempty"`
+	TaskPool     string `json:"task_pool,omitempty" bson:"task_pool,omitempty" yaml:"task_pool,omitempty"`
+	Created      string `json:"created" bson:"created" yaml:"created"`
+	Started      string `json:"started" bson:"started" yaml:"started"`
+	// Orders entries of the same priority by when they were queued
+	Order int64 `json:"-" bson:"order" yaml:"-"`
+	// Namespace the run counted against when it started
+	Namespace string `json:"namespace,omitempty" bson:"namespace,omitempty" yaml:"namespace,omitempty"`
+}
+
+// The concurrency limits that apply to an entry, taken from its workflow,
+// task, and namespace when it is dispatched
+type limits struct {
+	WorkflowRuns  int
+	WorkflowPool  string
+	TaskRuns      int
+	TaskPool      string
+	Namespace     string
+	NamespaceRuns int
+}
+
+// Only one dispatch looks at the queue at a time so two of them cannot both
+// give out the last slot
+var dispatchLock = &sync.Mutex{}
+
+// Queue a trigger to start once its limits allow it, starting it right away
+// if they already do
+func Submit(m msg.TriggerMsg, priority int) (*Entry, error) {
+	now := time.Now().UTC()
+	e := &Entry{
+		ID:       uuid.New().String(),
+		Workflow: m.Workflow,
+		Task:     m.Task,
+		RunID:    m.RunID,
+		Number:   m.Number,
+		Groups:   m.Groups,
+		Context:  m.Context,
+		Priority: priority,
+		Status:   constants.QUEUE_STATUS_PENDING,
+		Created:  now.Format("2006-01-02T15:04:05Z"),
+		Order:    now.UnixNano(),
+	}
+	if _, err := mongodb.Collections[constants.MONGODB_RUN_QUEUE_COLLECTION_NAME].InsertOne(mongodb.Ctx, e); err != nil {
+		return nil, err
+	}
+
+	started, failed, err := dispatch()
+	if err != nil {
+		return e, err
+	}
+	// A run that cannot be sent to the manager queue is refused rather than
+	// left pending, as nothing may dispatch it again
+	if err, ok := failed[e.ID]; ok {
+		if err := DeleteEntryByID(e.ID); err != nil {
+			logger.Errorf("", "Cannot remove queued run of %s/%s: %s", e.Workflow, e.Task, err.Error())
+		}
+		return nil, err
+	}
+	for _, id := range started {
+		if id == e.ID {
+			e.Status = constants.QUEUE_STATUS_RUNNING
+			return e, nil
+		}
+	}
+	if current, err := GetEntryByID(e.ID); err == nil && current != nil {
+		e = current
+	}
+	return e, nil
+}
+
+// Start every pending run whose limits allow it, highest priority first, and
+// return the IDs of the entries started
+func Dispatch() ([]string, error) {
+	started, _, err := dispatch()
+	return started, err
+}
+
+// Start every pending run whose limits allow it, returning the IDs of the
+// entries started and the errors of those that could not be sent. Entries
+// that could not be sent are put back to pending to be tried again
+func dispatch() ([]string, map[string]error, error) {
+	dispatchLock.Lock()
+	defer dispatchLock.Unlock()
+
+	entries, err := GetAllEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+	pending := []*Entry{}
+	running := []*Entry{}
+	for _, e := range entries {
+		if e.Status == constants.QUEUE_STATUS_RUNNING {
+			running = append(running, e)
+		} else {
+			pending = append(pending, e)
+		}
+	}
+	Sort(pending)
+
+	started := []string{}
+	failed := map[string]error{}
+	for _, e := range pending {
+		l, err := limitsFor(e)
+		if err != nil {
+			logger.Errorf("", "Cannot get concurrency limits of %s/%s: %s", e.Workflow, e.Task, err.Error())
+			continue
+		}
+		ok, reason := admit(e, running, l, config.Config.ConcurrencyPools)
+		if !ok {
+			if reason != e.Reason {
+				e.Reason = reason
+				if err := setFields(e.ID, bson.M{"reason": reason}); err != nil {
+					logger.Errorf("", "Cannot update queued run of %s/%s: %s", e.Workflow, e.Task, err.Error())
+				}
+			}
+			continue
+		}
+
+		e.Status = constants.QUEUE_STATUS_RUNNING
+		e.Reason = ""
+		e.WorkflowPool = l.WorkflowPool
+		e.TaskPool = l.TaskPool
+		e.Namespace = l.Namespace
+		e.Started = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+		if err := setFields(e.ID, bson.M{"status": e.Status, "reason": e.Reason, "workflow_pool": e.WorkflowPool, "task_pool": e.TaskPool, "namespace": e.Namespace, "started": e.Started}); err != nil {
+			logger.Errorf("", "Cannot start queued run of %s/%s: %s", e.Workflow, e.Task, err.Error())
+			continue
+		}
+
+		m := msg.TriggerMsg{
+			Task:     e.Task,
+			Workflow: e.Workflow,
+			Action:   constants.ACTION_TRIGGER,
+			Number:   e.Number,
+			Groups:   e.Groups,
+			RunID:    e.RunID,
+			Context:  e.Context,
+		}
+		logger.Infof("", "Starting queued run with message %v", m)
+		if err := rabbitmq.ManagerPublish(m); err != nil {
+			logger.Errorf("", "Cannot start queued run of %s/%s: %s", e.Workflow, e.Task, err.Error())
+			failed[e.ID] = err
+			// Give the slot back so the entry does not hold it forever
+			reset := bson.M{"status": constants.QUEUE_STATUS_PENDING, "reason": "", "workflow_pool": "", "task_pool": "", "namespace": "", "started": ""}
+			if err := setFields(e.ID, reset); err != nil {
+				logger.Errorf("", "Cannot put queued run of %s/%s back to pending: %s", e.Workflow, e.Task, err.Error())
+				if err := DeleteEntryByID(e.ID); err != nil {
+					logger.Errorf("", "Cannot remove queued run of %s/%s: %s", e.Workflow, e.Task, err.Error())
+				}
+			}
+			continue
+		}
+		running = append(running, e)
+		started = append(started, e.ID)
+	}
+	return started, failed, nil
+}
+
+// Free the slot held by a finished run of a task and start whatever can go
+// in its place
+func Finish(workflowName, taskName, runID string) error {
+	filter := bson.M{"workflow": workflowName, "task": taskName, "status": constants.QUEUE_STATUS_RUNNING}
+	if runID != "" {
+		filter["run_id"] = runID
+	}
+	if _, err := mongodb.Collections[constants.MONGODB_RUN_QUEUE_COLLECTION_NAME].DeleteOne(mongodb.Ctx, filter); err != nil {
+		return err
+	}
+	_, err := Dispatch()
+	return err
+}
+
+// Drop the pending runs of a task, such as when it is killed
+func Cancel(workflowName, taskName string) error {
+	filter := bson.M{"workflow": workflowName, "task": taskName, "status": constants.QUEUE_STATUS_PENDING}
+	_, err := mongodb.Collections[constants.MONGODB_RUN_QUEUE_COLLECTION_NAME].DeleteMany(mongodb.Ctx, filter)
+	return err
+}
+
+// Take an entry off the queue. Removing a running entry frees its slot
+// without killing the task, for when its worker went away before reporting
+// back
+func Remove(id string) error {
+	if err := DeleteEntryByID(id); err != nil {
+		return err
+	}
+	_, err := Dispatch()
+	return err
+}
+
+// Put entries in the order they leave the queue, highest priority first and
+// then oldest first
+func Sort(entries []*Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Priority != entries[j].Priority {
+			return entries[i].Priority > entries[j].Priority
+		}
+		return entries[i].Order < entries[j].Order
+	})
+}
+
+func limitsFor(e *Entry) (limits, error) {
+	l := limits{}
+	w, err := workflow.GetWorkflowByName(e.Workflow)
+	if err != nil {
+		return l, err
+	}
+	if w != nil {
+		l.WorkflowRuns = w.MaxConcurrentRuns
+		l.WorkflowPool = w.Pool
+	}
+	l.Namespace = workflow.NamespaceOf(w)
+	n, err := namespace.GetNamespaceByName(l.Namespace)
+	if err != nil {
+		return l, err
+	}
+	if n != nil {
+		l.NamespaceRuns = n.MaxConcurrentRuns
+	}
+	t, err := task.GetTaskByNames(e.Workflow, e.Task)
+	if err != nil {
+		return l, err
+	}
+	if t != nil {
+		l.TaskRuns = t.MaxConcurrentRuns
+		l.TaskPool = t.Pool
+	}
+	return l, nil
+}
+
+// Count the slots taken in a pool. Each running task in the pool takes one,
+// and each run of a workflow in the pool takes one however many of its tasks
+// are running
+func poolUsage(pool string, running []*Entry) int {
+	count := 0
+	runs := map[string]bool{}
+	for _, r := range running {
+		if r.TaskPool == pool {
+			count++
+		}
+		if r.WorkflowPool == pool && !runs[r.RunID] {
+			runs[r.RunID] = true
+			count++
+		}
+	}
+	return count
+}
+
+// Count the runs going in a namespace however many of their tasks are running
+func namespaceUsage(name string, running []*Entry) int {
+	runs := map[string]bool{}
+	for _, r := range running {
+		if r.Namespace == name {
+			runs[r.RunID] = true
+		}
+	}
+	return len(runs)
+}
+
+// Get how many runs are going in a namespace
+func CountNamespaceRuns(name string) (int, error) {
+	entries, err := FilterEntries(bson.M{"status": constants.QUEUE_STATUS_RUNNING})
+	if err != nil {
+		return 0, err
+	}
+	return namespaceUsage(name, entries), nil
+}
+
+// Work out whether an entry can start alongside the running ones, and if not
+// which limit holds it back. Tasks of a run that already has a task going are
+// part of that run, so only the limits of the task apply to them
+func admit(e *Entry, running []*Entry, l limits, pools map[string]int) (bool, string) {
+	taskRuns := 0
+	workflowRuns := map[string]bool{}
+	inRun := false
+	for _, r := range running {
+		if r.Workflow != e.Workflow {
+			continue
+		}
+		if r.Task == e.Task {
+			taskRuns++
+		}
+		workflowRuns[r.RunID] = true
+		if e.RunID != "" && r.RunID == e.RunID {
+			inRun = true
+		}
+	}
+
+	if l.TaskRuns > 0 && taskRuns >= l.TaskRuns {
+		return false, fmt.Sprintf("task %s/%s has %d of %d runs going", e.Workflow, e.Task, taskRuns, l.TaskRuns)
+	}
+	if size, ok := pools[l.TaskPool]; l.TaskPool != "" && ok {
+		if used := poolUsage(l.TaskPool, running); used >= size {
+			return false, fmt.Sprintf("pool %s has %d of %d slots taken", l.TaskPool, used, size)
+		}
+	}
+	if inRun {
+		return true, ""
+	}
+	if l.WorkflowRuns > 0 && len(workflowRuns) >= l.WorkflowRuns {
+		return false, fmt.Sprintf("workflow %s has %d of %d runs going", e.Workflow, len(workflowRuns), l.WorkflowRuns)
+	}
+	if size, ok := pools[l.WorkflowPool]; l.WorkflowPool != "" && ok {
+		if used := poolUsage(l.WorkflowPool, running); used >= size {
+			return false, fmt.Sprintf("pool %s has %d of %d slots taken", l.WorkflowPool, used, size)
+		}
+	}
+	if l.NamespaceRuns > 0 {
+		if used := namespaceUsage(l.Namespace, running); used >= l.NamespaceRuns {
+			return false, fmt.Sprintf("namespace %s has %d of %d runs going", l.Namespace, used, l.NamespaceRuns)
+		}
+	}
+	return true, ""
+}
+
+func setFields(id string, fields bson.M) error {
+	filter := bson.M{"id": id}
+	update := bson.M{"$set": fields}
+	result, err := mongodb.Collections[constants.MONGODB_RUN_QUEUE_COLLECTION_NAME].UpdateOne(mongodb.Ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount != 1 {
+		return fmt.Errorf("no queued run found with id %s", id)
+	}
+	return nil
+}
+
+func DeleteEntryByID(id string) error {
+	filter := bson.M{"id": id}
+
+	collection := mongodb.Collections[constants.MONGODB_RUN_QUEUE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no queued run found with id %s", id)
+	}
+
+	return nil
+}
+
+func GetAllEntries() ([]*Entry, error) {
+	filter := bson.D{{}}
+
+	entries, err := FilterEntries(filter)
+
+	return entries, err
+}
+
+func GetEntryByID(id string) (*Entry, error) {
+	filter := bson.M{"id": id}
+
+	entries, err := FilterEntries(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	if len(entries) > 1 {
+		return nil, fmt.Errorf("multiple queued runs found with id %s", id)
+	}
+
+	return entries[0], nil
+}
+
+// Get the queued runs that belong to a run, such as to tell whether it is
+// still waiting to start
+func GetEntriesByRunID(runID string) ([]*Entry, error) {
+	filter := bson.M{"run_id": runID}
+
+	entries, err := FilterEntries(filter)
+
+	return entries, err
+}
+
+func FilterEntries(filter interface{}) ([]*Entry, error) {
+	// A slice of entries for storing the decoded documents
+	var entries []*Entry
+
+	collection := mongodb.Collections[constants.MONGODB_RUN_QUEUE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return entries, err
+	}
+
+	for cur.Next(ctx) {
+		var e Entry
+		err := cur.Decode(&e)
+		if err != nil {
+			return entries, err
+		}
+
+		entries = append(entries, &e)
+	}
+
+	if err := cur.Err(); err != nil {
+		return entries, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return entries, nil
+}
@@ -0,0 +1,52 @@
+package queue
+
+import "testing"
+
+func TestAdmit(t *testing.T) {
+	pools := map[string]int{"prod-db": 1}
+	running := []*Entry{
+		{Workflow: "deploy", Task: "migrate", RunID: "a", TaskPool: "prod-db", Namespace: "default"},
+		{Workflow: "deploy", Task: "build", RunID: "b", Namespace: "default"},
+		{Workflow: "app.v2", Task: "build", RunID: "e", Namespace: "default"},
+	}
+
+	cases := []struct {
+		name   string
+		entry  *Entry
+		limits limits
+		want   bool
+		reason string
+	}{
+		{"unlimited", &Entry{Workflow: "deploy", Task: "build", RunID: "c"}, limits{}, true, ""},
+		{"task limit", &Entry{Workflow: "deploy", Task: "build", RunID: "c"}, limits{TaskRuns: 1}, false, "task deploy/build has 1 of 1 runs going"},
+		{"workflow limit", &Entry{Workflow: "deploy", Task: "build", RunID: "c"}, limits{WorkflowRuns: 2}, false, "workflow deploy has 2 of 2 runs going"},
+		{"same run", &Entry{Workflow: "deploy", Task: "test", RunID: "b"}, limits{WorkflowRuns: 2}, true, ""},
+		{"pool full", &Entry{Workflow: "other", Task: "migrate", RunID: "d"}, limits{TaskPool: "prod-db"}, false, "pool prod-db has 1 of 1 slots taken"},
+		{"unknown pool", &Entry{Workflow: "other", Task: "migrate", RunID: "d"}, limits{WorkflowPool: "missing"}, true, ""},
+		{"namespace limit", &Entry{Workflow: "other", Task: "build", RunID: "d"}, limits{Namespace: "default", NamespaceRuns: 3}, false, "namespace default has 3 of 3 runs going"},
+		{"other namespace", &Entry{Workflow: "ops.other", Task: "build", RunID: "d"}, limits{Namespace: "ops", NamespaceRuns: 1}, true, ""},
+		{"namespace run going", &Entry{Workflow: "deploy", Task: "test", RunID: "b"}, limits{Namespace: "default", NamespaceRuns: 3}, true, ""},
+		{"dotted default name", &Entry{Workflow: "app.deploy", Task: "build", RunID: "f"}, limits{Namespace: "app", NamespaceRuns: 1}, true, ""},
+	}
+	for _, c := range cases {
+		ok, reason := admit(c.entry, running, c.limits, pools)
+		if ok != c.want || reason != c.reason {
+			t.Errorf("%s: got %v %q, want %v %q", c.name, ok, reason, c.want, c.reason)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	entries := []*Entry{
+		{ID: "old-low", Priority: 0, Order: 1},
+		{ID: "new-high", Priority: 5, Order: 3},
+		{ID: "old-high", Priority: 5, Order: 2},
+	}
+	Sort(entries)
+	want := []string{"old-high", "new-high", "old-low"}
+	for i, e := range entries {
+		if e.ID != want[i] {
+			t.Errorf("position %d: got %s, want %s", i, e.ID, want[i])
+		}
+	}
+}
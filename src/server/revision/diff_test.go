@@ -0,0 +1,41 @@
+package revision
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	to := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+
+	want := `--- foo@1
++++ foo@2
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`
+	if got := UnifiedDiff("foo@1", "foo@2", from, to); got != want {
+		t.Errorf("UnifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := UnifiedDiff("foo@1", "foo@1", from, from); got != "" {
+		t.Errorf("UnifiedDiff of identical texts = %q, want empty", got)
+	}
+
+	want = `--- foo@0
++++ foo@1
+@@ -0,0 +1,2 @@
++a
++b
+`
+	if got := UnifiedDiff("foo@0", "foo@1", "", "a\nb\n"); got != want {
+		t.Errorf("UnifiedDiff from empty =\n%s\nwant\n%s", got, want)
+	}
+}
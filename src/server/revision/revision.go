@@ -0,0 +1,132 @@
+package revision
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"scaffold/server/constants"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"scaffold/server/mongodb"
+)
+
+// An immutable snapshot of a workflow definition as it was applied
+type Revision struct {
+	Workflow   string `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Version    int    `json:"version" bson:"version" yaml:"version"`
+	Author     string `json:"author" bson:"author" yaml:"author"`
+	Message    string `json:"message" bson:"message" yaml:"message"`
+	Checksum   string `json:"checksum" bson:"checksum" yaml:"checksum"`
+	Definition string `json:"definition" bson:"definition" yaml:"definition"`
+	Created    string `json:"created" bson:"created" yaml:"created"`
+}
+
+// Record a new revision of a workflow. Applying a definition identical to the
+// latest revision does not create a new one, the latest is returned instead
+func Record(workflow, definition, author, message string) (*Revision, error) {
+	sum := sha256.Sum256([]byte(definition))
+	checksum := hex.EncodeToString(sum[:])
+
+	latest, err := GetLatestRevision(workflow)
+	if err != nil {
+		return nil, err
+	}
+	version := 1
+	if latest != nil {
+		if latest.Checksum == checksum {
+			return latest, nil
+		}
+		version = latest.Version + 1
+	}
+
+	r := &Revision{
+		Workflow:   workflow,
+		Version:    version,
+		Author:     author,
+		Message:    message,
+		Checksum:   checksum,
+		Definition: definition,
+		Created:    time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	_, err = mongodb.Collections[constants.MONGODB_REVISION_COLLECTION_NAME].InsertOne(mongodb.Ctx, r)
+	return r, err
+}
+
+func GetRevisionsByWorkflow(workflow string) ([]*Revision, error) {
+	filter := bson.M{"workflow": workflow}
+	opts := options.Find().SetSort(bson.M{"version": 1})
+
+	return FilterRevisions(filter, opts)
+}
+
+func GetRevisionByVersion(workflow string, version int) (*Revision, error) {
+	filter := bson.M{"workflow": workflow, "version": version}
+
+	revisions, err := FilterRevisions(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		return nil, nil
+	}
+
+	if len(revisions) > 1 {
+		return nil, fmt.Errorf("multiple revisions found for %s with version %d", workflow, version)
+	}
+
+	return revisions[0], nil
+}
+
+func GetLatestRevision(workflow string) (*Revision, error) {
+	filter := bson.M{"workflow": workflow}
+	opts := options.Find().SetSort(bson.M{"version": -1}).SetLimit(1)
+
+	revisions, err := FilterRevisions(filter, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		return nil, nil
+	}
+
+	return revisions[0], nil
+}
+
+func FilterRevisions(filter interface{}, opts ...*options.FindOptions) ([]*Revision, error) {
+	// A slice of revisions for storing the decoded documents
+	var revisions []*Revision
+
+	collection := mongodb.Collections[constants.MONGODB_REVISION_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return revisions, err
+	}
+
+	for cur.Next(ctx) {
+		var r Revision
+		err := cur.Decode(&r)
+		if err != nil {
+			return revisions, err
+		}
+
+		revisions = append(revisions, &r)
+	}
+
+	if err := cur.Err(); err != nil {
+		return revisions, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return revisions, nil
+}
@@ -11,6 +11,7 @@ import (
 	"scaffold/server/middleware"
 	"scaffold/server/page"
 	"scaffold/server/page/common"
+	"scaffold/server/policy"
 
 	"github.com/gin-gonic/gin"
 	swaggerfiles "github.com/swaggo/files"
@@ -44,76 +45,92 @@ func initializeRoutes() {
 	}
 
 	if config.Config.Node.Type == constants.NODE_TYPE_MANAGER {
-		authRoutes := router.Group("/auth", middleware.CORSMiddleware())
+		authRoutes := router.Group("/auth", middleware.CORSMiddleware(), middleware.Audit())
 		{
 			authRoutes.POST("/login", middleware.EnsureNotLoggedIn(), auth.PerformLogin)
+			authRoutes.POST("/login/totp", middleware.EnsureNotLoggedIn(), auth.PerformTOTPLogin)
 			authRoutes.GET("/logout", middleware.EnsureLoggedIn(), auth.PerformLogout)
 			authRoutes.POST("/reset/request", middleware.EnsureNotLoggedIn(), auth.RequestPasswordReset)
 			authRoutes.POST("/reset/do", middleware.EnsureNotLoggedIn(), auth.DoPasswordReset)
+			authRoutes.GET("/oidc/login", middleware.EnsureNotLoggedIn(), auth.OIDCLogin)
+			authRoutes.GET("/oidc/callback", middleware.EnsureNotLoggedIn(), auth.OIDCCallback)
 			authRoutes.POST("/join", auth.JoinNode)
 			authRoutes.POST("/token/:username/:name", middleware.EnsureLoggedIn(), middleware.EnsureSelf(), api.GenerateAPIToken)
 			authRoutes.DELETE("/token/:username/:name", middleware.EnsureLoggedIn(), middleware.EnsureSelf(), api.RevokeAPIToken)
+			authRoutes.GET("/session/:username", middleware.EnsureLoggedIn(), middleware.EnsureSelf(), api.GetSessions)
+			authRoutes.DELETE("/session/:username", middleware.EnsureLoggedIn(), middleware.EnsureSelf(), api.RevokeAllSessions)
+			authRoutes.DELETE("/session/:username/:id", middleware.EnsureLoggedIn(), middleware.EnsureSelf(), api.RevokeSession)
+			authRoutes.POST("/totp/:username", middleware.EnsureLoggedIn(), middleware.EnsureSelf(), api.BeginTOTPEnrollment)
+			authRoutes.PUT("/totp/:username", middleware.EnsureLoggedIn(), middleware.EnsureSelf(), api.EnableTOTP)
+			authRoutes.POST("/totp/:username/disable", middleware.EnsureLoggedIn(), middleware.EnsureSelf(), api.DisableTOTP)
+			authRoutes.DELETE("/totp/:username", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.ResetTOTP)
 		}
 
-		apiRoutes := router.Group("/api", middleware.CORSMiddleware())
+		apiRoutes := router.Group("/api", middleware.CORSMiddleware(), middleware.Audit())
 		{
 			v1Routes := apiRoutes.Group("/v1")
 			{
 				workflowRoutes := v1Routes.Group("/workflow")
 				{
 					workflowRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetAllWorkflows)
-					workflowRoutes.GET("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("name"), api.GetWorkflowByName)
-					workflowRoutes.DELETE("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("name"), api.DeleteWorkflowByName)
+					workflowRoutes.GET("/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.GetWorkflowByName)
+					workflowRoutes.DELETE("/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "name", ""), api.DeleteWorkflowByName)
 					workflowRoutes.POST("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), api.CreateWorkflow)
-					workflowRoutes.PUT("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("name"), api.UpdateWorkflowByName)
+					workflowRoutes.PUT("/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "name", ""), api.UpdateWorkflowByName)
+					workflowRoutes.GET("/:name/revisions", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.GetWorkflowRevisions)
+					workflowRoutes.GET("/:name/revisions/:version", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.GetWorkflowRevision)
+					workflowRoutes.GET("/:name/diff", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.DiffWorkflowRevisions)
+					workflowRoutes.POST("/:name/rollback/:version", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "name", ""), api.RollbackWorkflow)
 				}
 				datastoreRoutes := v1Routes.Group("/datastore")
 				{
 					datastoreRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetAllDataStores)
-					datastoreRoutes.GET("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("name"), api.GetDataStoreByName)
-					datastoreRoutes.DELETE("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("name"), api.DeleteDataStoreByWorkflow)
+					datastoreRoutes.GET("/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.GetDataStoreByName)
+					datastoreRoutes.DELETE("/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "name", ""), api.DeleteDataStoreByWorkflow)
 					datastoreRoutes.POST("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), api.CreateDataStore)
-					datastoreRoutes.PUT("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("name"), api.UpdateDataStoreByWorkflow)
+					datastoreRoutes.PUT("/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "name", ""), api.UpdateDataStoreByWorkflow)
 				}
 				fileRoutes := v1Routes.Group("/file")
 				{
 					fileRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetAllFiles)
-					fileRoutes.GET("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("name"), api.GetFilesByWorkflow)
-					fileRoutes.GET("/:name/:file", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("name"), api.GetFileByNames)
-					fileRoutes.GET("/:name/:file/download", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("name"), api.DownloadFile)
-					fileRoutes.POST("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("name"), api.UploadFile)
+					fileRoutes.GET("/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.GetFilesByWorkflow)
+					fileRoutes.GET("/:name/:file", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.GetFileByNames)
+					fileRoutes.GET("/:name/:file/download", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.DownloadFile)
+					fileRoutes.GET("/:name/:file/versions", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.GetFileVersions)
+					fileRoutes.GET("/:name/:file/versions/:version/download", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.DownloadFileVersion)
+					fileRoutes.POST("/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "name", ""), api.UploadFile)
 				}
 				stateRoutes := v1Routes.Group("/state")
 				{
 					stateRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetAllStates)
-					stateRoutes.GET("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("workflow"), api.GetStatesByWorkflow)
-					stateRoutes.GET("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("workflow"), api.GetStateByNames)
-					stateRoutes.DELETE("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.DeleteStatesByWorkflow)
-					stateRoutes.DELETE("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.DeleteStateByNames)
+					stateRoutes.GET("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", ""), api.GetStatesByWorkflow)
+					stateRoutes.GET("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", "task"), api.GetStateByNames)
+					stateRoutes.DELETE("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.DeleteStatesByWorkflow)
+					stateRoutes.DELETE("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", "task"), api.DeleteStateByNames)
 					stateRoutes.POST("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), api.CreateState)
-					stateRoutes.PUT("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.UpdateStateByNames)
+					stateRoutes.PUT("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", "task"), api.UpdateStateByNames)
 				}
 				inputRoutes := v1Routes.Group("/input")
 				{
 					inputRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetAllInputs)
-					inputRoutes.GET("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("workflow"), api.GetInputsByWorkflow)
-					inputRoutes.GET("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("workflow"), api.GetInputByNames)
-					inputRoutes.DELETE("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.DeleteInputsByWorkflow)
-					inputRoutes.DELETE("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.DeleteInputByNames)
+					inputRoutes.GET("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", ""), api.GetInputsByWorkflow)
+					inputRoutes.GET("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", ""), api.GetInputByNames)
+					inputRoutes.DELETE("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.DeleteInputsByWorkflow)
+					inputRoutes.DELETE("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.DeleteInputByNames)
 					inputRoutes.POST("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), api.CreateInput)
-					inputRoutes.POST("/:workflow/update", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.UpdateInputDependenciesByName)
-					inputRoutes.PUT("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.UpdateInputByNames)
+					inputRoutes.POST("/:workflow/update", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.UpdateInputDependenciesByName)
+					inputRoutes.PUT("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.UpdateInputByNames)
 				}
 				taskRoutes := v1Routes.Group("/task")
 				{
 					taskRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetAllTasks)
-					taskRoutes.GET("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("workflow"), api.GetTasksByWorkflow)
-					taskRoutes.GET("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), middleware.EnsureWorkflowGroup("workflow"), api.GetTaskByNames)
-					taskRoutes.DELETE("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.DeleteTasksByWorkflow)
-					taskRoutes.DELETE("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.DeleteTaskByNames)
+					taskRoutes.GET("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", ""), api.GetTasksByWorkflow)
+					taskRoutes.GET("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", "task"), api.GetTaskByNames)
+					taskRoutes.DELETE("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.DeleteTasksByWorkflow)
+					taskRoutes.DELETE("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", "task"), api.DeleteTaskByNames)
 					taskRoutes.POST("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), api.CreateTask)
-					taskRoutes.PUT("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.UpdateTaskByNames)
-					taskRoutes.PUT("/:workflow/:task/enabled", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.ToggleTaskEnabled)
+					taskRoutes.PUT("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", "task"), api.UpdateTaskByNames)
+					taskRoutes.PUT("/:workflow/:task/enabled", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", "task"), api.ToggleTaskEnabled)
 				}
 				userRoutes := v1Routes.Group("/user")
 				{
@@ -125,17 +142,90 @@ func initializeRoutes() {
 				}
 				runRoutes := v1Routes.Group("/run")
 				{
-					runRoutes.POST("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.CreateRun)
-					runRoutes.DELETE("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureWorkflowGroup("workflow"), api.ManagerKillRun)
-					runRoutes.GET("/:runID", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetRunStatus)
+					runRoutes.POST("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_TRIGGER, "workflow", "task"), api.CreateRun)
+					runRoutes.DELETE("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_KILL, "workflow", "task"), api.ManagerKillRun)
+					runRoutes.GET("/:runID", middleware.EnsureLoggedIn(), middleware.EnsureRunAllowed(policy.VERB_VIEW, "runID"), api.GetRunStatus)
 				}
 				historyRoutes := v1Routes.Group("/history")
 				{
-					historyRoutes.GET("/:runID", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetHistory)
+					historyRoutes.GET("/:runID", middleware.EnsureLoggedIn(), middleware.EnsureRunAllowed(policy.VERB_VIEW, "runID"), api.GetHistory)
+				}
+				cacheRoutes := v1Routes.Group("/cache")
+				{
+					cacheRoutes.GET("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", ""), api.GetCacheStatsByWorkflow)
+					cacheRoutes.GET("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", "task"), api.GetCacheEntriesByNames)
+					cacheRoutes.DELETE("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.DeleteCacheByWorkflow)
+					cacheRoutes.DELETE("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", "task"), api.DeleteCacheByNames)
+				}
+				secretRoutes := v1Routes.Group("/secret")
+				{
+					secretRoutes.GET("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW_SECRETS, "workflow", ""), api.GetSecretsByWorkflow)
+					secretRoutes.GET("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW_SECRETS, "workflow", ""), api.GetSecretByNames)
+					secretRoutes.POST("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.CreateSecret)
+					secretRoutes.PUT("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.UpdateSecretByNames)
+					secretRoutes.DELETE("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.DeleteSecretByNames)
 				}
 				webhookRoutes := v1Routes.Group("/webhook")
 				{
-					webhookRoutes.POST("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), middleware.EnsureWorkflowGroup("workflow"), api.TriggerWebhookByID)
+					webhookRoutes.POST("/:workflow/:task", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_TRIGGER, "workflow", "task"), api.TriggerWebhookByID)
+					webhookRoutes.GET("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", ""), api.GetWebhooksByWorkflow)
+					webhookRoutes.GET("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", ""), api.GetWebhookByNames)
+					webhookRoutes.GET("/:workflow/:name/deliveries", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "workflow", ""), api.GetWebhookDeliveries)
+					webhookRoutes.POST("/:workflow", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.CreateWebhook)
+					webhookRoutes.PUT("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.UpdateWebhookByNames)
+					webhookRoutes.DELETE("/:workflow/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_EDIT, "workflow", ""), api.DeleteWebhookByNames)
+				}
+				// Signed webhooks authenticate with their signature instead of a user
+				hookRoutes := v1Routes.Group("/hook")
+				{
+					hookRoutes.POST("/:id", api.ReceiveWebhook)
+				}
+				templateRoutes := v1Routes.Group("/template")
+				{
+					templateRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetAllTemplates)
+					templateRoutes.GET("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetTemplateByName)
+					templateRoutes.POST("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), api.CreateTemplate)
+					templateRoutes.PUT("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), api.UpdateTemplateByName)
+					templateRoutes.DELETE("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write"}), api.DeleteTemplateByName)
+				}
+				policyRoutes := v1Routes.Group("/policy")
+				{
+					policyRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.GetAllPolicies)
+					policyRoutes.GET("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.GetPolicyByName)
+					policyRoutes.POST("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.CreatePolicy)
+					policyRoutes.PUT("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.UpdatePolicyByName)
+					policyRoutes.DELETE("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.DeletePolicyByName)
+				}
+				namespaceRoutes := v1Routes.Group("/namespace")
+				{
+					namespaceRoutes.GET("", middleware.EnsureLoggedIn(), api.GetAllNamespaces)
+					namespaceRoutes.GET("/:name", middleware.EnsureLoggedIn(), api.GetNamespaceByName)
+					namespaceRoutes.POST("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.CreateNamespace)
+					namespaceRoutes.PUT("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.UpdateNamespaceByName)
+					namespaceRoutes.DELETE("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.DeleteNamespaceByName)
+				}
+				queueRoutes := v1Routes.Group("/queue")
+				{
+					queueRoutes.GET("", middleware.EnsureLoggedIn(), api.GetQueue)
+					queueRoutes.DELETE("/:id", middleware.EnsureLoggedIn(), api.DeleteQueueEntryByID)
+				}
+				auditRoutes := v1Routes.Group("/audit")
+				{
+					auditRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.GetAuditEntries)
+					auditRoutes.GET("/export", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.ExportAuditEntries)
+				}
+				nodeRoutes := v1Routes.Group("/node")
+				{
+					nodeRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.GetAllNodes)
+					nodeRoutes.GET("/revoked", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.GetAllRevokedNodes)
+					nodeRoutes.DELETE("/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.RevokeNode)
+					nodeRoutes.DELETE("/revoked/:name", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.DeleteRevokedNode)
+				}
+				syncRoutes := v1Routes.Group("/sync")
+				{
+					syncRoutes.GET("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin", "write", "read"}), api.GetSyncStatus)
+					syncRoutes.GET("/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), api.GetSyncStatusByWorkflow)
+					syncRoutes.POST("", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), api.TriggerSync)
 				}
 			}
 		}
@@ -143,6 +233,7 @@ func initializeRoutes() {
 		uiRoutes := router.Group("/ui", middleware.CORSMiddleware())
 		{
 			uiRoutes.GET("/login", middleware.EnsureNotLoggedIn(), page.LoginPageEndpoint)
+			uiRoutes.GET("/login/totp", middleware.EnsureNotLoggedIn(), page.LoginTOTPPageEndpoint)
 			uiRoutes.GET("/forgot_password", middleware.EnsureNotLoggedIn(), page.ShowForgotPasswordPage)
 			uiRoutes.GET("/email_success", middleware.EnsureNotLoggedIn(), page.ShowEmailSuccessPage)
 			uiRoutes.GET("/email_failure", middleware.EnsureNotLoggedIn(), page.ShowEmailFailurePage)
@@ -151,10 +242,14 @@ func initializeRoutes() {
 			uiRoutes.GET("/dashboard", middleware.EnsureLoggedIn(), page.DashboardPageEndpoint)
 
 			uiRoutes.GET("/workflows", middleware.EnsureLoggedIn(), page.WorkflowsPageEndpoint)
-			uiRoutes.GET("/workflows/:name", middleware.EnsureLoggedIn(), page.WorkflowPageEndpoint)
+			uiRoutes.GET("/workflows/:name", middleware.EnsureLoggedIn(), middleware.EnsureAllowed(policy.VERB_VIEW, "name", ""), page.WorkflowPageEndpoint)
+
+			uiRoutes.GET("/files", middleware.EnsureLoggedIn(), page.FilesPageEndpoint)
 
 			uiRoutes.GET("/runs", middleware.EnsureLoggedIn(), page.HistoriesPageEndpoint)
-			uiRoutes.GET("/runs/:run_id", middleware.EnsureLoggedIn(), page.HistoryPageEndpoint)
+			uiRoutes.GET("/runs/:run_id", middleware.EnsureLoggedIn(), middleware.EnsureRunAllowed(policy.VERB_VIEW, "run_id"), page.HistoryPageEndpoint)
+
+			uiRoutes.GET("/audit", middleware.EnsureLoggedIn(), middleware.EnsureRolesAllowed([]string{"admin"}), page.AuditPageEndpoint)
 
 			uiRoutes.GET("/users", middleware.EnsureLoggedIn(), page.UsersPageEndpoint)
 			uiRoutes.GET("/users/:username", middleware.EnsureLoggedIn(), page.UserPageEndpoint)
@@ -180,12 +275,12 @@ func initializeRoutes() {
 			// }
 			workflowRoutes := htmxRoutes.Group("/workflow")
 			{
-				workflowRoutes.GET("/:name/display/:task", page.WorkflowDisplayEndpoint)
-				workflowRoutes.GET("/:name/output/:task", page.WorkflowOutputEndpoint)
-				workflowRoutes.GET("/:name/started/:task", page.WorkflowStartedEndpoint)
-				workflowRoutes.GET("/:name/finished/:task", page.WorkflowFinishedEndpoint)
-				workflowRoutes.GET("/:name/status/:task", page.WorkflowStatusEndpoint)
-				workflowRoutes.GET("/:name/modal/:task", page.WorkflowModalEndpoint)
+				workflowRoutes.GET("/:name/display/:task", middleware.EnsureAllowed(policy.VERB_VIEW, "name", "task"), page.WorkflowDisplayEndpoint)
+				workflowRoutes.GET("/:name/output/:task", middleware.EnsureAllowed(policy.VERB_VIEW, "name", "task"), page.WorkflowOutputEndpoint)
+				workflowRoutes.GET("/:name/started/:task", middleware.EnsureAllowed(policy.VERB_VIEW, "name", "task"), page.WorkflowStartedEndpoint)
+				workflowRoutes.GET("/:name/finished/:task", middleware.EnsureAllowed(policy.VERB_VIEW, "name", "task"), page.WorkflowFinishedEndpoint)
+				workflowRoutes.GET("/:name/status/:task", middleware.EnsureAllowed(policy.VERB_VIEW, "name", "task"), page.WorkflowStatusEndpoint)
+				workflowRoutes.GET("/:name/modal/:task", middleware.EnsureAllowed(policy.VERB_VIEW, "name", "task"), page.WorkflowModalEndpoint)
 			}
 			workflowsRoutes := htmxRoutes.Group("/workflows")
 			{
@@ -197,12 +292,22 @@ func initializeRoutes() {
 				dashboardRoutes.GET("/table", page.DashboardTableEndpoint)
 				dashboardRoutes.GET("/search", page.DashboardSearchEndpoint)
 			}
+			filesRoutes := htmxRoutes.Group("/files")
+			{
+				filesRoutes.GET("/table", page.FilesTableEndpoint)
+				filesRoutes.GET("/search", page.FilesSearchEndpoint)
+			}
 			runsRoutes := htmxRoutes.Group("/runs")
 			{
 				runsRoutes.GET("/table", page.HistoriesTableEndpoint)
 				runsRoutes.GET("/search", page.HistoriesSearchEndpoint)
-				runsRoutes.GET("/timeline/:run_id", page.HistoryTimelineEndpoint)
-				runsRoutes.GET("/timeline/:run_id/status/:state_name", page.HistoryStateEndpoint)
+				runsRoutes.GET("/queue", page.HistoriesQueueEndpoint)
+				runsRoutes.GET("/timeline/:run_id", middleware.EnsureRunAllowed(policy.VERB_VIEW, "run_id"), page.HistoryTimelineEndpoint)
+				runsRoutes.GET("/timeline/:run_id/status/:state_name", middleware.EnsureRunAllowed(policy.VERB_VIEW, "run_id"), page.HistoryStateEndpoint)
+			}
+			auditRoutes := htmxRoutes.Group("/audit")
+			{
+				auditRoutes.GET("/table", middleware.EnsureRolesAllowed([]string{"admin"}), page.AuditTableEndpoint)
 			}
 			usersRoutes := htmxRoutes.Group("/users")
 			{
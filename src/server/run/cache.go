@@ -0,0 +1,179 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"scaffold/server/artifact"
+	"scaffold/server/cache"
+	"scaffold/server/constants"
+	"scaffold/server/utils"
+	"strings"
+	"time"
+
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// Look up the digest of a container image, pulling it first if it is not
+// present locally
+func imageDigest(image string) (string, error) {
+	inspect := func() (string, error) {
+		out, err := exec.Command("podman", "image", "inspect", "--format", "{{.Digest}}", image).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	if digest, err := inspect(); err == nil && digest != "" {
+		return digest, nil
+	}
+	if out, err := exec.Command("podman", "pull", "-q", image).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("cannot pull image %s: %s", image, string(out))
+	}
+	return inspect()
+}
+
+func computeCacheKey(rc *RunContext) (string, error) {
+	in := cache.KeyInput{
+		Kind:    rc.Run.Task.Kind,
+		Script:  rc.Run.Task.Run,
+		Env:     rc.Env,
+		Secrets: rc.Secrets,
+		Files:   rc.Loaded,
+	}
+	if rc.Run.Task.Kind == constants.TASK_KIND_CONTAINER {
+		digest, err := imageDigest(rc.Run.Task.Image)
+		if err != nil {
+			return "", err
+		}
+		in.Image = rc.Run.Task.Image
+		in.Digest = digest
+	}
+	return cache.ComputeKey(in), nil
+}
+
+// Check the task cache for a previous run with identical inputs. On a hit the
+// stored env values and files of that run are restored, the state is marked as
+// cached and true is returned so the caller can skip execution
+func checkCache(rc *RunContext) (bool, error) {
+	if !rc.Run.Task.Cache.Enabled {
+		return false, nil
+	}
+
+	key, err := computeCacheKey(rc)
+	if err != nil {
+		logger.Warnf("", "Cannot compute cache key for %s/%s, running without cache: %s", rc.Run.Task.Workflow, rc.Run.Task.Name, err.Error())
+		return false, nil
+	}
+	rc.CacheKey = key
+
+	e, err := cache.GetEntryByKey(rc.Run.Task.Workflow, rc.Run.Task.Name, key)
+	if err != nil {
+		logger.Errorf("", "Cannot get cache entry: %s", err.Error())
+		return false, nil
+	}
+	if e != nil && cache.IsExpired(e, rc.Run.Task.Cache.TTL) {
+		if err := cache.DeleteEntryByKey(e.Workflow, e.Task, e.Key); err != nil {
+			logger.Errorf("", "Cannot delete expired cache entry: %s", err.Error())
+		}
+		e = nil
+	}
+	if e == nil {
+		if err := cache.RecordMiss(rc.Run.Task.Workflow, rc.Run.Task.Name); err != nil {
+			logger.Errorf("", "Cannot record cache miss: %s", err.Error())
+		}
+		return false, nil
+	}
+
+	if err := restoreCacheFiles(rc, e); err != nil {
+		// The cached outputs are no longer available, so the entry is useless
+		logger.Warnf("", "Cannot restore cache entry %s, running task: %s", key, err.Error())
+		if err := cache.DeleteEntryByKey(e.Workflow, e.Task, e.Key); err != nil {
+			logger.Errorf("", "Cannot delete cache entry: %s", err.Error())
+		}
+		if err := cache.RecordMiss(rc.Run.Task.Workflow, rc.Run.Task.Name); err != nil {
+			logger.Errorf("", "Cannot record cache miss: %s", err.Error())
+		}
+		return false, nil
+	}
+
+	for _, name := range rc.Run.Task.Store.Env {
+		if rc.Run.Context == nil {
+			rc.Run.Context = make(map[string]string)
+		}
+		rc.Run.Context[name] = e.Env[name]
+	}
+
+	if err := cache.RecordHit(e); err != nil {
+		logger.Errorf("", "Cannot record cache hit: %s", err.Error())
+	}
+
+	currentTime := time.Now().UTC()
+	rc.Run.PID = 0
+	rc.Run.State.Status = constants.STATE_STATUS_CACHED
+	rc.Run.State.Finished = currentTime.Format("2006-01-02T15:04:05Z")
+	rc.Run.State.Output = fmt.Sprintf("Restored from cache entry %s created by run %s on %s", e.Key, e.RunID, e.Created)
+
+	nukeDir(rc.RunDir)
+	if err := updateRunState(rc.Run, true); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Store the files of a cache entry again as new versions produced by this run
+func restoreCacheFiles(rc *RunContext, e *cache.Entry) error {
+	for _, f := range e.Files {
+		a, err := artifact.GetArtifactByVersion(e.Workflow, f.Name, f.Version)
+		if err != nil {
+			return err
+		}
+		if a == nil {
+			return fmt.Errorf("version %d of %s no longer exists", f.Version, f.Name)
+		}
+		tmpDir, err := os.MkdirTemp("", "scaffold-cache-*")
+		if err != nil {
+			return err
+		}
+		p := filepath.Join(tmpDir, "restore")
+		err = artifact.Fetch(a, p)
+		if err == nil {
+			var stored *artifact.Artifact
+			stored, err = artifact.Store(p, rc.Run.Task.Workflow, f.Name, rc.Run.RunID, rc.Run.Task.Name)
+			if err == nil {
+				rc.Run.stored = append(rc.Run.stored, stored)
+			}
+		}
+		os.RemoveAll(tmpDir)
+		if err != nil {
+			return err
+		}
+		rc.DataStore.Files = append(rc.DataStore.Files, f.Name)
+		rc.DataStore.Files = utils.RemoveDuplicateValues(rc.DataStore.Files)
+	}
+	return nil
+}
+
+// Record the outputs of a successful run under its cache key
+func saveCache(rc *RunContext) {
+	if rc.CacheKey == "" || rc.Run.State.Status != constants.STATE_STATUS_SUCCESS {
+		return
+	}
+
+	e := cache.Entry{
+		Key:      rc.CacheKey,
+		Workflow: rc.Run.Task.Workflow,
+		Task:     rc.Run.Task.Name,
+		RunID:    rc.Run.RunID,
+		Env:      map[string]string{},
+		Files:    []cache.CacheFile{},
+	}
+	for _, name := range rc.Run.Task.Store.Env {
+		e.Env[name] = rc.Run.Context[name]
+	}
+	for _, a := range rc.Run.stored {
+		e.Files = append(e.Files, cache.CacheFile{Name: a.Name, Version: a.Version})
+	}
+
+	if err := cache.CreateEntry(&e); err != nil {
+		logger.Errorf("", "Cannot create cache entry: %s", err.Error())
+	}
+}
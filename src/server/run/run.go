@@ -8,15 +8,23 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"scaffold/server/artifact"
 	"scaffold/server/config"
 	"scaffold/server/constants"
 	"scaffold/server/datastore"
-	"scaffold/server/filestore"
+	"scaffold/server/history"
+	"scaffold/server/input"
 	"scaffold/server/msg"
+	"scaffold/server/node"
 	"scaffold/server/rabbitmq"
+	"scaffold/server/secret"
 	"scaffold/server/state"
 	"scaffold/server/task"
 	"scaffold/server/utils"
+	"scaffold/server/workflow"
+	"sort"
 	"strings"
 	"time"
 
@@ -36,6 +44,11 @@ type Run struct {
 	PID     int               `json:"pid" yaml:"pid"`
 	Context map[string]string `json:"context" yaml:"context"`
 	RunID   string            `json:"run_id" yaml:"run_id"`
+	// Secret values to mask out of anything the run reports back
+	masks []string
+	// Files stored by the run, reported back so the manager can fire file
+	// triggers
+	stored []*artifact.Artifact
 }
 
 type RunContext struct {
@@ -46,6 +59,11 @@ type RunContext struct {
 	EnvInPath   string
 	EnvOutPath  string
 	DisplayPath string
+	Env         map[string]string
+	Secrets     map[string]string
+	Params      map[string]string
+	Loaded      map[string]string
+	CacheKey    string
 }
 
 func setErrorStatus(r *Run, output string) {
@@ -63,6 +81,15 @@ func runCmd(cmd *exec.Cmd) {
 
 func updateRunState(r *Run, send bool) error {
 	r.State.PID = r.PID
+	if len(r.masks) > 0 {
+		r.State.Output = secret.Mask(r.State.Output, r.masks)
+		for idx, d := range r.State.Display {
+			r.State.Display[idx] = secret.MaskValue(d, r.masks).(map[string]interface{})
+		}
+		for key, val := range r.Context {
+			r.Context[key] = secret.Mask(val, r.masks)
+		}
+	}
 	m := msg.RunMsg{
 		Task:     r.Task.Name,
 		Workflow: r.Task.Workflow,
@@ -70,6 +97,10 @@ func updateRunState(r *Run, send bool) error {
 		Context:  r.Context,
 		State:    r.State,
 		RunID:    r.RunID,
+		Files:    []msg.StoredFile{},
+	}
+	for _, a := range r.stored {
+		m.Files = append(m.Files, msg.StoredFile{Name: a.Name, Version: a.Version})
 	}
 	logger.Debugf("", "Updating run state for %v", m)
 	if err := state.UpdateStateRunByNames(r.State.Workflow, r.State.Task, r.State); err != nil {
@@ -77,7 +108,11 @@ func updateRunState(r *Run, send bool) error {
 		return err
 	}
 	if send {
-		return rabbitmq.WorkerPublish(m)
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return rabbitmq.WorkerPublish(msg.SignedMsg{Worker: r.Worker, Signature: node.Sign(node.WorkerKey, data), Data: data})
 	}
 	return nil
 }
@@ -134,28 +169,132 @@ func setupRun(rc *RunContext) (bool, error) {
 		return false, err
 	}
 
+	// Input overrides the run was triggered with
+	rc.Params, err = history.GetParams(rc.Run.RunID)
+	if err != nil {
+		logger.Errorf("", "Cannot get parameters of run %s", rc.Run.RunID)
+		setErrorStatus(rc.Run, err.Error())
+		if err := updateRunState(rc.Run, true); err != nil {
+			return false, err
+		}
+		return false, err
+	}
+
 	return false, nil
 }
 
-func setupEnvLoad(rc *RunContext) (bool, error) {
-	envInput := ""
+// Get the value of a workflow input for this run, preferring the run's
+// overrides over the shared datastore
+func inputValue(rc *RunContext, name string) (string, bool) {
+	if val, ok := rc.Params[name]; ok {
+		return val, true
+	}
+	val, ok := rc.DataStore.Env[name]
+	return val, ok
+}
+
+// Collect the environment a run executes with. Task ENV values take precedence
+// over the context, which takes precedence over inputs
+func resolveEnv(rc *RunContext) map[string]string {
+	env := map[string]string{}
 	for key, val := range rc.Run.Task.Inputs {
-		dsVal, ok := rc.DataStore.Env[val]
-		var encoded string
+		dsVal, ok := inputValue(rc, val)
 		if ok {
-			encoded = base64.StdEncoding.EncodeToString([]byte(dsVal))
-			envInput += fmt.Sprintf("%s;%s\n", key, encoded)
+			env[key] = dsVal
 			continue
 		}
 		logger.Warnf("", "Input value missing for %s", val)
 	}
 	for key, val := range rc.Run.Context {
-		encoded := base64.StdEncoding.EncodeToString([]byte(val))
-		envInput += fmt.Sprintf("%s;%s\n", key, encoded)
-		continue
+		env[key] = val
+	}
+	for key, val := range rc.Run.Task.Env {
+		env[key] = val
+	}
+	// Secrets are passed through the process environment instead
+	for key := range rc.Secrets {
+		delete(env, key)
+	}
+	return env
+}
+
+// Resolve the task's secret references. Secret values are only ever handed to
+// the task process through its environment and are masked from its output
+func resolveSecrets(rc *RunContext) error {
+	rc.Secrets = map[string]string{}
+	w, err := workflow.GetWorkflowByName(rc.Run.Task.Workflow)
+	if err != nil {
+		return fmt.Errorf("cannot get workflow %s: %s", rc.Run.Task.Workflow, err.Error())
+	}
+	namespace := workflow.NamespaceOf(w)
+	for key, ref := range rc.Run.Task.Secrets {
+		val, err := secret.Resolve(namespace, rc.Run.Task.Workflow, ref)
+		if err != nil {
+			return fmt.Errorf("cannot resolve secret for %s: %s", key, err.Error())
+		}
+		rc.Secrets[key] = val
+		rc.Run.masks = append(rc.Run.masks, val)
+	}
+	// Values of secret inputs are masked the same way
+	is, err := input.GetInputsByWorkflow(rc.Run.Task.Workflow)
+	if err != nil {
+		logger.Warnf("", "Cannot get inputs to mask for %s: %s", rc.Run.Task.Workflow, err.Error())
+	}
+	for _, i := range is {
+		if i.Type != constants.INPUT_TYPE_SECRET {
+			continue
+		}
+		for _, name := range rc.Run.Task.Inputs {
+			if name == i.Name {
+				val, _ := inputValue(rc, name)
+				rc.Run.masks = append(rc.Run.masks, val)
+			}
+		}
 	}
+	// Task ENV values can also reference a secret in an external provider
 	for key, val := range rc.Run.Task.Env {
-		encoded := base64.StdEncoding.EncodeToString([]byte(val))
+		if !secret.IsReference(val) {
+			continue
+		}
+		resolved, err := secret.Resolve(namespace, rc.Run.Task.Workflow, val)
+		if err != nil {
+			return fmt.Errorf("cannot resolve secret for %s: %s", key, err.Error())
+		}
+		rc.Secrets[key] = resolved
+		rc.Run.masks = append(rc.Run.masks, resolved)
+	}
+	return nil
+}
+
+// Environment entries for the resolved secrets in `NAME=value` form
+func secretEnviron(rc *RunContext) []string {
+	env := os.Environ()
+	for key, val := range rc.Secrets {
+		env = append(env, fmt.Sprintf("%s=%s", key, val))
+	}
+	return env
+}
+
+func setupEnvLoad(rc *RunContext) (bool, error) {
+	if err := resolveSecrets(rc); err != nil {
+		logger.Errorf("", "Error resolving secrets %s", err.Error())
+		setErrorStatus(rc.Run, err.Error())
+		if err := updateRunState(rc.Run, true); err != nil {
+			return false, err
+		}
+		return false, err
+	}
+
+	rc.Env = resolveEnv(rc)
+	keys := make([]string, 0, len(rc.Env))
+	for key := range rc.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	envInput := ""
+	for _, key := range keys {
+		encoded := base64.StdEncoding.EncodeToString([]byte(rc.Env[key]))
 		envInput += fmt.Sprintf("%s;%s\n", key, encoded)
 	}
 
@@ -211,9 +350,57 @@ func setupRunScript(rc *RunContext) (bool, error) {
 	return false, nil
 }
 
+// Resolve a path relative to the run directory, refusing any path that would
+// escape it
+func runPath(rc *RunContext, rel string) (string, error) {
+	p := filepath.Join(rc.RunDir, filepath.FromSlash(rel))
+	r, err := filepath.Rel(rc.RunDir, p)
+	if err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside of the run directory", rel)
+	}
+	return p, nil
+}
+
+// Download resolved artifacts into the run directory. A destination given for
+// a glob pattern is treated as the directory to place the matches under
+func fetchArtifacts(rc *RunContext, as []*artifact.Artifact, src, dest string) error {
+	for _, a := range as {
+		target := a.Name
+		if dest != "" {
+			target = dest
+			if artifact.IsGlob(src) {
+				target = path.Join(dest, a.Name)
+			}
+		}
+		p, err := runPath(rc, target)
+		if err != nil {
+			return err
+		}
+		if err := artifact.Fetch(a, p); err != nil {
+			return err
+		}
+		checksum := a.Checksum
+		if checksum == "" {
+			// Files stored before versioning have no recorded checksum
+			if checksum, _, err = artifact.Checksum(p); err != nil {
+				return err
+			}
+		}
+		if rc.Loaded == nil {
+			rc.Loaded = map[string]string{}
+		}
+		rc.Loaded[target] = checksum
+	}
+	return nil
+}
+
 func loadFiles(rc *RunContext) (bool, error) {
-	for _, name := range rc.Run.Task.Load.File {
-		err := filestore.GetFile(fmt.Sprintf("%s/%s", rc.Run.State.Workflow, name), fmt.Sprintf("%s/%s", rc.RunDir, name))
+	for _, entry := range rc.Run.Task.Load.File {
+		src, dest := artifact.SplitMapping(entry)
+		as, err := artifact.Resolve(rc.Run.State.Workflow, src)
+		if err == nil {
+			err = fetchArtifacts(rc, as, src, dest)
+		}
 		if err != nil {
 			logger.Errorf("", "Error getting file %s", err.Error())
 			setErrorStatus(rc.Run, err.Error())
@@ -255,12 +442,52 @@ func checkDisplay(rc *RunContext) (bool, error) {
 }
 
 func storeFiles(rc *RunContext) {
-	for _, name := range rc.Run.Task.Store.File {
-		filePath := fmt.Sprintf("%s/%s", rc.RunDir, name)
-		if _, err := os.Stat(filePath); err == nil {
-			err := filestore.UploadFile(filePath, fmt.Sprintf("%s/%s", rc.Run.Task.Workflow, name))
+	for _, entry := range rc.Run.Task.Store.File {
+		src, dest := artifact.SplitMapping(entry)
+		matches := []string{src}
+		if artifact.IsGlob(src) {
+			found, err := filepath.Glob(filepath.Join(rc.RunDir, filepath.FromSlash(src)))
+			if err != nil {
+				logger.Errorf("", "Invalid file pattern %s: %s\n", src, err.Error())
+				continue
+			}
+			matches = []string{}
+			for _, f := range found {
+				rel, err := filepath.Rel(rc.RunDir, f)
+				if err != nil {
+					continue
+				}
+				matches = append(matches, filepath.ToSlash(rel))
+			}
+		}
+		for _, rel := range matches {
+			filePath, err := runPath(rc, rel)
+			if err != nil {
+				logger.Errorf("", "Error storing file %s: %s\n", rel, err.Error())
+				continue
+			}
+			if _, err := os.Stat(filePath); err != nil {
+				continue
+			}
+			name := rel
+			if dest != "" {
+				name = dest
+				if artifact.IsGlob(src) {
+					name = path.Join(dest, name)
+				}
+			}
+			// The destination is joined into the name the file is stored
+			// under, so it could otherwise name another workflow's files
+			name, err = artifact.CleanName(name)
+			if err != nil {
+				logger.Errorf("", "Error storing file %s: %s\n", rel, err.Error())
+				continue
+			}
+			a, err := artifact.Store(filePath, rc.Run.Task.Workflow, name, rc.Run.RunID, rc.Run.Task.Name)
 			if err != nil {
 				logger.Errorf("", "Error uploading file %s: %s\n", fmt.Sprintf("%s/%s", rc.Run.Task.Workflow, name), err.Error())
+			} else {
+				rc.Run.stored = append(rc.Run.stored, a)
 			}
 			rc.DataStore.Files = append(rc.DataStore.Files, name)
 			rc.DataStore.Files = utils.RemoveDuplicateValues(rc.DataStore.Files)
@@ -360,6 +587,10 @@ func StartContainerRun(rr *Run) (bool, error) {
 		}
 	}
 
+	if cached, err := checkCache(rc); cached || err != nil {
+		return false, err
+	}
+
 	podmanCommand := fmt.Sprintf("podman run --rm --privileged -d %s --device /dev/net/tun:/dev/net/tun ", config.Config.PodmanOpts)
 	podmanCommand += fmt.Sprintf("--name %s ", containerName)
 	podmanCommand += fmt.Sprintf("--mount type=bind,src=%s,dst=/tmp/run ", rc.RunDir)
@@ -369,12 +600,17 @@ func StartContainerRun(rr *Run) (bool, error) {
 	for _, e := range rc.Run.Task.Load.EnvPassthrough {
 		podmanCommand += fmt.Sprintf("--env %s=\"${%s}\" ", e, e)
 	}
+	for key := range rc.Secrets {
+		// Without a value podman passes the variable through from its own environment
+		podmanCommand += fmt.Sprintf("--env %s ", key)
+	}
 	podmanCommand += rc.Run.Task.Image
 	podmanCommand += " bash -c /tmp/run/.run.sh"
 
 	logger.Debugf("", "command: %s", podmanCommand)
 
 	cmd := exec.Command("/bin/sh", "-c", podmanCommand)
+	cmd.Env = secretEnviron(rc)
 	var outb, errb bytes.Buffer
 	cmd.Stdout = &outb
 	cmd.Stderr = &errb
@@ -463,6 +699,7 @@ func StartContainerRun(rr *Run) (bool, error) {
 		}
 
 		setStatus(rc, returnCode, 0)
+		saveCache(rc)
 
 		if rc.Run.Task.ShouldRM {
 			rmCommand := fmt.Sprintf("podman rm -f %s", containerName)
@@ -548,6 +785,10 @@ func StartLocalRun(rr *Run) (bool, error) {
 		return shouldRestart, err
 	}
 
+	if cached, err := checkCache(rc); cached || err != nil {
+		return false, err
+	}
+
 	if rc.Run.PID > 0 {
 		if err := exec.Command("/bin/sh", "-c", fmt.Sprintf("kill %d", rc.Run.PID)).Run(); err != nil {
 			logger.Infof("", "Cannot kill existing run: %s\n", err.Error())
@@ -559,6 +800,7 @@ func StartLocalRun(rr *Run) (bool, error) {
 	logger.Debugf("", "command: %s", localCommand)
 
 	cmd := exec.Command("/bin/bash", "-c", localCommand)
+	cmd.Env = secretEnviron(rc)
 	var outb, errb bytes.Buffer
 	cmd.Stdout = &outb
 	cmd.Stderr = &errb
@@ -624,6 +866,7 @@ func StartLocalRun(rr *Run) (bool, error) {
 	}
 
 	setStatus(rc, "", returnCode)
+	saveCache(rc)
 
 	rc.Run.PID = 0
 
@@ -0,0 +1,351 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"scaffold/server/mongodb"
+)
+
+const MASK = "********"
+
+const PROVIDER_VAULT = "vault"
+
+// Secrets are only ever stored encrypted. The plain-text value is accepted on
+// create/update and decrypted again when a run needs it, but is never returned
+// by the API
+type Secret struct {
+	Name       string `json:"name" bson:"name" yaml:"name"`
+	Workflow   string `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Value      string `json:"value,omitempty" bson:"-" yaml:"value,omitempty"`
+	Ciphertext string `json:"-" bson:"ciphertext" yaml:"-"`
+	Created    string `json:"created" bson:"created" yaml:"created"`
+	Updated    string `json:"updated" bson:"updated" yaml:"updated"`
+}
+
+func masterKey() ([]byte, error) {
+	if config.Config.SecretKey == "" {
+		return nil, errors.New("no secret key is configured")
+	}
+	sum := sha256.Sum256([]byte(config.Config.SecretKey))
+	return sum[:], nil
+}
+
+// Encrypt a value with AES-256-GCM using the configured master key. The nonce
+// is prepended to the ciphertext
+func Encrypt(plaintext string) (string, error) {
+	key, err := masterKey()
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func Decrypt(ciphertext string) (string, error) {
+	key, err := masterKey()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("secret ciphertext is too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt secret, has the secret key changed? %s", err.Error())
+	}
+	return string(plaintext), nil
+}
+
+// A Provider resolves references to secrets held outside of Scaffold
+type Provider interface {
+	Get(path, key string) (string, error)
+	// Check whether a workflow may read a path. Providers are shared by every
+	// workflow, so each is limited to its own part of the provider
+	Allows(namespace, workflow, path string) bool
+}
+
+// External providers by the reference scheme they handle, e.g. `vault`
+var Providers = map[string]Provider{}
+
+// Register the external providers enabled in the configuration
+func InitProviders() {
+	if config.Config.Vault.Address != "" {
+		v := NewVaultProvider(config.Config.Vault)
+		Providers[PROVIDER_VAULT] = v
+		go v.KeepAlive(time.Minute)
+	}
+}
+
+// Check whether a value is a reference to a secret in an external provider
+func IsReference(val string) bool {
+	scheme, _, found := strings.Cut(val, ":")
+	if !found {
+		return false
+	}
+	_, ok := Providers[scheme]
+	return ok
+}
+
+// Resolve a task's secret reference to its plain-text value. References of the
+// form `<provider>:<path>#<key>` are looked up in the external provider, as
+// long as the path is one the workflow in namespace may read. Any other
+// reference is the name of a secret stored for the workflow
+func Resolve(namespace, workflow, ref string) (string, error) {
+	if scheme, rest, found := strings.Cut(ref, ":"); found {
+		if p, ok := Providers[scheme]; ok {
+			path, key, found := strings.Cut(rest, "#")
+			if !found || key == "" {
+				return "", fmt.Errorf("secret reference %s is missing a key, expected %s:<path>#<key>", ref, scheme)
+			}
+			// Path prefixes use the name the workflow was given in its namespace
+			name := strings.TrimPrefix(workflow, namespace+constants.WORKFLOW_NAMESPACE_SEPARATOR)
+			if !p.Allows(namespace, name, path) {
+				return "", fmt.Errorf("secret reference %s is outside of the paths workflow %s may read", ref, workflow)
+			}
+			return p.Get(path, key)
+		}
+	}
+
+	s, err := GetSecretByNames(workflow, ref)
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		return "", fmt.Errorf("secret %s does not exist in workflow %s", ref, workflow)
+	}
+	return Decrypt(s.Ciphertext)
+}
+
+// Replace every occurrence of the given secret values in a string. Multi-line
+// values are also masked line by line so partial output is covered
+func Mask(s string, values []string) string {
+	patterns := []string{}
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		patterns = append(patterns, v)
+		if strings.Contains(v, "\n") {
+			for _, line := range strings.Split(v, "\n") {
+				if strings.TrimSpace(line) != "" {
+					patterns = append(patterns, line)
+				}
+			}
+		}
+	}
+	// Longest first so a secret containing another is masked as a whole
+	sort.Slice(patterns, func(i, j int) bool {
+		return len(patterns[i]) > len(patterns[j])
+	})
+	for _, p := range patterns {
+		s = strings.ReplaceAll(s, p, MASK)
+	}
+	return s
+}
+
+// Mask secret values in every string nested inside of a decoded JSON value
+func MaskValue(v interface{}, values []string) interface{} {
+	switch val := v.(type) {
+	case string:
+		return Mask(val, values)
+	case map[string]interface{}:
+		for k, vv := range val {
+			val[k] = MaskValue(vv, values)
+		}
+		return val
+	case []interface{}:
+		for idx, vv := range val {
+			val[idx] = MaskValue(vv, values)
+		}
+		return val
+	}
+	return v
+}
+
+func CreateSecret(s *Secret) error {
+	ss, err := GetSecretByNames(s.Workflow, s.Name)
+	if err != nil {
+		return fmt.Errorf("error getting secrets: %s", err.Error())
+	}
+	if ss != nil {
+		return fmt.Errorf("secret already exists with names %s, %s", s.Workflow, s.Name)
+	}
+
+	s.Ciphertext, err = Encrypt(s.Value)
+	if err != nil {
+		return err
+	}
+	s.Value = ""
+
+	currentTime := time.Now().UTC()
+	s.Created = currentTime.Format("2006-01-02T15:04:05Z")
+	s.Updated = currentTime.Format("2006-01-02T15:04:05Z")
+
+	_, err = mongodb.Collections[constants.MONGODB_SECRET_COLLECTION_NAME].InsertOne(mongodb.Ctx, s)
+	return err
+}
+
+func DeleteSecretByNames(workflow, name string) error {
+	filter := bson.M{"workflow": workflow, "name": name}
+
+	collection := mongodb.Collections[constants.MONGODB_SECRET_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no secret found with names %s, %s", workflow, name)
+	}
+
+	return nil
+}
+
+func DeleteSecretsByWorkflow(workflow string) error {
+	filter := bson.M{"workflow": workflow}
+
+	collection := mongodb.Collections[constants.MONGODB_SECRET_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	_, err := collection.DeleteMany(ctx, filter)
+
+	return err
+}
+
+func GetAllSecrets() ([]*Secret, error) {
+	filter := bson.D{{}}
+
+	secrets, err := FilterSecrets(filter)
+
+	return secrets, err
+}
+
+func GetSecretsByWorkflow(workflow string) ([]*Secret, error) {
+	filter := bson.M{"workflow": workflow}
+
+	secrets, err := FilterSecrets(filter)
+
+	return secrets, err
+}
+
+func GetSecretByNames(workflow, name string) (*Secret, error) {
+	filter := bson.M{"workflow": workflow, "name": name}
+
+	secrets, err := FilterSecrets(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+
+	if len(secrets) > 1 {
+		return nil, fmt.Errorf("multiple secrets found with names %s, %s", workflow, name)
+	}
+
+	return secrets[0], nil
+}
+
+func UpdateSecretByNames(workflow, name string, s *Secret) error {
+	existing, err := GetSecretByNames(workflow, name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		s.Workflow = workflow
+		s.Name = name
+		return CreateSecret(s)
+	}
+
+	ciphertext, err := Encrypt(s.Value)
+	if err != nil {
+		return err
+	}
+	s.Value = ""
+
+	currentTime := time.Now().UTC()
+	filter := bson.M{"workflow": workflow, "name": name}
+	update := bson.M{"$set": bson.M{"ciphertext": ciphertext, "updated": currentTime.Format("2006-01-02T15:04:05Z")}}
+
+	collection := mongodb.Collections[constants.MONGODB_SECRET_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	_, err = collection.UpdateOne(ctx, filter, update)
+
+	return err
+}
+
+func FilterSecrets(filter interface{}) ([]*Secret, error) {
+	// A slice of secrets for storing the decoded documents
+	var secrets []*Secret
+
+	collection := mongodb.Collections[constants.MONGODB_SECRET_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return secrets, err
+	}
+
+	for cur.Next(ctx) {
+		var s Secret
+		err := cur.Decode(&s)
+		if err != nil {
+			return secrets, err
+		}
+
+		secrets = append(secrets, &s)
+	}
+
+	if err := cur.Err(); err != nil {
+		return secrets, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return secrets, nil
+}
@@ -0,0 +1,51 @@
+package secret
+
+import (
+	"scaffold/server/config"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	config.Config.SecretKey = "test-key"
+
+	ciphertext, err := Encrypt("hunter2")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if strings.Contains(ciphertext, "hunter2") {
+		t.Fatalf("ciphertext contains plain-text value")
+	}
+
+	plaintext, err := Decrypt(ciphertext)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if plaintext != "hunter2" {
+		t.Errorf("Decrypt = %q, want %q", plaintext, "hunter2")
+	}
+
+	config.Config.SecretKey = "other-key"
+	if _, err := Decrypt(ciphertext); err == nil {
+		t.Errorf("Decrypt with wrong key succeeded")
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		in     string
+		values []string
+		want   string
+	}{
+		{"token=abc123", []string{"abc123"}, "token=" + MASK},
+		{"abc123 abc", []string{"abc", "abc123"}, MASK + " " + MASK},
+		{"first\nsecond", []string{"first\nsecond"}, MASK},
+		{"only second", []string{"first\nsecond"}, "only " + MASK},
+		{"nothing here", []string{""}, "nothing here"},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.in, tt.values); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"scaffold/server/config"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// Reads secrets from a HashiCorp Vault KV v2 engine, authenticating with
+// either a static token or an AppRole
+type VaultProvider struct {
+	Config config.VaultObject
+	Client *http.Client
+
+	mu        sync.Mutex
+	token     string
+	ttl       time.Duration
+	renewable bool
+	issued    time.Time
+}
+
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+type vaultResponse struct {
+	Auth   *vaultAuth      `json:"auth"`
+	Data   json.RawMessage `json:"data"`
+	Errors []string        `json:"errors"`
+}
+
+type vaultStatusError struct {
+	Status int
+	Errors []string
+}
+
+func (e *vaultStatusError) Error() string {
+	return fmt.Sprintf("vault returned status %d: %s", e.Status, strings.Join(e.Errors, ", "))
+}
+
+func NewVaultProvider(c config.VaultObject) *VaultProvider {
+	if c.AuthMount == "" {
+		c.AuthMount = "approle"
+	}
+	if len(c.PathPrefixes) == 0 {
+		c.PathPrefixes = []string{"secret/{namespace}/{workflow}"}
+	}
+	return &VaultProvider{
+		Config: c,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (v *VaultProvider) request(method, path string, body interface{}) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(v.Config.Address, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.Config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Config.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("cannot decode vault response: %s", err.Error())
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &vaultStatusError{Status: resp.StatusCode, Errors: out.Errors}
+	}
+	return &out, nil
+}
+
+func (v *VaultProvider) setAuth(a *vaultAuth) error {
+	if a == nil || a.ClientToken == "" {
+		return errors.New("vault response did not contain a token")
+	}
+	v.token = a.ClientToken
+	v.ttl = time.Duration(a.LeaseDuration) * time.Second
+	v.renewable = a.Renewable
+	v.issued = time.Now()
+	return nil
+}
+
+// Obtain a token, either by logging in with the AppRole or by looking up the
+// lease of the configured static token
+func (v *VaultProvider) login() error {
+	if v.Config.RoleID != "" {
+		v.token = ""
+		resp, err := v.request(http.MethodPost, fmt.Sprintf("/v1/auth/%s/login", v.Config.AuthMount), map[string]string{
+			"role_id":   v.Config.RoleID,
+			"secret_id": v.Config.SecretID,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot log in to vault with approle: %s", err.Error())
+		}
+		return v.setAuth(resp.Auth)
+	}
+
+	if v.Config.Token == "" {
+		return errors.New("no vault token or approle is configured")
+	}
+	v.token = v.Config.Token
+	resp, err := v.request(http.MethodGet, "/v1/auth/token/lookup-self", nil)
+	if err != nil {
+		return fmt.Errorf("cannot look up vault token: %s", err.Error())
+	}
+	var data struct {
+		TTL       int  `json:"ttl"`
+		Renewable bool `json:"renewable"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return fmt.Errorf("cannot decode vault token lookup: %s", err.Error())
+	}
+	return v.setAuth(&vaultAuth{ClientToken: v.Config.Token, LeaseDuration: data.TTL, Renewable: data.Renewable})
+}
+
+func (v *VaultProvider) renew() error {
+	resp, err := v.request(http.MethodPost, "/v1/auth/token/renew-self", map[string]string{})
+	if err != nil {
+		return fmt.Errorf("cannot renew vault token: %s", err.Error())
+	}
+	return v.setAuth(resp.Auth)
+}
+
+// Make sure a usable token is held. Once half of the token's lease has passed
+// it is renewed, and an AppRole logs in again if renewal is not possible
+func (v *VaultProvider) ensureToken() error {
+	if v.token == "" {
+		return v.login()
+	}
+	// A TTL of 0 is a token that never expires
+	if v.ttl == 0 {
+		return nil
+	}
+	elapsed := time.Since(v.issued)
+	if elapsed < v.ttl/2 {
+		return nil
+	}
+	if v.renewable && elapsed < v.ttl {
+		err := v.renew()
+		if err == nil {
+			return nil
+		}
+		logger.Warnf("", "%s", err.Error())
+	}
+	if v.Config.RoleID != "" {
+		return v.login()
+	}
+	if elapsed >= v.ttl {
+		return errors.New("vault token has expired")
+	}
+	return nil
+}
+
+// Read a key from a KV v2 secret. The first segment of the path is the mount
+// of the secrets engine, e.g. `secret/myapp` reads `myapp` from the `secret`
+// mount
+func (v *VaultProvider) Get(path, key string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	mount, rest, found := strings.Cut(strings.Trim(path, "/"), "/")
+	if !found || rest == "" {
+		return "", fmt.Errorf("vault path %s must be of the form <mount>/<path>", path)
+	}
+
+	if err := v.ensureToken(); err != nil {
+		return "", err
+	}
+
+	readPath := fmt.Sprintf("/v1/%s/data/%s", mount, rest)
+	resp, err := v.request(http.MethodGet, readPath, nil)
+	var statusErr *vaultStatusError
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusForbidden && v.Config.RoleID != "" {
+		// The token may have been revoked, so log in again once and retry
+		if err := v.login(); err != nil {
+			return "", err
+		}
+		resp, err = v.request(http.MethodGet, readPath, nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read vault secret %s: %s", path, err.Error())
+	}
+
+	var data struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return "", fmt.Errorf("cannot decode vault secret %s: %s", path, err.Error())
+	}
+	val, ok := data.Data[key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", path, key)
+	}
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+	out, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Check that a path is under one of the configured path prefixes once the
+// workflow's namespace and name are filled in. Paths that climb out of a
+// prefix with `..` are refused outright
+func (v *VaultProvider) Allows(namespace, workflow, path string) bool {
+	path = strings.Trim(path, "/")
+	for _, part := range strings.Split(path, "/") {
+		if part == ".." || part == "." || part == "" {
+			return false
+		}
+	}
+	for _, prefix := range v.Config.PathPrefixes {
+		prefix = strings.ReplaceAll(prefix, "{namespace}", namespace)
+		prefix = strings.ReplaceAll(prefix, "{workflow}", workflow)
+		prefix = strings.Trim(prefix, "/")
+		if prefix != "" && (path == prefix || strings.HasPrefix(path, prefix+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Periodically renew the token's lease so it does not expire while the worker
+// is idle
+func (v *VaultProvider) KeepAlive(interval time.Duration) {
+	for {
+		v.mu.Lock()
+		if err := v.ensureToken(); err != nil {
+			logger.Errorf("", "Cannot keep vault token alive: %s", err.Error())
+		}
+		v.mu.Unlock()
+		time.Sleep(interval)
+	}
+}
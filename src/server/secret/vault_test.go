@@ -0,0 +1,208 @@
+package secret
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"scaffold/server/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A minimal stand-in for the parts of the Vault API the provider uses
+type fakeVault struct {
+	mu       sync.Mutex
+	tokens   map[string]bool
+	logins   int
+	renewals int
+	ttl      int
+}
+
+func newFakeVault() *fakeVault {
+	return &fakeVault{tokens: map[string]bool{"static-token": true}, ttl: 3600}
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	writeJSON := func(status int, v interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	auth := func(token string) map[string]interface{} {
+		return map[string]interface{}{"auth": map[string]interface{}{"client_token": token, "lease_duration": f.ttl, "renewable": true}}
+	}
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			writeJSON(http.StatusBadRequest, map[string]interface{}{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		f.logins += 1
+		token := "approle-token"
+		f.tokens[token] = true
+		writeJSON(http.StatusOK, auth(token))
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	if !f.tokens[token] {
+		writeJSON(http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		writeJSON(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"ttl": f.ttl, "renewable": true}})
+	case "/v1/auth/token/renew-self":
+		f.renewals += 1
+		writeJSON(http.StatusOK, auth(token))
+	case "/v1/secret/data/myapp":
+		writeJSON(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+			"data":     map[string]interface{}{"password": "hunter2", "port": 5432},
+			"metadata": map[string]interface{}{"version": 1},
+		}})
+	default:
+		writeJSON(http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+	}
+}
+
+func TestVaultToken(t *testing.T) {
+	srv := httptest.NewServer(newFakeVault())
+	defer srv.Close()
+
+	v := NewVaultProvider(config.VaultObject{Address: srv.URL, Token: "static-token"})
+
+	val, err := v.Get("secret/myapp", "password")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if val != "hunter2" {
+		t.Errorf("Get = %q, want %q", val, "hunter2")
+	}
+
+	val, err = v.Get("secret/myapp", "port")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if val != "5432" {
+		t.Errorf("Get = %q, want %q", val, "5432")
+	}
+
+	if _, err := v.Get("secret/myapp", "missing"); err == nil {
+		t.Errorf("Get of missing key succeeded")
+	}
+	if _, err := v.Get("secret/other", "password"); err == nil {
+		t.Errorf("Get of missing secret succeeded")
+	}
+}
+
+func TestVaultAppRole(t *testing.T) {
+	fake := newFakeVault()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	v := NewVaultProvider(config.VaultObject{Address: srv.URL, RoleID: "role", SecretID: "secret"})
+	if _, err := v.Get("secret/myapp", "password"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if fake.logins != 1 {
+		t.Errorf("logins = %d, want 1", fake.logins)
+	}
+
+	// A revoked token is replaced by logging in again
+	delete(fake.tokens, "approle-token")
+	if _, err := v.Get("secret/myapp", "password"); err != nil {
+		t.Fatalf("Get after revocation: %v", err)
+	}
+	if fake.logins != 2 {
+		t.Errorf("logins = %d, want 2", fake.logins)
+	}
+
+	bad := NewVaultProvider(config.VaultObject{Address: srv.URL, RoleID: "role", SecretID: "wrong"})
+	if _, err := bad.Get("secret/myapp", "password"); err == nil {
+		t.Errorf("Get with invalid secret ID succeeded")
+	}
+}
+
+func TestVaultRenewal(t *testing.T) {
+	fake := newFakeVault()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	v := NewVaultProvider(config.VaultObject{Address: srv.URL, Token: "static-token"})
+	if _, err := v.Get("secret/myapp", "password"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if fake.renewals != 0 {
+		t.Fatalf("renewals = %d, want 0", fake.renewals)
+	}
+
+	// Past half of the lease the token is renewed before it is used
+	v.issued = time.Now().Add(-40 * time.Minute)
+	if _, err := v.Get("secret/myapp", "password"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if fake.renewals != 1 {
+		t.Errorf("renewals = %d, want 1", fake.renewals)
+	}
+	if time.Since(v.issued) > time.Minute {
+		t.Errorf("lease was not reset by renewal")
+	}
+}
+
+func TestResolveReference(t *testing.T) {
+	srv := httptest.NewServer(newFakeVault())
+	defer srv.Close()
+
+	Providers[PROVIDER_VAULT] = NewVaultProvider(config.VaultObject{Address: srv.URL, Token: "static-token", PathPrefixes: []string{"secret/{workflow}"}})
+	defer delete(Providers, PROVIDER_VAULT)
+
+	if !IsReference("vault:secret/myapp#password") {
+		t.Errorf("IsReference did not match vault reference")
+	}
+	if IsReference("plain value") || IsReference("http://example.com") {
+		t.Errorf("IsReference matched a plain value")
+	}
+
+	val, err := Resolve("default", "myapp", "vault:secret/myapp#password")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if val != "hunter2" {
+		t.Errorf("Resolve = %q, want %q", val, "hunter2")
+	}
+
+	if _, err := Resolve("default", "myapp", "vault:secret/myapp"); err == nil {
+		t.Errorf("Resolve of reference without key succeeded")
+	}
+	if _, err := Resolve("default", "other", "vault:secret/myapp#password"); err == nil {
+		t.Errorf("Resolve of another workflow's path succeeded")
+	}
+	if _, err := Resolve("payments", "payments.myapp", "vault:secret/myapp#password"); err != nil {
+		t.Errorf("Resolve in another namespace: %v", err)
+	}
+}
+
+func TestVaultAllows(t *testing.T) {
+	v := NewVaultProvider(config.VaultObject{})
+	cases := map[string]bool{
+		"secret/payments/deploy":             true,
+		"secret/payments/deploy/db":          true,
+		"/secret/payments/deploy/db/":        true,
+		"secret/payments/deployer":           false,
+		"secret/payments/other/db":           false,
+		"secret/payments/deploy/../other/db": false,
+		"secret/payments/deploy/./db":        false,
+		"kv/payments/deploy/db":              false,
+	}
+	for path, want := range cases {
+		if got := v.Allows("payments", "deploy", path); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
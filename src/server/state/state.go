@@ -30,6 +30,12 @@ type State struct {
 	Context        map[string]string        `json:"context" bson:"context" yaml:"context"`
 }
 
+// Whether a status counts as a successful run. Runs restored from the task
+// cache are treated the same as runs that executed successfully
+func Succeeded(status string) bool {
+	return status == constants.STATE_STATUS_SUCCESS || status == constants.STATE_STATUS_CACHED
+}
+
 func CreateState(s *State) error {
 	ss, err := GetStateByNames(s.Workflow, s.Task)
 	if err != nil {
@@ -2,8 +2,11 @@ package task
 
 import (
 	"fmt"
+	"path"
+	"scaffold/server/config"
 	"scaffold/server/constants"
 	"scaffold/server/state"
+	"strings"
 	"time"
 
 	logger "github.com/jfcarter2358/go-logger"
@@ -27,6 +30,22 @@ type TaskLoadStore struct {
 	Mounts         []string `json:"mounts" bson:"mounts" yaml:"mounts"`
 }
 
+type TaskCache struct {
+	Enabled bool `json:"enabled" bson:"enabled" yaml:"enabled"`
+	TTL     int  `json:"ttl" bson:"ttl" yaml:"ttl"`
+}
+
+// Start the task when a file matching Pattern is stored in Workflow, which
+// defaults to the task's own workflow
+type TaskFileTrigger struct {
+	Pattern  string `json:"pattern" bson:"pattern" yaml:"pattern"`
+	Workflow string `json:"workflow" bson:"workflow" yaml:"workflow"`
+}
+
+type TaskTrigger struct {
+	OnFile TaskFileTrigger `json:"on_file,omitempty" bson:"on_file,omitempty" yaml:"on_file,omitempty"`
+}
+
 type TaskCheck struct {
 	Cron      string            `json:"cron" bson:"cron" yaml:"cron"`
 	Image     string            `json:"image" bson:"image" yaml:"image"`
@@ -51,13 +70,147 @@ type Task struct {
 	Load        TaskLoadStore     `json:"load" bson:"load" yaml:"load"`
 	Env         map[string]string `json:"env" bson:"env" yaml:"env"`
 	Inputs      map[string]string `json:"inputs" bson:"inputs" yaml:"inputs"`
+	Secrets     map[string]string `json:"secrets" bson:"secrets" yaml:"secrets"`
 	Updated     string            `json:"updated" bson:"updated" yaml:"updated"`
 	RunNumber   int               `json:"run_number" bson:"run_number" yaml:"run_number"`
 	ShouldRM    bool              `json:"should_rm" bson:"should_rm" yaml:"should_rm"`
 	AutoExecute bool              `json:"auto_execute" bson:"auto_execute" yaml:"auto_execute"`
 	Disabled    bool              `json:"disabled" bson:"disabled" yaml:"disabled"`
+	Cache       TaskCache         `json:"cache" bson:"cache" yaml:"cache"`
+	Trigger     TaskTrigger       `json:"trigger,omitempty" bson:"trigger,omitempty" yaml:"trigger,omitempty"`
+	Uses        string            `json:"uses,omitempty" bson:"uses,omitempty" yaml:"uses,omitempty"`
+	With        map[string]string `json:"with,omitempty" bson:"with,omitempty" yaml:"with,omitempty"`
+	Template    string            `json:"template,omitempty" bson:"template,omitempty" yaml:"template,omitempty"`
 	// Check                 TaskCheck         `json:"check" bson:"check" yaml:"check"`
 	ContainerLoginCommand string `json:"container_login_command" bson:"container_login_command" yaml:"container_login_command"`
+	// How many runs of the task can go at once, unlimited when 0
+	MaxConcurrentRuns int `json:"max_concurrent_runs,omitempty" bson:"max_concurrent_runs,omitempty" yaml:"max_concurrent_runs,omitempty"`
+	// Concurrency pool each run of the task takes a slot in
+	Pool string `json:"pool,omitempty" bson:"pool,omitempty" yaml:"pool,omitempty"`
+	// Runs with a higher priority leave the pending queue first
+	Priority int `json:"priority,omitempty" bson:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Check that a task's file trigger pattern is a valid glob
+func ValidateTrigger(t *Task) error {
+	if t.Trigger.OnFile.Pattern == "" {
+		return nil
+	}
+	if _, err := path.Match(t.Trigger.OnFile.Pattern, ""); err != nil {
+		return fmt.Errorf("task %s has an invalid trigger.on_file pattern %s: %s", t.Name, t.Trigger.OnFile.Pattern, err.Error())
+	}
+	if t.Trigger.OnFile.Workflow != "" && !validWorkflowRef(t.Trigger.OnFile.Workflow) {
+		return fmt.Errorf("task %s has an invalid trigger.on_file workflow %s", t.Name, t.Trigger.OnFile.Workflow)
+	}
+	return nil
+}
+
+// Check that a task's concurrency limit is not negative and that its pool is
+// one of the configured concurrency pools
+func ValidateConcurrency(t *Task) error {
+	if t.MaxConcurrentRuns < 0 {
+		return fmt.Errorf("task %s cannot have a negative max_concurrent_runs", t.Name)
+	}
+	if _, ok := config.Config.ConcurrencyPools[t.Pool]; t.Pool != "" && !ok {
+		return fmt.Errorf("task %s uses concurrency pool %s which is not configured", t.Name, t.Pool)
+	}
+	return nil
+}
+
+// Get every `depends_on` entry of a task, whatever status it waits for
+func Dependencies(t *Task) []string {
+	deps := append([]string{}, t.DependsOn.Success...)
+	deps = append(deps, t.DependsOn.Error...)
+	return append(deps, t.DependsOn.Always...)
+}
+
+// Check that every `<workflow>/<task>` dependency names both a workflow and a
+// task
+func ValidateDependencies(t *Task) error {
+	for _, dep := range Dependencies(t) {
+		wn, tn, ok := strings.Cut(dep, "/")
+		if ok && (!validWorkflowRef(wn) || tn == "" || strings.Contains(tn, "/")) {
+			return fmt.Errorf("task %s has an invalid dependency %s, use <workflow>/<task>", t.Name, dep)
+		}
+	}
+	return nil
+}
+
+// Get the name a workflow is stored under. Names only have to be unique within
+// a namespace, so workflows outside the default namespace are stored as
+// `<namespace>.<name>`
+func QualifiedWorkflow(namespace, name string) string {
+	if namespace == "" || namespace == constants.NAMESPACE_DEFAULT {
+		return name
+	}
+	return namespace + constants.WORKFLOW_NAMESPACE_SEPARATOR + name
+}
+
+// Split the name a workflow is stored under into its namespace and the name it
+// was given in that namespace
+func SplitWorkflow(qualified string) (string, string) {
+	if ns, name, ok := strings.Cut(qualified, constants.WORKFLOW_NAMESPACE_SEPARATOR); ok {
+		return ns, name
+	}
+	return constants.NAMESPACE_DEFAULT, qualified
+}
+
+// Resolve a workflow name referenced from workflow wn. Names without a
+// namespace refer to a workflow in the same namespace as wn, while
+// `<namespace>.<name>` refers to one in another namespace
+func ResolveWorkflow(wn, ref string) string {
+	if ns, name, ok := strings.Cut(ref, constants.WORKFLOW_NAMESPACE_SEPARATOR); ok {
+		return QualifiedWorkflow(ns, name)
+	}
+	ns, _ := SplitWorkflow(wn)
+	return QualifiedWorkflow(ns, ref)
+}
+
+// Check that a workflow reference is a name, optionally in another namespace
+func validWorkflowRef(ref string) bool {
+	ns, name, ok := strings.Cut(ref, constants.WORKFLOW_NAMESPACE_SEPARATOR)
+	if !ok {
+		return ref != ""
+	}
+	return ns != "" && name != "" && !strings.Contains(name, constants.WORKFLOW_NAMESPACE_SEPARATOR)
+}
+
+// Split a `depends_on` entry of a task in workflow wn into the workflow and task
+// it refers to. Entries of the form `<workflow>/<task>` refer to a task in
+// another workflow, anything else to a task in the same workflow
+func SplitDependency(wn, dep string) (string, string) {
+	if w, t, ok := strings.Cut(dep, "/"); ok {
+		return ResolveWorkflow(wn, w), t
+	}
+	return wn, dep
+}
+
+// Check whether any of deps, listed by a task in workflow wn, refers to task tn
+// in workflow cn
+func DependsOnTask(deps []string, wn, cn, tn string) bool {
+	for _, dep := range deps {
+		w, t := SplitDependency(wn, dep)
+		if w == cn && t == tn {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether a file stored in a workflow should trigger the task
+func MatchesFile(t *Task, workflow, name string) bool {
+	if t.Trigger.OnFile.Pattern == "" {
+		return false
+	}
+	source := t.Workflow
+	if t.Trigger.OnFile.Workflow != "" {
+		source = ResolveWorkflow(t.Workflow, t.Trigger.OnFile.Workflow)
+	}
+	if source != workflow {
+		return false
+	}
+	matched, _ := path.Match(t.Trigger.OnFile.Pattern, name)
+	return matched
 }
 
 func CreateTask(t *Task) error {
@@ -241,20 +394,20 @@ func VerifyDepends(cn, tn string) (bool, error) {
 		return false, err
 	}
 	for _, n := range t.DependsOn.Success {
-		s, err := state.GetStateByNames(cn, n)
+		s, err := state.GetStateByNames(SplitDependency(cn, n))
 		if err != nil {
 			return false, err
 		}
-		if s.Status != constants.STATE_STATUS_SUCCESS {
+		if s == nil || !state.Succeeded(s.Status) {
 			return false, nil
 		}
 	}
 	for _, n := range t.DependsOn.Error {
-		s, err := state.GetStateByNames(cn, n)
+		s, err := state.GetStateByNames(SplitDependency(cn, n))
 		if err != nil {
 			return false, err
 		}
-		if s.Status != constants.STATE_STATUS_ERROR {
+		if s == nil || s.Status != constants.STATE_STATUS_ERROR {
 			return false, nil
 		}
 	}
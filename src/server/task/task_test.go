@@ -0,0 +1,103 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMatchesFile(t *testing.T) {
+	tk := &Task{Name: "deploy", Workflow: "app", Trigger: TaskTrigger{OnFile: TaskFileTrigger{Pattern: "dist/*.tar.gz"}}}
+	other := &Task{Name: "scan", Workflow: "security", Trigger: TaskTrigger{OnFile: TaskFileTrigger{Pattern: "*", Workflow: "app"}}}
+
+	for _, tc := range []struct {
+		task     *Task
+		workflow string
+		name     string
+		want     bool
+	}{
+		{tk, "app", "dist/app.tar.gz", true},
+		{tk, "app", "dist/app.zip", false},
+		{tk, "app", "dist/nested/app.tar.gz", false},
+		{tk, "other", "dist/app.tar.gz", false},
+		{other, "app", "report.json", true},
+		{other, "security", "report.json", false},
+		{&Task{Name: "none", Workflow: "app"}, "app", "anything", false},
+	} {
+		if got := MatchesFile(tc.task, tc.workflow, tc.name); got != tc.want {
+			t.Errorf("MatchesFile(%s, %s, %s) = %v, want %v", tc.task.Name, tc.workflow, tc.name, got, tc.want)
+		}
+	}
+
+	if err := ValidateTrigger(&Task{Name: "bad", Trigger: TaskTrigger{OnFile: TaskFileTrigger{Pattern: "[a-"}}}); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+	if err := ValidateTrigger(tk); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
+
+func TestTriggerOmittedWhenUnset(t *testing.T) {
+	out, err := yaml.Marshal(Task{Name: "build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "trigger") {
+		t.Errorf("unset trigger was marshalled:\n%s", out)
+	}
+}
+
+func TestDependsOnTask(t *testing.T) {
+	deps := []string{"build", "nightly/publish"}
+	for _, tc := range []struct {
+		workflow string
+		task     string
+		want     bool
+	}{
+		{"deploy", "build", true},
+		{"nightly", "publish", true},
+		{"nightly", "build", false},
+		{"deploy", "publish", false},
+	} {
+		if got := DependsOnTask(deps, "deploy", tc.workflow, tc.task); got != tc.want {
+			t.Errorf("DependsOnTask(%s/%s) = %v, want %v", tc.workflow, tc.task, got, tc.want)
+		}
+	}
+
+	for _, dep := range []string{"/publish", "nightly/", "a/b/c", ".nightly/publish", "ops./publish", "ops.a.b/publish"} {
+		tk := &Task{Name: "deploy", DependsOn: TaskDependsOn{Success: []string{dep}}}
+		if err := ValidateDependencies(tk); err == nil {
+			t.Errorf("dependency %s was accepted", dep)
+		}
+	}
+}
+
+func TestResolveWorkflow(t *testing.T) {
+	for _, tc := range []struct {
+		from string
+		ref  string
+		want string
+	}{
+		{"deploy", "nightly", "nightly"},
+		{"ops.deploy", "nightly", "ops.nightly"},
+		{"ops.deploy", "default.nightly", "nightly"},
+		{"deploy", "ops.nightly", "ops.nightly"},
+	} {
+		if got := ResolveWorkflow(tc.from, tc.ref); got != tc.want {
+			t.Errorf("ResolveWorkflow(%s, %s) = %s, want %s", tc.from, tc.ref, got, tc.want)
+		}
+	}
+
+	if ns, name := SplitWorkflow("ops.deploy"); ns != "ops" || name != "deploy" {
+		t.Errorf("SplitWorkflow(ops.deploy) = %s, %s", ns, name)
+	}
+	if ns, name := SplitWorkflow("deploy"); ns != "default" || name != "deploy" {
+		t.Errorf("SplitWorkflow(deploy) = %s, %s", ns, name)
+	}
+
+	tk := &Task{Name: "scan", Workflow: "ops.security", Trigger: TaskTrigger{OnFile: TaskFileTrigger{Pattern: "*", Workflow: "app"}}}
+	if !MatchesFile(tk, "ops.app", "report.json") || MatchesFile(tk, "app", "report.json") {
+		t.Errorf("on_file workflow was not resolved in the task's namespace")
+	}
+}
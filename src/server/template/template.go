@@ -0,0 +1,334 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"scaffold/server/constants"
+	"scaffold/server/input"
+	"scaffold/server/task"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"scaffold/server/mongodb"
+)
+
+// A value a template is instantiated with. Parameters are referenced as
+// `${{ params.<name> }}` from any string in the template's tasks and inputs
+type Param struct {
+	Name        string `json:"name" bson:"name" yaml:"name"`
+	Description string `json:"description" bson:"description" yaml:"description"`
+	Default     string `json:"default" bson:"default" yaml:"default"`
+	Required    bool   `json:"required" bson:"required" yaml:"required"`
+}
+
+// Reusable tasks and inputs that workflows pull in with `extends` or `uses`
+type Template struct {
+	Name        string        `json:"name" bson:"name" yaml:"name"`
+	Description string        `json:"description" bson:"description" yaml:"description"`
+	Params      []Param       `json:"params" bson:"params" yaml:"params"`
+	Inputs      []input.Input `json:"inputs" bson:"inputs" yaml:"inputs"`
+	Tasks       []task.Task   `json:"tasks" bson:"tasks" yaml:"tasks"`
+	Created     string        `json:"created" bson:"created" yaml:"created"`
+	Updated     string        `json:"updated" bson:"updated" yaml:"updated"`
+}
+
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, "; ")
+}
+
+var paramPattern = regexp.MustCompile(`\$\{\{\s*params\.([A-Za-z0-9_-]*)\s*\}\}`)
+
+// Check a template before it is stored. Every parameter reference must be
+// declared and dependencies must point at tasks in the template or, as
+// `<workflow>/<task>`, at a task in another workflow
+func Validate(t *Template) error {
+	errs := []string{}
+	if t.Name == "" {
+		errs = append(errs, "template name is required")
+	}
+
+	declared := map[string]string{}
+	for _, p := range t.Params {
+		if p.Name == "" {
+			errs = append(errs, fmt.Sprintf("template %s has a parameter without a name", t.Name))
+			continue
+		}
+		if _, ok := declared[p.Name]; ok {
+			errs = append(errs, fmt.Sprintf("template %s declares parameter %s more than once", t.Name, p.Name))
+		}
+		declared[p.Name] = p.Default
+	}
+
+	names := map[string]bool{}
+	for _, tt := range t.Tasks {
+		if tt.Name == "" {
+			errs = append(errs, fmt.Sprintf("template %s has a task without a name", t.Name))
+			continue
+		}
+		if names[tt.Name] {
+			errs = append(errs, fmt.Sprintf("template %s defines task %s more than once", t.Name, tt.Name))
+		}
+		names[tt.Name] = true
+		if tt.Uses != "" {
+			errs = append(errs, fmt.Sprintf("template %s task %s cannot use another template", t.Name, tt.Name))
+		}
+	}
+	for _, tt := range t.Tasks {
+		for _, dep := range Dependencies(&tt) {
+			if !names[dep] && !strings.Contains(dep, "/") {
+				errs = append(errs, fmt.Sprintf("template %s task %s depends on unknown task %s", t.Name, tt.Name, dep))
+			}
+		}
+	}
+
+	if _, _, err := Render(t, declared); err != nil {
+		errs = append(errs, err.(*ValidationError).Errors...)
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// Get the names of every task a task depends on
+func Dependencies(t *task.Task) []string {
+	deps := append([]string{}, t.DependsOn.Success...)
+	deps = append(deps, t.DependsOn.Error...)
+	return append(deps, t.DependsOn.Always...)
+}
+
+// Work out the value of every parameter from the values a workflow passes with
+// `with`, falling back to the defaults
+func Resolve(t *Template, with map[string]string) (map[string]string, error) {
+	errs := []string{}
+	params := map[string]string{}
+	for _, p := range t.Params {
+		val, ok := with[p.Name]
+		if !ok {
+			if p.Required {
+				errs = append(errs, fmt.Sprintf("template %s parameter %s is required", t.Name, p.Name))
+				continue
+			}
+			val = p.Default
+		}
+		params[p.Name] = val
+	}
+	for name := range with {
+		if _, ok := params[name]; !ok {
+			errs = append(errs, fmt.Sprintf("template %s has no parameter %s", t.Name, name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	return params, nil
+}
+
+// Get copies of the template's tasks and inputs with every parameter reference
+// replaced by its value
+func Render(t *Template, params map[string]string) ([]task.Task, []input.Input, error) {
+	errs := []string{}
+
+	tasks := make([]task.Task, len(t.Tasks))
+	for idx, tt := range t.Tasks {
+		if err := substitute(tt, &tasks[idx], params); err != nil {
+			errs = append(errs, fmt.Sprintf("template %s task %s: %s", t.Name, tt.Name, err.Error()))
+		}
+	}
+	inputs := make([]input.Input, len(t.Inputs))
+	for idx, i := range t.Inputs {
+		if err := substitute(i, &inputs[idx], params); err != nil {
+			errs = append(errs, fmt.Sprintf("template %s input %s: %s", t.Name, i.Name, err.Error()))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, &ValidationError{Errors: errs}
+	}
+	return tasks, inputs, nil
+}
+
+// Replace parameter references in every string of in and decode the result
+// into out
+func substitute(in, out interface{}, params map[string]string) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	unknown := []string{}
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch val := v.(type) {
+		case string:
+			return paramPattern.ReplaceAllStringFunc(val, func(ref string) string {
+				name := paramPattern.FindStringSubmatch(ref)[1]
+				p, ok := params[name]
+				if !ok {
+					unknown = append(unknown, name)
+					return ref
+				}
+				return p
+			})
+		case map[string]interface{}:
+			for k, vv := range val {
+				val[k] = walk(vv)
+			}
+			return val
+		case []interface{}:
+			for idx, vv := range val {
+				val[idx] = walk(vv)
+			}
+			return val
+		}
+		return v
+	}
+	v = walk(v)
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown parameter %s", strings.Join(unknown, ", "))
+	}
+
+	data, err = json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func CreateTemplate(t *Template) error {
+	if err := Validate(t); err != nil {
+		return err
+	}
+
+	tt, err := GetTemplateByName(t.Name)
+	if err != nil {
+		return fmt.Errorf("error getting templates: %s", err.Error())
+	}
+	if tt != nil {
+		return fmt.Errorf("template already exists with name %s", t.Name)
+	}
+
+	currentTime := time.Now().UTC()
+	t.Created = currentTime.Format("2006-01-02T15:04:05Z")
+	t.Updated = currentTime.Format("2006-01-02T15:04:05Z")
+
+	_, err = mongodb.Collections[constants.MONGODB_TEMPLATE_COLLECTION_NAME].InsertOne(mongodb.Ctx, t)
+	return err
+}
+
+func DeleteTemplateByName(name string) error {
+	filter := bson.M{"name": name}
+
+	collection := mongodb.Collections[constants.MONGODB_TEMPLATE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no template found with name %s", name)
+	}
+
+	return nil
+}
+
+func GetAllTemplates() ([]*Template, error) {
+	filter := bson.D{{}}
+
+	templates, err := FilterTemplates(filter)
+
+	return templates, err
+}
+
+func GetTemplateByName(name string) (*Template, error) {
+	filter := bson.M{"name": name}
+
+	templates, err := FilterTemplates(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(templates) == 0 {
+		return nil, nil
+	}
+
+	if len(templates) > 1 {
+		return nil, fmt.Errorf("multiple templates found with name %s", name)
+	}
+
+	return templates[0], nil
+}
+
+func UpdateTemplateByName(name string, t *Template) error {
+	t.Name = name
+	if err := Validate(t); err != nil {
+		return err
+	}
+
+	existing, err := GetTemplateByName(name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return CreateTemplate(t)
+	}
+
+	t.Created = existing.Created
+	t.Updated = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	filter := bson.M{"name": name}
+	opts := options.Replace().SetUpsert(true)
+
+	_, err = mongodb.Collections[constants.MONGODB_TEMPLATE_COLLECTION_NAME].ReplaceOne(mongodb.Ctx, filter, t, opts)
+	return err
+}
+
+func FilterTemplates(filter interface{}) ([]*Template, error) {
+	// A slice of templates for storing the decoded documents
+	var templates []*Template
+
+	collection := mongodb.Collections[constants.MONGODB_TEMPLATE_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return templates, err
+	}
+
+	for cur.Next(ctx) {
+		var t Template
+		err := cur.Decode(&t)
+		if err != nil {
+			return templates, err
+		}
+
+		templates = append(templates, &t)
+	}
+
+	if err := cur.Err(); err != nil {
+		return templates, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return templates, nil
+}
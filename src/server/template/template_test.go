@@ -0,0 +1,33 @@
+package template
+
+import (
+	"scaffold/server/task"
+	"strings"
+	"testing"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	tmpl := &Template{
+		Name:   "bad",
+		Params: []Param{{Name: "a"}},
+		Tasks: []task.Task{
+			{Name: "one", Run: "echo ${{ params.b }}"},
+			{Name: "two", DependsOn: task.TaskDependsOn{Success: []string{"three"}}},
+		},
+	}
+	err := Validate(tmpl)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"template bad task one: unknown parameter b", "template bad task two depends on unknown task three"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err.Error(), want)
+		}
+	}
+
+	tmpl.Params = append(tmpl.Params, Param{Name: "b"})
+	tmpl.Tasks = append(tmpl.Tasks, task.Task{Name: "three", Run: "${{params.a}}"})
+	if err := Validate(tmpl); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
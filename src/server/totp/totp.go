@@ -0,0 +1,101 @@
+// Package totp implements time-based one-time passwords as described in
+// RFC 6238, the codes shown by authenticator apps
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// How long each code is valid for in seconds
+const PERIOD = 30
+
+// How many digits codes have
+const DIGITS = 6
+
+// How many periods either side of the current one are accepted, allowing for
+// clock drift and codes entered just as they change
+const SKEW = 1
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generate a new random secret, encoded in base32 as authenticator apps expect
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Get the period a time falls in
+func Counter(t time.Time) int64 {
+	return t.Unix() / PERIOD
+}
+
+// Get the code for a secret in a given period
+func Code(secret string, counter int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("invalid totp secret: %s", err.Error())
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < DIGITS; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", DIGITS, value%mod), nil
+}
+
+// Check a code against a secret at a given time. Codes from periods up to and
+// including after are refused so that a code cannot be used twice, and the
+// period the code matched is returned so it can be passed as after next time
+func Validate(secret, code string, t time.Time, after int64) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != DIGITS {
+		return 0, false
+	}
+	now := Counter(t)
+	for counter := now - SKEW; counter <= now+SKEW; counter++ {
+		if counter <= after {
+			continue
+		}
+		expected, err := Code(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// Build the otpauth URI authenticator apps read from QR codes
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprintf("%d", DIGITS))
+	v.Set("period", fmt.Sprintf("%d", PERIOD))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
@@ -0,0 +1,63 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA1 test vectors from RFC 6238, cut down to six digits
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	cases := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		code, err := Code(rfcSecret, Counter(time.Unix(c.time, 0)))
+		if err != nil {
+			t.Fatalf("time %d: %s", c.time, err.Error())
+		}
+		if code != c.code {
+			t.Errorf("time %d: got %s, want %s", c.time, code, c.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	counter := Counter(now)
+	code, _ := Code(rfcSecret, counter)
+	previous, _ := Code(rfcSecret, counter-1)
+	old, _ := Code(rfcSecret, counter-2)
+
+	if got, ok := Validate(rfcSecret, code, now, 0); !ok || got != counter {
+		t.Errorf("current code: got %d, %v", got, ok)
+	}
+	if _, ok := Validate(rfcSecret, previous, now, 0); !ok {
+		t.Errorf("previous code was refused")
+	}
+	if _, ok := Validate(rfcSecret, old, now, 0); ok {
+		t.Errorf("code from two periods ago was accepted")
+	}
+	if _, ok := Validate(rfcSecret, code, now, counter); ok {
+		t.Errorf("code was accepted twice")
+	}
+	if _, ok := Validate(rfcSecret, "12345", now, 0); ok {
+		t.Errorf("short code was accepted")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Scaffold", "admin", rfcSecret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Scaffold:admin?") || !strings.Contains(uri, "secret="+rfcSecret) {
+		t.Errorf("unexpected uri %s", uri)
+	}
+}
@@ -0,0 +1,132 @@
+package user
+
+import (
+	"fmt"
+	"scaffold/server/constants"
+	"scaffold/server/ldap"
+	"scaffold/server/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// Copy the details of a directory account onto a user, reporting whether
+// anything changed
+func applyAccount(u *User, a *ldap.Account) bool {
+	groups, roles := ldap.MapGroups(a.Groups)
+	changed := u.Email != a.Email || u.GivenName != a.GivenName || u.FamilyName != a.FamilyName || u.Disabled ||
+		!sameStrings(u.Groups, groups) || !sameStrings(u.Roles, roles)
+
+	u.Email = a.Email
+	u.GivenName = a.GivenName
+	u.FamilyName = a.FamilyName
+	u.Groups = groups
+	u.Roles = roles
+	u.Disabled = false
+	return changed
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// Check a user's password against the directory, creating the user on their
+// first login and refreshing their groups and roles on every login after that
+func verifyLDAPUser(username, password string, u *User) (bool, error) {
+	a, err := ldap.Authenticate(username, password)
+	if err != nil {
+		return false, err
+	}
+
+	if u == nil {
+		logger.Infof("", "Provisioning directory user %s", username)
+		u = &User{
+			Username:  username,
+			Password:  utils.GenerateToken(32),
+			APITokens: []APIToken{},
+			Provider:  constants.USER_PROVIDER_LDAP,
+		}
+		applyAccount(u, a)
+		if err := CreateUser(u); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if applyAccount(u, a) {
+		if err := UpdateUserByUsername(username, u); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Bring every directory user up to date with the directory. Users no longer
+// found there are disabled, and enabled again if they come back
+func SyncLDAPUsers() error {
+	users, err := FilterUsers(bson.M{"provider": constants.USER_PROVIDER_LDAP})
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	conn, err := ldap.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	accounts := make([]*ldap.Account, len(users))
+	found := 0
+	for idx, u := range users {
+		if accounts[idx], err = conn.FindUser(u.Username); err != nil {
+			return fmt.Errorf("cannot look up user %s: %s", u.Username, err.Error())
+		}
+		if accounts[idx] != nil {
+			found++
+		}
+	}
+
+	// A misconfigured base DN or filter finds nobody, which should not lock
+	// everyone out
+	if found == 0 && len(users) > 1 {
+		return fmt.Errorf("none of the %d directory users were found, not disabling them", len(users))
+	}
+
+	for idx, u := range users {
+		a := accounts[idx]
+		if a == nil {
+			if u.Disabled {
+				continue
+			}
+			logger.Infof("", "Disabling user %s as they are no longer in the directory", u.Username)
+			u.Disabled = true
+			if err := DeleteSessionsByUsername(u.Username); err != nil {
+				logger.Errorf("", "Cannot log out directory user %s: %s", u.Username, err.Error())
+			}
+		} else if !applyAccount(u, a) {
+			continue
+		}
+		if err := UpdateUserByUsername(u.Username, u); err != nil {
+			logger.Errorf("", "Cannot update directory user %s: %s", u.Username, err.Error())
+		}
+	}
+	return nil
+}
+
+func RunLDAPSync() {
+	if err := SyncLDAPUsers(); err != nil {
+		logger.Errorf("", "LDAP sync failed: %s", err.Error())
+	}
+}
@@ -0,0 +1,244 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"scaffold/server/mongodb"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// A login session. The cookie holds the token and only its hash is stored, so
+// a session can be looked up directly without keeping the token itself around.
+// A user can have any number of sessions, each one expiring once it has gone
+// unused for the idle timeout or has reached its absolute expiry
+type Session struct {
+	ID        string `json:"id" bson:"id" yaml:"id"`
+	Username  string `json:"username" bson:"username" yaml:"username"`
+	Token     string `json:"-" bson:"token" yaml:"-"`
+	Created   string `json:"created" bson:"created" yaml:"created"`
+	LastSeen  string `json:"last_seen" bson:"last_seen" yaml:"last_seen"`
+	Expires   string `json:"expires" bson:"expires" yaml:"expires"`
+	IP        string `json:"ip" bson:"ip" yaml:"ip"`
+	UserAgent string `json:"user_agent" bson:"user_agent" yaml:"user_agent"`
+	// Whether this is the session the request listing sessions was made with
+	Current bool `json:"current" bson:"-" yaml:"-"`
+}
+
+// Check whether a session has passed its absolute expiry or gone unused for
+// longer than idle. An idle timeout of zero disables it
+func (s *Session) Expired(now time.Time, idle time.Duration) bool {
+	expires, err := time.Parse("2006-01-02T15:04:05Z", s.Expires)
+	if err != nil || !now.Before(expires) {
+		return true
+	}
+	if idle <= 0 {
+		return false
+	}
+	lastSeen, err := time.Parse("2006-01-02T15:04:05Z", s.LastSeen)
+	if err != nil {
+		return true
+	}
+	return now.Sub(lastSeen) > idle
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func sessionIdleTimeout() time.Duration {
+	return time.Duration(config.Config.SessionIdleTimeout) * time.Second
+}
+
+// Start a session for a user and return the token to hand to the browser
+func CreateSession(username, ip, userAgent string) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	s := &Session{
+		ID:        uuid.New().String(),
+		Username:  username,
+		Token:     hashSessionToken(token),
+		Created:   now.Format("2006-01-02T15:04:05Z"),
+		LastSeen:  now.Format("2006-01-02T15:04:05Z"),
+		Expires:   now.Add(time.Duration(config.Config.SessionAbsoluteTimeout) * time.Second).Format("2006-01-02T15:04:05Z"),
+		IP:        ip,
+		UserAgent: userAgent,
+	}
+
+	if _, err := mongodb.Collections[constants.MONGODB_SESSION_COLLECTION_NAME].InsertOne(mongodb.Ctx, s); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Find the session a token belongs to. Expired sessions are removed and
+// refused, and live ones have their last seen time updated
+func GetSessionByToken(token string) (*Session, error) {
+	if token == "" {
+		return nil, errors.New("invalid login token")
+	}
+
+	sessions, err := FilterSessions(bson.M{"token": hashSessionToken(token)})
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, errors.New("no session found with login token")
+	}
+	s := sessions[0]
+
+	now := time.Now().UTC()
+	if s.Expired(now, sessionIdleTimeout()) {
+		if err := DeleteSessionByID(s.Username, s.ID); err != nil {
+			logger.Errorf("", "Cannot delete expired session %s: %s", s.ID, err.Error())
+		}
+		return nil, fmt.Errorf("session %s has expired", s.ID)
+	}
+	touchSession(s, now)
+	return s, nil
+}
+
+// Record when a session was last used, at most once every LAST_USED_INTERVAL
+func touchSession(s *Session, now time.Time) {
+	if last, err := time.Parse("2006-01-02T15:04:05Z", s.LastSeen); err == nil && now.Sub(last) < LAST_USED_INTERVAL {
+		return
+	}
+	s.LastSeen = now.Format("2006-01-02T15:04:05Z")
+
+	filter := bson.M{"id": s.ID}
+	update := bson.M{"$set": bson.M{"last_seen": s.LastSeen}}
+	if _, err := mongodb.Collections[constants.MONGODB_SESSION_COLLECTION_NAME].UpdateOne(mongodb.Ctx, filter, update); err != nil {
+		logger.Errorf("", "Cannot record use of session %s: %s", s.ID, err.Error())
+	}
+}
+
+func DeleteSessionByToken(token string) error {
+	filter := bson.M{"token": hashSessionToken(token)}
+
+	collection := mongodb.Collections[constants.MONGODB_SESSION_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return errors.New("no session found with login token")
+	}
+
+	return nil
+}
+
+func DeleteSessionByID(username, id string) error {
+	filter := bson.M{"username": username, "id": id}
+
+	collection := mongodb.Collections[constants.MONGODB_SESSION_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no session found with id %s for user %s", id, username)
+	}
+
+	return nil
+}
+
+// Log a user out everywhere
+func DeleteSessionsByUsername(username string) error {
+	filter := bson.M{"username": username}
+
+	_, err := mongodb.Collections[constants.MONGODB_SESSION_COLLECTION_NAME].DeleteMany(mongodb.Ctx, filter)
+
+	return err
+}
+
+// Get the live sessions of a user, most recently used first
+func GetSessionsByUsername(username string) ([]*Session, error) {
+	filter := bson.M{"username": username}
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen", Value: -1}})
+
+	sessions, err := FilterSessions(filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	live := []*Session{}
+	for _, s := range sessions {
+		if !s.Expired(now, sessionIdleTimeout()) {
+			live = append(live, s)
+		}
+	}
+	return live, nil
+}
+
+// Remove every session which has expired
+func PruneSessions() {
+	sessions, err := FilterSessions(bson.D{{}})
+	if err != nil {
+		logger.Errorf("", "Cannot get sessions: %s", err.Error())
+		return
+	}
+	now := time.Now().UTC()
+	for _, s := range sessions {
+		if !s.Expired(now, sessionIdleTimeout()) {
+			continue
+		}
+		if err := DeleteSessionByID(s.Username, s.ID); err != nil {
+			logger.Errorf("", "Cannot delete session %s: %s", s.ID, err.Error())
+		}
+	}
+}
+
+func FilterSessions(filter interface{}, opts ...*options.FindOptions) ([]*Session, error) {
+	// A slice of sessions for storing the decoded documents
+	var sessions []*Session
+
+	collection := mongodb.Collections[constants.MONGODB_SESSION_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return sessions, err
+	}
+
+	for cur.Next(ctx) {
+		var s Session
+		err := cur.Decode(&s)
+		if err != nil {
+			return sessions, err
+		}
+
+		sessions = append(sessions, &s)
+	}
+
+	if err := cur.Err(); err != nil {
+		return sessions, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return sessions, nil
+}
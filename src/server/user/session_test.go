@@ -0,0 +1,29 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionExpired(t *testing.T) {
+	format := "2006-01-02T15:04:05Z"
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		lastSeen string
+		expires  string
+		idle     time.Duration
+		want     bool
+	}{
+		{now.Add(-time.Minute).Format(format), now.Add(time.Hour).Format(format), time.Hour, false},
+		{now.Add(-2 * time.Hour).Format(format), now.Add(time.Hour).Format(format), time.Hour, true},
+		{now.Add(-2 * time.Hour).Format(format), now.Add(time.Hour).Format(format), 0, false},
+		{now.Add(-time.Minute).Format(format), now.Add(-time.Second).Format(format), time.Hour, true},
+		{now.Add(-time.Minute).Format(format), "", time.Hour, true},
+	}
+	for _, c := range cases {
+		s := Session{LastSeen: c.lastSeen, Expires: c.expires}
+		if got := s.Expired(now, c.idle); got != c.want {
+			t.Errorf("last seen %q, expires %q, idle %s: got %v, want %v", c.lastSeen, c.expires, c.idle, got, c.want)
+		}
+	}
+}
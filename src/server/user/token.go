@@ -0,0 +1,192 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"scaffold/server/constants"
+	"scaffold/server/mongodb"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+
+	logger "github.com/jfcarter2358/go-logger"
+)
+
+// How often the last used time of a token is written back
+const LAST_USED_INTERVAL = time.Minute
+
+// An API token. Tokens are handed out as `scaffold_<id>_<secret>` and only a
+// hash of the secret is kept. A scope limits a token to reading or to
+// triggering and killing runs, and workflows limit it to the workflows
+// matching the given globs. Tokens without either can do anything their user
+// can
+type APIToken struct {
+	Name      string   `json:"name" bson:"name" yaml:"name"`
+	ID        string   `json:"id" bson:"id" yaml:"id"`
+	Token     string   `json:"token" bson:"token" yaml:"token"`
+	Scope     string   `json:"scope" bson:"scope" yaml:"scope"`
+	Workflows []string `json:"workflows" bson:"workflows" yaml:"workflows"`
+	Created   string   `json:"created" bson:"created" yaml:"created"`
+	Expires   string   `json:"expires" bson:"expires" yaml:"expires"`
+	LastUsed  string   `json:"last_used" bson:"last_used" yaml:"last_used"`
+}
+
+// Check whether a token is limited to less than its user can do
+func (t *APIToken) Restricted() bool {
+	return t.Scope != "" || len(t.Workflows) > 0
+}
+
+func (t *APIToken) Expired() bool {
+	if t.Expires == "" {
+		return false
+	}
+	expires, err := time.Parse("2006-01-02T15:04:05Z", t.Expires)
+	if err != nil {
+		return true
+	}
+	return time.Now().UTC().After(expires)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Split a token into its ID and secret. Tokens issued before IDs were added
+// have no ID
+func parseAPIToken(apiToken string) (string, string) {
+	if !strings.HasPrefix(apiToken, constants.API_TOKEN_PREFIX) {
+		return "", apiToken
+	}
+	id, secret, found := strings.Cut(strings.TrimPrefix(apiToken, constants.API_TOKEN_PREFIX), "_")
+	if !found {
+		return "", apiToken
+	}
+	return id, secret
+}
+
+// Find the user an API token belongs to along with the token itself. Expired
+// tokens and tokens of disabled users are refused
+func GetAPIToken(apiToken string) (*User, *APIToken, error) {
+	id, secret := parseAPIToken(apiToken)
+
+	var filter interface{} = bson.D{{}}
+	if id != "" {
+		filter = bson.M{"api_tokens.id": id}
+	}
+	users, err := FilterUsers(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, u := range users {
+		if u.Disabled {
+			continue
+		}
+		for idx := range u.APITokens {
+			t := &u.APITokens[idx]
+			if t.ID != id {
+				continue
+			}
+			if err := bcrypt.CompareHashAndPassword([]byte(t.Token), []byte(secret)); err != nil {
+				continue
+			}
+			if t.Expired() {
+				return nil, nil, fmt.Errorf("api token %s of user %s has expired", t.Name, u.Username)
+			}
+			touchAPIToken(u.Username, t)
+			return u, t, nil
+		}
+	}
+
+	return nil, nil, errors.New("no user found with api token")
+}
+
+func GetUserByAPIToken(apiToken string) (*User, error) {
+	u, _, err := GetAPIToken(apiToken)
+	return u, err
+}
+
+// Record when a token was last used, at most once every LAST_USED_INTERVAL
+func touchAPIToken(username string, t *APIToken) {
+	now := time.Now().UTC()
+	if last, err := time.Parse("2006-01-02T15:04:05Z", t.LastUsed); err == nil && now.Sub(last) < LAST_USED_INTERVAL {
+		return
+	}
+	t.LastUsed = now.Format("2006-01-02T15:04:05Z")
+
+	filter := bson.M{"username": username, "api_tokens.name": t.Name}
+	update := bson.M{"$set": bson.M{"api_tokens.$.last_used": t.LastUsed}}
+	if _, err := mongodb.Collections[constants.MONGODB_USER_COLLECTION_NAME].UpdateOne(mongodb.Ctx, filter, update); err != nil {
+		logger.Errorf("", "Cannot record use of api token %s: %s", t.Name, err.Error())
+	}
+}
+
+// Issue a token for a user with the name, scope, workflows, and expiry of t.
+// A token with the same name is replaced. The token is returned in full only
+// here
+func GenerateAPIToken(username string, t *APIToken) (string, error) {
+	u, err := GetUserByUsername(username)
+	if err != nil {
+		return "", err
+	}
+	if u == nil {
+		return "", fmt.Errorf("no user found with username %s", username)
+	}
+
+	id, err := randomHex(6)
+	if err != nil {
+		return "", err
+	}
+	secret, err := randomHex(20)
+	if err != nil {
+		return "", err
+	}
+	hashedSecret, err := HashAndSalt([]byte(secret))
+	if err != nil {
+		return "", err
+	}
+
+	t.ID = id
+	t.Token = hashedSecret
+	t.Created = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	t.LastUsed = ""
+	if t.Workflows == nil {
+		t.Workflows = []string{}
+	}
+
+	tokens := []APIToken{}
+	for _, existing := range u.APITokens {
+		if existing.Name != t.Name {
+			tokens = append(tokens, existing)
+		}
+	}
+	u.APITokens = append(tokens, *t)
+
+	err = UpdateUserByUsername(username, u)
+	return constants.API_TOKEN_PREFIX + id + "_" + secret, err
+}
+
+func RevokeAPIToken(username, name string) error {
+	u, err := GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	for idx, apiToken := range u.APITokens {
+		if apiToken.Name == name {
+			u.APITokens = append(u.APITokens[:idx], u.APITokens[idx+1:]...)
+			break
+		}
+	}
+
+	err = UpdateUserByUsername(username, u)
+	return err
+}
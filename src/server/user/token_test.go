@@ -0,0 +1,43 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAPIToken(t *testing.T) {
+	cases := []struct {
+		token  string
+		id     string
+		secret string
+	}{
+		{"scaffold_0a1b2c3d4e5f_deadbeef", "0a1b2c3d4e5f", "deadbeef"},
+		{"1f2e3d4c5b6a7988", "", "1f2e3d4c5b6a7988"},
+		{"scaffold_nosecret", "", "scaffold_nosecret"},
+	}
+	for _, c := range cases {
+		id, secret := parseAPIToken(c.token)
+		if id != c.id || secret != c.secret {
+			t.Errorf("%s parsed to %q, %q, want %q, %q", c.token, id, secret, c.id, c.secret)
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	format := "2006-01-02T15:04:05Z"
+	cases := []struct {
+		expires string
+		want    bool
+	}{
+		{"", false},
+		{time.Now().UTC().Add(time.Hour).Format(format), false},
+		{time.Now().UTC().Add(-time.Hour).Format(format), true},
+		{"not a time", true},
+	}
+	for _, c := range cases {
+		tok := APIToken{Expires: c.expires}
+		if got := tok.Expired(); got != c.want {
+			t.Errorf("expires %q: got %v, want %v", c.expires, got, c.want)
+		}
+	}
+}
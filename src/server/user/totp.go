@@ -0,0 +1,195 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"scaffold/server/config"
+	"scaffold/server/constants"
+	"scaffold/server/mongodb"
+	"scaffold/server/totp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// How many recovery codes a user gets when setting up a second factor
+const RECOVERY_CODE_COUNT = 10
+
+// A second factor being set up, returned in full only when enrollment starts
+type TOTPEnrollment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Check whether a user can have a second factor. Users logging in through
+// single sign-on or a directory get theirs from there, and service accounts
+// cannot log in at all
+func (u *User) TOTPAllowed() bool {
+	return u.Provider == "" && !u.ServiceAccount
+}
+
+// Check whether a user has to give a code when logging in
+func (u *User) HasTOTP() bool {
+	return u.TOTPAllowed() && u.TOTPEnabled && u.TOTPSecret != ""
+}
+
+// Check whether a user has to set up a second factor before they can log in
+func (u *User) NeedsTOTP() bool {
+	return config.Config.TOTP.Required && u.TOTPAllowed() && !u.HasTOTP()
+}
+
+// Generate a secret and recovery codes for a user to set up. The hashes of the
+// recovery codes are kept and the codes themselves only handed out here
+func NewTOTPEnrollment(username string) (*TOTPEnrollment, []string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e := &TOTPEnrollment{
+		Secret:        secret,
+		URI:           totp.URI(config.Config.TOTP.Issuer, username, secret),
+		RecoveryCodes: []string{},
+	}
+	hashes := []string{}
+	for i := 0; i < RECOVERY_CODE_COUNT; i++ {
+		code, err := randomHex(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		code = code[:5] + "-" + code[5:]
+		hash, err := HashAndSalt([]byte(code))
+		if err != nil {
+			return nil, nil, err
+		}
+		e.RecoveryCodes = append(e.RecoveryCodes, code)
+		hashes = append(hashes, hash)
+	}
+	return e, hashes, nil
+}
+
+// Start setting up a second factor for a user. It is not asked for until
+// EnableTOTP is called with a code from it
+func BeginTOTPEnrollment(username string) (*TOTPEnrollment, error) {
+	u, err := GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("no user found with username %s", username)
+	}
+	if !u.TOTPAllowed() {
+		return nil, fmt.Errorf("user %s cannot use two-factor authentication", username)
+	}
+	if u.HasTOTP() {
+		return nil, fmt.Errorf("user %s already has two-factor authentication set up", username)
+	}
+
+	e, hashes, err := NewTOTPEnrollment(username)
+	if err != nil {
+		return nil, err
+	}
+	if err := setTOTP(username, bson.M{"totp_enabled": false, "totp_secret": e.Secret, "totp_counter": int64(0), "recovery_codes": hashes}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Finish setting up a second factor once the user has shown they can generate
+// codes for it
+func EnableTOTP(username, code string) error {
+	u, err := GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("no user found with username %s", username)
+	}
+	if u.HasTOTP() {
+		return fmt.Errorf("user %s already has two-factor authentication set up", username)
+	}
+	if u.TOTPSecret == "" {
+		return fmt.Errorf("user %s has not started setting up two-factor authentication", username)
+	}
+	return CompleteTOTPEnrollment(username, u.TOTPSecret, u.RecoveryCodes, code)
+}
+
+// Turn on a second factor with the given secret and recovery code hashes if
+// the code is valid for the secret
+func CompleteTOTPEnrollment(username, secret string, recoveryCodes []string, code string) error {
+	counter, ok := totp.Validate(secret, code, time.Now(), 0)
+	if !ok {
+		return errors.New("invalid two-factor code")
+	}
+	return setTOTP(username, bson.M{"totp_enabled": true, "totp_secret": secret, "totp_counter": counter, "recovery_codes": recoveryCodes})
+}
+
+// Remove a user's second factor, such as when they have lost it
+func ResetTOTP(username string) error {
+	return setTOTP(username, bson.M{"totp_enabled": false, "totp_secret": "", "totp_counter": int64(0), "recovery_codes": []string{}})
+}
+
+// Check a code from a user's authenticator app or one of their recovery codes.
+// Each code only works once, and used recovery codes are removed
+func VerifyTOTP(u *User, code string) (bool, error) {
+	if !u.HasTOTP() {
+		return false, fmt.Errorf("user %s does not have two-factor authentication set up", u.Username)
+	}
+	code = strings.TrimSpace(code)
+
+	if counter, ok := totp.Validate(u.TOTPSecret, code, time.Now(), u.TOTPCounter); ok {
+		u.TOTPCounter = counter
+		return true, setTOTP(u.Username, bson.M{"totp_counter": counter})
+	}
+
+	for idx, hash := range u.RecoveryCodes {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)); err != nil {
+			continue
+		}
+		u.RecoveryCodes = append(u.RecoveryCodes[:idx], u.RecoveryCodes[idx+1:]...)
+		return true, setTOTP(u.Username, bson.M{"recovery_codes": u.RecoveryCodes})
+	}
+	return false, nil
+}
+
+func setTOTP(username string, fields bson.M) error {
+	fields["updated"] = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	filter := bson.M{"username": username}
+	update := bson.M{"$set": fields}
+	result, err := mongodb.Collections[constants.MONGODB_USER_COLLECTION_NAME].UpdateOne(mongodb.Ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount != 1 {
+		return fmt.Errorf("no user found with username %s", username)
+	}
+	return nil
+}
+
+// Check the password of a request using basic auth. Users with a second factor
+// have to give a code along with their password, and users who still have to
+// set one up cannot use basic auth at all
+func VerifyBasicAuth(username, password, code string) (bool, error) {
+	verified, err := VerifyUser(username, password)
+	if err != nil || !verified {
+		return verified, err
+	}
+	u, err := GetUserByUsername(username)
+	if err != nil {
+		return false, err
+	}
+	if u == nil {
+		return true, nil
+	}
+	if u.NeedsTOTP() {
+		return false, fmt.Errorf("user %s has to set up two-factor authentication", username)
+	}
+	if u.HasTOTP() {
+		return VerifyTOTP(u, code)
+	}
+	return true, nil
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"scaffold/server/config"
 	"scaffold/server/constants"
-	"scaffold/server/utils"
+	"scaffold/server/ldap"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -26,16 +26,19 @@ type User struct {
 	ResetTokenCreated string     `json:"reset_token_created" bson:"reset_token_created" yaml:"reset_token_created"`
 	Created           string     `json:"created" bson:"created" yaml:"created"`
 	Updated           string     `json:"updated" bson:"updated" yaml:"updated"`
-	LoginToken        string     `json:"login_token" bson:"login_token" yaml:"login_token"`
 	APITokens         []APIToken `json:"api_tokens" bson:"api_tokens" yaml:"api_tokens"`
 	Groups            []string   `json:"groups" bson:"groups" yaml:"groups"`
 	Roles             []string   `json:"roles" bson:"roles" yaml:"roles"`
-}
-
-type APIToken struct {
-	Name    string `json:"name" bson:"name" yaml:"name"`
-	Token   string `json:"token" bson:"token" yaml:"token"`
-	Created string `json:"created" bson:"created" yaml:"created"`
+	Provider          string     `json:"provider" bson:"provider" yaml:"provider"`
+	Disabled          bool       `json:"disabled" bson:"disabled" yaml:"disabled"`
+	// Service accounts have no password and can only use their API tokens
+	ServiceAccount bool `json:"service_account" bson:"service_account" yaml:"service_account"`
+	// The second factor of a local user. The secret is set while enrolling so
+	// the first code can be checked, and is only asked for once enabled
+	TOTPEnabled   bool     `json:"totp_enabled" bson:"totp_enabled" yaml:"totp_enabled"`
+	TOTPSecret    string   `json:"-" bson:"totp_secret" yaml:"-"`
+	TOTPCounter   int64    `json:"-" bson:"totp_counter" yaml:"-"`
+	RecoveryCodes []string `json:"-" bson:"recovery_codes" yaml:"-"`
 }
 
 func CreateUser(u *User) error {
@@ -51,13 +54,16 @@ func CreateUser(u *User) error {
 		return fmt.Errorf("user already exists with username %s", u.Username)
 	}
 
-	password, err := HashAndSalt([]byte(u.Password))
-	if err != nil {
-		return err
+	if u.ServiceAccount {
+		u.Password = ""
+	} else {
+		password, err := HashAndSalt([]byte(u.Password))
+		if err != nil {
+			return err
+		}
+		u.Password = password
 	}
 
-	u.Password = password
-
 	_, err = mongodb.Collections[constants.MONGODB_USER_COLLECTION_NAME].InsertOne(mongodb.Ctx, u)
 	return err
 }
@@ -121,27 +127,6 @@ func GetUserByUsername(username string) (*User, error) {
 	return users[0], nil
 }
 
-func GetUserByAPIToken(apiToken string) (*User, error) {
-	// filter := bson.M{"api_tokens": bson.M{"token": apiToken}}
-
-	filter := bson.D{{}}
-	users, err := FilterUsers(filter)
-
-	if err != nil {
-		return nil, err
-	}
-
-	for _, u := range users {
-		for _, t := range u.APITokens {
-			if err := bcrypt.CompareHashAndPassword([]byte(t.Token), []byte(apiToken)); err == nil {
-				return u, nil
-			}
-		}
-	}
-
-	return nil, fmt.Errorf("no user found with api token %s", apiToken)
-}
-
 func GetUserByEmail(email string) (*User, error) {
 	filter := bson.M{"email": email}
 
@@ -162,45 +147,23 @@ func GetUserByEmail(email string) (*User, error) {
 	return users[0], nil
 }
 
+// Find the user a login session token belongs to. Sessions of disabled users
+// are refused
 func GetUserByLoginToken(loginToken string) (*User, error) {
-	/*
-		if loginToken == "" {
-			return nil, fmt.Errorf("invalid login token")
-		}
-
-		filter := bson.M{"login_token": loginToken}
-
-		users, err := FilterUsers(filter)
-
-		if err != nil {
-			return nil, err
-		}
-
-		if len(users) == 0 {
-			return nil, fmt.Errorf("no user found with login token %s", loginToken)
-		}
-
-		if len(users) > 1 {
-			return nil, fmt.Errorf("multiple users found with login token %s", loginToken)
-		}
-
-		return users[0], nil
-	*/
-
-	filter := bson.D{{}}
-	users, err := FilterUsers(filter)
-
+	s, err := GetSessionByToken(loginToken)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, u := range users {
-		if err := bcrypt.CompareHashAndPassword([]byte(u.LoginToken), []byte(loginToken)); err == nil {
-			return u, nil
-		}
+	u, err := GetUserByUsername(s.Username)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || u.Disabled {
+		return nil, fmt.Errorf("no user found with login token")
 	}
 
-	return nil, fmt.Errorf("no user found with login token %s", loginToken)
+	return u, nil
 }
 
 func GetUserByResetToken(resetToken string) (*User, error) {
@@ -240,49 +203,6 @@ func GetUserByResetToken(resetToken string) (*User, error) {
 	return nil, fmt.Errorf("no user found with reset token %s", resetToken)
 }
 
-func GenerateAPIToken(username, name string) (string, error) {
-	token := utils.GenerateToken(32)
-	currentTime := time.Now().UTC()
-
-	hashedToken, err := HashAndSalt([]byte(token))
-	if err != nil {
-		return "", err
-	}
-
-	apiToken := APIToken{
-		Name:    name,
-		Token:   hashedToken,
-		Created: currentTime.Format("2006-01-02T15:04:05Z"),
-	}
-
-	u, err := GetUserByUsername(username)
-	if err != nil {
-		return "", err
-	}
-
-	u.APITokens = append(u.APITokens, apiToken)
-
-	err = UpdateUserByUsername(username, u)
-	return token, err
-}
-
-func RevokeAPIToken(username, name string) error {
-	u, err := GetUserByUsername(username)
-	if err != nil {
-		return err
-	}
-
-	for idx, apiToken := range u.APITokens {
-		if apiToken.Name == name {
-			u.APITokens = append(u.APITokens[:idx], u.APITokens[idx+1:]...)
-			break
-		}
-	}
-
-	err = UpdateUserByUsername(username, u)
-	return err
-}
-
 func UpdateUserByUsername(username string, u *User) error {
 	filter := bson.M{"username": username}
 
@@ -357,7 +277,6 @@ func VerifyAdmin() error {
 		Email:             config.Config.Admin.Email,
 		ResetToken:        "",
 		ResetTokenCreated: "",
-		LoginToken:        "",
 		APITokens:         []APIToken{},
 		Groups:            []string{"admin"},
 		Roles:             []string{"admin"},
@@ -388,10 +307,28 @@ func VerifyUser(username, password string) (bool, error) {
 		return false, err
 	}
 
+	if u != nil && u.Disabled {
+		return false, fmt.Errorf("user %s is disabled", username)
+	}
+	if u != nil && u.ServiceAccount {
+		return false, fmt.Errorf("user %s is a service account", username)
+	}
+
+	// Directory users are checked against the directory, unknown users may be
+	// in the directory too
+	if ldap.Enabled() && (u == nil || u.Provider == constants.USER_PROVIDER_LDAP) {
+		return verifyLDAPUser(username, password, u)
+	}
+
 	if u == nil {
 		return false, fmt.Errorf("no user found that matches credentials")
 	}
 
+	// Users provisioned by single sign-on or a directory have no usable password
+	if u.Provider != "" {
+		return false, fmt.Errorf("user %s logs in with %s", username, u.Provider)
+	}
+
 	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	if err != nil {
 		return false, err
@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"scaffold/server/constants"
+	"scaffold/server/input"
+	"scaffold/server/secret"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"scaffold/server/mongodb"
+)
+
+// How many deliveries are kept for each webhook
+const DELIVERY_RETENTION = 100
+
+// How much of a payload is kept in the delivery log
+const DELIVERY_PAYLOAD_LIMIT = 64 * 1024
+
+// A call received by a webhook and what came of it
+type Delivery struct {
+	ID       string            `json:"id" bson:"id" yaml:"id"`
+	Webhook  string            `json:"webhook" bson:"webhook" yaml:"webhook"`
+	Workflow string            `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Event    string            `json:"event" bson:"event" yaml:"event"`
+	Status   string            `json:"status" bson:"status" yaml:"status"`
+	Reason   string            `json:"reason" bson:"reason" yaml:"reason"`
+	RunID    string            `json:"run_id" bson:"run_id" yaml:"run_id"`
+	Context  map[string]string `json:"context" bson:"context" yaml:"context"`
+	Payload  string            `json:"payload" bson:"payload" yaml:"payload"`
+	Received string            `json:"received" bson:"received" yaml:"received"`
+}
+
+// Keep the values mapped from a payload in the delivery log, masking those
+// that override secret inputs. The payload they came from is not kept then
+func SetContext(d *Delivery, data map[string]string, is []input.Input) {
+	d.Context = map[string]string{}
+	for key, val := range data {
+		d.Context[key] = val
+	}
+	for _, i := range is {
+		if _, ok := d.Context[i.Name]; ok && i.Type == constants.INPUT_TYPE_SECRET {
+			d.Context[i.Name] = secret.MASK
+			d.Payload = ""
+		}
+	}
+}
+
+// Store a delivery and drop the oldest ones beyond the retention limit
+func RecordDelivery(d *Delivery) error {
+	d.ID = uuid.New().String()
+	d.Received = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	if len(d.Payload) > DELIVERY_PAYLOAD_LIMIT {
+		d.Payload = d.Payload[:DELIVERY_PAYLOAD_LIMIT]
+	}
+
+	collection := mongodb.Collections[constants.MONGODB_WEBHOOK_DELIVERY_COLLECTION_NAME]
+	if _, err := collection.InsertOne(mongodb.Ctx, d); err != nil {
+		return err
+	}
+
+	filter := bson.M{"workflow": d.Workflow, "webhook": d.Webhook}
+	opts := options.Find().SetSort(bson.D{{Key: "received", Value: -1}, {Key: "_id", Value: -1}}).SetSkip(DELIVERY_RETENTION)
+	old, err := FilterDeliveries(filter, opts)
+	if err != nil {
+		return err
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	ids := make([]string, len(old))
+	for idx, o := range old {
+		ids[idx] = o.ID
+	}
+	_, err = collection.DeleteMany(mongodb.Ctx, bson.M{"id": bson.M{"$in": ids}})
+	return err
+}
+
+func DeleteDeliveriesByNames(workflow, name string) error {
+	filter := bson.M{"workflow": workflow, "webhook": name}
+
+	_, err := mongodb.Collections[constants.MONGODB_WEBHOOK_DELIVERY_COLLECTION_NAME].DeleteMany(mongodb.Ctx, filter)
+	return err
+}
+
+// Get the deliveries of a webhook, newest first
+func GetDeliveriesByNames(workflow, name string) ([]*Delivery, error) {
+	filter := bson.M{"workflow": workflow, "webhook": name}
+	opts := options.Find().SetSort(bson.D{{Key: "received", Value: -1}, {Key: "_id", Value: -1}})
+
+	return FilterDeliveries(filter, opts)
+}
+
+func FilterDeliveries(filter interface{}, opts ...*options.FindOptions) ([]*Delivery, error) {
+	// A slice of deliveries for storing the decoded documents
+	var deliveries []*Delivery
+
+	collection := mongodb.Collections[constants.MONGODB_WEBHOOK_DELIVERY_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return deliveries, err
+	}
+
+	for cur.Next(ctx) {
+		var d Delivery
+		err := cur.Decode(&d)
+		if err != nil {
+			return deliveries, err
+		}
+
+		deliveries = append(deliveries, &d)
+	}
+
+	if err := cur.Err(); err != nil {
+		return deliveries, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return deliveries, nil
+}
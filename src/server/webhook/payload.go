@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// A child or index selector of a JSONPath
+type selector struct {
+	key   string
+	index int
+}
+
+// Parse a JSONPath such as `$.repository.name`, `$.commits[0].id`, or
+// `$['head_commit']['id']`. Only child and index selectors are supported
+func parsePath(path string) ([]selector, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path %s does not start with $", path)
+	}
+	selectors := []selector{}
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %s has an empty key", path)
+			}
+			selectors = append(selectors, selector{key: rest[:end], index: -1})
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("path %s has an unclosed [", path)
+			}
+			sel := rest[1:end]
+			rest = rest[end+1:]
+			if unquoted, err := strconv.Unquote(strings.ReplaceAll(sel, "'", "\"")); err == nil {
+				selectors = append(selectors, selector{key: unquoted, index: -1})
+			} else if i, err := strconv.Atoi(sel); err == nil && i >= 0 {
+				selectors = append(selectors, selector{index: i})
+			} else {
+				return nil, fmt.Errorf("path %s has an invalid selector [%s]", path, sel)
+			}
+		default:
+			return nil, fmt.Errorf("path %s is invalid at %s", path, rest)
+		}
+	}
+	return selectors, nil
+}
+
+// Look up a value in a decoded JSON payload with a JSONPath, reporting whether
+// the value exists
+func Lookup(payload interface{}, path string) (interface{}, bool, error) {
+	selectors, err := parsePath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	v := payload
+	for _, sel := range selectors {
+		if sel.index >= 0 {
+			list, ok := v.([]interface{})
+			if !ok || sel.index >= len(list) {
+				return nil, false, nil
+			}
+			v = list[sel.index]
+			continue
+		}
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false, nil
+		}
+		if v, ok = obj[sel.key]; !ok {
+			return nil, false, nil
+		}
+	}
+	return v, true, nil
+}
+
+// Get the string form of a payload value. Strings are used as is, anything
+// else is JSON encoded
+func stringify(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	if v == nil {
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+type filter struct {
+	path  string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+var filterOperators = []string{"==", "!=", "=~"}
+
+// Parse a filter of the form `<path> <op> <value>` where op is `==`, `!=`, or
+// `=~` for a regular expression. A filter that is just a path passes when the
+// value exists and is not false, null, or empty
+func parseFilter(expr string) (*filter, error) {
+	f := &filter{path: strings.TrimSpace(expr)}
+	for _, op := range filterOperators {
+		if path, value, found := strings.Cut(expr, " "+op+" "); found {
+			f.path = strings.TrimSpace(path)
+			f.op = op
+			f.value = strings.TrimSpace(value)
+			if unquoted, err := strconv.Unquote(f.value); err == nil {
+				f.value = unquoted
+			} else if len(f.value) > 1 && f.value[0] == '\'' && f.value[len(f.value)-1] == '\'' {
+				f.value = f.value[1 : len(f.value)-1]
+			}
+			break
+		}
+	}
+	if f.op == "=~" {
+		re, err := regexp.Compile(f.value)
+		if err != nil {
+			return nil, err
+		}
+		f.re = re
+	}
+	if _, err := parsePath(f.path); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Check a payload against every filter of a webhook, returning the first one
+// that does not pass
+func Filter(h *Webhook, payload interface{}) (string, error) {
+	for _, expr := range h.Filters {
+		f, err := parseFilter(expr)
+		if err != nil {
+			return "", err
+		}
+		v, found, err := Lookup(payload, f.path)
+		if err != nil {
+			return "", err
+		}
+		s := stringify(v)
+		passed := false
+		switch f.op {
+		case "==":
+			passed = found && s == f.value
+		case "!=":
+			passed = !found || s != f.value
+		case "=~":
+			passed = found && f.re.MatchString(s)
+		default:
+			passed = found && s != "" && s != "false"
+		}
+		if !passed {
+			return expr, nil
+		}
+	}
+	return "", nil
+}
+
+func validateMapping(expr string) error {
+	if strings.HasPrefix(expr, "$") {
+		_, err := parsePath(expr)
+		return err
+	}
+	_, err := template.New("mapping").Parse(expr)
+	return err
+}
+
+// Build the run context from a payload. Mappings starting with `$` are
+// JSONPaths, anything else is a Go template rendered with the payload
+func Map(h *Webhook, payload interface{}) (map[string]string, error) {
+	context := map[string]string{}
+	for key, expr := range h.Mapping {
+		if strings.HasPrefix(expr, "$") {
+			v, _, err := Lookup(payload, expr)
+			if err != nil {
+				return nil, err
+			}
+			context[key] = stringify(v)
+			continue
+		}
+		t, err := template.New(key).Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		if err := t.Execute(&out, payload); err != nil {
+			return nil, fmt.Errorf("mapping %s: %s", key, err.Error())
+		}
+		// Missing keys of a JSON object render as "<no value>"
+		context[key] = strings.ReplaceAll(out.String(), "<no value>", "")
+	}
+	return context, nil
+}
+
+// Decode a request body. An empty body is treated as an empty object
+func Decode(body []byte) (interface{}, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.New("payload is not valid JSON")
+	}
+	return payload, nil
+}
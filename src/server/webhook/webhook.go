@@ -0,0 +1,283 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"scaffold/server/constants"
+	"scaffold/server/secret"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"scaffold/server/mongodb"
+)
+
+// A signed endpoint that triggers a task from an external service such as
+// GitHub or GitLab. The secret is stored encrypted and only returned when the
+// webhook is created
+type Webhook struct {
+	ID         string            `json:"id" bson:"id" yaml:"id"`
+	Name       string            `json:"name" bson:"name" yaml:"name"`
+	Workflow   string            `json:"workflow" bson:"workflow" yaml:"workflow"`
+	Task       string            `json:"task" bson:"task" yaml:"task"`
+	Secret     string            `json:"secret,omitempty" bson:"-" yaml:"secret,omitempty"`
+	Ciphertext string            `json:"-" bson:"ciphertext" yaml:"-"`
+	Verify     string            `json:"verify" bson:"verify" yaml:"verify"`
+	Header     string            `json:"header" bson:"header" yaml:"header"`
+	Mapping    map[string]string `json:"mapping" bson:"mapping" yaml:"mapping"`
+	Filters    []string          `json:"filters" bson:"filters" yaml:"filters"`
+	Created    string            `json:"created" bson:"created" yaml:"created"`
+	Updated    string            `json:"updated" bson:"updated" yaml:"updated"`
+}
+
+var defaultHeaders = map[string]string{
+	constants.WEBHOOK_VERIFY_HMAC_SHA256: "X-Hub-Signature-256",
+	constants.WEBHOOK_VERIFY_TOKEN:       "X-Gitlab-Token",
+}
+
+// Check a webhook and fill in its defaults before it is stored
+func Validate(h *Webhook) error {
+	if h.Name == "" {
+		return errors.New("webhook name is required")
+	}
+	if h.Task == "" {
+		return fmt.Errorf("webhook %s has no task", h.Name)
+	}
+	if h.Verify == "" {
+		h.Verify = constants.WEBHOOK_VERIFY_HMAC_SHA256
+	}
+	if _, ok := defaultHeaders[h.Verify]; !ok {
+		return fmt.Errorf("webhook %s has unknown verify %s", h.Name, h.Verify)
+	}
+	if h.Header == "" {
+		h.Header = defaultHeaders[h.Verify]
+	}
+	for key, val := range h.Mapping {
+		if err := validateMapping(val); err != nil {
+			return fmt.Errorf("webhook %s mapping %s: %s", h.Name, key, err.Error())
+		}
+	}
+	for _, f := range h.Filters {
+		if _, err := parseFilter(f); err != nil {
+			return fmt.Errorf("webhook %s filter %q: %s", h.Name, f, err.Error())
+		}
+	}
+	return nil
+}
+
+// Check the signature or token a request was sent with against the webhook's
+// secret
+func VerifyRequest(h *Webhook, headers http.Header, body []byte) error {
+	key, err := secret.Decrypt(h.Ciphertext)
+	if err != nil {
+		return err
+	}
+	val := headers.Get(h.Header)
+	if val == "" {
+		return fmt.Errorf("request has no %s header", h.Header)
+	}
+	return verify(h.Verify, key, val, body)
+}
+
+func verify(method, key, val string, body []byte) error {
+	switch method {
+	case constants.WEBHOOK_VERIFY_HMAC_SHA256:
+		sig, err := hex.DecodeString(strings.TrimPrefix(val, "sha256="))
+		if err != nil {
+			return errors.New("signature is not hex encoded")
+		}
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(body)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return errors.New("signature does not match")
+		}
+		return nil
+	case constants.WEBHOOK_VERIFY_TOKEN:
+		if subtle.ConstantTimeCompare([]byte(val), []byte(key)) != 1 {
+			return errors.New("token does not match")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown verify %s", method)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Create a webhook with a new ID. A secret is generated when none is given and
+// is left on the webhook so it can be shown once
+func CreateWebhook(h *Webhook) error {
+	if err := Validate(h); err != nil {
+		return err
+	}
+	hh, err := GetWebhookByNames(h.Workflow, h.Name)
+	if err != nil {
+		return fmt.Errorf("error getting webhooks: %s", err.Error())
+	}
+	if hh != nil {
+		return fmt.Errorf("webhook already exists with names %s, %s", h.Workflow, h.Name)
+	}
+
+	if h.ID, err = randomHex(16); err != nil {
+		return err
+	}
+	if h.Secret == "" {
+		if h.Secret, err = randomHex(32); err != nil {
+			return err
+		}
+	}
+	if h.Ciphertext, err = secret.Encrypt(h.Secret); err != nil {
+		return err
+	}
+
+	currentTime := time.Now().UTC()
+	h.Created = currentTime.Format("2006-01-02T15:04:05Z")
+	h.Updated = currentTime.Format("2006-01-02T15:04:05Z")
+
+	_, err = mongodb.Collections[constants.MONGODB_WEBHOOK_COLLECTION_NAME].InsertOne(mongodb.Ctx, h)
+	return err
+}
+
+func DeleteWebhookByNames(workflow, name string) error {
+	filter := bson.M{"workflow": workflow, "name": name}
+
+	collection := mongodb.Collections[constants.MONGODB_WEBHOOK_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	result, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return fmt.Errorf("no webhook found with names %s, %s", workflow, name)
+	}
+
+	return DeleteDeliveriesByNames(workflow, name)
+}
+
+func GetWebhooksByWorkflow(workflow string) ([]*Webhook, error) {
+	filter := bson.M{"workflow": workflow}
+
+	return FilterWebhooks(filter)
+}
+
+func GetWebhookByNames(workflow, name string) (*Webhook, error) {
+	filter := bson.M{"workflow": workflow, "name": name}
+
+	webhooks, err := FilterWebhooks(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+
+	if len(webhooks) > 1 {
+		return nil, fmt.Errorf("multiple webhooks found with names %s, %s", workflow, name)
+	}
+
+	return webhooks[0], nil
+}
+
+func GetWebhookByID(id string) (*Webhook, error) {
+	filter := bson.M{"id": id}
+
+	webhooks, err := FilterWebhooks(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+
+	if len(webhooks) > 1 {
+		return nil, fmt.Errorf("multiple webhooks found with id %s", id)
+	}
+
+	return webhooks[0], nil
+}
+
+// Replace a webhook's settings, keeping its ID. The secret is only changed
+// when a new one is given
+func UpdateWebhookByNames(workflow, name string, h *Webhook) error {
+	h.Workflow = workflow
+	h.Name = name
+	if err := Validate(h); err != nil {
+		return err
+	}
+
+	existing, err := GetWebhookByNames(workflow, name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return CreateWebhook(h)
+	}
+
+	h.ID = existing.ID
+	h.Ciphertext = existing.Ciphertext
+	if h.Secret != "" {
+		if h.Ciphertext, err = secret.Encrypt(h.Secret); err != nil {
+			return err
+		}
+	}
+	h.Created = existing.Created
+	h.Updated = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	filter := bson.M{"workflow": workflow, "name": name}
+	opts := options.Replace().SetUpsert(true)
+
+	_, err = mongodb.Collections[constants.MONGODB_WEBHOOK_COLLECTION_NAME].ReplaceOne(mongodb.Ctx, filter, h, opts)
+	return err
+}
+
+func FilterWebhooks(filter interface{}) ([]*Webhook, error) {
+	// A slice of webhooks for storing the decoded documents
+	var webhooks []*Webhook
+
+	collection := mongodb.Collections[constants.MONGODB_WEBHOOK_COLLECTION_NAME]
+	ctx := mongodb.Ctx
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return webhooks, err
+	}
+
+	for cur.Next(ctx) {
+		var h Webhook
+		err := cur.Decode(&h)
+		if err != nil {
+			return webhooks, err
+		}
+
+		webhooks = append(webhooks, &h)
+	}
+
+	if err := cur.Err(); err != nil {
+		return webhooks, err
+	}
+
+	// once exhausted, close the cursor
+	cur.Close(ctx)
+
+	return webhooks, nil
+}
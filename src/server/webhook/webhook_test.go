@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"scaffold/server/constants"
+	"scaffold/server/input"
+	"scaffold/server/secret"
+	"testing"
+)
+
+var payload, _ = Decode([]byte(`{
+	"ref": "refs/heads/main",
+	"deleted": false,
+	"repository": {"name": "app", "full_name": "org/app"},
+	"head_commit": {"id": "abc123", "message": "Fix build"},
+	"commits": [{"id": "abc123"}, {"id": "def456"}]
+}`))
+
+func TestLookup(t *testing.T) {
+	for _, tc := range []struct {
+		path  string
+		want  string
+		found bool
+	}{
+		{"$.ref", "refs/heads/main", true},
+		{"$.repository.full_name", "org/app", true},
+		{"$.commits[1].id", "def456", true},
+		{"$['head_commit']['id']", "abc123", true},
+		{"$.deleted", "false", true},
+		{"$.commits[5].id", "", false},
+		{"$.missing.key", "", false},
+	} {
+		v, found, err := Lookup(payload, tc.path)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.path, err.Error())
+		}
+		if found != tc.found || stringify(v) != tc.want {
+			t.Errorf("Lookup(%s) = %q %v, want %q %v", tc.path, stringify(v), found, tc.want, tc.found)
+		}
+	}
+
+	for _, path := range []string{"ref", "$.", "$[unquoted]", "$.a[0"} {
+		if _, _, err := Lookup(payload, path); err == nil {
+			t.Errorf("invalid path %s was accepted", path)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	for _, tc := range []struct {
+		filters []string
+		failed  string
+	}{
+		{[]string{"$.ref == refs/heads/main"}, ""},
+		{[]string{`$.ref == "refs/heads/main"`, "$.repository.name != api"}, ""},
+		{[]string{"$.ref =~ ^refs/tags/"}, "$.ref =~ ^refs/tags/"},
+		{[]string{"$.head_commit"}, ""},
+		{[]string{"$.deleted"}, "$.deleted"},
+		{[]string{"$.ref == refs/heads/main", "$.repository.name == api"}, "$.repository.name == api"},
+	} {
+		h := &Webhook{Filters: tc.filters}
+		failed, err := Filter(h, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed != tc.failed {
+			t.Errorf("Filter(%v) failed on %q, want %q", tc.filters, failed, tc.failed)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	h := &Webhook{Mapping: map[string]string{
+		"SHA":     "$.head_commit.id",
+		"BRANCH":  `{{ .ref | printf "%.11s" }}`,
+		"TITLE":   "{{ .repository.full_name }}@{{ .head_commit.id }}",
+		"MISSING": "{{ .nothing }}",
+	}}
+	context, err := Map(h, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context["SHA"] != "abc123" || context["BRANCH"] != "refs/heads/" || context["TITLE"] != "org/app@abc123" || context["MISSING"] != "" {
+		t.Errorf("unexpected context %v", context)
+	}
+}
+
+func TestSetContext(t *testing.T) {
+	is := []input.Input{
+		{Name: "TOKEN", Type: constants.INPUT_TYPE_SECRET},
+		{Name: "BRANCH", Type: constants.INPUT_TYPE_STRING},
+	}
+	for _, tc := range []struct {
+		data    map[string]string
+		want    map[string]string
+		payload string
+	}{
+		{map[string]string{"BRANCH": "main"}, map[string]string{"BRANCH": "main"}, "{}"},
+		{map[string]string{"BRANCH": "main", "TOKEN": "shh"}, map[string]string{"BRANCH": "main", "TOKEN": secret.MASK}, ""},
+	} {
+		d := &Delivery{Payload: "{}"}
+		SetContext(d, tc.data, is)
+		if !reflect.DeepEqual(d.Context, tc.want) || d.Payload != tc.payload {
+			t.Errorf("SetContext(%v) = %v with payload %q, want %v with payload %q", tc.data, d.Context, d.Payload, tc.want, tc.payload)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("shh"))
+	mac.Write(body)
+	sig := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if err := verify(constants.WEBHOOK_VERIFY_HMAC_SHA256, "shh", sig, body); err != nil {
+		t.Errorf("valid signature was rejected: %s", err.Error())
+	}
+	if err := verify(constants.WEBHOOK_VERIFY_HMAC_SHA256, "other", sig, body); err == nil {
+		t.Errorf("signature with the wrong secret was accepted")
+	}
+	if err := verify(constants.WEBHOOK_VERIFY_HMAC_SHA256, "shh", sig, []byte(`{"ref":"refs/heads/dev"}`)); err == nil {
+		t.Errorf("signature of a different body was accepted")
+	}
+	if err := verify(constants.WEBHOOK_VERIFY_TOKEN, "shh", "shh", body); err != nil {
+		t.Errorf("valid token was rejected: %s", err.Error())
+	}
+	if err := verify(constants.WEBHOOK_VERIFY_TOKEN, "shh", "nope", body); err == nil {
+		t.Errorf("wrong token was accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	h := &Webhook{Name: "push", Task: "build", Mapping: map[string]string{"SHA": "$.after"}, Filters: []string{"$.ref == refs/heads/main"}}
+	if err := Validate(h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Verify != constants.WEBHOOK_VERIFY_HMAC_SHA256 || h.Header != "X-Hub-Signature-256" {
+		t.Errorf("defaults were not set: %s %s", h.Verify, h.Header)
+	}
+
+	for _, h := range []*Webhook{
+		{Name: "push"},
+		{Name: "push", Task: "build", Verify: "md5"},
+		{Name: "push", Task: "build", Mapping: map[string]string{"SHA": "$.a["}},
+		{Name: "push", Task: "build", Filters: []string{"$.ref =~ ("}},
+	} {
+		if err := Validate(h); err == nil {
+			t.Errorf("invalid webhook %+v was accepted", h)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"scaffold/server/constants"
 	"scaffold/server/health"
 	"scaffold/server/msg"
+	"scaffold/server/node"
 	"scaffold/server/run"
 	"scaffold/server/state"
 	"scaffold/server/task"
@@ -24,14 +25,16 @@ var RunQueue []run.Run
 var startTime int64
 
 var JoinKey = ""
-var PrimaryKey = ""
 var ID = ""
 var isRunning = false
 
 func Run() {
 	startTime = time.Now().UTC().Unix()
 
-	ID = uuid.New().String()
+	ID = config.Config.Node.Name
+	if ID == "" {
+		ID = uuid.New().String()
+	}
 
 	go EnsureManagerConnection()
 
@@ -51,7 +54,6 @@ func Run() {
 
 func JoinManager() error {
 	JoinKey = config.Config.Node.JoinKey
-	PrimaryKey = config.Config.Node.PrimaryKey
 
 	obj := auth.NodeJoinObject{
 		Name:     ID,
@@ -76,9 +78,19 @@ func JoinManager() error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
 		return fmt.Errorf("received join status code %d", resp.StatusCode)
 	}
+
+	var joined auth.NodeJoinResponse
+	if err := json.NewDecoder(resp.Body).Decode(&joined); err != nil {
+		return fmt.Errorf("cannot read join response: %s", err.Error())
+	}
+	if joined.Key == "" {
+		return fmt.Errorf("manager did not issue a node key")
+	}
+	node.WorkerKey = joined.Key
 	return nil
 }
 
@@ -98,7 +110,7 @@ func DoPing() int {
 	httpClient := &http.Client{}
 	requestURL := fmt.Sprintf("%s://%s:%d/health/ping/%s", config.Config.Node.ManagerProtocol, config.Config.Node.ManagerHost, config.Config.Node.ManagerPort, ID)
 	req, _ := http.NewRequest("POST", requestURL, nil)
-	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", PrimaryKey))
+	req.Header.Set("Authorization", fmt.Sprintf("X-Scaffold-API %s", node.WorkerKey))
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -0,0 +1,192 @@
+package workflow
+
+import (
+	"fmt"
+	"scaffold/server/input"
+	"scaffold/server/task"
+	"scaffold/server/template"
+	"strings"
+)
+
+// Replace the workflow's `extends` and `uses` references with the tasks and
+// inputs of the templates they point at. The expanded tasks record the template
+// they came from and expanding an already expanded workflow changes nothing
+func Expand(w *Workflow) error {
+	return expand(w, template.GetTemplateByName)
+}
+
+func expand(w *Workflow, lookup func(string) (*template.Template, error)) error {
+	errs := []string{}
+	get := func(name, source string) *template.Template {
+		t, err := lookup(name)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", source, err.Error()))
+			return nil
+		}
+		if t == nil {
+			errs = append(errs, fmt.Sprintf("%s: template %s does not exist", source, name))
+		}
+		return t
+	}
+
+	defined := map[string]bool{}
+	for _, t := range w.Tasks {
+		defined[t.Name] = true
+	}
+	definedInputs := map[string]bool{}
+	for _, i := range w.Inputs {
+		definedInputs[i.Name] = true
+	}
+
+	tasks := []task.Task{}
+	inputs := []input.Input{}
+	addInputs := func(t *template.Template, is []input.Input, only map[string]bool) {
+		for _, i := range is {
+			if definedInputs[i.Name] || (only != nil && !only[i.Name]) {
+				continue
+			}
+			if err := input.ValidateDefinition(&i); err != nil {
+				errs = append(errs, fmt.Sprintf("template %s input %s: %s", t.Name, i.Name, err.Error()))
+			}
+			definedInputs[i.Name] = true
+			inputs = append(inputs, i)
+		}
+	}
+
+	if w.Extends != "" {
+		source := fmt.Sprintf("workflow %s extends", w.Name)
+		if t := get(w.Extends, source); t != nil {
+			rendered, renderedInputs, renderErrs := render(t, w.With, source)
+			errs = append(errs, renderErrs...)
+			for _, tt := range rendered {
+				// Tasks defined in the workflow replace the template's
+				if defined[tt.Name] {
+					continue
+				}
+				tt.Template = t.Name
+				tasks = append(tasks, tt)
+			}
+			addInputs(t, renderedInputs, nil)
+		}
+	}
+
+	for _, wt := range w.Tasks {
+		if wt.Uses == "" {
+			tasks = append(tasks, wt)
+			continue
+		}
+		source := fmt.Sprintf("workflow %s task %s uses", w.Name, wt.Name)
+		name, taskName, _ := strings.Cut(wt.Uses, "/")
+		t := get(name, source)
+		if t == nil {
+			continue
+		}
+		rendered, renderedInputs, renderErrs := render(t, wt.With, source)
+		if len(renderErrs) > 0 {
+			errs = append(errs, renderErrs...)
+			continue
+		}
+
+		var tt *task.Task
+		if taskName == "" {
+			if len(rendered) != 1 {
+				errs = append(errs, fmt.Sprintf("%s template %s which has %d tasks, pick one with %s/<task>", source, name, len(rendered), name))
+				continue
+			}
+			tt = &rendered[0]
+		}
+		for idx := range rendered {
+			if rendered[idx].Name == taskName {
+				tt = &rendered[idx]
+			}
+		}
+		if tt == nil {
+			errs = append(errs, fmt.Sprintf("%s template %s which has no task %s", source, name, taskName))
+			continue
+		}
+
+		// Only the name, schedule, dependencies and variables are taken from
+		// the workflow, everything else comes from the template
+		out := *tt
+		out.Name = wt.Name
+		out.DependsOn = wt.DependsOn
+		if wt.Cron != "" {
+			out.Cron = wt.Cron
+		}
+		out.Env = mergeMaps(out.Env, wt.Env)
+		out.Inputs = mergeMaps(out.Inputs, wt.Inputs)
+		out.Secrets = mergeMaps(out.Secrets, wt.Secrets)
+		out.Uses = ""
+		out.With = nil
+		out.Template = wt.Uses
+		tasks = append(tasks, out)
+
+		used := map[string]bool{}
+		for _, i := range out.Inputs {
+			used[i] = true
+		}
+		addInputs(t, renderedInputs, used)
+	}
+
+	names := map[string]bool{}
+	for _, t := range tasks {
+		if names[t.Name] {
+			errs = append(errs, fmt.Sprintf("workflow %s defines task %s more than once", w.Name, t.Name))
+		}
+		names[t.Name] = true
+	}
+	for _, t := range tasks {
+		if t.Template == "" {
+			continue
+		}
+		for _, dep := range template.Dependencies(&t) {
+			// Tasks in other workflows are resolved when the task runs
+			if !names[dep] && !strings.Contains(dep, "/") {
+				errs = append(errs, fmt.Sprintf("task %s from template %s depends on unknown task %s", t.Name, t.Template, dep))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &template.ValidationError{Errors: errs}
+	}
+
+	w.Tasks = tasks
+	w.Inputs = append(w.Inputs, inputs...)
+	w.Extends = ""
+	w.With = nil
+	return nil
+}
+
+// Render a template with the parameters passed to it, prefixing any errors
+// with where the template is referenced from
+func render(t *template.Template, with map[string]string, source string) ([]task.Task, []input.Input, []string) {
+	params, err := template.Resolve(t, with)
+	if err == nil {
+		var tasks []task.Task
+		var inputs []input.Input
+		tasks, inputs, err = template.Render(t, params)
+		if err == nil {
+			return tasks, inputs, nil
+		}
+	}
+	errs := []string{}
+	for _, e := range err.(*template.ValidationError).Errors {
+		errs = append(errs, fmt.Sprintf("%s: %s", source, e))
+	}
+	return nil, nil, errs
+}
+
+func mergeMaps(base, override map[string]string) map[string]string {
+	if base == nil && override == nil {
+		return nil
+	}
+	out := map[string]string{}
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range override {
+		out[k] = v
+	}
+	return out
+}
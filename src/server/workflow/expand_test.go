@@ -0,0 +1,167 @@
+package workflow
+
+import (
+	"scaffold/server/input"
+	"scaffold/server/task"
+	"scaffold/server/template"
+	"strings"
+	"testing"
+)
+
+var templates = map[string]*template.Template{
+	"docker": {
+		Name: "docker",
+		Params: []template.Param{
+			{Name: "image", Required: true},
+			{Name: "registry", Default: "ghcr.io"},
+		},
+		Inputs: []input.Input{
+			{Name: "tag", Type: "string", Default: "latest"},
+		},
+		Tasks: []task.Task{
+			{Name: "login", Run: "podman login ${{ params.registry }}"},
+			{
+				Name:      "build",
+				Run:       "podman build -t ${{params.registry}}/${{ params.image }}:$TAG .",
+				DependsOn: task.TaskDependsOn{Success: []string{"login"}},
+				Inputs:    map[string]string{"TAG": "tag"},
+				Env:       map[string]string{"CONTEXT": "."},
+			},
+		},
+	},
+	"notify": {
+		Name:  "notify",
+		Tasks: []task.Task{{Name: "send", Run: "echo done", Kind: "container", Image: "alpine"}},
+	},
+}
+
+func lookup(name string) (*template.Template, error) {
+	return templates[name], nil
+}
+
+func TestExpandExtends(t *testing.T) {
+	w := Workflow{
+		Name:    "app",
+		Extends: "docker",
+		With:    map[string]string{"image": "app"},
+		Tasks: []task.Task{
+			{Name: "login", Run: "echo skip"},
+			{Name: "test", Run: "make test", DependsOn: task.TaskDependsOn{Success: []string{"build"}}},
+		},
+	}
+	if err := expand(&w, lookup); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Extends != "" || w.With != nil {
+		t.Errorf("references were not cleared: %q %v", w.Extends, w.With)
+	}
+	if len(w.Tasks) != 3 || w.Tasks[0].Name != "build" || w.Tasks[1].Name != "login" || w.Tasks[2].Name != "test" {
+		t.Fatalf("unexpected tasks: %+v", w.Tasks)
+	}
+	if w.Tasks[0].Run != "podman build -t ghcr.io/app:$TAG ." || w.Tasks[0].Template != "docker" {
+		t.Errorf("build was not rendered: %+v", w.Tasks[0])
+	}
+	if w.Tasks[1].Run != "echo skip" || w.Tasks[1].Template != "" {
+		t.Errorf("login was not overridden: %+v", w.Tasks[1])
+	}
+	if len(w.Inputs) != 1 || w.Inputs[0].Name != "tag" {
+		t.Errorf("unexpected inputs: %+v", w.Inputs)
+	}
+	if templates["docker"].Tasks[1].Run != "podman build -t ${{params.registry}}/${{ params.image }}:$TAG ." {
+		t.Errorf("template was modified")
+	}
+
+	// Expanding again is a no-op
+	before, _ := Definition(&w)
+	if err := expand(&w, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := Definition(&w); after != before {
+		t.Errorf("second expansion changed the workflow:\n%s\n%s", before, after)
+	}
+}
+
+func TestExpandUses(t *testing.T) {
+	w := Workflow{
+		Name: "app",
+		Tasks: []task.Task{
+			{Name: "compile", Run: "make"},
+			{
+				Name:      "image",
+				Uses:      "docker/build",
+				With:      map[string]string{"image": "app", "registry": "quay.io"},
+				DependsOn: task.TaskDependsOn{Success: []string{"compile"}},
+				Env:       map[string]string{"CONTEXT": "src"},
+				Run:       "ignored",
+			},
+			{Name: "notify", Uses: "notify", DependsOn: task.TaskDependsOn{Always: []string{"image"}}},
+		},
+	}
+	if err := expand(&w, lookup); err != nil {
+		t.Fatal(err)
+	}
+
+	image := w.Tasks[1]
+	if image.Name != "image" || image.Template != "docker/build" || image.Uses != "" {
+		t.Errorf("unexpected task: %+v", image)
+	}
+	if image.Run != "podman build -t quay.io/app:$TAG ." {
+		t.Errorf("run was not taken from the template: %s", image.Run)
+	}
+	if len(image.DependsOn.Success) != 1 || image.DependsOn.Success[0] != "compile" {
+		t.Errorf("dependencies were not taken from the workflow: %+v", image.DependsOn)
+	}
+	if image.Env["CONTEXT"] != "src" || image.Inputs["TAG"] != "tag" {
+		t.Errorf("variables were not merged: %v %v", image.Env, image.Inputs)
+	}
+	if w.Tasks[2].Image != "alpine" || w.Tasks[2].Kind != "container" {
+		t.Errorf("single task template was not used: %+v", w.Tasks[2])
+	}
+	if len(w.Inputs) != 1 || w.Inputs[0].Name != "tag" {
+		t.Errorf("inputs used by the task were not added: %+v", w.Inputs)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		w    Workflow
+		want string
+	}{
+		{
+			name: "missing template",
+			w:    Workflow{Name: "app", Extends: "nope"},
+			want: "workflow app extends: template nope does not exist",
+		},
+		{
+			name: "missing parameter",
+			w:    Workflow{Name: "app", Extends: "docker"},
+			want: "workflow app extends: template docker parameter image is required",
+		},
+		{
+			name: "unknown parameter",
+			w:    Workflow{Name: "app", Tasks: []task.Task{{Name: "n", Uses: "notify", With: map[string]string{"to": "me"}}}},
+			want: "workflow app task n uses: template notify has no parameter to",
+		},
+		{
+			name: "ambiguous task",
+			w:    Workflow{Name: "app", Tasks: []task.Task{{Name: "d", Uses: "docker", With: map[string]string{"image": "x"}}}},
+			want: "workflow app task d uses template docker which has 2 tasks",
+		},
+		{
+			name: "missing dependency",
+			w: Workflow{Name: "app", Extends: "docker", With: map[string]string{"image": "x"}, Tasks: []task.Task{
+				{Name: "b", Uses: "docker/build", With: map[string]string{"image": "x"}, DependsOn: task.TaskDependsOn{Success: []string{"missing", "nightly/publish"}}},
+			}},
+			want: "task b from template docker/build depends on unknown task missing",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := expand(&tc.w, lookup)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
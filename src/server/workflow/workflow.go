@@ -2,28 +2,45 @@ package workflow
 
 import (
 	"fmt"
+	"scaffold/server/config"
 	"scaffold/server/constants"
 	"scaffold/server/datastore"
 	"scaffold/server/input"
+	"scaffold/server/notify"
+	"scaffold/server/revision"
 	"scaffold/server/task"
+	"strings"
 	"sync"
 	"time"
 
 	logger "github.com/jfcarter2358/go-logger"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v3"
 
 	"scaffold/server/mongodb"
 )
 
 type Workflow struct {
-	Version string        `json:"version" bson:"version" yaml:"version"`
-	Name    string        `json:"name" bson:"name" yaml:"name"`
-	Inputs  []input.Input `json:"inputs" bson:"inputs" yaml:"inputs"`
-	Tasks   []task.Task   `json:"tasks" bson:"tasks" yaml:"tasks"`
-	Created string        `json:"created" bson:"created" yaml:"created"`
-	Updated string        `json:"updated" bson:"updated" yaml:"updated"`
-	Groups  []string      `json:"groups" bson:"groups" yaml:"groups"`
+	Version string            `json:"version" bson:"version" yaml:"version"`
+	Name    string            `json:"name" bson:"name" yaml:"name"`
+	Inputs  []input.Input     `json:"inputs" bson:"inputs" yaml:"inputs"`
+	Tasks   []task.Task       `json:"tasks" bson:"tasks" yaml:"tasks"`
+	Created string            `json:"created" bson:"created" yaml:"created"`
+	Updated string            `json:"updated" bson:"updated" yaml:"updated"`
+	Groups  []string          `json:"groups" bson:"groups" yaml:"groups"`
+	Extends string            `json:"extends,omitempty" bson:"extends,omitempty" yaml:"extends,omitempty"`
+	With    map[string]string `json:"with,omitempty" bson:"with,omitempty" yaml:"with,omitempty"`
+	// Where to send notifications about the workflow's runs
+	Notifications []notify.Rule `json:"notifications,omitempty" bson:"notifications,omitempty" yaml:"notifications,omitempty"`
+	// Namespace the workflow and its inputs, datastore, files and secrets
+	// belong to. Outside the default namespace the workflow is stored as
+	// `<namespace>.<name>`
+	Namespace string `json:"namespace" bson:"namespace" yaml:"namespace"`
+	// How many runs of the workflow can go at once, unlimited when 0
+	MaxConcurrentRuns int `json:"max_concurrent_runs,omitempty" bson:"max_concurrent_runs,omitempty" yaml:"max_concurrent_runs,omitempty"`
+	// Concurrency pool each run of the workflow takes a slot in
+	Pool string `json:"pool,omitempty" bson:"pool,omitempty" yaml:"pool,omitempty"`
 }
 
 type cacheObj struct {
@@ -76,7 +93,94 @@ func GetCacheSingle(name string) Workflow {
 	return Workflow{}
 }
 
+// Render the user-authored part of a workflow as YAML. Timestamps, run numbers,
+// and names filled in by Scaffold are left out so revisions only differ when
+// the definition does
+func Definition(w *Workflow) (string, error) {
+	d := *w
+	d.Created = ""
+	d.Updated = ""
+	d.Namespace = NamespaceOf(w)
+	d.Name = ShortName(w)
+	d.Tasks = make([]task.Task, len(w.Tasks))
+	for idx, t := range w.Tasks {
+		t.Workflow = ""
+		t.Updated = ""
+		t.RunNumber = 0
+		d.Tasks[idx] = t
+	}
+	d.Inputs = make([]input.Input, len(w.Inputs))
+	for idx, i := range w.Inputs {
+		i.Workflow = ""
+		d.Inputs[idx] = i
+	}
+	out, err := yaml.Marshal(d)
+	return string(out), err
+}
+
+// Store the applied definition of a workflow as a new revision
+func RecordRevision(w *Workflow, author, message string) (*revision.Revision, error) {
+	def, err := Definition(w)
+	if err != nil {
+		return nil, err
+	}
+	return revision.Record(w.Name, def, author, message)
+}
+
+// Parse a workflow back out of a stored revision
+func FromRevision(r *revision.Revision) (*Workflow, error) {
+	var w Workflow
+	if err := yaml.Unmarshal([]byte(r.Definition), &w); err != nil {
+		return nil, fmt.Errorf("cannot parse revision %d of %s: %s", r.Version, r.Workflow, err.Error())
+	}
+	w.Name = r.Workflow
+	return &w, nil
+}
+
+// Expand template references and check the workflow's input definitions and
+// task triggers before anything is written
+func validate(w *Workflow) error {
+	if err := Qualify(w); err != nil {
+		return err
+	}
+	if err := Expand(w); err != nil {
+		return err
+	}
+	if w.MaxConcurrentRuns < 0 {
+		return fmt.Errorf("workflow %s cannot have a negative max_concurrent_runs", w.Name)
+	}
+	if _, ok := config.Config.ConcurrencyPools[w.Pool]; w.Pool != "" && !ok {
+		return fmt.Errorf("workflow %s uses concurrency pool %s which is not configured", w.Name, w.Pool)
+	}
+	for idx := range w.Inputs {
+		if err := input.ValidateDefinition(&w.Inputs[idx]); err != nil {
+			return err
+		}
+	}
+	for idx := range w.Tasks {
+		if err := task.ValidateTrigger(&w.Tasks[idx]); err != nil {
+			return err
+		}
+		if err := task.ValidateDependencies(&w.Tasks[idx]); err != nil {
+			return err
+		}
+		if err := task.ValidateConcurrency(&w.Tasks[idx]); err != nil {
+			return err
+		}
+	}
+	for idx := range w.Notifications {
+		if err := notify.Validate(&w.Notifications[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func CreateWorkflow(w *Workflow) error {
+	if err := validate(w); err != nil {
+		return err
+	}
+
 	currentTime := time.Now().UTC()
 	w.Created = currentTime.Format("2006-01-02T15:04:05Z")
 	w.Updated = currentTime.Format("2006-01-02T15:04:05Z")
@@ -170,6 +274,62 @@ func GetAllWorkflows() ([]*Workflow, error) {
 	return workflows, err
 }
 
+// Get the workflows in a namespace. Workflows stored before namespaces existed
+// have none and belong to the default namespace
+func GetWorkflowsByNamespace(namespace string) ([]*Workflow, error) {
+	filter := bson.M{"namespace": namespace}
+	if namespace == constants.NAMESPACE_DEFAULT {
+		filter = bson.M{"namespace": bson.M{"$in": []string{namespace, ""}}}
+	}
+
+	workflows, err := FilterWorkflows(filter)
+
+	return workflows, err
+}
+
+// Default a workflow's namespace and set its name to the one it is stored
+// under. Names that already carry the workflow's namespace are left as they are
+func Qualify(w *Workflow) error {
+	if w.Namespace == "" {
+		w.Namespace = constants.NAMESPACE_DEFAULT
+	}
+	name := strings.TrimPrefix(w.Name, w.Namespace+constants.WORKFLOW_NAMESPACE_SEPARATOR)
+	if name == "" || strings.Contains(name, constants.WORKFLOW_NAMESPACE_SEPARATOR) {
+		return fmt.Errorf("invalid workflow name %s in namespace %s, names cannot contain %s", w.Name, w.Namespace, constants.WORKFLOW_NAMESPACE_SEPARATOR)
+	}
+	w.Name = task.QualifiedWorkflow(w.Namespace, name)
+	return nil
+}
+
+// Get the name a workflow was given in its namespace
+func ShortName(w *Workflow) string {
+	return strings.TrimPrefix(w.Name, NamespaceOf(w)+constants.WORKFLOW_NAMESPACE_SEPARATOR)
+}
+
+// Get the namespace a workflow belongs to
+func NamespaceOf(w *Workflow) string {
+	if w == nil || w.Namespace == "" {
+		return constants.NAMESPACE_DEFAULT
+	}
+	return w.Namespace
+}
+
+// Log workflows kept from before namespaces whose names have a . in them.
+// They still run, but cannot be updated or referred to by other workflows
+// until they are applied again under a name without one
+func CheckNames() error {
+	workflows, err := GetAllWorkflows()
+	if err != nil {
+		return err
+	}
+	for _, w := range workflows {
+		if w.Namespace == "" && strings.Contains(w.Name, constants.WORKFLOW_NAMESPACE_SEPARATOR) {
+			logger.Errorf("", "Workflow %s has a %s in its name and has to be applied again under a new name", w.Name, constants.WORKFLOW_NAMESPACE_SEPARATOR)
+		}
+	}
+	return nil
+}
+
 func GetWorkflowByName(name string) (*Workflow, error) {
 	filter := bson.M{"name": name}
 
@@ -288,6 +448,14 @@ func UpdateWorkflowByName(name string, w *Workflow) error {
 
 	// return nil
 
+	if err := validate(w); err != nil {
+		return err
+	}
+	// Moving a workflow to another namespace changes the name it is stored under
+	if w.Name != name {
+		return fmt.Errorf("workflow %s is stored as %s, it cannot be updated through %s", ShortName(w), w.Name, name)
+	}
+
 	if err := DeleteWorkflowByName(name); err != nil {
 		logger.Warnf("", "Got error doing workflow update delete: %s", err.Error())
 	}
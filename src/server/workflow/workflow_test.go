@@ -0,0 +1,61 @@
+package workflow
+
+import (
+	"scaffold/server/revision"
+	"strings"
+	"testing"
+)
+
+func TestQualify(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		namespace string
+		want      string
+	}{
+		{"deploy", "", "deploy"},
+		{"deploy", "default", "deploy"},
+		{"deploy", "payments", "payments.deploy"},
+		{"payments.deploy", "payments", "payments.deploy"},
+	} {
+		w := &Workflow{Name: tc.name, Namespace: tc.namespace}
+		if err := Qualify(w); err != nil {
+			t.Errorf("Qualify(%s, %s): %s", tc.name, tc.namespace, err.Error())
+			continue
+		}
+		if w.Name != tc.want {
+			t.Errorf("Qualify(%s, %s) = %s, want %s", tc.name, tc.namespace, w.Name, tc.want)
+		}
+		if got := ShortName(w); got != "deploy" {
+			t.Errorf("ShortName(%s) = %s, want deploy", w.Name, got)
+		}
+	}
+
+	for _, name := range []string{"", "ops.deploy", "payments.a.b"} {
+		if err := Qualify(&Workflow{Name: name, Namespace: "payments"}); err == nil {
+			t.Errorf("name %q was accepted", name)
+		}
+	}
+}
+
+func TestShortNameOfDottedDefaultName(t *testing.T) {
+	if got := ShortName(&Workflow{Name: "app.v2"}); got != "app.v2" {
+		t.Errorf("ShortName(app.v2) = %s, want app.v2", got)
+	}
+}
+
+func TestDefinitionUsesShortName(t *testing.T) {
+	def, err := Definition(&Workflow{Name: "payments.deploy", Namespace: "payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(def, "name: deploy\n") {
+		t.Errorf("definition does not use the short name:\n%s", def)
+	}
+	w, err := FromRevision(&revision.Revision{Workflow: "payments.deploy", Definition: def})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Qualify(w); err != nil || w.Name != "payments.deploy" {
+		t.Errorf("revision of payments.deploy was restored as %s: %v", w.Name, err)
+	}
+}
@@ -19,6 +19,19 @@ def test_create():
 
     helpers.workflow_teardown(test_id)
 
+def test_create_basic_auth():
+    test_id = helpers.user_setup()
+
+    w = scaffold.workflow.Workflow()
+    w.loadf(WORKFLOW_FIXTURE_PATH)
+    w.name = test_id
+
+    # Users made from the fixture have the password foo
+    response = requests.post(f"{SCAFFOLD_BASE}/api/v1/workflow", auth=(test_id, "foo"), json=w.json(), verify=False)
+    assert response.status_code == 201
+
+    helpers.workflow_teardown(test_id)
+
 def test_get_individual():
     test_id = helpers.workflow_setup()
     